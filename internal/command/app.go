@@ -22,6 +22,13 @@ func NewApp() *cli.App {
 			commandInit(),
 			commandShim(),
 			commandAttach(),
+			commandUpdate(),
+			commandPause(),
+			commandResume(),
+			commandStats(),
+			commandNetwork(),
+			commandIpam(),
+			commandPort(),
 		},
 	}
 
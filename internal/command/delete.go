@@ -11,7 +11,13 @@ func commandDelete() *cli.Command {
 		Name:      "delete",
 		Usage:     "delete a container",
 		ArgsUsage: "<container-id>",
-		Action:    runDelete,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "kill every process of a running or paused container before deleting it",
+			},
+		},
+		Action: runDelete,
 	}
 }
 
@@ -23,6 +29,7 @@ func runDelete(ctx *cli.Context) error {
 	containerDelete := container.NewContainerDelete()
 	err := containerDelete.Delete(container.DeleteOption{
 		ContainerId: containerId,
+		Force:       ctx.Bool("force"),
 	})
 	if err != nil {
 		return err
@@ -0,0 +1,162 @@
+package command
+
+import (
+	"droplet/internal/ipam"
+	"encoding/json"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandIpam() *cli.Command {
+	return &cli.Command{
+		Name:  "ipam",
+		Usage: "manage address pools and leases of container interfaces",
+		Subcommands: []*cli.Command{
+			commandIpamList(),
+			commandIpamPool(),
+		},
+	}
+}
+
+func commandIpamList() *cli.Command {
+	return &cli.Command{
+		Name:  "list",
+		Usage: "list the addresses leased to containers",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "print format [default|json]",
+			},
+		},
+		Action: runIpamList,
+	}
+}
+
+func commandIpamPool() *cli.Command {
+	return &cli.Command{
+		Name:  "pool",
+		Usage: "manage the subnet pools of bridges",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "add",
+				Usage: "define the subnet pool of a bridge",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "bridge",
+						Usage:    "bridge interface name",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "subnet",
+						Usage:    "ipv4 subnet (e.g. 10.166.0.0/24)",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "gateway",
+						Usage: "gateway address (default: last address of the subnet)",
+					},
+				},
+				Action: runIpamPoolAdd,
+			},
+			{
+				Name:  "remove",
+				Usage: "remove the subnet pool of a bridge",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "bridge",
+						Usage:    "bridge interface name",
+						Required: true,
+					},
+				},
+				Action: runIpamPoolRemove,
+			},
+			{
+				Name:  "list",
+				Usage: "list the subnet pools",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "print format [default|json]",
+					},
+				},
+				Action: runIpamPoolList,
+			},
+		},
+	}
+}
+
+func runIpamList(ctx *cli.Context) error {
+	leases, err := ipam.NewIpamHandler().ListLeases()
+	if err != nil {
+		return err
+	}
+
+	if ctx.String("format") == "json" {
+		if leases == nil {
+			leases = []ipam.Lease{}
+		}
+		dataStr, err := json.Marshal(leases)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(dataStr))
+		return nil
+	}
+
+	fmt.Printf("%-15s %-15s %-15s %-20s %-s\n", "ID", "INTERFACE", "BRIDGE", "ADDRESS", "TYPE")
+	for _, lease := range leases {
+		leaseType := "auto"
+		if lease.Static {
+			leaseType = "static"
+		}
+		fmt.Printf("%-15s %-15s %-15s %-20s %-s\n", lease.ContainerId, lease.Interface, lease.Bridge, lease.Address, leaseType)
+	}
+	return nil
+}
+
+func runIpamPoolAdd(ctx *cli.Context) error {
+	pool, err := ipam.NewIpamHandler().AddPool(ipam.Pool{
+		Bridge:  ctx.String("bridge"),
+		Subnet:  ctx.String("subnet"),
+		Gateway: ctx.String("gateway"),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("added pool %s (gateway %s) to %s\n", pool.Subnet, pool.Gateway, pool.Bridge)
+	return nil
+}
+
+func runIpamPoolRemove(ctx *cli.Context) error {
+	if err := ipam.NewIpamHandler().RemovePool(ctx.String("bridge")); err != nil {
+		return err
+	}
+	fmt.Printf("removed pool of %s\n", ctx.String("bridge"))
+	return nil
+}
+
+func runIpamPoolList(ctx *cli.Context) error {
+	pools, err := ipam.NewIpamHandler().ListPools()
+	if err != nil {
+		return err
+	}
+
+	if ctx.String("format") == "json" {
+		if pools == nil {
+			pools = []ipam.Pool{}
+		}
+		dataStr, err := json.Marshal(pools)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(dataStr))
+		return nil
+	}
+
+	fmt.Printf("%-15s %-20s %-s\n", "BRIDGE", "SUBNET", "GATEWAY")
+	for _, pool := range pools {
+		fmt.Printf("%-15s %-20s %-s\n", pool.Bridge, pool.Subnet, pool.Gateway)
+	}
+	return nil
+}
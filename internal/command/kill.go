@@ -11,7 +11,13 @@ func commandKill() *cli.Command {
 		Name:      "kill",
 		Usage:     "kill a container",
 		ArgsUsage: "<container-id> [signal]",
-		Action:    runKill,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "send the signal to every process in the container cgroup",
+			},
+		},
+		Action: runKill,
 	}
 }
 
@@ -30,6 +36,7 @@ func runKill(ctx *cli.Context) error {
 	err := containerKill.Kill(container.KillOption{
 		ContainerId: containerId,
 		Signal:      signal,
+		All:         ctx.Bool("all"),
 	})
 	if err != nil {
 		return err
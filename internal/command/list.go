@@ -4,6 +4,7 @@ import (
 	"droplet/internal/status"
 	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/urfave/cli/v2"
 )
@@ -36,6 +37,15 @@ func runList(ctx *cli.Context) error {
 
 	printList(containerStatusList, formatOption)
 
+	// report cgroups left behind by removed containers
+	leftoverCgroups, err := containerStatusHandler.ListLeftoverCgroups()
+	if err != nil {
+		return err
+	}
+	for _, path := range leftoverCgroups {
+		fmt.Fprintf(os.Stderr, "warning: leftover cgroup without container: %s\n", path)
+	}
+
 	return nil
 }
 
@@ -50,7 +60,11 @@ func printList(list []status.StatusObject, format string) {
 	} else {
 		fmt.Printf("%-15s %-15s %-8s %-s\n", "ID", "STATUS", "PID", "BUNDLE")
 		for _, entry := range list {
-			fmt.Printf("%-15s %-15s %-8d %-s\n", entry.Id, entry.Status, entry.Pid, entry.Bundle)
+			containerStatus := entry.Status
+			if entry.OOMKilled {
+				containerStatus += " (oom)"
+			}
+			fmt.Printf("%-15s %-15s %-8d %-s\n", entry.Id, containerStatus, entry.Pid, entry.Bundle)
 		}
 	}
 }
@@ -0,0 +1,81 @@
+package command
+
+import (
+	"droplet/internal/container"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandNetwork() *cli.Command {
+	return &cli.Command{
+		Name:  "network",
+		Usage: "manage container networking on the host",
+		Subcommands: []*cli.Command{
+			commandNetworkPrune(),
+			commandNetworkCheck(),
+		},
+	}
+}
+
+func commandNetworkPrune() *cli.Command {
+	return &cli.Command{
+		Name:  "prune",
+		Usage: "remove veth interfaces on the bridge that no longer belong to a live container, and address leases of removed containers",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "bridge",
+				Usage: "bridge interface name, repeatable",
+				Value: cli.NewStringSlice("raind_br0"),
+			},
+		},
+		Action: runNetworkPrune,
+	}
+}
+
+func runNetworkPrune(ctx *cli.Context) error {
+	networkPrune := container.NewNetworkPrune()
+	removed, err := networkPrune.Prune(container.NetworkPruneOption{
+		Bridges: ctx.StringSlice("bridge"),
+	})
+	// report what was removed even if a later interface failed
+	for _, name := range removed {
+		fmt.Printf("removed %s\n", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	released, err := networkPrune.PruneLeases()
+	for _, containerId := range released {
+		fmt.Printf("released addresses of %s\n", containerId)
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func commandNetworkCheck() *cli.Command {
+	return &cli.Command{
+		Name:      "check",
+		Usage:     "verify the network of a container with the CHECK of its cni plugins",
+		ArgsUsage: "<container-id>",
+		Action:    runNetworkCheck,
+	}
+}
+
+func runNetworkCheck(ctx *cli.Context) error {
+	// retrieve container id
+	containerId := ctx.Args().Get(0)
+
+	networkCheck := container.NewNetworkCheck()
+	err := networkCheck.Check(container.NetworkCheckOption{
+		ContainerId: containerId,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("network of %s is ok\n", containerId)
+	return nil
+}
@@ -0,0 +1,30 @@
+package command
+
+import (
+	"droplet/internal/container"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandPause() *cli.Command {
+	return &cli.Command{
+		Name:      "pause",
+		Usage:     "suspend all processes in a container",
+		ArgsUsage: "<container-id>",
+		Action:    runPause,
+	}
+}
+
+func runPause(ctx *cli.Context) error {
+	// retrieve container id
+	containerId := ctx.Args().Get(0)
+
+	containerPause := container.NewContainerPause()
+	err := containerPause.Pause(container.PauseOption{
+		ContainerId: containerId,
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package command
+
+import (
+	"droplet/internal/container"
+	"encoding/json"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandPort() *cli.Command {
+	return &cli.Command{
+		Name:      "port",
+		Usage:     "list the ports a container publishes on the host",
+		ArgsUsage: "<container-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "print format [default|json]",
+			},
+		},
+		Action: runPort,
+	}
+}
+
+func runPort(ctx *cli.Context) error {
+	// retrieve container id
+	containerId := ctx.Args().Get(0)
+
+	containerPort := container.NewContainerPort()
+	mappings, err := containerPort.List(container.PortListOption{
+		ContainerId: containerId,
+	})
+	if err != nil {
+		return err
+	}
+
+	if ctx.String("format") == "json" {
+		if mappings == nil {
+			mappings = []container.PortMapping{}
+		}
+		dataStr, err := json.Marshal(mappings)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(dataStr))
+		return nil
+	}
+
+	for _, mapping := range mappings {
+		fmt.Println(mapping.String())
+	}
+	return nil
+}
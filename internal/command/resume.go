@@ -0,0 +1,30 @@
+package command
+
+import (
+	"droplet/internal/container"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandResume() *cli.Command {
+	return &cli.Command{
+		Name:      "resume",
+		Usage:     "resume all processes in a container",
+		ArgsUsage: "<container-id>",
+		Action:    runResume,
+	}
+}
+
+func runResume(ctx *cli.Context) error {
+	// retrieve container id
+	containerId := ctx.Args().Get(0)
+
+	containerResume := container.NewContainerResume()
+	err := containerResume.Resume(container.ResumeOption{
+		ContainerId: containerId,
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
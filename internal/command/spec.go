@@ -2,10 +2,15 @@ package command
 
 import (
 	"fmt"
+	"math"
+	"net"
 	"os"
+	"strconv"
 	"strings"
 
+	"droplet/internal/container"
 	"droplet/internal/spec"
+	"droplet/internal/utils"
 
 	"github.com/google/shlex"
 	"github.com/urfave/cli/v2"
@@ -39,9 +44,50 @@ func commandSpec() *cli.Command {
 				Usage: "container entrypoint",
 				Value: "sh",
 			},
+			&cli.StringFlag{
+				Name:  "user",
+				Usage: "process user (name or uid)",
+			},
+			&cli.StringFlag{
+				Name:  "group",
+				Usage: "process group (name or gid)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "additional_gid",
+				Usage: "additional group id",
+			},
+			&cli.StringFlag{
+				Name:  "umask",
+				Usage: "process umask (octal, e.g. 0022)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "rlimit",
+				Usage: "process resource limit (TYPE=soft[:hard], e.g. RLIMIT_NOFILE=1024:4096)",
+			},
+			&cli.StringFlag{
+				Name:  "oom_score_adj",
+				Usage: "process oom_score_adj (-1000 to 1000)",
+			},
+			&cli.BoolFlag{
+				Name:  "no_new_privileges",
+				Usage: "set no_new_privileges for the process",
+				Value: true,
+			},
 			&cli.StringSliceFlag{
 				Name:  "ns",
-				Usage: "namespace target [mount|network|uts|pid|ipc|user|cgroup]",
+				Usage: "namespace target [mount|network|uts|pid|ipc|user|cgroup|time] (type[:path] joins an existing namespace, e.g. network:/proc/123/ns/net)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "uid_map",
+				Usage: "user namespace uid mapping (containerID:hostID:size)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "gid_map",
+				Usage: "user namespace gid mapping (containerID:hostID:size)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "time_offset",
+				Usage: "time namespace clock offset (clock:secs[:nanosecs], clock is monotonic or boottime)",
 			},
 			&cli.StringFlag{
 				Name:  "hostname",
@@ -49,6 +95,10 @@ func commandSpec() *cli.Command {
 			},
 
 			// network
+			&cli.StringFlag{
+				Name:  "network",
+				Usage: "network mode [none|host|bridge|container:<id>] (default: host without a network namespace, bridge otherwise)",
+			},
 			&cli.StringFlag{
 				Name:  "host_if_name",
 				Usage: "host interface name",
@@ -66,7 +116,7 @@ func commandSpec() *cli.Command {
 			},
 			&cli.StringFlag{
 				Name:  "if_addr",
-				Usage: "container interface address",
+				Usage: "container interface address, or auto to allocate one from the ipam pool of the bridge",
 				Value: "172.16.0.1/24",
 			},
 			&cli.StringFlag{
@@ -74,10 +124,91 @@ func commandSpec() *cli.Command {
 				Usage: "container interface gateway",
 				Value: "172.16.0.254",
 			},
+			&cli.StringFlag{
+				Name:  "if_addr6",
+				Usage: "container interface IPv6 address (e.g. fd00::2/64)",
+			},
+			&cli.StringFlag{
+				Name:  "if_gateway6",
+				Usage: "container interface IPv6 gateway",
+			},
+			&cli.BoolFlag{
+				Name:  "if_addr6_nodad",
+				Usage: "disable duplicate address detection for the IPv6 address",
+			},
+			&cli.StringSliceFlag{
+				Name:  "route",
+				Usage: "static route through the container interface (destination[,gateway])",
+			},
+			&cli.StringFlag{
+				Name:  "if_mac",
+				Usage: "container interface MAC address, or auto to derive a stable one from the interface name",
+			},
+			&cli.StringFlag{
+				Name:  "if_host_mac",
+				Usage: "MAC address of the host side veth, or auto",
+			},
+			&cli.StringFlag{
+				Name:  "if_mtu",
+				Usage: "MTU of both sides of the veth",
+			},
+			&cli.StringFlag{
+				Name:  "ingress_rate",
+				Usage: "rate limit of the traffic to the container (e.g. 10mbit, 1gbit, 500kbps)",
+			},
+			&cli.StringFlag{
+				Name:  "ingress_burst",
+				Usage: "bucket size of the ingress rate limit (e.g. 64k, default: 10ms of traffic, at least 64k)",
+			},
+			&cli.StringFlag{
+				Name:  "egress_rate",
+				Usage: "rate limit of the traffic from the container",
+			},
+			&cli.StringFlag{
+				Name:  "egress_burst",
+				Usage: "bucket size of the egress rate limit",
+			},
+			&cli.StringSliceFlag{
+				Name:  "net",
+				Usage: "container interface definition, repeatable. replaces the single interface flags above (key=value,...: bridge_if_name, if_name, host_if_name, container_if_name, mac, host_mac, mtu, ingress_rate, ingress_burst, egress_rate, egress_burst, if_addr, if_gateway, if_addr6, if_gateway6, if_addr6_nodad, route=destination[@gateway])",
+			},
+			&cli.StringFlag{
+				Name:  "cni_network",
+				Usage: "set up the network with the cni plugins of the named conflist instead of the interface flags above",
+			},
+			&cli.StringFlag{
+				Name:  "cni_if_name",
+				Usage: "interface created by the cni plugins in the container",
+				Value: "eth0",
+			},
 			&cli.StringSliceFlag{
 				Name:  "dns",
 				Usage: "dns server",
 			},
+			&cli.StringSliceFlag{
+				Name:  "dns_search",
+				Usage: "dns search domain",
+			},
+			&cli.StringSliceFlag{
+				Name:  "dns_option",
+				Usage: "dns resolver option (e.g. ndots:2)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "add_host",
+				Usage: "extra /etc/hosts entry, repeatable (host:ip)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "publish",
+				Usage: "publish a container port on the host, repeatable ([host_ip:]host_port[-end]:container_port[-end][/tcp|udp])",
+			},
+			&cli.StringFlag{
+				Name:  "policy",
+				Usage: "path to a firewall policy JSON document of the container interfaces",
+			},
+			&cli.StringSliceFlag{
+				Name:  "skip_file",
+				Usage: "do not generate and mount the /etc file, repeatable (resolv.conf, hosts or hostname)",
+			},
 
 			// layer
 			&cli.StringSliceFlag{
@@ -198,25 +329,132 @@ func createConfigOptions(ctx *cli.Context) (spec.ConfigOptions, error) {
 		return spec.ConfigOptions{}, err
 	}
 
+	// user
+	user, err := parseUserFlag(ctx.String("user"), ctx.String("group"), ctx.StringSlice("additional_gid"), ctx.String("umask"))
+	if err != nil {
+		return spec.ConfigOptions{}, err
+	}
+
+	// rlimits
+	rlimits, err := parseRlimitFlag(ctx.StringSlice("rlimit"))
+	if err != nil {
+		return spec.ConfigOptions{}, err
+	}
+	// oom_score_adj
+	oomScoreAdj, err := parseOOMScoreAdjFlag(ctx.String("oom_score_adj"))
+	if err != nil {
+		return spec.ConfigOptions{}, err
+	}
+	// no_new_privileges
+	noNewPrivileges := ctx.Bool("no_new_privileges")
+
 	// namespace
-	namespace := ctx.StringSlice("ns")
+	namespace, err := parseNamespaceFlag(ctx.StringSlice("ns"))
+	if err != nil {
+		return spec.ConfigOptions{}, err
+	}
+
+	// user namespace id mappings
+	uidMaps, err := parseIDMapFlag(ctx.StringSlice("uid_map"))
+	if err != nil {
+		return spec.ConfigOptions{}, err
+	}
+	gidMaps, err := parseIDMapFlag(ctx.StringSlice("gid_map"))
+	if err != nil {
+		return spec.ConfigOptions{}, err
+	}
+
+	// time namespace offsets
+	timeOffsets, err := parseTimeOffsetFlag(ctx.StringSlice("time_offset"))
+	if err != nil {
+		return spec.ConfigOptions{}, err
+	}
 
 	// hostname
 	hostname := ctx.String("hostname")
 
 	// net
-	// host interface name
-	hostIfName := ctx.String("host_if_name")
-	// bridge interface name
-	brIfName := ctx.String("bridge_if_name")
-	// interface name
-	ifName := ctx.String("if_name")
-	// interface address
-	ifAddr := ctx.String("if_addr")
-	// gateway
-	ifGateway := ctx.String("if_gateway")
+	// network mode
+	networkMode, err := parseNetworkModeFlag(ctx.String("network"), namespace)
+	if err != nil {
+		return spec.ConfigOptions{}, err
+	}
+	//   --net definitions replace the single interface flags
+	netInterfaces, err := parseNetFlag(ctx.StringSlice("net"))
+	if err != nil {
+		return spec.ConfigOptions{}, err
+	}
+	if len(netInterfaces) > 0 && networkMode != "bridge" {
+		return spec.ConfigOptions{}, fmt.Errorf("--net requires network mode bridge")
+	}
+	// cni network
+	cniNetwork := ctx.String("cni_network")
+	if cniNetwork != "" && (networkMode != "bridge" || len(netInterfaces) > 0) {
+		return spec.ConfigOptions{}, fmt.Errorf("--cni_network requires network mode bridge and cannot be used with --net")
+	}
+	if len(netInterfaces) == 0 && networkMode == "bridge" && cniNetwork == "" {
+		// ipv6 address
+		ifAddr6 := ctx.String("if_addr6")
+		// ipv6 gateway
+		ifGateway6 := ctx.String("if_gateway6")
+		if ifAddr6 == "" && (ifGateway6 != "" || ctx.Bool("if_addr6_nodad")) {
+			return spec.ConfigOptions{}, fmt.Errorf("--if_gateway6 and --if_addr6_nodad require --if_addr6")
+		}
+		// static routes
+		routes, err := parseRouteFlag(ctx.StringSlice("route"))
+		if err != nil {
+			return spec.ConfigOptions{}, err
+		}
+		netInterface := spec.NetInterfaceOption{
+			HostInterface:          ctx.String("host_if_name"),
+			BridgeInterfaceName:    ctx.String("bridge_if_name"),
+			InterfaceName:          ctx.String("if_name"),
+			ContainerInterfaceName: "eth0",
+			Address:                ctx.String("if_addr"),
+			Gateway:                ctx.String("if_gateway"),
+			Address6:               ifAddr6,
+			Gateway6:               ifGateway6,
+			DisableDAD6:            ctx.Bool("if_addr6_nodad"),
+			Routes:                 routes,
+		}
+		// link attributes and rate limits
+		for _, f := range [][2]string{
+			{"if_mac", "mac"},
+			{"if_host_mac", "host_mac"},
+			{"if_mtu", "mtu"},
+			{"ingress_rate", "ingress_rate"},
+			{"ingress_burst", "ingress_burst"},
+			{"egress_rate", "egress_rate"},
+			{"egress_burst", "egress_burst"},
+		} {
+			if value := ctx.String(f[0]); value != "" {
+				if err := parseLinkKey(&netInterface, f[1], value); err != nil {
+					return spec.ConfigOptions{}, fmt.Errorf("--%s: %w", f[0], err)
+				}
+			}
+		}
+		netInterfaces = []spec.NetInterfaceOption{netInterface}
+	}
 	// dns
 	dns := ctx.StringSlice("dns")
+	// extra hosts
+	extraHosts, err := parseAddHostFlag(ctx.StringSlice("add_host"))
+	if err != nil {
+		return spec.ConfigOptions{}, err
+	}
+	// published ports
+	ports, err := parsePublishFlag(ctx.StringSlice("publish"))
+	if err != nil {
+		return spec.ConfigOptions{}, err
+	}
+	// policy
+	var policy *spec.PolicyObject
+	if path := ctx.String("policy"); path != "" {
+		policy = &spec.PolicyObject{}
+		if err := utils.ReadJsonFile(path, policy); err != nil {
+			return spec.ConfigOptions{}, fmt.Errorf("read policy file %s failed: %w", path, err)
+		}
+	}
 
 	// image
 	// image layer
@@ -264,16 +502,29 @@ func createConfigOptions(ctx *cli.Context) (spec.ConfigOptions, error) {
 			Cwd:  cwd,
 			Env:  env,
 			Args: args,
+			User: user,
+
+			Rlimits:         rlimits,
+			OOMScoreAdj:     oomScoreAdj,
+			NoNewPrivileges: noNewPrivileges,
 		},
-		Namespace: namespace,
-		Hostname:  hostname,
+		Namespace:   namespace,
+		UIDMaps:     uidMaps,
+		GIDMaps:     gidMaps,
+		TimeOffsets: timeOffsets,
+		Hostname:    hostname,
 		Net: spec.NetOption{
-			HostInterface:       hostIfName,
-			BridgeInterfaceName: brIfName,
-			InterfaceName:       ifName,
-			Address:             ifAddr,
-			Gateway:             ifGateway,
-			Dns:                 dns,
+			Mode:       networkMode,
+			Interfaces: netInterfaces,
+			Dns:        dns,
+			DnsSearch:  ctx.StringSlice("dns_search"),
+			DnsOptions: ctx.StringSlice("dns_option"),
+			ExtraHosts: extraHosts,
+			SkipFiles:  ctx.StringSlice("skip_file"),
+			CniNetwork: cniNetwork,
+			CniIfName:  ctx.String("cni_if_name"),
+			Ports:      ports,
+			Policy:     policy,
 		},
 		Image: spec.ImageOption{
 			ImageLayer: imageLayer,
@@ -346,6 +597,378 @@ func parseCommandFlag(s string) ([]string, error) {
 	return args, nil
 }
 
+func parseUserFlag(user string, group string, additionalGids []string, umask string) (spec.UserOption, error) {
+	var userOption spec.UserOption
+
+	// user: numeric value is uid, otherwise username resolved in the container
+	if user != "" {
+		if uid, err := strconv.ParseUint(user, 10, 32); err == nil {
+			userOption.Uid = uint32(uid)
+		} else {
+			userOption.Username = user
+		}
+	}
+	// group: numeric value is gid, otherwise group name resolved in the container
+	if group != "" {
+		if gid, err := strconv.ParseUint(group, 10, 32); err == nil {
+			userOption.Gid = uint32(gid)
+		} else {
+			userOption.Groupname = group
+		}
+	}
+	// additional gids
+	for _, v := range additionalGids {
+		gid, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return spec.UserOption{}, fmt.Errorf("invalid additional gid: %q", v)
+		}
+		userOption.AdditionalGids = append(userOption.AdditionalGids, uint32(gid))
+	}
+	// umask
+	if umask != "" {
+		mask, err := strconv.ParseUint(umask, 8, 32)
+		if err != nil || mask > 0o777 {
+			return spec.UserOption{}, fmt.Errorf("invalid umask: %q", umask)
+		}
+		m := uint32(mask)
+		userOption.Umask = &m
+	}
+
+	return userOption, nil
+}
+
+func parseRlimitFlag(rlimits []string) ([]spec.RlimitOption, error) {
+	var rlimitOption []spec.RlimitOption
+	for _, rlimit := range rlimits {
+		parts := strings.SplitN(rlimit, "=", 2)
+		if len(parts) != 2 {
+			return []spec.RlimitOption{}, fmt.Errorf("invalid rlimit format: %q", rlimit)
+		}
+		// type: RLIMIT_ prefix is optional
+		rlimitType := strings.ToUpper(parts[0])
+		if !strings.HasPrefix(rlimitType, "RLIMIT_") {
+			rlimitType = "RLIMIT_" + rlimitType
+		}
+		if err := container.ValidateRlimitType(rlimitType); err != nil {
+			return []spec.RlimitOption{}, err
+		}
+		// soft[:hard], hard defaults to soft
+		values := strings.SplitN(parts[1], ":", 2)
+		soft, err := strconv.ParseUint(values[0], 10, 64)
+		if err != nil {
+			return []spec.RlimitOption{}, fmt.Errorf("invalid rlimit format: %q", rlimit)
+		}
+		hard := soft
+		if len(values) == 2 {
+			hard, err = strconv.ParseUint(values[1], 10, 64)
+			if err != nil {
+				return []spec.RlimitOption{}, fmt.Errorf("invalid rlimit format: %q", rlimit)
+			}
+		}
+		if soft > hard {
+			return []spec.RlimitOption{}, fmt.Errorf("invalid rlimit: soft limit exceeds hard limit: %q", rlimit)
+		}
+		rlimitOption = append(rlimitOption, spec.RlimitOption{
+			Type: rlimitType,
+			Soft: soft,
+			Hard: hard,
+		})
+	}
+	return rlimitOption, nil
+}
+
+func parseOOMScoreAdjFlag(score string) (*int, error) {
+	if score == "" {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(score)
+	if err != nil || v < -1000 || v > 1000 {
+		return nil, fmt.Errorf("invalid oom_score_adj: %q", score)
+	}
+	return &v, nil
+}
+
+func parseNamespaceFlag(namespaces []string) ([]spec.NamespaceOption, error) {
+	var namespaceOption []spec.NamespaceOption
+	for _, ns := range namespaces {
+		// type[:path]
+		parts := strings.SplitN(ns, ":", 2)
+		if parts[0] == "" {
+			return []spec.NamespaceOption{}, fmt.Errorf("invalid namespace format: %q", ns)
+		}
+		opt := spec.NamespaceOption{Type: parts[0]}
+		if len(parts) == 2 {
+			if parts[1] == "" {
+				return []spec.NamespaceOption{}, fmt.Errorf("invalid namespace format: %q (path is empty)", ns)
+			}
+			opt.Path = parts[1]
+		}
+		namespaceOption = append(namespaceOption, opt)
+	}
+	return namespaceOption, nil
+}
+
+func parseIDMapFlag(mappings []string) ([]spec.IDMappingOption, error) {
+	var idMappingOption []spec.IDMappingOption
+	for _, mapping := range mappings {
+		parts := strings.Split(mapping, ":")
+		if len(parts) != 3 {
+			return []spec.IDMappingOption{}, fmt.Errorf("invalid id mapping format: %q", mapping)
+		}
+		var values [3]uint32
+		for i, p := range parts {
+			v, err := strconv.ParseUint(p, 10, 32)
+			if err != nil {
+				return []spec.IDMappingOption{}, fmt.Errorf("invalid id mapping format: %q", mapping)
+			}
+			values[i] = uint32(v)
+		}
+		idMappingOption = append(idMappingOption, spec.IDMappingOption{
+			ContainerID: values[0],
+			HostID:      values[1],
+			Size:        values[2],
+		})
+	}
+	return idMappingOption, nil
+}
+
+func parseTimeOffsetFlag(offsets []string) ([]spec.TimeOffsetOption, error) {
+	var timeOffsetOption []spec.TimeOffsetOption
+	for _, offset := range offsets {
+		parts := strings.Split(offset, ":")
+		if len(parts) != 2 && len(parts) != 3 {
+			return []spec.TimeOffsetOption{}, fmt.Errorf("invalid time offset format: %q", offset)
+		}
+		if parts[0] != "monotonic" && parts[0] != "boottime" {
+			return []spec.TimeOffsetOption{}, fmt.Errorf("invalid time offset clock: %q", parts[0])
+		}
+		secs, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return []spec.TimeOffsetOption{}, fmt.Errorf("invalid time offset format: %q", offset)
+		}
+		var nanosecs uint64
+		if len(parts) == 3 {
+			nanosecs, err = strconv.ParseUint(parts[2], 10, 32)
+			if err != nil || nanosecs >= 1e9 {
+				return []spec.TimeOffsetOption{}, fmt.Errorf("invalid time offset format: %q", offset)
+			}
+		}
+		timeOffsetOption = append(timeOffsetOption, spec.TimeOffsetOption{
+			Clock:    parts[0],
+			Secs:     secs,
+			Nanosecs: uint32(nanosecs),
+		})
+	}
+	return timeOffsetOption, nil
+}
+
+func parseRouteFlag(routes []string) ([]spec.RouteOption, error) {
+	var routeOption []spec.RouteOption
+	for _, route := range routes {
+		r, err := parseRoute(route, ",")
+		if err != nil {
+			return []spec.RouteOption{}, err
+		}
+		routeOption = append(routeOption, r)
+	}
+	return routeOption, nil
+}
+
+// parseRoute parses "destination[<sep>gateway]".
+func parseRoute(route string, sep string) (spec.RouteOption, error) {
+	destination, gateway, _ := strings.Cut(route, sep)
+	if _, _, err := net.ParseCIDR(destination); err != nil {
+		return spec.RouteOption{}, fmt.Errorf("invalid route destination: %q", route)
+	}
+	if gateway != "" && net.ParseIP(gateway) == nil {
+		return spec.RouteOption{}, fmt.Errorf("invalid route gateway: %q", route)
+	}
+	return spec.RouteOption{
+		Destination: destination,
+		Gateway:     gateway,
+	}, nil
+}
+
+// parseNetworkModeFlag validates the --network mode against the network
+// namespace of --ns. Without a mode, host is used if no network namespace
+// is created and bridge otherwise. A network namespace joined by path is
+// left without a mode.
+func parseNetworkModeFlag(mode string, namespaces []spec.NamespaceOption) (string, error) {
+	var netns *spec.NamespaceOption
+	for i := range namespaces {
+		if namespaces[i].Type == "network" {
+			netns = &namespaces[i]
+		}
+	}
+
+	switch {
+	case mode == "":
+		if netns == nil {
+			return "host", nil
+		}
+		if netns.Path != "" {
+			return "", nil
+		}
+		return "bridge", nil
+	case mode == "host":
+		if netns != nil {
+			return "", fmt.Errorf("network mode host cannot be used with --ns network")
+		}
+	case mode == "none" || mode == "bridge":
+		if netns == nil || netns.Path != "" {
+			return "", fmt.Errorf("network mode %s requires --ns network", mode)
+		}
+	case strings.HasPrefix(mode, "container:"):
+		if strings.TrimPrefix(mode, "container:") == "" {
+			return "", fmt.Errorf("network mode container requires a container id")
+		}
+		if netns != nil && netns.Path != "" {
+			return "", fmt.Errorf("network mode %s cannot be used with a network namespace path", mode)
+		}
+	default:
+		return "", fmt.Errorf("invalid network mode: %q", mode)
+	}
+	return mode, nil
+}
+
+// parseNetFlag parses --net definitions. The n-th definition is named
+// eth<n> inside the container unless container_if_name is given, and
+// its peer is created under that name unless host_if_name is given.
+func parseNetFlag(definitions []string) ([]spec.NetInterfaceOption, error) {
+	var netInterfaces []spec.NetInterfaceOption
+	for n, definition := range definitions {
+		var netInterface spec.NetInterfaceOption
+		for _, kv := range strings.Split(definition, ",") {
+			key, value, _ := strings.Cut(kv, "=")
+			switch key {
+			case "bridge_if_name":
+				netInterface.BridgeInterfaceName = value
+			case "if_name":
+				netInterface.InterfaceName = value
+			case "host_if_name":
+				netInterface.HostInterface = value
+			case "container_if_name":
+				netInterface.ContainerInterfaceName = value
+			case "mac", "host_mac", "mtu", "ingress_rate", "ingress_burst", "egress_rate", "egress_burst":
+				if err := parseLinkKey(&netInterface, key, value); err != nil {
+					return nil, fmt.Errorf("%w: %q", err, definition)
+				}
+			case "if_addr":
+				netInterface.Address = value
+			case "if_gateway":
+				netInterface.Gateway = value
+			case "if_addr6":
+				netInterface.Address6 = value
+			case "if_gateway6":
+				netInterface.Gateway6 = value
+			case "if_addr6_nodad":
+				netInterface.DisableDAD6 = value == "" || value == "true"
+			case "route":
+				r, err := parseRoute(value, "@")
+				if err != nil {
+					return nil, err
+				}
+				netInterface.Routes = append(netInterface.Routes, r)
+			default:
+				return nil, fmt.Errorf("unknown net key %q: %q", key, definition)
+			}
+		}
+
+		if netInterface.BridgeInterfaceName == "" || netInterface.InterfaceName == "" {
+			return nil, fmt.Errorf("bridge_if_name and if_name are required: %q", definition)
+		}
+		if netInterface.Address == "" && netInterface.Address6 == "" {
+			return nil, fmt.Errorf("if_addr or if_addr6 is required: %q", definition)
+		}
+		if netInterface.ContainerInterfaceName == "" {
+			netInterface.ContainerInterfaceName = fmt.Sprintf("eth%d", n)
+		}
+		if netInterface.HostInterface == "" {
+			netInterface.HostInterface = netInterface.ContainerInterfaceName
+		}
+		netInterfaces = append(netInterfaces, netInterface)
+	}
+	return netInterfaces, nil
+}
+
+// parseLinkKey parses a link attribute or rate limit of an interface
+// definition (mac, host_mac, mtu, ingress_rate, ingress_burst,
+// egress_rate or egress_burst) into netInterface.
+func parseLinkKey(netInterface *spec.NetInterfaceOption, key string, value string) error {
+	switch key {
+	case "mac", "host_mac":
+		if value != "auto" {
+			if mac, err := net.ParseMAC(value); err != nil || len(mac) != 6 {
+				return fmt.Errorf("invalid mac address")
+			}
+		}
+		if key == "mac" {
+			netInterface.Mac = value
+		} else {
+			netInterface.HostMac = value
+		}
+	case "mtu":
+		mtu, err := strconv.Atoi(value)
+		if err != nil || mtu < 68 || mtu > 65535 {
+			return fmt.Errorf("invalid mtu")
+		}
+		netInterface.Mtu = mtu
+	case "ingress_rate", "egress_rate":
+		rate, err := parseRate(value)
+		if err != nil {
+			return err
+		}
+		if key == "ingress_rate" {
+			netInterface.IngressRate = rate
+		} else {
+			netInterface.EgressRate = rate
+		}
+	case "ingress_burst", "egress_burst":
+		burst, err := parseByteSize(value)
+		if err != nil || burst <= 0 {
+			return fmt.Errorf("invalid burst")
+		}
+		if key == "ingress_burst" {
+			netInterface.IngressBurst = uint64(burst)
+		} else {
+			netInterface.EgressBurst = uint64(burst)
+		}
+	default:
+		return fmt.Errorf("unknown link key %q", key)
+	}
+	return nil
+}
+
+// parseRate parses a rate in bits per second as tc does: a number with a
+// bit, kbit, mbit, gbit or tbit suffix (decimal units), or a bps, kbps,
+// mbps, gbps or tbps suffix for bytes per second. A plain number is in
+// bits per second.
+func parseRate(s string) (uint64, error) {
+	num := strings.ToLower(strings.TrimSpace(s))
+	multiplier := uint64(1)
+	switch {
+	case strings.HasSuffix(num, "bps"):
+		multiplier = 8
+		num = strings.TrimSuffix(num, "bps")
+	case strings.HasSuffix(num, "bit"):
+		num = strings.TrimSuffix(num, "bit")
+	}
+	for i, prefix := range []string{"k", "m", "g", "t"} {
+		if strings.HasSuffix(num, prefix) {
+			num = strings.TrimSuffix(num, prefix)
+			for j := 0; j <= i; j++ {
+				multiplier *= 1000
+			}
+			break
+		}
+	}
+	v, err := strconv.ParseUint(num, 10, 64)
+	if err != nil || v == 0 || v > math.MaxUint64/multiplier {
+		return 0, fmt.Errorf("invalid rate: %q", s)
+	}
+	return v * multiplier, nil
+}
+
 func parseHookFlag(command []string, env []string) ([]spec.HookOption, error) {
 	var hooks []spec.HookOption
 
@@ -379,3 +1002,84 @@ func parseHookFlag(command []string, env []string) ([]spec.HookOption, error) {
 	}
 	return hooks, nil
 }
+
+// parseAddHostFlag parses the host:ip values of --add_host. The address
+// may be IPv6, so the value is split at the first colon.
+func parseAddHostFlag(values []string) ([]spec.HostOption, error) {
+	var hosts []spec.HostOption
+	for _, v := range values {
+		hostname, address, ok := strings.Cut(v, ":")
+		if !ok || hostname == "" || net.ParseIP(address) == nil {
+			return nil, fmt.Errorf("invalid host entry: %q (expected host:ip)", v)
+		}
+		hosts = append(hosts, spec.HostOption{Hostname: hostname, Address: address})
+	}
+	return hosts, nil
+}
+
+// parsePublishFlag parses the values of --publish:
+//
+//	[host_ip:]host_port[-end]:container_port[-end][/tcp|udp]
+//
+// The host and container ranges must be of the same length.
+func parsePublishFlag(values []string) ([]spec.PortOption, error) {
+	var ports []spec.PortOption
+	for _, v := range values {
+		port := spec.PortOption{Protocol: "tcp"}
+		mapping := v
+		if m, protocol, ok := strings.Cut(v, "/"); ok {
+			mapping = m
+			port.Protocol = protocol
+		}
+
+		parts := strings.Split(mapping, ":")
+		switch len(parts) {
+		case 2:
+		case 3:
+			port.HostIP = parts[0]
+			parts = parts[1:]
+		default:
+			return nil, fmt.Errorf("invalid publish: %q", v)
+		}
+
+		hostPort, hostRange, err := parsePortRange(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid publish: %q", v)
+		}
+		containerPort, containerRange, err := parsePortRange(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid publish: %q", v)
+		}
+		if hostRange != containerRange {
+			return nil, fmt.Errorf("invalid publish: %q (host and container ranges differ)", v)
+		}
+		port.HostPort = hostPort
+		port.ContainerPort = containerPort
+		if hostRange > 1 {
+			port.Range = hostRange
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// parsePortRange parses a port or a range of ports (start-end) and
+// returns the first port and the number of ports.
+func parsePortRange(s string) (int, int, error) {
+	first, last, isRange := strings.Cut(s, "-")
+	start, err := strconv.Atoi(first)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return start, 1, nil
+	}
+	end, err := strconv.Atoi(last)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("invalid port range: %s", s)
+	}
+	return start, end - start + 1, nil
+}
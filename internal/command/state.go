@@ -1,7 +1,7 @@
 package command
 
 import (
-	"droplet/internal/status"
+	"droplet/internal/container"
 	"fmt"
 	"github.com/urfave/cli/v2"
 )
@@ -19,8 +19,10 @@ func runState(ctx *cli.Context) error {
 	// retrieve container id
 	containerId := ctx.Args().Get(0)
 
-	containerStatusHandler := status.NewStatusHandler()
-	statusInfo, err := containerStatusHandler.ReadStatusFile(containerId)
+	containerState := container.NewContainerState()
+	statusInfo, err := containerState.State(container.StateOption{
+		ContainerId: containerId,
+	})
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,210 @@
+package command
+
+import (
+	"droplet/internal/container"
+	"droplet/internal/status"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandStats() *cli.Command {
+	return &cli.Command{
+		Name:      "stats",
+		Usage:     "display resource usage of containers",
+		ArgsUsage: "[container-id...]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "show all created, running and paused containers",
+			},
+			&cli.BoolFlag{
+				Name:  "stream",
+				Usage: "keep printing stats every --interval",
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "interval between samples in stream mode",
+				Value: time.Second,
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "print format [default|json]",
+			},
+		},
+		Action: runStats,
+	}
+}
+
+func runStats(ctx *cli.Context) error {
+	// format option
+	formatOption := ctx.String("format")
+
+	// resolve target containers
+	containerIds := ctx.Args().Slice()
+	if ctx.Bool("all") {
+		ids, err := listActiveContainers()
+		if err != nil {
+			return err
+		}
+		containerIds = ids
+	}
+	if len(containerIds) == 0 && !ctx.Bool("all") {
+		return fmt.Errorf("container id or --all is required")
+	}
+	if ctx.Duration("interval") <= 0 {
+		return fmt.Errorf("invalid interval: %s", ctx.Duration("interval"))
+	}
+
+	containerStats := container.NewContainerStats()
+	previous := map[string]container.StatsObject{}
+	for {
+		// collect a sample of each container
+		var list []container.StatsObject
+		for _, containerId := range containerIds {
+			stats, err := containerStats.Stats(container.StatsOption{
+				ContainerId: containerId,
+			})
+			if err != nil {
+				if !ctx.Bool("stream") && !ctx.Bool("all") {
+					return err
+				}
+				// the container may have stopped since it was listed
+				continue
+			}
+			list = append(list, stats)
+		}
+
+		printStats(list, previous, formatOption)
+
+		if !ctx.Bool("stream") {
+			return nil
+		}
+		for _, stats := range list {
+			previous[stats.Id] = stats
+		}
+		time.Sleep(ctx.Duration("interval"))
+
+		// pick up containers started while streaming
+		if ctx.Bool("all") {
+			ids, err := listActiveContainers()
+			if err != nil {
+				return err
+			}
+			containerIds = ids
+		}
+	}
+}
+
+// listActiveContainers returns the ids of containers that have a cgroup
+// to read, i.e. created, running or paused containers.
+func listActiveContainers() ([]string, error) {
+	containerStatusHandler := status.NewStatusHandler()
+	containerStatusList, err := containerStatusHandler.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range containerStatusList {
+		switch entry.Status {
+		case status.CREATED.String(), status.RUNNING.String(), status.PAUSED.String():
+			ids = append(ids, entry.Id)
+		}
+	}
+	return ids, nil
+}
+
+// printStats prints one sample per container. In json format each sample
+// is printed as a single line array so that stream output can be read
+// line by line.
+//
+// The CPU column is computed from the previous sample and is empty for
+// the first one.
+func printStats(list []container.StatsObject, previous map[string]container.StatsObject, format string) {
+	if format == "json" {
+		if list == nil {
+			list = []container.StatsObject{}
+		}
+		dataStr, err := json.Marshal(list)
+		if err != nil {
+			return
+		}
+		fmt.Println(string(dataStr))
+		return
+	}
+
+	fmt.Printf("%-15s %-8s %-8s %-21s %-7s %-10s %-21s %-s\n", "ID", "STATUS", "CPU %", "MEM USAGE / LIMIT", "MEM %", "PIDS", "NET I/O", "BLOCK I/O")
+	for _, entry := range list {
+		cpu := "--"
+		if prev, ok := previous[entry.Id]; ok {
+			cpu = fmt.Sprintf("%.2f%%", cpuPercent(prev, entry))
+		}
+
+		memUsage, memPercent := "--", "--"
+		if entry.Memory != nil {
+			limit := "unlimited"
+			if entry.Memory.Limit > 0 {
+				limit = formatBytes(entry.Memory.Limit)
+				memPercent = fmt.Sprintf("%.2f%%", float64(entry.Memory.Usage)/float64(entry.Memory.Limit)*100)
+			}
+			memUsage = formatBytes(entry.Memory.Usage) + " / " + limit
+		}
+
+		pids := "--"
+		if entry.Pids != nil {
+			pids = fmt.Sprint(entry.Pids.Current)
+		}
+
+		netIO := "--"
+		if entry.SharedNetns == "host" {
+			// no counters of its own
+			netIO = "host"
+		} else if len(entry.Network) > 0 {
+			var rxBytes, txBytes uint64
+			for _, network := range entry.Network {
+				rxBytes += network.RxBytes
+				txBytes += network.TxBytes
+			}
+			netIO = formatBytes(rxBytes) + " / " + formatBytes(txBytes)
+		}
+
+		var readBytes, writeBytes uint64
+		for _, io := range entry.IO {
+			readBytes += io.RBytes
+			writeBytes += io.WBytes
+		}
+		blockIO := formatBytes(readBytes) + " / " + formatBytes(writeBytes)
+
+		fmt.Printf("%-15s %-8s %-8s %-21s %-7s %-10s %-21s %-s\n", entry.Id, entry.Status, cpu, memUsage, memPercent, pids, netIO, blockIO)
+	}
+}
+
+// cpuPercent returns the CPU usage between two samples, where 100% is
+// one fully used CPU.
+func cpuPercent(prev container.StatsObject, cur container.StatsObject) float64 {
+	if prev.Cpu == nil || cur.Cpu == nil || cur.Cpu.UsageUsec < prev.Cpu.UsageUsec {
+		return 0
+	}
+	elapsed := cur.Read.Sub(prev.Read).Microseconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(cur.Cpu.UsageUsec-prev.Cpu.UsageUsec) / float64(elapsed) * 100
+}
+
+// formatBytes formats a byte count with binary units.
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,294 @@
+package command
+
+import (
+	"droplet/internal/container"
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandUpdate() *cli.Command {
+	return &cli.Command{
+		Name:      "update",
+		Usage:     "update resource limits, /etc files and firewall policy of a container",
+		ArgsUsage: "<container-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "resources",
+				Usage: "path to an OCI linux.resources JSON document (flags override its values)",
+			},
+			&cli.StringFlag{
+				Name:  "memory",
+				Usage: "memory limit (bytes, or with k/m/g suffix; -1 for unlimited)",
+			},
+			&cli.StringFlag{
+				Name:  "memory-reservation",
+				Usage: "memory soft limit (bytes, or with k/m/g suffix)",
+			},
+			&cli.StringFlag{
+				Name:  "memory-swap",
+				Usage: "total memory + swap limit (bytes, or with k/m/g suffix; -1 for unlimited swap)",
+			},
+			&cli.StringFlag{
+				Name:  "cpus",
+				Usage: "number of CPUs (e.g. 1.5), converted to cpu quota",
+			},
+			&cli.Uint64Flag{
+				Name:  "cpu-shares",
+				Usage: "CPU shares (relative weight)",
+			},
+			&cli.Int64Flag{
+				Name:  "cpu-quota",
+				Usage: "CPU CFS quota in microseconds (-1 for unlimited)",
+			},
+			&cli.Uint64Flag{
+				Name:  "cpu-period",
+				Usage: "CPU CFS period in microseconds",
+			},
+			&cli.StringFlag{
+				Name:  "cpuset-cpus",
+				Usage: "CPUs in which to allow execution (e.g. 0-3, 0,1; empty to clear)",
+			},
+			&cli.StringFlag{
+				Name:  "cpuset-mems",
+				Usage: "memory nodes in which to allow execution (e.g. 0-3, 0,1; empty to clear)",
+			},
+			&cli.Int64Flag{
+				Name:  "pids-limit",
+				Usage: "maximum number of pids (-1 for unlimited)",
+			},
+			&cli.UintFlag{
+				Name:  "blkio-weight",
+				Usage: "block IO weight (10-1000)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "dns",
+				Usage: "dns server, replaces the servers of resolv.conf",
+			},
+			&cli.StringSliceFlag{
+				Name:  "dns-search",
+				Usage: "dns search domain, replaces the search domains of resolv.conf",
+			},
+			&cli.StringSliceFlag{
+				Name:  "dns-option",
+				Usage: "dns resolver option, replaces the options of resolv.conf",
+			},
+			&cli.StringSliceFlag{
+				Name:  "add-host",
+				Usage: "extra /etc/hosts entry (host:ip), replaces the extra hosts",
+			},
+			&cli.StringFlag{
+				Name:  "policy",
+				Usage: "path to a firewall policy JSON document, replaces the policy ({} removes it)",
+			},
+		},
+		Action: runUpdate,
+	}
+}
+
+func runUpdate(ctx *cli.Context) error {
+	// retrieve container id
+	containerId := ctx.Args().Get(0)
+
+	// build resources from --resources and flags
+	resources, err := createUpdateResources(ctx)
+	if err != nil {
+		return err
+	}
+
+	// build dns settings and extra hosts from flags
+	networkFiles, err := createUpdateNetworkFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	// policy document
+	var policy *spec.PolicyObject
+	if path := ctx.String("policy"); path != "" {
+		policy = &spec.PolicyObject{}
+		if err := utils.ReadJsonFile(path, policy); err != nil {
+			return fmt.Errorf("read policy file %s failed: %w", path, err)
+		}
+	}
+
+	containerUpdate := container.NewContainerUpdate()
+	err = containerUpdate.Update(container.UpdateOption{
+		ContainerId:  containerId,
+		Resources:    resources,
+		NetworkFiles: networkFiles,
+		Policy:       policy,
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func createUpdateResources(ctx *cli.Context) (spec.ResourceObject, error) {
+	var resources spec.ResourceObject
+
+	// resources document
+	if path := ctx.String("resources"); path != "" {
+		if err := utils.ReadJsonFile(path, &resources); err != nil {
+			return spec.ResourceObject{}, fmt.Errorf("read resources file %s failed: %w", path, err)
+		}
+	}
+
+	// memory
+	if ctx.IsSet("memory") {
+		v, err := parseByteSize(ctx.String("memory"))
+		if err != nil {
+			return spec.ResourceObject{}, err
+		}
+		resources.Memory.Limit = &v
+	}
+	if ctx.IsSet("memory-reservation") {
+		v, err := parseByteSize(ctx.String("memory-reservation"))
+		if err != nil {
+			return spec.ResourceObject{}, err
+		}
+		resources.Memory.Reservation = &v
+	}
+	if ctx.IsSet("memory-swap") {
+		v, err := parseByteSize(ctx.String("memory-swap"))
+		if err != nil {
+			return spec.ResourceObject{}, err
+		}
+		resources.Memory.Swap = &v
+	}
+
+	// cpu
+	if ctx.IsSet("cpu-shares") {
+		v := ctx.Uint64("cpu-shares")
+		resources.Cpu.Shares = &v
+	}
+	if ctx.IsSet("cpu-period") {
+		v := ctx.Uint64("cpu-period")
+		resources.Cpu.Period = &v
+	}
+	if ctx.IsSet("cpu-quota") {
+		v := ctx.Int64("cpu-quota")
+		resources.Cpu.Quota = &v
+	}
+	if ctx.IsSet("cpus") {
+		if ctx.IsSet("cpu-quota") {
+			return spec.ResourceObject{}, fmt.Errorf("--cpus and --cpu-quota cannot be used together")
+		}
+		period := uint64(100000)
+		if resources.Cpu.Period != nil && *resources.Cpu.Period != 0 {
+			period = *resources.Cpu.Period
+		}
+		cpus, err := strconv.ParseFloat(ctx.String("cpus"), 64)
+		if err != nil || cpus <= 0 {
+			return spec.ResourceObject{}, fmt.Errorf("invalid cpus: %q", ctx.String("cpus"))
+		}
+		quota := int64(cpus * float64(period))
+		resources.Cpu.Quota = &quota
+		resources.Cpu.Period = &period
+	}
+	if ctx.IsSet("cpuset-cpus") {
+		v := ctx.String("cpuset-cpus")
+		resources.Cpu.Cpus = &v
+	}
+	if ctx.IsSet("cpuset-mems") {
+		v := ctx.String("cpuset-mems")
+		resources.Cpu.Mems = &v
+	}
+
+	// pids
+	if ctx.IsSet("pids-limit") {
+		resources.Pids = &spec.PidsObject{Limit: ctx.Int64("pids-limit")}
+	}
+
+	// blkio
+	if ctx.IsSet("blkio-weight") {
+		w := ctx.Uint("blkio-weight")
+		if w > 1000 {
+			return spec.ResourceObject{}, fmt.Errorf("invalid blkio weight: %d", w)
+		}
+		weight := uint16(w)
+		if resources.BlockIO == nil {
+			resources.BlockIO = &spec.BlockIOObject{}
+		}
+		resources.BlockIO.Weight = &weight
+	}
+
+	return resources, nil
+}
+
+// createUpdateNetworkFiles returns the dns settings and extra hosts set
+// by flags, or nil if none is set and the /etc files are left as is.
+func createUpdateNetworkFiles(ctx *cli.Context) (*spec.NetworkFilesObject, error) {
+	var files spec.NetworkFilesObject
+	set := false
+
+	// dns
+	dns := spec.DnsObject{}
+	if ctx.IsSet("dns") {
+		dns.Servers = ctx.StringSlice("dns")
+		set = true
+	}
+	if ctx.IsSet("dns-search") {
+		dns.Search = ctx.StringSlice("dns-search")
+		set = true
+	}
+	if ctx.IsSet("dns-option") {
+		dns.Options = ctx.StringSlice("dns-option")
+		set = true
+	}
+	if set {
+		files.Dns = &dns
+	}
+
+	// extra hosts
+	if ctx.IsSet("add-host") {
+		hosts, err := parseAddHostFlag(ctx.StringSlice("add-host"))
+		if err != nil {
+			return nil, err
+		}
+		files.ExtraHosts = []spec.HostObject{}
+		for _, h := range hosts {
+			files.ExtraHosts = append(files.ExtraHosts, spec.HostObject{
+				Hostname: h.Hostname,
+				Address:  h.Address,
+			})
+		}
+		set = true
+	}
+
+	if !set {
+		return nil, nil
+	}
+	return &files, nil
+}
+
+// parseByteSize parses a byte size with an optional k/m/g suffix
+// (binary units). "-1" is accepted as unlimited.
+func parseByteSize(s string) (int64, error) {
+	if s == "-1" {
+		return -1, nil
+	}
+	multiplier := int64(1)
+	num := strings.ToLower(strings.TrimSpace(s))
+	num = strings.TrimSuffix(num, "b")
+	switch {
+	case strings.HasSuffix(num, "k"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(num, "m"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(num, "g"):
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		num = num[:len(num)-1]
+	}
+	v, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return v * multiplier, nil
+}
@@ -1,7 +1,6 @@
 package container
 
 import (
-	"fmt"
 	"github.com/syndtr/gocapability/capability"
 )
 
@@ -27,8 +26,6 @@ func toCaps(names []string) []capability.Cap {
 	for _, n := range names {
 		if v, ok := capNameMap[n]; ok {
 			res = append(res, v)
-		} else {
-			fmt.Errorf("unknown capability: %s\n", n)
 		}
 	}
 	return res
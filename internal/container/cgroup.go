@@ -4,8 +4,21 @@ import (
 	"droplet/internal/spec"
 	"droplet/internal/utils"
 	"fmt"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// cgroupDrainTimeout bounds how long remove waits for the processes
+	// left in a cgroup to exit after SIGKILL.
+	cgroupDrainTimeout = 5 * time.Second
+	// cgroupDrainInterval is the polling interval while draining.
+	cgroupDrainInterval = 50 * time.Millisecond
 )
 
 // newContainerCgroupController returns a new containerCgroupController
@@ -20,91 +33,358 @@ func newContainerCgroupController() *containerCgroupController {
 
 // containerCgroupPreparer defines the behavior required to
 // prepare cgroup resources for a container. Implementations
-// should apply resource limits and attach a process to the cgroup.
+// should create the cgroup and apply resource limits before the
+// init process is started.
 type containerCgroupPreparer interface {
-	prepare(containerId string, spec spec.Spec, pid int) error
+	prepare(containerId string, spec spec.Spec) error
+}
+
+// containerCgroupStarter defines the behavior required to start a
+// process inside the cgroup of a container.
+type containerCgroupStarter interface {
+	start(cmd utils.CommandExecutor, containerId string, spec spec.Spec) error
 }
 
-// containerCgroupController manages cgroup resource configuration
-// for a container. It applies CPU and memory limits and assigns
-// processes into the appropriate cgroup.
+// containerCgroupUpdater defines the behavior required to change the
+// resource limits of an existing container cgroup.
+type containerCgroupUpdater interface {
+	update(containerId string, spec spec.Spec, resources spec.ResourceObject) error
+}
+
+// containerCgroupKiller defines the behavior required to signal every
+// process in the cgroup of a container.
+type containerCgroupKiller interface {
+	kill(containerId string, spec spec.Spec, signal syscall.Signal) error
+}
+
+// containerCgroupRemover defines the behavior required to remove the
+// cgroup of a container that is being deleted.
+type containerCgroupRemover interface {
+	remove(containerId string, spec spec.Spec) error
+}
+
+// containerCgroupController manages the cgroup of a container. It creates
+// the cgroup, applies the OCI linux.resources limits, starts processes
+// inside it and removes it when the container is deleted.
 type containerCgroupController struct {
 	syscallHandler utils.KernelSyscallHandler
 }
 
-// prepare applies resource limits defined in the container spec
-// and assigns the given process ID to the container's cgroup.
-// This method configures memory, CPU, and process membership
-// sequentially and returns an error if any step fails.
-func (c *containerCgroupController) prepare(containerId string, spec spec.Spec, pid int) error {
-	// 1. set memory limit
-	if err := c.setMemoryLimit(containerId, spec.LinuxSpec.Resources.Memory); err != nil {
+// prepare creates the container's cgroup and applies resource limits
+// defined in the container spec.
+//
+// The workflow is:
+//  1. Resolve the cgroup path from linux.cgroupsPath
+//  2. Convert linux.resources into cgroup v2 interface file values
+//  3. Create the cgroup and enable the required controllers in the
+//     cgroup.subtree_control of each ancestor
+//  4. Verify the required controllers are enabled for the cgroup
+//  5. Write the values to the container's cgroup directory
+//
+// It is called before the init process is started, so that the process
+// can be spawned directly into a fully configured cgroup (see start).
+// An error is returned if any step fails.
+func (c *containerCgroupController) prepare(containerId string, spec spec.Spec) error {
+	// 1. resolve cgroup path
+	cgroupPath, err := utils.ResolveCgroupPath(containerId, spec.LinuxSpec.CgroupsPath)
+	if err != nil {
+		return err
+	}
+
+	// 2. build resource values
+	values, err := buildCgroupFileValues(spec.LinuxSpec.Resources)
+	if err != nil {
 		return err
 	}
 
-	// 2. set cpu limit
-	if err := c.setCpuLimit(containerId, spec.LinuxSpec.Resources.Cpu); err != nil {
+	// 3. create cgroup
+	if err := c.createCgroup(cgroupPath, values); err != nil {
 		return err
 	}
 
-	// 3. set pids max
-	if err := c.setPidsLimit(containerId, 512); err != nil {
+	// 4. check controllers
+	if err := c.checkControllers(cgroupPath, values); err != nil {
 		return err
 	}
 
-	// 3. set pid to cgroup.procs
-	if err := c.setProcessToCgroup(containerId, pid); err != nil {
+	// 5. apply resource values
+	if err := c.applyResources(cgroupPath, values); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// setMemoryLimit writes the memory limit value to memory.max
-// under the container's cgroup directory. The value is applied
-// according to the provided MemoryObject configuration.
-func (c *containerCgroupController) setMemoryLimit(containerId string, memoryObject spec.MemoryObject) error {
-	cgroupPath := utils.CgroupPath(containerId)
-	memoryPath := filepath.Join(cgroupPath, "memory.max")
-	memoryLimit := strconv.FormatInt(int64(memoryObject.Limit), 10)
+// start starts cmd inside the container's cgroup.
+//
+// The process is spawned with clone3 CLONE_INTO_CGROUP, so it never runs
+// outside of the cgroup limits. On kernels without CLONE_INTO_CGROUP the
+// process is started normally and moved into the cgroup right after via
+// cgroup.procs. This only places the process; the root of a cgroup
+// namespace created by the same clone is not guaranteed to be the
+// container's cgroup, and with the fallback it is the caller's cgroup.
+func (c *containerCgroupController) start(cmd utils.CommandExecutor, containerId string, spec spec.Spec) error {
+	// 1. open cgroup directory
+	cgroupPath, err := utils.ResolveCgroupPath(containerId, spec.LinuxSpec.CgroupsPath)
+	if err != nil {
+		return err
+	}
+	cgroupDir, err := c.syscallHandler.OpenFile(cgroupPath, os.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open cgroup %s failed: %w", cgroupPath, err)
+	}
+	defer cgroupDir.Close()
 
-	if err := c.syscallHandler.WriteFile(memoryPath, []byte(memoryLimit+"\n"), 0644); err != nil {
+	// 2. start process in cgroup
+	placed, err := cmd.StartInCgroup(int(cgroupDir.Fd()))
+	if err != nil {
 		return err
 	}
 
+	// 3. fallback: set pid to cgroup.procs
+	if !placed {
+		if err := c.setProcessToCgroup(cgroupPath, cmd.Pid()); err != nil {
+			// do not leave the process running outside of the cgroup
+			_ = c.syscallHandler.Kill(cmd.Pid(), syscall.SIGKILL)
+			return err
+		}
+	}
+
 	return nil
 }
 
-// setCpuLimit writes CPU quota and period values to cpu.max
-// under the container's cgroup directory. The quota and period
-// together define the scheduler time allocation for the container.
-func (c *containerCgroupController) setCpuLimit(containerId string, cpuObject spec.CpuObject) error {
-	cgroupPath := utils.CgroupPath(containerId)
-	cpuPath := filepath.Join(cgroupPath, "cpu.max")
-	cpuLimit := fmt.Sprintf("%d %d\n", cpuObject.Quota, cpuObject.Period)
+// update applies the given resources to the container's existing cgroup.
+//
+// The resources are expected to be the complete effective set (see
+// mergeResources), since unset limits within a configured controller are
+// written as "max". Controllers that were not needed at create time are
+// enabled on the ancestors first.
+func (c *containerCgroupController) update(containerId string, spec spec.Spec, resources spec.ResourceObject) error {
+	// 1. resolve cgroup path
+	cgroupPath, err := utils.ResolveCgroupPath(containerId, spec.LinuxSpec.CgroupsPath)
+	if err != nil {
+		return err
+	}
+	if _, err := c.syscallHandler.Stat(cgroupPath); err != nil {
+		return fmt.Errorf("cgroup %s: %w", cgroupPath, err)
+	}
+
+	// 2. build resource values
+	values, err := buildCgroupFileValues(resources)
+	if err != nil {
+		return err
+	}
+
+	// 3. enable controllers
+	if err := c.enableControllers(cgroupPath, values); err != nil {
+		return err
+	}
+
+	// 4. check controllers
+	if err := c.checkControllers(cgroupPath, values); err != nil {
+		return err
+	}
+
+	// 5. apply resource values
+	return c.applyResources(cgroupPath, values)
+}
+
+// remove drains and removes the container's cgroup.
+//
+// Processes still attached to the cgroup (e.g. daemons left behind by a
+// stopped container) are killed with SIGKILL, and the cgroup directory is
+// removed once it is no longer populated, together with any cgroups the
+// container created below it. A cgroup that does not exist is not an
+// error. Intermediate cgroups of a nested cgroupsPath are kept, since they
+// may be shared with other containers.
+func (c *containerCgroupController) remove(containerId string, spec spec.Spec) error {
+	// 1. resolve cgroup path
+	cgroupPath, err := utils.ResolveCgroupPath(containerId, spec.LinuxSpec.CgroupsPath)
+	if err != nil {
+		return err
+	}
+	if _, err := c.syscallHandler.Stat(cgroupPath); err != nil {
+		if c.syscallHandler.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
 
-	if err := c.syscallHandler.WriteFile(cpuPath, []byte(cpuLimit), 0644); err != nil {
+	// 2. drain processes
+	if err := c.drainCgroup(cgroupPath); err != nil {
 		return err
 	}
+
+	// 3. remove cgroup directories, children first
+	dirs, err := listCgroupTree(cgroupPath)
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := c.syscallHandler.Rmdir(dirs[i]); err != nil {
+			return fmt.Errorf("remove cgroup %s failed: %w", dirs[i], err)
+		}
+	}
 	return nil
 }
 
-func (c *containerCgroupController) setPidsLimit(containerId string, pids int) error {
-	cgroupPath := utils.CgroupPath(containerId)
-	pidsMaxPath := filepath.Join(cgroupPath, "pids.max")
-	pidsMax := fmt.Sprintf("%d\n", pids)
+// kill sends signal to every process in the container's cgroup, including
+// processes in cgroups created below it.
+//
+// SIGKILL is delivered by writing 1 to cgroup.kill (Linux 5.14+), which
+// kills the whole subtree at once so that processes forked concurrently
+// cannot escape. Other signals, and SIGKILL on older kernels, are sent to
+// each pid listed in cgroup.procs.
+func (c *containerCgroupController) kill(containerId string, spec spec.Spec, signal syscall.Signal) error {
+	cgroupPath, err := utils.ResolveCgroupPath(containerId, spec.LinuxSpec.CgroupsPath)
+	if err != nil {
+		return err
+	}
+	return c.signalCgroup(cgroupPath, signal)
+}
+
+// signalCgroup sends signal to every process in the cgroup subtree at
+// cgroupPath. Processes that exit in the meantime are ignored.
+func (c *containerCgroupController) signalCgroup(cgroupPath string, signal syscall.Signal) error {
+	// 1. cgroup.kill
+	if signal == syscall.SIGKILL {
+		killPath := filepath.Join(cgroupPath, "cgroup.kill")
+		if _, err := c.syscallHandler.Stat(killPath); err == nil {
+			if err := c.syscallHandler.WriteFile(killPath, []byte("1\n"), 0644); err != nil {
+				return fmt.Errorf("write %s failed: %w", killPath, err)
+			}
+			return nil
+		}
+	}
 
-	if err := c.syscallHandler.WriteFile(pidsMaxPath, []byte(pidsMax), 0644); err != nil {
+	// 2. signal each pid in cgroup.procs
+	pids, err := readCgroupTreeProcs(cgroupPath)
+	if err != nil {
 		return err
 	}
+	for _, pid := range pids {
+		if err := c.syscallHandler.Kill(pid, signal); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("kill pid %d in %s failed: %w", pid, cgroupPath, err)
+		}
+	}
+	return nil
+}
+
+// createCgroup creates cgroupPath (including any missing parents) and
+// enables the controllers required by values along the way.
+func (c *containerCgroupController) createCgroup(cgroupPath string, values []cgroupFileValue) error {
+	if err := c.syscallHandler.MkdirAll(cgroupPath, 0755); err != nil {
+		return fmt.Errorf("create cgroup %s failed: %w", cgroupPath, err)
+	}
+	return c.enableControllers(cgroupPath, values)
+}
+
+// enableControllers enables the controllers referenced by values in the
+// cgroup.subtree_control of every ancestor of cgroupPath, starting at the
+// cgroup v2 mount point. A controller can only be enabled for a child when
+// its parent has it enabled, hence the top-down order.
+func (c *containerCgroupController) enableControllers(cgroupPath string, values []cgroupFileValue) error {
+	var controllers []string
+	seen := map[string]struct{}{}
+	for _, v := range values {
+		if v.controller == "" {
+			continue
+		}
+		if _, ok := seen[v.controller]; ok {
+			continue
+		}
+		seen[v.controller] = struct{}{}
+		controllers = append(controllers, v.controller)
+	}
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	rel, err := filepath.Rel(utils.CgroupMountDir(), cgroupPath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("cgroup %s is not under %s", cgroupPath, utils.CgroupMountDir())
+	}
+	dir := utils.CgroupMountDir()
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		if err := c.enableSubtreeControllers(dir, controllers); err != nil {
+			return err
+		}
+		dir = filepath.Join(dir, elem)
+	}
+	return nil
+}
+
+// enableSubtreeControllers writes "+<controller>" to dir's
+// cgroup.subtree_control for every controller that is not enabled yet.
+func (c *containerCgroupController) enableSubtreeControllers(dir string, controllers []string) error {
+	enabled, err := readControllerList(filepath.Join(dir, "cgroup.subtree_control"))
+	if err != nil {
+		return err
+	}
+	available, err := readControllerList(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return err
+	}
+
+	var enable []string
+	for _, controller := range controllers {
+		if _, ok := enabled[controller]; ok {
+			continue
+		}
+		if _, ok := available[controller]; !ok {
+			return fmt.Errorf("cgroup controller %q is not available in %s", controller, dir)
+		}
+		enable = append(enable, "+"+controller)
+	}
+	if len(enable) == 0 {
+		return nil
+	}
+
+	subtreeControlPath := filepath.Join(dir, "cgroup.subtree_control")
+	if err := c.syscallHandler.WriteFile(subtreeControlPath, []byte(strings.Join(enable, " ")+"\n"), 0644); err != nil {
+		return fmt.Errorf("enable %s in %s failed: %w", strings.Join(enable, " "), subtreeControlPath, err)
+	}
+	return nil
+}
+
+// checkControllers verifies that every controller referenced by values is
+// enabled in the parent's cgroup.subtree_control. Without it the interface
+// files do not exist in the container cgroup and the write would fail with
+// a less helpful ENOENT.
+func (c *containerCgroupController) checkControllers(cgroupPath string, values []cgroupFileValue) error {
+	subtreeControlPath := filepath.Join(filepath.Dir(cgroupPath), "cgroup.subtree_control")
+	enabled, err := readControllerList(subtreeControlPath)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range values {
+		if v.controller == "" {
+			continue
+		}
+		if _, ok := enabled[v.controller]; !ok {
+			return fmt.Errorf("cgroup controller %q is required for %s but not enabled in %s", v.controller, v.file, subtreeControlPath)
+		}
+	}
+	return nil
+}
+
+// applyResources writes each value to its interface file under cgroupPath
+// in order.
+func (c *containerCgroupController) applyResources(cgroupPath string, values []cgroupFileValue) error {
+	for _, v := range values {
+		path := filepath.Join(cgroupPath, v.file)
+		if err := c.syscallHandler.WriteFile(path, []byte(v.value+"\n"), 0644); err != nil {
+			return fmt.Errorf("write %q to %s failed: %w", v.value, path, err)
+		}
+	}
 	return nil
 }
 
 // setProcessToCgroup assigns the given process ID to the container's
 // cgroup by writing it into cgroup.procs. This ensures the process
 // becomes subject to the configured resource limits.
-func (c *containerCgroupController) setProcessToCgroup(containerId string, pid int) error {
-	cgroupPath := utils.CgroupPath(containerId)
+func (c *containerCgroupController) setProcessToCgroup(cgroupPath string, pid int) error {
 	cgroupProcs := filepath.Join(cgroupPath, "cgroup.procs")
 	data := strconv.Itoa(pid) + "\n"
 
@@ -114,3 +394,97 @@ func (c *containerCgroupController) setProcessToCgroup(containerId string, pid i
 
 	return nil
 }
+
+// drainCgroup kills every process in the cgroup subtree and waits until
+// no process is left or cgroupDrainTimeout expires.
+func (c *containerCgroupController) drainCgroup(cgroupPath string) error {
+	deadline := time.Now().Add(cgroupDrainTimeout)
+	for {
+		pids, err := readCgroupTreeProcs(cgroupPath)
+		if err != nil {
+			return err
+		}
+		if len(pids) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("cgroup %s still has %d processes after %s", cgroupPath, len(pids), cgroupDrainTimeout)
+		}
+		if err := c.signalCgroup(cgroupPath, syscall.SIGKILL); err != nil {
+			return err
+		}
+		time.Sleep(cgroupDrainInterval)
+	}
+}
+
+// listCgroupTree returns cgroupPath and every cgroup below it, parents
+// before their children.
+func listCgroupTree(cgroupPath string) ([]string, error) {
+	var dirs []string
+	err := filepath.WalkDir(cgroupPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// readCgroupTreeProcs returns the pids of every cgroup in the subtree at
+// cgroupPath.
+func readCgroupTreeProcs(cgroupPath string) ([]int, error) {
+	dirs, err := listCgroupTree(cgroupPath)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, dir := range dirs {
+		dirPids, err := readCgroupProcs(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// removed concurrently
+				continue
+			}
+			return nil, err
+		}
+		pids = append(pids, dirPids...)
+	}
+	return pids, nil
+}
+
+// readCgroupProcs returns the pids listed in cgroupPath/cgroup.procs.
+func readCgroupProcs(cgroupPath string) ([]int, error) {
+	data, err := os.ReadFile(filepath.Join(cgroupPath, "cgroup.procs"))
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, field := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid in %s/cgroup.procs: %q", cgroupPath, field)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// readControllerList reads a space separated controller list such as
+// cgroup.controllers or cgroup.subtree_control.
+func readControllerList(path string) (map[string]struct{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed: %w", path, err)
+	}
+	controllers := map[string]struct{}{}
+	for _, controller := range strings.Fields(string(data)) {
+		controllers[controller] = struct{}{}
+	}
+	return controllers, nil
+}
@@ -0,0 +1,99 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// cgroupFreezeTimeout bounds how long freeze/thaw wait for
+	// cgroup.events to report the requested state.
+	cgroupFreezeTimeout = 5 * time.Second
+	// cgroupFreezeInterval is the polling interval of cgroup.events.
+	cgroupFreezeInterval = 10 * time.Millisecond
+)
+
+// containerCgroupFreezer defines the behavior required to suspend and
+// resume every process of a container through the cgroup v2 freezer.
+type containerCgroupFreezer interface {
+	freeze(containerId string, spec spec.Spec) error
+	thaw(containerId string, spec spec.Spec) error
+}
+
+// freeze writes 1 to the container's cgroup.freeze and waits until
+// cgroup.events reports "frozen 1".
+func (c *containerCgroupController) freeze(containerId string, spec spec.Spec) error {
+	return c.setFrozen(containerId, spec, true)
+}
+
+// thaw writes 0 to the container's cgroup.freeze and waits until
+// cgroup.events reports "frozen 0".
+func (c *containerCgroupController) thaw(containerId string, spec spec.Spec) error {
+	return c.setFrozen(containerId, spec, false)
+}
+
+// setFrozen changes the freezer state of the container's cgroup.
+//
+// Writing cgroup.freeze only requests the state change; the kernel
+// reports completion asynchronously through the "frozen" key of
+// cgroup.events, which is polled until it matches or
+// cgroupFreezeTimeout expires.
+func (c *containerCgroupController) setFrozen(containerId string, spec spec.Spec, frozen bool) error {
+	// 1. resolve cgroup path
+	cgroupPath, err := utils.ResolveCgroupPath(containerId, spec.LinuxSpec.CgroupsPath)
+	if err != nil {
+		return err
+	}
+
+	// 2. write cgroup.freeze
+	value := "0"
+	if frozen {
+		value = "1"
+	}
+	freezePath := filepath.Join(cgroupPath, "cgroup.freeze")
+	if err := c.syscallHandler.WriteFile(freezePath, []byte(value+"\n"), 0644); err != nil {
+		return fmt.Errorf("write %q to %s failed: %w", value, freezePath, err)
+	}
+
+	// 3. wait for cgroup.events
+	deadline := time.Now().Add(cgroupFreezeTimeout)
+	for {
+		events, err := readCgroupEvents(cgroupPath)
+		if err != nil {
+			return err
+		}
+		if events["frozen"] == value {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("cgroup %s did not report frozen %s within %s", cgroupPath, value, cgroupFreezeTimeout)
+		}
+		time.Sleep(cgroupFreezeInterval)
+	}
+}
+
+// readCgroupEvents parses the flat keyed cgroup.events file, e.g.
+//
+//	populated 1
+//	frozen 0
+func readCgroupEvents(cgroupPath string) (map[string]string, error) {
+	eventsPath := filepath.Join(cgroupPath, "cgroup.events")
+	data, err := os.ReadFile(eventsPath)
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed: %w", eventsPath, err)
+	}
+	events := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		events[fields[0]] = fields[1]
+	}
+	return events, nil
+}
@@ -0,0 +1,22 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadCgroupEvents_Success(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "cgroup.events"), []byte("populated 1\nfrozen 1\n"), 0644))
+
+	// == act ==
+	events, err := readCgroupEvents(dir)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"populated": "1", "frozen": "1"}, events)
+}
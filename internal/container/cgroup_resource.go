@@ -0,0 +1,356 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// cgroupMax is the value written to a cgroup v2 limit file to remove
+	// the limit.
+	cgroupMax = "max"
+	// defaultCpuPeriod is the CFS period used when only a quota is given.
+	defaultCpuPeriod = 100000
+)
+
+// cgroupFileValue is a single value to be written to a cgroup v2 interface
+// file, together with the controller that provides the file.
+//
+// controller is empty for core interface files (cgroup.*), which do not
+// require any controller to be enabled.
+type cgroupFileValue struct {
+	controller string
+	file       string
+	value      string
+}
+
+// buildCgroupFileValues converts OCI linux.resources into the list of
+// cgroup v2 interface file writes that apply them.
+//
+// Only controllers that are configured in the spec produce entries. Within
+// a configured controller, unset limits are written as "max" so that a
+// reused cgroup does not keep stale limits. The unified map is applied
+// last and therefore takes precedence over the typed fields.
+func buildCgroupFileValues(resources spec.ResourceObject) ([]cgroupFileValue, error) {
+	var values []cgroupFileValue
+
+	// 1. memory
+	memoryValues, err := buildMemoryFileValues(resources.Memory)
+	if err != nil {
+		return nil, err
+	}
+	values = append(values, memoryValues...)
+
+	// 2. cpu / cpuset
+	cpuValues, err := buildCpuFileValues(resources.Cpu)
+	if err != nil {
+		return nil, err
+	}
+	values = append(values, cpuValues...)
+
+	// 3. pids
+	if resources.Pids != nil {
+		values = append(values, cgroupFileValue{"pids", "pids.max", limitValue(resources.Pids.Limit)})
+	}
+
+	// 4. io
+	if resources.BlockIO != nil {
+		ioValues, err := buildIOFileValues(*resources.BlockIO)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, ioValues...)
+	}
+
+	// 5. hugetlb
+	for _, h := range resources.HugepageLimits {
+		if h.PageSize == "" || strings.ContainsAny(h.PageSize, "/.") {
+			return nil, fmt.Errorf("invalid hugepage size: %q", h.PageSize)
+		}
+		values = append(values, cgroupFileValue{"hugetlb", fmt.Sprintf("hugetlb.%s.max", h.PageSize), strconv.FormatUint(h.Limit, 10)})
+	}
+
+	// 6. unified
+	unifiedValues, err := buildUnifiedFileValues(resources.Unified)
+	if err != nil {
+		return nil, err
+	}
+	values = append(values, unifiedValues...)
+
+	return values, nil
+}
+
+// buildMemoryFileValues maps memory.limit, memory.reservation and
+// memory.swap onto memory.max, memory.low and memory.swap.max.
+//
+// A limit of 0 or -1 means no limit, and a swap of 0 leaves
+// memory.swap.max untouched. OCI swap is the combined memory+swap limit,
+// while memory.swap.max only covers swap, so the memory limit is
+// subtracted from it.
+func buildMemoryFileValues(memory spec.MemoryObject) ([]cgroupFileValue, error) {
+	if memory.Limit == nil && memory.Reservation == nil && memory.Swap == nil {
+		return nil, nil
+	}
+
+	var limit int64
+	if memory.Limit != nil {
+		limit = *memory.Limit
+	}
+	if limit < -1 {
+		return nil, fmt.Errorf("invalid memory limit: %d", limit)
+	}
+	values := []cgroupFileValue{
+		{"memory", "memory.max", limitValue(limit)},
+	}
+
+	if memory.Reservation != nil {
+		if *memory.Reservation < 0 {
+			return nil, fmt.Errorf("invalid memory reservation: %d", *memory.Reservation)
+		}
+		values = append(values, cgroupFileValue{"memory", "memory.low", strconv.FormatInt(*memory.Reservation, 10)})
+	}
+
+	if memory.Swap != nil && *memory.Swap != 0 {
+		swap, err := memorySwapValue(*memory.Swap, limit)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, cgroupFileValue{"memory", "memory.swap.max", swap})
+	}
+
+	return values, nil
+}
+
+// memorySwapValue converts an OCI memory+swap limit into a memory.swap.max
+// value.
+func memorySwapValue(swap int64, limit int64) (string, error) {
+	switch {
+	case swap == -1:
+		return cgroupMax, nil
+	case limit <= 0:
+		return "", fmt.Errorf("memory swap %d requires a memory limit", swap)
+	case swap < limit:
+		return "", fmt.Errorf("memory swap %d must not be lower than memory limit %d", swap, limit)
+	}
+	return strconv.FormatInt(swap-limit, 10), nil
+}
+
+// buildCpuFileValues maps cpu.shares, cpu.quota/cpu.period and
+// cpu.cpus/cpu.mems onto cpu.weight, cpu.max and cpuset.cpus/cpuset.mems.
+func buildCpuFileValues(cpu spec.CpuObject) ([]cgroupFileValue, error) {
+	var values []cgroupFileValue
+
+	// cpu.weight
+	if cpu.Shares != nil && *cpu.Shares != 0 {
+		if *cpu.Shares < 2 || *cpu.Shares > 262144 {
+			return nil, fmt.Errorf("invalid cpu shares: %d (must be 2-262144)", *cpu.Shares)
+		}
+		values = append(values, cgroupFileValue{"cpu", "cpu.weight", strconv.FormatUint(cpuSharesToWeight(*cpu.Shares), 10)})
+	}
+
+	// cpu.max
+	if cpu.Quota != nil || cpu.Period != nil {
+		quota := cgroupMax
+		if cpu.Quota != nil && *cpu.Quota > 0 {
+			quota = strconv.FormatInt(*cpu.Quota, 10)
+		}
+		period := uint64(defaultCpuPeriod)
+		if cpu.Period != nil && *cpu.Period != 0 {
+			period = *cpu.Period
+		}
+		values = append(values, cgroupFileValue{"cpu", "cpu.max", fmt.Sprintf("%s %d", quota, period)})
+	}
+
+	// cpuset
+	//   an empty value resets it to the effective value of the parent
+	if cpu.Cpus != nil {
+		values = append(values, cgroupFileValue{"cpuset", "cpuset.cpus", *cpu.Cpus})
+	}
+	if cpu.Mems != nil {
+		values = append(values, cgroupFileValue{"cpuset", "cpuset.mems", *cpu.Mems})
+	}
+
+	return values, nil
+}
+
+// cpuSharesToWeight converts cgroup v1 cpu.shares [2-262144] into cgroup v2
+// cpu.weight [1-10000], keeping the default of 1024 shares close to the
+// default weight of 100.
+func cpuSharesToWeight(shares uint64) uint64 {
+	return 1 + ((shares-2)*9999)/262142
+}
+
+// blkioWeightToIOWeight converts cgroup v1 blkio.weight [10-1000] into
+// cgroup v2 io.weight [1-10000].
+func blkioWeightToIOWeight(weight uint16) uint64 {
+	return 1 + (uint64(weight)-10)*9999/990
+}
+
+// buildIOFileValues maps linux.resources.blockIO onto io.weight and io.max.
+func buildIOFileValues(blockIO spec.BlockIOObject) ([]cgroupFileValue, error) {
+	var values []cgroupFileValue
+
+	validWeight := func(w uint16) error {
+		if w < 10 || w > 1000 {
+			return fmt.Errorf("invalid blkio weight: %d (must be 10-1000)", w)
+		}
+		return nil
+	}
+
+	// io.weight
+	if blockIO.Weight != nil && *blockIO.Weight != 0 {
+		if err := validWeight(*blockIO.Weight); err != nil {
+			return nil, err
+		}
+		values = append(values, cgroupFileValue{"io", "io.weight", fmt.Sprintf("default %d", blkioWeightToIOWeight(*blockIO.Weight))})
+	}
+	for _, d := range blockIO.WeightDevice {
+		if d.Weight == nil {
+			continue
+		}
+		if err := validWeight(*d.Weight); err != nil {
+			return nil, err
+		}
+		values = append(values, cgroupFileValue{"io", "io.weight", fmt.Sprintf("%d:%d %d", d.Major, d.Minor, blkioWeightToIOWeight(*d.Weight))})
+	}
+
+	// io.max
+	throttles := []struct {
+		key     string
+		devices []spec.ThrottleDeviceObject
+	}{
+		{"rbps", blockIO.ThrottleReadBpsDevice},
+		{"wbps", blockIO.ThrottleWriteBpsDevice},
+		{"riops", blockIO.ThrottleReadIOPSDevice},
+		{"wiops", blockIO.ThrottleWriteIOPSDevice},
+	}
+	for _, t := range throttles {
+		for _, d := range t.devices {
+			rate := cgroupMax
+			if d.Rate != 0 {
+				rate = strconv.FormatUint(d.Rate, 10)
+			}
+			values = append(values, cgroupFileValue{"io", "io.max", fmt.Sprintf("%d:%d %s=%s", d.Major, d.Minor, t.key, rate)})
+		}
+	}
+
+	return values, nil
+}
+
+// buildUnifiedFileValues maps the linux.resources.unified key/value map
+// onto cgroup interface files.
+//
+// Keys must be plain file names of the form <controller>.<name>; keys
+// starting with "cgroup." are core files and need no controller. Entries
+// are sorted by key so that writes happen in a stable order.
+func buildUnifiedFileValues(unified map[string]string) ([]cgroupFileValue, error) {
+	keys := make([]string, 0, len(unified))
+	for k := range unified {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var values []cgroupFileValue
+	for _, k := range keys {
+		if k != filepath.Base(k) || strings.HasPrefix(k, ".") || !strings.Contains(k, ".") {
+			return nil, fmt.Errorf("invalid unified resource key: %q", k)
+		}
+		controller := strings.SplitN(k, ".", 2)[0]
+		if controller == "cgroup" {
+			controller = ""
+		}
+		values = append(values, cgroupFileValue{controller, k, unified[k]})
+	}
+	return values, nil
+}
+
+// limitValue formats a limit where 0 and negative values mean unlimited.
+func limitValue(limit int64) string {
+	if limit <= 0 {
+		return cgroupMax
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+// mergeResources returns base with every field that is set in update
+// applied on top of it.
+//
+// Scalar limits and cpuset strings replace the base value only when set;
+// an empty cpuset string clears it.
+// pids and blockIO are replaced as a whole, hugepage limits are merged by
+// page size and unified entries are merged by key.
+func mergeResources(base spec.ResourceObject, update spec.ResourceObject) spec.ResourceObject {
+	merged := base
+
+	// memory
+	if update.Memory.Limit != nil {
+		merged.Memory.Limit = update.Memory.Limit
+	}
+	if update.Memory.Reservation != nil {
+		merged.Memory.Reservation = update.Memory.Reservation
+	}
+	if update.Memory.Swap != nil {
+		merged.Memory.Swap = update.Memory.Swap
+	}
+
+	// cpu
+	if update.Cpu.Shares != nil {
+		merged.Cpu.Shares = update.Cpu.Shares
+	}
+	if update.Cpu.Quota != nil {
+		merged.Cpu.Quota = update.Cpu.Quota
+	}
+	if update.Cpu.Period != nil {
+		merged.Cpu.Period = update.Cpu.Period
+	}
+	if update.Cpu.Cpus != nil {
+		merged.Cpu.Cpus = update.Cpu.Cpus
+	}
+	if update.Cpu.Mems != nil {
+		merged.Cpu.Mems = update.Cpu.Mems
+	}
+
+	// pids, blockIO
+	if update.Pids != nil {
+		merged.Pids = update.Pids
+	}
+	if update.BlockIO != nil {
+		merged.BlockIO = update.BlockIO
+	}
+
+	// hugetlb
+	if len(update.HugepageLimits) > 0 {
+		hugepageLimits := append([]spec.HugepageLimitObject{}, base.HugepageLimits...)
+		for _, h := range update.HugepageLimits {
+			replaced := false
+			for i := range hugepageLimits {
+				if hugepageLimits[i].PageSize == h.PageSize {
+					hugepageLimits[i] = h
+					replaced = true
+				}
+			}
+			if !replaced {
+				hugepageLimits = append(hugepageLimits, h)
+			}
+		}
+		merged.HugepageLimits = hugepageLimits
+	}
+
+	// unified
+	if len(update.Unified) > 0 {
+		unified := map[string]string{}
+		for k, v := range base.Unified {
+			unified[k] = v
+		}
+		for k, v := range update.Unified {
+			unified[k] = v
+		}
+		merged.Unified = unified
+	}
+
+	return merged
+}
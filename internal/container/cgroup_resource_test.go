@@ -0,0 +1,122 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildCgroupFileValues_Success(t *testing.T) {
+	// == arrange ==
+	limit := int64(1073741824)
+	swap := int64(2147483648)
+	shares := uint64(1024)
+	quota := int64(50000)
+	weight := uint16(500)
+	cpus := "0-1"
+	resources := spec.ResourceObject{
+		Memory: spec.MemoryObject{Limit: &limit, Swap: &swap},
+		Cpu:    spec.CpuObject{Shares: &shares, Quota: &quota, Cpus: &cpus},
+		Pids:   &spec.PidsObject{Limit: 0},
+		BlockIO: &spec.BlockIOObject{
+			Weight:                &weight,
+			ThrottleReadBpsDevice: []spec.ThrottleDeviceObject{{Major: 8, Minor: 0, Rate: 1048576}},
+		},
+		HugepageLimits: []spec.HugepageLimitObject{{PageSize: "2MB", Limit: 4194304}},
+		Unified:        map[string]string{"memory.high": "900000000"},
+	}
+
+	// == act ==
+	values, err := buildCgroupFileValues(resources)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []cgroupFileValue{
+		{"memory", "memory.max", "1073741824"},
+		{"memory", "memory.swap.max", "1073741824"},
+		{"cpu", "cpu.weight", "39"},
+		{"cpu", "cpu.max", "50000 100000"},
+		{"cpuset", "cpuset.cpus", "0-1"},
+		{"pids", "pids.max", "max"},
+		{"io", "io.weight", "default 4950"},
+		{"io", "io.max", "8:0 rbps=1048576"},
+		{"hugetlb", "hugetlb.2MB.max", "4194304"},
+		{"memory", "memory.high", "900000000"},
+	}, values)
+}
+
+func TestBuildCgroupFileValues_UnsetMeansMax(t *testing.T) {
+	// == arrange ==
+	zero := int64(0)
+	period := uint64(100000)
+	resources := spec.ResourceObject{
+		Memory: spec.MemoryObject{Limit: &zero},
+		Cpu:    spec.CpuObject{Period: &period},
+	}
+
+	// == act ==
+	values, err := buildCgroupFileValues(resources)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []cgroupFileValue{
+		{"memory", "memory.max", "max"},
+		{"cpu", "cpu.max", "max 100000"},
+	}, values)
+}
+
+func TestCheckControllers_NotEnabled(t *testing.T) {
+	// == arrange ==
+	parent := t.TempDir()
+	_ = os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("cpu memory\n"), 0644)
+	controller := &containerCgroupController{}
+	values := []cgroupFileValue{
+		{"memory", "memory.max", "max"},
+		{"pids", "pids.max", "512"},
+	}
+
+	// == act ==
+	err := controller.checkControllers(filepath.Join(parent, "111111"), values)
+
+	// == assert ==
+	assert.EqualError(t, err, `cgroup controller "pids" is required for pids.max but not enabled in `+filepath.Join(parent, "cgroup.subtree_control"))
+}
+
+func TestMergeResources(t *testing.T) {
+	// == arrange ==
+	limit := int64(1073741824)
+	newLimit := int64(536870912)
+	quota := int64(80000)
+	period := uint64(100000)
+	cpus := "0"
+	mems := "0"
+	cleared := ""
+	base := spec.ResourceObject{
+		Memory:  spec.MemoryObject{Limit: &limit},
+		Cpu:     spec.CpuObject{Quota: &quota, Period: &period, Mems: &mems},
+		Pids:    &spec.PidsObject{Limit: 512},
+		Unified: map[string]string{"memory.high": "900000000"},
+	}
+	update := spec.ResourceObject{
+		Memory:  spec.MemoryObject{Limit: &newLimit},
+		Cpu:     spec.CpuObject{Cpus: &cpus, Mems: &cleared},
+		Unified: map[string]string{"pids.max": "64"},
+	}
+
+	// == act ==
+	merged := mergeResources(base, update)
+
+	// == assert ==
+	assert.Equal(t, newLimit, *merged.Memory.Limit)
+	assert.Equal(t, quota, *merged.Cpu.Quota)
+	assert.Equal(t, period, *merged.Cpu.Period)
+	assert.Equal(t, "0", *merged.Cpu.Cpus)
+	assert.Equal(t, "", *merged.Cpu.Mems)
+	assert.Equal(t, int64(512), merged.Pids.Limit)
+	assert.Equal(t, map[string]string{"memory.high": "900000000", "pids.max": "64"}, merged.Unified)
+	assert.Equal(t, limit, *base.Memory.Limit)
+	assert.Equal(t, map[string]string{"memory.high": "900000000"}, base.Unified)
+}
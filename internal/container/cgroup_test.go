@@ -0,0 +1,87 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnableSubtreeControllers_Success(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("cpuset cpu io memory pids\n"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("cpu\n"), 0644))
+	controller := newContainerCgroupController()
+
+	// == act ==
+	err := controller.enableSubtreeControllers(dir, []string{"cpu", "memory", "pids"})
+
+	// == assert ==
+	assert.Nil(t, err)
+	data, _ := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	assert.Equal(t, "+memory +pids\n", string(data))
+}
+
+func TestEnableSubtreeControllers_NotAvailable(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("cpu memory\n"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte(""), 0644))
+	controller := newContainerCgroupController()
+
+	// == act ==
+	err := controller.enableSubtreeControllers(dir, []string{"hugetlb"})
+
+	// == assert ==
+	assert.EqualError(t, err, `cgroup controller "hugetlb" is not available in `+dir)
+}
+
+func TestReadCgroupProcs_Success(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte("12\n345\n"), 0644))
+
+	// == act ==
+	pids, err := readCgroupProcs(dir)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []int{12, 345}, pids)
+}
+
+func TestSignalCgroup_CgroupKill(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte(""), 0644))
+	controller := newContainerCgroupController()
+
+	// == act ==
+	err := controller.signalCgroup(dir, syscall.SIGKILL)
+
+	// == assert ==
+	assert.Nil(t, err)
+	data, _ := os.ReadFile(filepath.Join(dir, "cgroup.kill"))
+	assert.Equal(t, "1\n", string(data))
+}
+
+func TestReadCgroupTreeProcs_Nested(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	child := filepath.Join(dir, "child")
+	assert.Nil(t, os.Mkdir(child, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte("10\n"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(child, "cgroup.procs"), []byte("20\n21\n"), 0644))
+
+	// == act ==
+	dirs, dirsErr := listCgroupTree(dir)
+	pids, pidsErr := readCgroupTreeProcs(dir)
+
+	// == assert ==
+	assert.Nil(t, dirsErr)
+	assert.Equal(t, []string{dir, child}, dirs)
+	assert.Nil(t, pidsErr)
+	assert.Equal(t, []int{10, 20, 21}, pids)
+}
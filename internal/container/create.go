@@ -2,7 +2,9 @@ package container
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"strconv"
 	"strings"
@@ -25,9 +27,17 @@ func NewContainerCreator() *ContainerCreator {
 		fifoCreator:              newContainerFifoHandler(),
 		processExecutor:          newContainerInitExecutor(),
 		containerNetworkPreparer: newContainerNetworkController(),
+		containerNetworkRemover:  newContainerNetworkController(),
+		networkModeResolver:      newNetworkModeResolver(),
+		addressAllocator:         newContainerAddressAllocator(),
+		etcFileGenerator:         newContainerEtcFileGenerator(),
 		containerCgroupPreparer:  newContainerCgroupController(),
+		containerCgroupRemover:   newContainerCgroupController(),
 		containerStatusManager:   status.NewStatusHandler(),
 		containerHookController:  hook.NewHookController(),
+		userNsAllocator:          newUserNsAllocator(),
+		fifoRemover:              newContainerFifoHandler(),
+		syscallHandler:           utils.NewSyscallHandler(),
 	}
 }
 
@@ -36,8 +46,9 @@ func NewContainerCreator() *ContainerCreator {
 // the container init process workflow.
 func newContainerInitExecutor() *containerInitExecutor {
 	return &containerInitExecutor{
-		commandFactory: &utils.ExecCommandFactory{},
-		syscallHandler: utils.NewSyscallHandler(),
+		commandFactory:         &utils.ExecCommandFactory{},
+		syscallHandler:         utils.NewSyscallHandler(),
+		containerCgroupStarter: newContainerCgroupController(),
 	}
 }
 
@@ -46,15 +57,29 @@ func newContainerInitExecutor() *containerInitExecutor {
 //
 // The flow currently consists of:
 //
-//  1. Loading the OCI spec (config.json)
-//  2. Creating the initial state.json (status=creating, pid=0)
+//  1. Loading the OCI spec (config.json) and resolving its network mode
+//  2. Leasing the addresses of its interfaces and creating the initial
+//     state.json (status=creating, pid=0)
 //  3. Running createRuntime hooks
 //  4. Creating the FIFO used for init synchronization
-//  5. Launching the init process via the init subcommand
-//  6. Configuring cgroups for the init process
+//  5. Creating the cgroup and applying resource limits
+//  6. Launching the init process via the init subcommand, directly
+//     inside the cgroup
 //  7. Configuring network for the init process
-//  8. Updating state.json (status=created, pid=init pid)
-//  9. Running createContainer hooks
+//  8. Generating resolv.conf, hosts and hostname, which the init process
+//     bind-mounts when the container is started
+//  9. Updating state.json (status=created, pid=init pid, user namespace
+//     range, network mode)
+//  10. Running createContainer hooks
+//
+// If a step fails, everything acquired by the previous steps is rolled
+// back in reverse order: the init (and shim) process is killed, the
+// host-side veth, the cgroup and the FIFO are removed, the user namespace
+// id range and the leased addresses are released and state.json is
+// removed, so that no half-created container is left behind. Only what
+// this call acquired is released: a container that already has a
+// state.json is rejected before anything is acquired, and leases or id
+// ranges recorded before the call are kept.
 //
 // Each step is delegated to an interface to allow testing and substitution.
 type ContainerCreator struct {
@@ -62,9 +87,17 @@ type ContainerCreator struct {
 	fifoCreator              fifoCreator
 	processExecutor          processExecutor
 	containerNetworkPreparer containerNetworkPreparer
+	containerNetworkRemover  containerNetworkRemover
+	networkModeResolver      networkModeResolver
+	addressAllocator         addressAllocator
+	etcFileGenerator         etcFileGenerator
 	containerCgroupPreparer  containerCgroupPreparer
+	containerCgroupRemover   containerCgroupRemover
 	containerStatusManager   status.ContainerStatusManager
 	containerHookController  hook.ContainerHookController
+	userNsAllocator          userNsRangeManager
+	fifoRemover              fifoRemover
+	syscallHandler           utils.KernelSyscallHandler
 }
 
 // Create executes the container creation pipeline for the given container ID.
@@ -73,18 +106,30 @@ type ContainerCreator struct {
 //   - Loading the spec
 //   - Initializing container state
 //   - Running lifecycle hooks
+//   - Applying cgroup configuration
 //   - Spawning the init process
-//   - Applying cgroup and network configuration
+//   - Applying network configuration
 //   - Updating final status
 //
 // This method performs no low-level work itself and relies entirely on
-// its collaborators. If any step fails, the error is returned immediately.
+// its collaborators. If any step fails, the error is returned after the
+// resources acquired so far are rolled back.
 func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 	var (
-		spec  spec.Spec
-		event = "create"
-		stage string
-		pid   int
+		spec             spec.Spec
+		event            = "create"
+		stage            string
+		pid              int
+		initPid          int
+		shimPid          int
+		userNs           *logs.UserNsInfo
+		leasedInterfaces []string
+		stateCreated     bool
+		fifoCreated      bool
+		cgroupStarted    bool
+		userNsHeld       bool
+		processStarted   bool
+		networkStarted   bool
 	)
 
 	// audit log
@@ -98,31 +143,99 @@ func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 			Event:       event,
 			Stage:       stage,
 			Pid:         pid,
+			UserNs:      userNs,
 			Spec:        &spec,
 			Result:      result,
 			Error:       err,
 		})
 	}()
 
+	// rollback
+	//   deferred in the order of acquisition, so that they run in reverse,
+	//   and limited to what this call acquired
+	defer func() {
+		if err != nil && stateCreated {
+			_ = c.containerStatusManager.RemoveStatusFile(opt.ContainerId)
+		}
+	}()
+	defer func() {
+		if err != nil && len(leasedInterfaces) > 0 {
+			_ = c.addressAllocator.releaseInterfaces(opt.ContainerId, leasedInterfaces)
+		}
+	}()
+	defer func() {
+		if err != nil && fifoCreated {
+			_ = c.fifoRemover.removeFifo(utils.FifoPath(opt.ContainerId))
+		}
+	}()
+	defer func() {
+		// the id range is allocated while the process attributes are built
+		if err != nil && processStarted && !userNsHeld {
+			_ = c.userNsAllocator.release(opt.ContainerId)
+		}
+	}()
+	defer func() {
+		if err != nil && cgroupStarted {
+			_ = c.containerCgroupRemover.remove(opt.ContainerId, spec)
+		}
+	}()
+	defer func() {
+		if err != nil && networkStarted {
+			_ = c.containerNetworkRemover.remove(opt.ContainerId, spec)
+		}
+	}()
+	defer func() {
+		if err != nil && processStarted {
+			c.killCreatedProcesses(initPid, shimPid)
+		}
+	}()
+
 	// 1. load config.json
 	stage = "load_spec"
 	spec, err = c.specSecureLoad(opt.ContainerId)
 	if err != nil {
 		return err
 	}
+	stage = "resolve_network_mode"
+	networkMode, err := c.networkModeResolver.resolve(opt.ContainerId, &spec)
+	if err != nil {
+		return err
+	}
 
-	// 2. create state.json
+	// 2. lease addresses and create state.json
 	//      status = creating
 	//      pid = 0
-	stage = "create_state"
-	err = c.containerStatusManager.CreateStatusFile(
-		opt.ContainerId,
-		0,
-		status.CREATING,
-		spec.Root.Path,
-		utils.ContainerDir(opt.ContainerId),
-		spec.Annotations,
-	)
+	//    under the state lock, so that network prune does not release the
+	//    leases before state.json exists. Nothing is acquired for an
+	//    existing container.
+	err = utils.WithFileLock(utils.ContainerStateLockPath(opt.ContainerId), func() error {
+		stage = "check_state"
+		if err := checkContainerNotExists(opt.ContainerId); err != nil {
+			return err
+		}
+
+		stage = "allocate_address"
+		leased, err := c.addressAllocator.allocate(opt.ContainerId, &spec)
+		leasedInterfaces = leased
+		if err != nil {
+			return err
+		}
+
+		stage = "create_state"
+		err = c.containerStatusManager.CreateStatusFile(
+			opt.ContainerId,
+			0,
+			status.CREATING,
+			spec.Root.Path,
+			utils.ContainerDir(opt.ContainerId),
+			spec.Annotations,
+		)
+		if err != nil {
+			return err
+		}
+		stateCreated = true
+		return nil
+	})
 	if err != nil {
 		return err
 	}
@@ -144,12 +257,24 @@ func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 	if err != nil {
 		return err
 	}
+	fifoCreated = true
 
-	// 5. execute init subcommand
-	var (
-		initPid int
-		shimPid int
-	)
+	// 5. cgroup setup
+	stage = "setup_cgroup"
+	cgroupStarted = true
+	err = c.containerCgroupPreparer.prepare(opt.ContainerId, spec)
+	if err != nil {
+		return err
+	}
+
+	// 6. execute init subcommand
+	//      a user namespace id range recorded before is not ours to release
+	stage = "lookup_userns"
+	_, userNsHeld, err = c.userNsAllocator.lookup(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	processStarted = true
 	if opt.TtyFlag {
 		// cleanup old files before execute shim
 		stage = "cleanup_shim_file"
@@ -180,22 +305,24 @@ func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 		}
 		initPid = pid
 	}
+	userNs = readUserNsInfo(initPid)
 
-	// 6. cgroup setup
-	stage = "setup_cgroup"
-	err = c.containerCgroupPreparer.prepare(opt.ContainerId, spec, initPid)
+	// 7. network setup
+	stage = "setup_network"
+	networkStarted = true
+	err = c.containerNetworkPreparer.prepare(opt.ContainerId, initPid, spec)
 	if err != nil {
 		return err
 	}
 
-	// 7. network setup
-	stage = "setup_network"
-	err = c.containerNetworkPreparer.prepare(opt.ContainerId, initPid, spec.Annotations)
+	// 8. generate /etc files
+	stage = "generate_etc_files"
+	err = c.etcFileGenerator.generate(opt.ContainerId, spec, nil)
 	if err != nil {
 		return err
 	}
 
-	// 8. update state.json
+	// 9. update state.json
 	//      status = created
 	//      pid    = init pid
 	stage = "update_state"
@@ -208,8 +335,18 @@ func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 	if err != nil {
 		return err
 	}
+	stage = "update_state_userns"
+	err = c.recordUserNsAllocation(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	stage = "update_state_network_mode"
+	err = c.containerStatusManager.SetNetworkMode(opt.ContainerId, networkMode.String())
+	if err != nil {
+		return err
+	}
 
-	// 9. HOOK: createContainer
+	// 10. HOOK: createContainer
 	stage = "hook_create_container"
 	err = c.containerHookController.RunCreateContainerHooks(
 		opt.ContainerId,
@@ -221,6 +358,43 @@ func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 	return nil
 }
 
+// killCreatedProcesses sends SIGKILL to the init and shim processes of a
+// container whose creation failed. Processes that are already gone, or
+// were never started (pid 0), are ignored.
+func (c *ContainerCreator) killCreatedProcesses(initPid int, shimPid int) {
+	for _, pid := range []int{initPid, shimPid} {
+		if pid > 0 {
+			_ = c.syscallHandler.Kill(pid, signalMap["KILL"])
+		}
+	}
+}
+
+// checkContainerNotExists returns an error if the container already has
+// a state.json. It must be called with the state lock held.
+func checkContainerNotExists(containerId string) error {
+	_, err := os.Stat(utils.ContainerStatePath(containerId))
+	if err == nil {
+		return fmt.Errorf("container %s already exists", containerId)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// recordUserNsAllocation writes the host id range allocated to the
+// container's user namespace, if any, into state.json.
+func (c *ContainerCreator) recordUserNsAllocation(containerId string) error {
+	allocation, ok, err := c.userNsAllocator.lookup(containerId)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return c.containerStatusManager.SetUserNamespace(containerId, allocation.HostID, allocation.Size)
+}
+
 func (c *ContainerCreator) specSecureLoad(containerId string) (spec.Spec, error) {
 	fileHashPath := utils.ConfigFileHashPath(containerId)
 
@@ -288,16 +462,17 @@ type processExecutor interface {
 // It invokes this binary with the `init` subcommand and the FIFO path,
 // passing the spec's process args as the container entrypoint.
 type containerInitExecutor struct {
-	commandFactory utils.CommandFactory
-	syscallHandler utils.KernelSyscallHandler
+	commandFactory         utils.CommandFactory
+	syscallHandler         utils.KernelSyscallHandler
+	containerCgroupStarter containerCgroupStarter
 }
 
 // executeInit starts the init process and returns its PID.
 //
 // The init process is started as a child of the current runtime binary
-// with the appropriate namespace and process attributes applied. The FIFO
-// path is passed as an argument so that the init process can synchronize
-// with the runtime before proceeding.
+// with the appropriate namespace and process attributes applied, directly
+// inside the container cgroup. The FIFO path is passed as an argument so
+// that the init process can synchronize with the runtime before proceeding.
 func (c *containerInitExecutor) executeInit(containerId string, spec spec.Spec, fifo string) (int, error) {
 	// retrieve entrypoint from spec
 	entrypoint := spec.Process.Args
@@ -316,13 +491,29 @@ func (c *containerInitExecutor) executeInit(containerId string, spec spec.Spec,
 
 	// apply SysProcAttr
 	nsConfig := buildNamespaceConfig(spec)
-	procAttr := buildProcAttrForRootContainer(nsConfig)
+	procAttr, err := buildProcAttrForRootContainer(containerId, spec, nsConfig)
+	if err != nil {
+		return -1, err
+	}
 	sysProcAttr := buildSysProcAttr(procAttr)
 	sysProcAttr.Setsid = true
 	cmd.SetSysProcAttr(sysProcAttr)
 
-	// execute init subcommand
-	if err := cmd.Start(); err != nil {
+	// hand runtime files over to the remapped container root
+	if err := chownForRemappedRoot(containerId, spec.Annotations.Image, procAttr.uidMap, procAttr.gidMap); err != nil {
+		return -1, err
+	}
+	auditLog, err := passAuditLog(cmd)
+	if err != nil {
+		return -1, err
+	}
+	defer auditLog.Close()
+	if err := passNetnsPath(cmd, spec); err != nil {
+		return -1, err
+	}
+
+	// execute init subcommand inside the container cgroup
+	if err := c.containerCgroupStarter.start(cmd, containerId, spec); err != nil {
 		return -1, err
 	}
 
@@ -0,0 +1,162 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"droplet/internal/hook"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProcessExecutor struct {
+	cmd *exec.Cmd
+}
+
+func (f *fakeProcessExecutor) executeInit(containerId string, spec spec.Spec, fifo string) (int, error) {
+	if err := f.cmd.Start(); err != nil {
+		return 0, err
+	}
+	return f.cmd.Process.Pid, nil
+}
+
+func (f *fakeProcessExecutor) executeShim(containerId string, spec spec.Spec, fifo string) (int, error) {
+	return f.executeInit(containerId, spec, fifo)
+}
+
+type fakeNetworkModeResolver struct{}
+
+func (f *fakeNetworkModeResolver) resolve(containerId string, containerSpec *spec.Spec) (networkMode, error) {
+	return networkMode{kind: networkModeNone}, nil
+}
+
+type fakeNetworkPreparer struct{}
+
+func (f *fakeNetworkPreparer) prepare(containerId string, pid int, containerSpec spec.Spec) error {
+	return nil
+}
+
+type fakeNetworkRemoverRecorder struct {
+	removed []string
+}
+
+func (f *fakeNetworkRemoverRecorder) remove(containerId string, containerSpec spec.Spec) error {
+	f.removed = append(f.removed, containerId)
+	return nil
+}
+
+type fakeCgroupPreparer struct{}
+
+func (f *fakeCgroupPreparer) prepare(containerId string, spec spec.Spec) error {
+	return nil
+}
+
+type fakeEtcFileGenerator struct {
+	err error
+}
+
+func (f *fakeEtcFileGenerator) generate(containerId string, containerSpec spec.Spec, files *spec.NetworkFilesObject) error {
+	return f.err
+}
+
+func TestContainerCreate_RollbackOnLateFailure(t *testing.T) {
+	// == arrange ==
+	setupTestRootDir(t)
+	containerId := "111111"
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir(containerId), 0700))
+	assert.Nil(t, os.WriteFile(utils.ConfigFilePath(containerId), []byte("{}"), 0600))
+	initCmd := exec.Command("sleep", "60")
+	networkRemover := &fakeNetworkRemoverRecorder{}
+	cgroupRemover := &fakeCgroupRemover{}
+	userNsAllocator := &fakeUserNsRangeManager{}
+	addressAllocator := &fakeContainerAddressAllocator{leased: []string{"rd_111111"}}
+	creator := &ContainerCreator{
+		specLoader:               &fakeSpecLoader{spec: buildAuditableSpec()},
+		fifoCreator:              newContainerFifoHandler(),
+		processExecutor:          &fakeProcessExecutor{cmd: initCmd},
+		containerNetworkPreparer: &fakeNetworkPreparer{},
+		containerNetworkRemover:  networkRemover,
+		networkModeResolver:      &fakeNetworkModeResolver{},
+		addressAllocator:         addressAllocator,
+		etcFileGenerator:         &fakeEtcFileGenerator{err: errors.New("write hosts failed")},
+		containerCgroupPreparer:  &fakeCgroupPreparer{},
+		containerCgroupRemover:   cgroupRemover,
+		containerStatusManager:   status.NewStatusHandler(),
+		containerHookController:  hook.NewHookController(),
+		userNsAllocator:          userNsAllocator,
+		fifoRemover:              newContainerFifoHandler(),
+		syscallHandler:           utils.NewSyscallHandler(),
+	}
+
+	// == act ==
+	err := creator.Create(CreateOption{ContainerId: containerId})
+
+	// == assert ==
+	assert.EqualError(t, err, "write hosts failed")
+	waitErr := initCmd.Wait()
+	var exitErr *exec.ExitError
+	assert.True(t, errors.As(waitErr, &exitErr))
+	assert.Equal(t, syscall.SIGKILL, exitErr.Sys().(syscall.WaitStatus).Signal())
+	assert.Equal(t, []string{containerId}, networkRemover.removed)
+	assert.Equal(t, []string{containerId}, cgroupRemover.removed)
+	assert.Equal(t, []string{containerId}, userNsAllocator.released)
+	assert.Equal(t, []string{"rd_111111"}, addressAllocator.releasedInterfaces)
+	assert.Nil(t, addressAllocator.released)
+	_, fifoErr := os.Stat(utils.FifoPath(containerId))
+	assert.True(t, os.IsNotExist(fifoErr))
+	_, stateErr := os.Stat(utils.ContainerStatePath(containerId))
+	assert.True(t, os.IsNotExist(stateErr))
+}
+
+func TestContainerCreate_ExistingContainer(t *testing.T) {
+	// == arrange ==
+	setupTestRootDir(t)
+	containerId := "111111"
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir(containerId), 0700))
+	assert.Nil(t, os.WriteFile(utils.ConfigFilePath(containerId), []byte("{}"), 0600))
+	statusManager := status.NewStatusHandler()
+	assert.Nil(t, statusManager.CreateStatusFile(containerId, 4242, status.RUNNING, "/rootfs", "/bundle", spec.AnnotationObject{}))
+	networkRemover := &fakeNetworkRemoverRecorder{}
+	cgroupRemover := &fakeCgroupRemover{}
+	userNsAllocator := &fakeUserNsRangeManager{}
+	addressAllocator := &fakeContainerAddressAllocator{leased: []string{"rd_111111"}}
+	creator := &ContainerCreator{
+		specLoader:               &fakeSpecLoader{spec: buildAuditableSpec()},
+		fifoCreator:              newContainerFifoHandler(),
+		processExecutor:          &fakeProcessExecutor{cmd: exec.Command("sleep", "60")},
+		containerNetworkPreparer: &fakeNetworkPreparer{},
+		containerNetworkRemover:  networkRemover,
+		networkModeResolver:      &fakeNetworkModeResolver{},
+		addressAllocator:         addressAllocator,
+		etcFileGenerator:         &fakeEtcFileGenerator{},
+		containerCgroupPreparer:  &fakeCgroupPreparer{},
+		containerCgroupRemover:   cgroupRemover,
+		containerStatusManager:   statusManager,
+		containerHookController:  hook.NewHookController(),
+		userNsAllocator:          userNsAllocator,
+		fifoRemover:              newContainerFifoHandler(),
+		syscallHandler:           utils.NewSyscallHandler(),
+	}
+
+	// == act ==
+	err := creator.Create(CreateOption{ContainerId: containerId})
+
+	// == assert ==
+	assert.EqualError(t, err, "container 111111 already exists")
+	assert.Nil(t, addressAllocator.allocated)
+	assert.Nil(t, addressAllocator.releasedInterfaces)
+	assert.Nil(t, addressAllocator.released)
+	assert.Nil(t, userNsAllocator.released)
+	assert.Nil(t, cgroupRemover.removed)
+	assert.Nil(t, networkRemover.removed)
+	var statusObject status.StatusObject
+	assert.Nil(t, utils.ReadJsonFile(utils.ContainerStatePath(containerId), &statusObject))
+	assert.Equal(t, status.RUNNING.String(), statusObject.Status)
+	assert.Equal(t, 4242, statusObject.Pid)
+}
@@ -7,6 +7,7 @@ import (
 	"droplet/internal/status"
 	"droplet/internal/utils"
 	"fmt"
+	"syscall"
 )
 
 // NewContainerDelete constructs a ContainerDelete with the default
@@ -19,6 +20,11 @@ func NewContainerDelete() *ContainerDelete {
 		containerStatusManager:  status.NewStatusHandler(),
 		containerHookController: hook.NewHookController(),
 		syscallHandler:          utils.NewSyscallHandler(),
+		userNsAllocator:         newUserNsAllocator(),
+		containerCgroupRemover:  newContainerCgroupController(),
+		containerCgroupKiller:   newContainerCgroupController(),
+		containerNetworkRemover: newContainerNetworkController(),
+		addressAllocator:        newContainerAddressAllocator(),
 	}
 }
 
@@ -27,7 +33,12 @@ func NewContainerDelete() *ContainerDelete {
 // It is responsible for:
 //   - Validating the current container status
 //   - Loading the OCI spec (for hooks)
+//   - Killing the processes of a created, or force deleted, container
 //   - Executing poststop hooks
+//   - Removing the container cgroup
+//   - Removing the host-side network interface
+//   - Releasing the user namespace id range allocated to the container
+//   - Releasing the addresses leased to the container
 //   - Removing the container state file
 //
 // Low-level operations are delegated to its collaborators so that
@@ -40,19 +51,33 @@ type ContainerDelete struct {
 	containerStatusManager  status.ContainerStatusManager
 	containerHookController hook.ContainerHookController
 	syscallHandler          utils.KernelSyscallHandler
+	userNsAllocator         userNsRangeManager
+	containerCgroupRemover  containerCgroupRemover
+	containerCgroupKiller   containerCgroupKiller
+	containerNetworkRemover containerNetworkRemover
+	addressAllocator        addressAllocator
 }
 
 // Delete executes the container deletion pipeline for the given container ID.
 //
 // The workflow is:
-//  1. Check the container status and fail if it is still running
+//  1. Check the container status and fail if it is still running or
+//     paused, unless opt.Force is set
 //  2. Load the OCI spec (config.json)
-//  3. Run poststop hooks
-//  4. Remove the container state file (state.json)
-//  5. Remove the FIFO if the container status is created
+//  3. Kill every process in the container cgroup if the container is
+//     created, or running/paused and opt.Force is set
+//  4. Run poststop hooks
+//  5. Record the OOM counters of the cgroup
+//  6. Remove the container cgroup, killing any process left in it
+//  7. Remove the host-side veth of the container
+//  8. Release the user namespace id range allocated to the container
+//  9. Release the addresses leased to the container
+//  10. Remove the FIFO, if any
+//  11. Remove the container state file (state.json)
 //
 // If any step fails, the error is returned immediately and subsequent
-// steps are not executed.
+// steps are not executed. Every step can be repeated and state.json is
+// removed last, so a failed delete can be run again.
 func (c *ContainerDelete) Delete(opt DeleteOption) (err error) {
 	var (
 		spec  spec.Spec
@@ -85,21 +110,13 @@ func (c *ContainerDelete) Delete(opt DeleteOption) (err error) {
 		return err
 	}
 
-	// if status is running, return error
+	// if status is running or paused, return error unless forced
 	stage = "check_status"
-	if containerStatus == status.RUNNING {
+	active := containerStatus == status.RUNNING || containerStatus == status.PAUSED
+	if active && !opt.Force {
 		return fmt.Errorf("container: %s is not stopped. current status: %s", opt.ContainerId, containerStatus)
 	}
 
-	// if status is created, kill init process before delete container
-	stage = "kill_process_before_remove"
-	if containerStatus == status.CREATED {
-		err = c.killInitProcess(opt.ContainerId)
-		if err != nil {
-			return fmt.Errorf("kill init process failed: %w", err)
-		}
-	}
-
 	// 2. load config.json
 	stage = "load_spec"
 	spec, err = c.specLoader.loadFile(opt.ContainerId)
@@ -107,7 +124,18 @@ func (c *ContainerDelete) Delete(opt DeleteOption) (err error) {
 		return err
 	}
 
-	// 3. HOOK: poststop
+	// 3. kill processes
+	//    if status is created, or running/paused with --force,
+	//    kill every process before delete container
+	stage = "kill_process_before_remove"
+	if containerStatus == status.CREATED || active {
+		err = c.killContainerProcesses(opt.ContainerId, spec)
+		if err != nil {
+			return fmt.Errorf("kill container processes failed: %w", err)
+		}
+	}
+
+	// 4. HOOK: poststop
 	stage = "hook_poststop"
 	err = c.containerHookController.RunPoststopHooks(
 		opt.ContainerId,
@@ -117,37 +145,81 @@ func (c *ContainerDelete) Delete(opt DeleteOption) (err error) {
 		return err
 	}
 
-	// 4. remove state.json
-	stage = "remove_state"
-	err = c.containerStatusManager.RemoveStatusFile(opt.ContainerId)
+	// 5. record oom events
+	//      memory.events is gone once the cgroup is removed
+	stage = "check_oom"
+	recordOOMEvents(c.containerStatusManager, opt.ContainerId, spec)
+
+	// 6. remove cgroup
+	stage = "remove_cgroup"
+	err = c.containerCgroupRemover.remove(opt.ContainerId, spec)
+	if err != nil {
+		return err
+	}
+
+	// 7. remove network
+	stage = "remove_network"
+	err = c.containerNetworkRemover.remove(opt.ContainerId, spec)
 	if err != nil {
 		return err
 	}
 
-	// 5. remove exec.fifo if status is created
+	// 8. release user namespace id range
+	stage = "release_userns"
+	err = c.userNsAllocator.release(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+
+	// 9. release addresses
+	stage = "release_address"
+	err = c.addressAllocator.release(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+
+	// 10. remove exec.fifo
+	//       it is left by a created container, and by a delete that
+	//       failed after killing it
 	stage = "remove_fifo"
-	if containerStatus == status.CREATED {
-		err = c.fifoHandler.removeFifo(utils.FifoPath(opt.ContainerId))
-		if err != nil {
-			return err
-		}
+	err = c.fifoHandler.removeFifo(utils.FifoPath(opt.ContainerId))
+	if err != nil && !c.syscallHandler.IsNotExist(err) {
+		return err
+	}
+
+	// 11. remove state.json
+	//       last, so that a failed delete can be retried
+	stage = "remove_state"
+	err = c.containerStatusManager.RemoveStatusFile(opt.ContainerId)
+	if err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func (c *ContainerDelete) killInitProcess(containerId string) error {
+// killContainerProcesses sends SIGKILL to the init process and to every
+// other process in the container cgroup, so that no stray process
+// survives the deletion, and marks the container as stopped.
+func (c *ContainerDelete) killContainerProcesses(containerId string, spec spec.Spec) error {
 	containerPid, containerPidErr := c.containerStatusManager.GetPidFromId(containerId)
 	if containerPidErr != nil {
 		return containerPidErr
 	}
 
 	// 1. send signal to pid
-	if err := c.syscallHandler.Kill(containerPid, signalMap["KILL"]); err != nil {
+	if containerPid > 0 {
+		if err := c.syscallHandler.Kill(containerPid, signalMap["KILL"]); err != nil && err != syscall.ESRCH {
+			return err
+		}
+	}
+
+	// 2. send signal to cgroup
+	if err := c.containerCgroupKiller.kill(containerId, spec, signalMap["KILL"]); err != nil && !c.syscallHandler.IsNotExist(err) {
 		return err
 	}
 
-	// 2. update status file
+	// 3. update status file
 	//      status = stopped
 	//      pid = 0
 	//		shimPid = 0
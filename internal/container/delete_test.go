@@ -0,0 +1,136 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"droplet/internal/hook"
+	"droplet/internal/logs"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSpecLoader struct {
+	spec spec.Spec
+}
+
+func (f *fakeSpecLoader) loadFile(containerId string) (spec.Spec, error) {
+	return f.spec, nil
+}
+
+type fakeCgroupRemover struct {
+	removed []string
+}
+
+func (f *fakeCgroupRemover) remove(containerId string, spec spec.Spec) error {
+	f.removed = append(f.removed, containerId)
+	return nil
+}
+
+type fakeNetworkRemover struct{}
+
+func (f *fakeNetworkRemover) remove(containerId string, containerSpec spec.Spec) error {
+	return nil
+}
+
+type fakeUserNsRangeManager struct {
+	userNsRangeManager
+	held       bool
+	releaseErr error
+	released   []string
+}
+
+func (f *fakeUserNsRangeManager) lookup(containerId string) (userNsAllocation, bool, error) {
+	return userNsAllocation{}, f.held, nil
+}
+
+func (f *fakeUserNsRangeManager) release(containerId string) error {
+	if f.releaseErr != nil {
+		return f.releaseErr
+	}
+	f.released = append(f.released, containerId)
+	return nil
+}
+
+type fakeContainerAddressAllocator struct {
+	leased             []string
+	allocated          []string
+	released           []string
+	releasedInterfaces []string
+}
+
+func (f *fakeContainerAddressAllocator) allocate(containerId string, containerSpec *spec.Spec) ([]string, error) {
+	f.allocated = append(f.allocated, containerId)
+	return f.leased, nil
+}
+
+func (f *fakeContainerAddressAllocator) release(containerId string) error {
+	f.released = append(f.released, containerId)
+	return nil
+}
+
+func (f *fakeContainerAddressAllocator) releaseInterfaces(containerId string, ifaces []string) error {
+	f.releasedInterfaces = append(f.releasedInterfaces, ifaces...)
+	return nil
+}
+
+// setupTestRootDir points the runtime root directory and the audit log
+// at a temporary directory.
+func setupTestRootDir(t *testing.T) string {
+	tmp := t.TempDir()
+	t.Setenv("RAIND_ROOT_DIR", tmp)
+	logger, err := logs.OpenFileLogger(filepath.Join(tmp, "audit.log"), 0)
+	assert.Nil(t, err)
+	logs.AuditLogger = logger
+	return tmp
+}
+
+// buildAuditableSpec returns the smallest spec the audit log accepts.
+func buildAuditableSpec() spec.Spec {
+	return spec.Spec{
+		Process:   spec.ProcessObject{Args: []string{"/bin/sh"}},
+		LinuxSpec: spec.LinuxSpecObject{Seccomp: &spec.SeccompObject{}},
+	}
+}
+
+func TestContainerDelete_RetryAfterFailedRelease(t *testing.T) {
+	// == arrange ==
+	setupTestRootDir(t)
+	containerId := "111111"
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir(containerId), 0700))
+	statusHandler := status.NewStatusHandler()
+	assert.Nil(t, statusHandler.CreateStatusFile(containerId, 0, status.STOPPED, "/rootfs", "/bundle", spec.AnnotationObject{}))
+	userNsAllocator := &fakeUserNsRangeManager{releaseErr: errors.New("lock failed")}
+	addressAllocator := &fakeContainerAddressAllocator{}
+	deleter := &ContainerDelete{
+		specLoader:              &fakeSpecLoader{spec: buildAuditableSpec()},
+		fifoHandler:             newContainerFifoHandler(),
+		containerStatusManager:  statusHandler,
+		containerHookController: hook.NewHookController(),
+		syscallHandler:          utils.NewSyscallHandler(),
+		userNsAllocator:         userNsAllocator,
+		containerCgroupRemover:  &fakeCgroupRemover{},
+		containerNetworkRemover: &fakeNetworkRemover{},
+		addressAllocator:        addressAllocator,
+	}
+
+	// == act ==
+	err_1 := deleter.Delete(DeleteOption{ContainerId: containerId})
+	_, statErr_1 := os.Stat(utils.ContainerStatePath(containerId))
+	userNsAllocator.releaseErr = nil
+	err_2 := deleter.Delete(DeleteOption{ContainerId: containerId})
+	_, statErr_2 := os.Stat(utils.ContainerStatePath(containerId))
+
+	// == assert ==
+	assert.EqualError(t, err_1, "lock failed")
+	assert.Nil(t, statErr_1)
+	assert.Nil(t, err_2)
+	assert.True(t, os.IsNotExist(statErr_2))
+	assert.Equal(t, []string{containerId}, userNsAllocator.released)
+	assert.Equal(t, []string{containerId}, addressAllocator.released)
+}
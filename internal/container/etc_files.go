@@ -0,0 +1,277 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// files under /etc of the container generated by the runtime
+const (
+	etcResolvConf = "resolv.conf"
+	etcHosts      = "hosts"
+	etcHostname   = "hostname"
+)
+
+// newContainerEtcFileGenerator constructs a containerEtcFileGenerator
+// that falls back to the resolver configuration of the host.
+func newContainerEtcFileGenerator() *containerEtcFileGenerator {
+	return &containerEtcFileGenerator{
+		hostResolvConfPath: "/etc/resolv.conf",
+	}
+}
+
+// etcFileGenerator defines the behavior required to write the resolv.conf,
+// hosts and hostname files that are bind-mounted into the container.
+type etcFileGenerator interface {
+	generate(containerId string, containerSpec spec.Spec, files *spec.NetworkFilesObject) error
+}
+
+// containerEtcFileGenerator is the default implementation of
+// etcFileGenerator. The files are written to the etc directory of the
+// container directory.
+type containerEtcFileGenerator struct {
+	hostResolvConfPath string
+}
+
+// generate writes the /etc files of the container from the spec.
+//
+//	resolv.conf = dns servers, search and options of the annotation; each
+//	              of them defaults to the one of the host
+//	hosts       = localhost, the container addresses and the extra hosts
+//	hostname    = hostname of the spec
+//
+// files, if not nil, replaces the dns and extra hosts of the annotation.
+// Files are rewritten in place so that a running container sees the new
+// content through its bind mount. A skipped file is removed.
+func (g *containerEtcFileGenerator) generate(containerId string, containerSpec spec.Spec, files *spec.NetworkFilesObject) error {
+	networkConfig, err := spec.ParseNetConfig(containerSpec.Annotations)
+	if err != nil {
+		return err
+	}
+	if files != nil {
+		if files.Dns != nil {
+			networkConfig.Dns = *files.Dns
+		}
+		if files.ExtraHosts != nil {
+			networkConfig.ExtraHosts = files.ExtraHosts
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(utils.ContainerEtcFilePath(containerId, etcHosts)), 0755); err != nil {
+		return err
+	}
+
+	for _, name := range networkConfig.SkipFiles {
+		switch name {
+		case etcResolvConf, etcHosts, etcHostname:
+		default:
+			return fmt.Errorf("invalid skip file: %q", name)
+		}
+	}
+
+	managed := managedEtcFiles(containerSpec, networkConfig)
+	for _, name := range []string{etcResolvConf, etcHosts, etcHostname} {
+		path := utils.ContainerEtcFilePath(containerId, name)
+		if !managed[name] {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+
+		var content []byte
+		switch name {
+		case etcResolvConf:
+			content, err = g.buildResolvConf(networkConfig.Dns)
+		case etcHosts:
+			content, err = buildHosts(containerSpec.Hostname, containerAddresses(containerId, networkConfig), networkConfig.ExtraHosts)
+		case etcHostname:
+			content = []byte(containerSpec.Hostname + "\n")
+		}
+		if err != nil {
+			return fmt.Errorf("generate %s: %w", name, err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildResolvConf returns resolv.conf with the dns settings, taking the
+// settings left empty from the resolv.conf of the host.
+func (g *containerEtcFileGenerator) buildResolvConf(dns spec.DnsObject) ([]byte, error) {
+	if len(dns.Servers) == 0 || len(dns.Search) == 0 || len(dns.Options) == 0 {
+		host, err := parseResolvConf(g.hostResolvConfPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(dns.Servers) == 0 {
+			dns.Servers = host.Servers
+		}
+		if len(dns.Search) == 0 {
+			dns.Search = host.Search
+		}
+		if len(dns.Options) == 0 {
+			dns.Options = host.Options
+		}
+	}
+
+	var b bytes.Buffer
+	for _, server := range dns.Servers {
+		if net.ParseIP(server) == nil {
+			return nil, fmt.Errorf("invalid dns server: %s", server)
+		}
+		fmt.Fprintf(&b, "nameserver %s\n", server)
+	}
+	if len(dns.Search) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(dns.Search, " "))
+	}
+	if len(dns.Options) > 0 {
+		fmt.Fprintf(&b, "options %s\n", strings.Join(dns.Options, " "))
+	}
+	return b.Bytes(), nil
+}
+
+// buildHosts returns the hosts file of the container. The hostname maps
+// to the container addresses, or to 127.0.1.1 if it has none.
+func buildHosts(hostname string, addresses []string, extraHosts []spec.HostObject) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("127.0.0.1\tlocalhost\n")
+	b.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	if hostname != "" {
+		if len(addresses) == 0 {
+			addresses = []string{"127.0.1.1"}
+		}
+		for _, address := range addresses {
+			fmt.Fprintf(&b, "%s\t%s\n", address, hostname)
+		}
+	}
+	for _, h := range extraHosts {
+		if net.ParseIP(h.Address) == nil || h.Hostname == "" {
+			return nil, fmt.Errorf("invalid host entry: %s:%s", h.Hostname, h.Address)
+		}
+		fmt.Fprintf(&b, "%s\t%s\n", h.Address, h.Hostname)
+	}
+	return b.Bytes(), nil
+}
+
+// parseResolvConf reads the nameserver, search and options lines of a
+// resolv.conf. A missing file yields empty settings.
+func parseResolvConf(path string) (spec.DnsObject, error) {
+	var dns spec.DnsObject
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return dns, nil
+		}
+		return dns, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			dns.Servers = append(dns.Servers, fields[1])
+		case "search":
+			dns.Search = fields[1:]
+		case "options":
+			dns.Options = append(dns.Options, fields[1:]...)
+		}
+	}
+	return dns, scanner.Err()
+}
+
+// managedEtcFiles returns the /etc files generated and mounted for the
+// container: every file not skipped in the annotation, and hostname only
+// if the spec has one.
+func managedEtcFiles(containerSpec spec.Spec, networkConfig spec.NetConfigObject) map[string]bool {
+	managed := map[string]bool{
+		etcResolvConf: true,
+		etcHosts:      true,
+		etcHostname:   containerSpec.Hostname != "",
+	}
+	for _, name := range networkConfig.SkipFiles {
+		managed[name] = false
+	}
+	return managed
+}
+
+// etcFileMounts returns the bind mounts of the generated /etc files.
+func etcFileMounts(containerId string, containerSpec spec.Spec) ([]spec.MountObject, error) {
+	networkConfig, err := spec.ParseNetConfig(containerSpec.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	managed := managedEtcFiles(containerSpec, networkConfig)
+
+	var mounts []spec.MountObject
+	for _, name := range []string{etcResolvConf, etcHostname, etcHosts} {
+		if !managed[name] {
+			continue
+		}
+		mounts = append(mounts, spec.MountObject{
+			Destination: "/etc/" + name,
+			Type:        "bind",
+			Source:      utils.ContainerEtcFilePath(containerId, name),
+			Options: []string{
+				"rbind",
+				"rprivate",
+			},
+		})
+	}
+	return mounts, nil
+}
+
+// containerAddresses returns the addresses of the container interfaces
+// without prefix length: those of the annotation, or those of the CNI
+// result with the cni backend.
+func containerAddresses(containerId string, networkConfig spec.NetConfigObject) []string {
+	var addresses []string
+	appendAddress := func(cidr string) {
+		if ip, _, err := net.ParseCIDR(cidr); err == nil {
+			addresses = append(addresses, ip.String())
+		}
+	}
+
+	if networkConfig.Backend == networkBackendCni {
+		resultFile, err := readCniResult(containerId)
+		if err != nil || resultFile.Result == nil {
+			return nil
+		}
+		var result struct {
+			Ips []struct {
+				Address string `json:"address"`
+			} `json:"ips"`
+		}
+		if err := json.Unmarshal(resultFile.Result, &result); err != nil {
+			return nil
+		}
+		for _, ip := range result.Ips {
+			appendAddress(ip.Address)
+		}
+		return addresses
+	}
+
+	for _, i := range networkConfig.Interfaces {
+		appendAddress(i.IPv4.Address)
+		if i.IPv6 != nil {
+			appendAddress(i.IPv6.Address)
+		}
+	}
+	return addresses
+}
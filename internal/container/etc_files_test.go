@@ -0,0 +1,135 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEtcFileGenerator(t *testing.T) *containerEtcFileGenerator {
+	tmp := t.TempDir()
+	t.Setenv("RAIND_ROOT_DIR", tmp)
+	hostResolvConf := filepath.Join(tmp, "resolv.conf")
+	assert.Nil(t, os.WriteFile(hostResolvConf, []byte("# host\nnameserver 192.168.1.1\nsearch home.lan\noptions edns0\n"), 0644))
+	return &containerEtcFileGenerator{hostResolvConfPath: hostResolvConf}
+}
+
+func buildEtcFileSpec(hostname string, net string) spec.Spec {
+	return spec.Spec{
+		Hostname:    hostname,
+		Annotations: spec.AnnotationObject{Version: "0.2.0", Net: net},
+	}
+}
+
+func readEtcFile(t *testing.T, name string) string {
+	data, err := os.ReadFile(utils.ContainerEtcFilePath("111111", name))
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func TestEtcFileGenerate_ResolvConfHostFallback(t *testing.T) {
+	// == arrange ==
+	generator := newTestEtcFileGenerator(t)
+	containerSpec := buildEtcFileSpec("", `{"dns":{"servers":["8.8.8.8"],"options":["ndots:2"]}}`)
+
+	// == act ==
+	err := generator.generate("111111", containerSpec, nil)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, "nameserver 8.8.8.8\nsearch home.lan\noptions ndots:2\n", readEtcFile(t, etcResolvConf))
+}
+
+func TestEtcFileGenerate_Hosts(t *testing.T) {
+	// == arrange ==
+	generator := newTestEtcFileGenerator(t)
+	containerSpec := buildEtcFileSpec("web", `{
+		"mode":"bridge",
+		"interfaces":[{"name":"eth0","bridgeInterface":"raind0","ipv4":{"address":"10.166.0.2/24"}}],
+		"extraHosts":[{"hostname":"db","address":"10.166.0.3"}]
+	}`)
+
+	// == act ==
+	err := generator.generate("111111", containerSpec, nil)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1\tlocalhost\n"+
+		"::1\tlocalhost ip6-localhost ip6-loopback\n"+
+		"10.166.0.2\tweb\n"+
+		"10.166.0.3\tdb\n", readEtcFile(t, etcHosts))
+	assert.Equal(t, "web\n", readEtcFile(t, etcHostname))
+}
+
+func TestEtcFileGenerate_Override(t *testing.T) {
+	// == arrange ==
+	generator := newTestEtcFileGenerator(t)
+	containerSpec := buildEtcFileSpec("", `{"dns":{"servers":["8.8.8.8"]}}`)
+	files := &spec.NetworkFilesObject{
+		Dns:        &spec.DnsObject{Servers: []string{"1.1.1.1"}, Search: []string{"corp"}, Options: []string{"rotate"}},
+		ExtraHosts: []spec.HostObject{{Hostname: "cache", Address: "10.0.0.9"}},
+	}
+
+	// == act ==
+	err := generator.generate("111111", containerSpec, files)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, "nameserver 1.1.1.1\nsearch corp\noptions rotate\n", readEtcFile(t, etcResolvConf))
+	assert.Contains(t, readEtcFile(t, etcHosts), "10.0.0.9\tcache\n")
+}
+
+func TestEtcFileGenerate_SkipFile(t *testing.T) {
+	// == arrange ==
+	generator := newTestEtcFileGenerator(t)
+	assert.Nil(t, generator.generate("111111", buildEtcFileSpec("web", `{}`), nil))
+	containerSpec := buildEtcFileSpec("web", `{"skipFiles":["hosts"]}`)
+
+	// == act ==
+	err := generator.generate("111111", containerSpec, nil)
+	mounts, mountErr := etcFileMounts("111111", containerSpec)
+
+	// == assert ==
+	assert.Nil(t, err)
+	_, statErr := os.Stat(utils.ContainerEtcFilePath("111111", etcHosts))
+	assert.True(t, os.IsNotExist(statErr))
+	assert.Nil(t, mountErr)
+	assert.Len(t, mounts, 2)
+	assert.Equal(t, "/etc/resolv.conf", mounts[0].Destination)
+	assert.Equal(t, "/etc/hostname", mounts[1].Destination)
+}
+
+func TestEtcFileGenerate_InvalidSkipFile(t *testing.T) {
+	// == arrange ==
+	generator := newTestEtcFileGenerator(t)
+	containerSpec := buildEtcFileSpec("", `{"skipFiles":["passwd"]}`)
+
+	// == act ==
+	err := generator.generate("111111", containerSpec, nil)
+
+	// == assert ==
+	assert.EqualError(t, err, `invalid skip file: "passwd"`)
+}
+
+func TestMergeNetworkFiles(t *testing.T) {
+	// == arrange ==
+	current := spec.NetworkFilesObject{
+		Dns:        &spec.DnsObject{Servers: []string{"8.8.8.8"}, Search: []string{"corp"}},
+		ExtraHosts: []spec.HostObject{{Hostname: "db", Address: "10.0.0.3"}},
+	}
+	requested := spec.NetworkFilesObject{
+		Dns: &spec.DnsObject{Servers: []string{"1.1.1.1"}},
+	}
+
+	// == act ==
+	merged := mergeNetworkFiles(current, requested)
+
+	// == assert ==
+	assert.Equal(t, []string{"1.1.1.1"}, merged.Dns.Servers)
+	assert.Equal(t, []string{"corp"}, merged.Dns.Search)
+	assert.Equal(t, current.ExtraHosts, merged.ExtraHosts)
+}
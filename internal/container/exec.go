@@ -2,6 +2,7 @@ package container
 
 import (
 	"droplet/internal/logs"
+	"droplet/internal/spec"
 	"droplet/internal/status"
 	"droplet/internal/utils"
 	"fmt"
@@ -16,9 +17,11 @@ import (
 // runs an additional process inside an existing container.
 func NewContainerExec() *ContainerExec {
 	return &ContainerExec{
+		specLoader:             newFileSpecLoader(),
 		commandFactory:         utils.NewCommandFactory(),
 		containerStatusManager: status.NewStatusHandler(),
 		syscallHandler:         utils.NewSyscallHandler(),
+		containerCgroupStarter: newContainerCgroupController(),
 	}
 }
 
@@ -29,14 +32,17 @@ func NewContainerExec() *ContainerExec {
 //   - Verifying the container is in the RUNNING state
 //   - Resolving the container’s init process PID
 //   - Entering the container namespaces via nsenter
+//   - Placing the process in the container cgroup
 //   - Executing the requested command (optionally in interactive mode)
 //
 // Responsibility for low-level execution details is delegated to
 // its collaborators to keep the workflow testable.
 type ContainerExec struct {
+	specLoader             specLoader
 	commandFactory         utils.CommandFactory
 	containerStatusManager status.ContainerStatusManager
 	syscallHandler         utils.KernelSyscallHandler
+	containerCgroupStarter containerCgroupStarter
 }
 
 // Exec runs the given entrypoint inside the target container.
@@ -45,7 +51,7 @@ type ContainerExec struct {
 //  1. Verify that the container is RUNNING
 //  2. Look up the container’s PID from state.json
 //  3. Construct an nsenter invocation targeting that PID and namespaces
-//  4. Start the command
+//  4. Start the command inside the container cgroup
 //  5. If interactive mode is enabled, attach stdio and wait for completion
 //
 // If any step fails, execution stops and the error is returned.
@@ -82,6 +88,9 @@ func (c *ContainerExec) Exec(opt ExecOption) (err error) {
 	}
 
 	stage = "check_status"
+	if containerStatus == status.PAUSED {
+		return fmt.Errorf("container: %s is paused. resume it before exec", opt.ContainerId)
+	}
 	if containerStatus != status.RUNNING {
 		return fmt.Errorf("container: %s not running.", opt.ContainerId)
 	}
@@ -93,7 +102,15 @@ func (c *ContainerExec) Exec(opt ExecOption) (err error) {
 		return err
 	}
 
-	// 3. prepare entrypoint with nsenter
+	// 3. load config.json
+	//    linux.cgroupsPath is needed to place the process in the cgroup
+	stage = "load_spec"
+	spec, err := c.specLoader.loadFile(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+
+	// 4. prepare entrypoint with nsenter
 	if opt.Tty {
 		stage = "exec_shim"
 		err = c.executeShim(containerPid, opt)
@@ -102,7 +119,7 @@ func (c *ContainerExec) Exec(opt ExecOption) (err error) {
 		}
 	} else {
 		stage = "exec_nsenter"
-		err = c.executeNsenter(containerPid, opt)
+		err = c.executeNsenter(containerPid, spec, opt)
 		if err != nil {
 			return err
 		}
@@ -111,7 +128,7 @@ func (c *ContainerExec) Exec(opt ExecOption) (err error) {
 	return nil
 }
 
-func (c *ContainerExec) executeNsenter(containerPid int, opt ExecOption) error {
+func (c *ContainerExec) executeNsenter(containerPid int, spec spec.Spec, opt ExecOption) error {
 	nsenterCommand := []string{"nsenter", "-t", strconv.Itoa(containerPid), "--all"}
 	commandStr := slices.Concat(nsenterCommand, opt.Entrypoint)
 	cmd := c.commandFactory.Command(commandStr[0], commandStr[1:]...)
@@ -124,8 +141,8 @@ func (c *ContainerExec) executeNsenter(containerPid int, opt ExecOption) error {
 	cmd.SetStdout(f)
 	cmd.SetStderr(f)
 
-	// execute entrypoint
-	if err := cmd.Start(); err != nil {
+	// execute entrypoint inside the container cgroup
+	if err := c.containerCgroupStarter.start(cmd, opt.ContainerId, spec); err != nil {
 		return err
 	}
 
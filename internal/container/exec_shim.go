@@ -21,14 +21,16 @@ import (
 
 func NewContainerExecShim() *ContainerExecShim {
 	return &ContainerExecShim{
-		specLoader:     newFileSpecLoader(),
-		commandFactory: &utils.ExecCommandFactory{},
+		specLoader:             newFileSpecLoader(),
+		commandFactory:         &utils.ExecCommandFactory{},
+		containerCgroupStarter: newContainerCgroupController(),
 	}
 }
 
 type ContainerExecShim struct {
-	specLoader     specLoader
-	commandFactory utils.CommandFactory
+	specLoader             specLoader
+	commandFactory         utils.CommandFactory
+	containerCgroupStarter containerCgroupStarter
 }
 
 func (c *ContainerExecShim) Execute(containerId string, containerPid string, entrypoint []string) (err error) {
@@ -65,6 +67,14 @@ func (c *ContainerExecShim) Execute(containerId string, containerPid string, ent
 	defer shimLog.Close()
 	logger := log.New(shimLog, "exec_shim: ", log.LstdFlags|log.Lmicroseconds)
 
+	// load config.json
+	stage = "load_spec"
+	spec, err = c.specLoader.loadFile(containerId)
+	if err != nil {
+		logger.Printf("load spec failed: %v", err)
+		return err
+	}
+
 	// 1. remove old file
 	stage = "remove_old_socket"
 	sockPath := utils.ExecSockPath(containerId)
@@ -104,9 +114,9 @@ func (c *ContainerExecShim) Execute(containerId string, containerPid string, ent
 		Ctty:    0,
 	})
 
-	// 5. execute nsenter command
+	// 5. execute nsenter command inside the container cgroup
 	stage = "exec_command"
-	err = cmd.Start()
+	err = c.containerCgroupStarter.start(cmd, containerId, spec)
 	if err != nil {
 		logger.Printf("nsenter failed: %v", err)
 		return err
@@ -0,0 +1,223 @@
+package container
+
+import (
+	"droplet/internal/logs"
+	"droplet/internal/spec"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	subUidPath = "/etc/subuid"
+	subGidPath = "/etc/subgid"
+)
+
+// subIDRange is a single subordinate id range allocated to a host user in
+// /etc/subuid or /etc/subgid.
+type subIDRange struct {
+	start uint32
+	count uint32
+}
+
+// toSysProcIDMap converts OCI id mappings into the form expected by
+// syscall.SysProcAttr.
+func toSysProcIDMap(mappings []spec.IDMappingObject) []syscall.SysProcIDMap {
+	idMap := make([]syscall.SysProcIDMap, 0, len(mappings))
+	for _, m := range mappings {
+		idMap = append(idMap, syscall.SysProcIDMap{
+			ContainerID: int(m.ContainerID),
+			HostID:      int(m.HostID),
+			Size:        int(m.Size),
+		})
+	}
+	return idMap
+}
+
+// validateIDMappings checks a list of uid or gid mappings before it is
+// handed to the kernel.
+//
+// Each mapping must have a non-zero size, container-side and host-side
+// ranges must not overlap each other, and every host-side range must be
+// fully contained in one of the subordinate ranges allocated to the host
+// user.
+func validateIDMappings(kind string, mappings []spec.IDMappingObject, allowed []subIDRange) error {
+	for i, m := range mappings {
+		if m.Size == 0 {
+			return fmt.Errorf("%s mapping[%d]: size must be greater than 0", kind, i)
+		}
+		if uint64(m.ContainerID)+uint64(m.Size) > 1<<32 || uint64(m.HostID)+uint64(m.Size) > 1<<32 {
+			return fmt.Errorf("%s mapping[%d]: range exceeds 32-bit id space", kind, i)
+		}
+
+		// overlap with previous mappings
+		for j := 0; j < i; j++ {
+			prev := mappings[j]
+			if rangesOverlap(m.ContainerID, m.Size, prev.ContainerID, prev.Size) {
+				return fmt.Errorf("%s mapping[%d]: container range %d-%d overlaps mapping[%d]",
+					kind, i, m.ContainerID, uint64(m.ContainerID)+uint64(m.Size)-1, j)
+			}
+			if rangesOverlap(m.HostID, m.Size, prev.HostID, prev.Size) {
+				return fmt.Errorf("%s mapping[%d]: host range %d-%d overlaps mapping[%d]",
+					kind, i, m.HostID, uint64(m.HostID)+uint64(m.Size)-1, j)
+			}
+		}
+
+		// host range must be within the subordinate id allocation
+		if !rangeAllowed(m.HostID, m.Size, allowed) {
+			return fmt.Errorf("%s mapping[%d]: host range %d-%d is not allocated to the runtime user",
+				kind, i, m.HostID, uint64(m.HostID)+uint64(m.Size)-1)
+		}
+	}
+	return nil
+}
+
+// rangesOverlap reports whether [aStart, aStart+aSize) and
+// [bStart, bStart+bSize) share at least one id.
+func rangesOverlap(aStart uint32, aSize uint32, bStart uint32, bSize uint32) bool {
+	aEnd := uint64(aStart) + uint64(aSize)
+	bEnd := uint64(bStart) + uint64(bSize)
+	return uint64(aStart) < bEnd && uint64(bStart) < aEnd
+}
+
+// rangeAllowed reports whether [start, start+size) is fully contained in
+// one of the allowed subordinate ranges.
+func rangeAllowed(start uint32, size uint32, allowed []subIDRange) bool {
+	end := uint64(start) + uint64(size)
+	for _, r := range allowed {
+		if uint64(start) >= uint64(r.start) && end <= uint64(r.start)+uint64(r.count) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSubIDRanges reads the subordinate id ranges allocated to the current
+// host user from path (/etc/subuid or /etc/subgid).
+//
+// Entries are matched either by user name or by numeric uid, following
+// the format name:start:count.
+func loadSubIDRanges(path string) ([]subIDRange, error) {
+	uid := strconv.Itoa(os.Getuid())
+	names := []string{uid}
+	if u, err := user.LookupId(uid); err == nil {
+		names = append(names, u.Username)
+	}
+	return parseSubIDFile(path, names)
+}
+
+// parseSubIDFile parses a subuid/subgid style file and returns the ranges
+// that belong to any of the given owner names.
+func parseSubIDFile(path string, owners []string) ([]subIDRange, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed: %w", path, err)
+	}
+
+	var ranges []subIDRange
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid entry in %s: %q", path, line)
+		}
+		owned := false
+		for _, o := range owners {
+			if parts[0] == o {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			continue
+		}
+		start, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry in %s: %q", path, line)
+		}
+		count, err := strconv.ParseUint(parts[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry in %s: %q", path, line)
+		}
+		ranges = append(ranges, subIDRange{start: uint32(start), count: uint32(count)})
+	}
+	return ranges, nil
+}
+
+// formatIDMap renders id mappings in the "containerID:hostID:size" form
+// used by the audit log, separated by commas.
+func formatIDMap(idMap []syscall.SysProcIDMap) string {
+	entries := make([]string, 0, len(idMap))
+	for _, m := range idMap {
+		entries = append(entries, fmt.Sprintf("%d:%d:%d", m.ContainerID, m.HostID, m.Size))
+	}
+	return strings.Join(entries, ",")
+}
+
+// readUserNsInfo reads the uid_map and gid_map actually installed for the
+// given process and returns them as audit information.
+//
+// A nil value is returned when the process is not running in a separate
+// user namespace or its maps cannot be read.
+func readUserNsInfo(pid int) *logs.UserNsInfo {
+	if pid <= 0 {
+		return nil
+	}
+	selfNs, err := os.Readlink("/proc/self/ns/user")
+	if err != nil {
+		return nil
+	}
+	pidNs, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/user", pid))
+	if err != nil || pidNs == selfNs {
+		return nil
+	}
+
+	uidMap, err := readProcIDMap(fmt.Sprintf("/proc/%d/uid_map", pid))
+	if err != nil {
+		return nil
+	}
+	gidMap, err := readProcIDMap(fmt.Sprintf("/proc/%d/gid_map", pid))
+	if err != nil {
+		return nil
+	}
+	return &logs.UserNsInfo{
+		Enabled: true,
+		UIDMap:  formatIDMap(uidMap),
+		GIDMap:  formatIDMap(gidMap),
+	}
+}
+
+// readProcIDMap parses a /proc/<pid>/uid_map or gid_map file.
+func readProcIDMap(path string) ([]syscall.SysProcIDMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var idMap []syscall.SysProcIDMap
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		var values [3]int
+		for i, f := range fields {
+			v, err := strconv.Atoi(f)
+			if err != nil {
+				return nil, fmt.Errorf("invalid entry in %s: %q", path, line)
+			}
+			values[i] = v
+		}
+		idMap = append(idMap, syscall.SysProcIDMap{
+			ContainerID: values[0],
+			HostID:      values[1],
+			Size:        values[2],
+		})
+	}
+	return idMap, nil
+}
@@ -0,0 +1,74 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"droplet/internal/spec"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateIDMappings_Success(t *testing.T) {
+	// == arrange ==
+	allowed := []subIDRange{{start: 100000, count: 131072}}
+	mappings := []spec.IDMappingObject{
+		{ContainerID: 0, HostID: 100000, Size: 65536},
+		{ContainerID: 65536, HostID: 165536, Size: 65536},
+	}
+
+	// == act ==
+	err := validateIDMappings("uid", mappings, allowed)
+
+	// == assert ==
+	assert.Nil(t, err)
+}
+
+func TestValidateIDMappings_OverlapError(t *testing.T) {
+	// == arrange ==
+	allowed := []subIDRange{{start: 100000, count: 131072}}
+	containerOverlap := []spec.IDMappingObject{
+		{ContainerID: 0, HostID: 100000, Size: 65536},
+		{ContainerID: 1000, HostID: 165536, Size: 10},
+	}
+	hostOverlap := []spec.IDMappingObject{
+		{ContainerID: 0, HostID: 100000, Size: 65536},
+		{ContainerID: 65536, HostID: 100010, Size: 10},
+	}
+
+	// == act ==
+	err_1 := validateIDMappings("uid", containerOverlap, allowed)
+	err_2 := validateIDMappings("uid", hostOverlap, allowed)
+
+	// == assert ==
+	assert.NotNil(t, err_1)
+	assert.NotNil(t, err_2)
+}
+
+func TestValidateIDMappings_ExceedSubIDError(t *testing.T) {
+	// == arrange ==
+	allowed := []subIDRange{{start: 100000, count: 65536}}
+	mappings := []spec.IDMappingObject{
+		{ContainerID: 0, HostID: 100000, Size: 65537},
+	}
+
+	// == act ==
+	err := validateIDMappings("gid", mappings, allowed)
+
+	// == assert ==
+	assert.NotNil(t, err)
+}
+
+func TestParseSubIDFile_Success(t *testing.T) {
+	// == arrange ==
+	path := filepath.Join(t.TempDir(), "subuid")
+	_ = os.WriteFile(path, []byte("root:100000:65536\nalice:200000:65536\n0:300000:1000\n"), 0644)
+
+	// == act ==
+	ranges, err := parseSubIDFile(path, []string{"0", "root"})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []subIDRange{{start: 100000, count: 65536}, {start: 300000, count: 1000}}, ranges)
+}
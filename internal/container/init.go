@@ -112,6 +112,13 @@ func (c *ContainerInit) Execute(opt InitOption) (err error) {
 	}
 
 	// 3. prepare container environment
+	//      the network namespace of container:<id> was resolved on the
+	//      host when the init process was started
+	stage = "apply_netns_path"
+	err = applyPassedNetnsPath(&spec)
+	if err != nil {
+		return err
+	}
 	stage = "prepare"
 	err = c.containerEnvPreparer.prepare(opt.ContainerId, spec)
 	if err != nil {
@@ -252,68 +259,119 @@ type rootContainerEnvPreparer struct {
 // according to the provided OCI spec.
 //
 // The workflow is:
-//  1. Switch to uid=0 (root) inside the user namespace
-//  2. Set the hostname to the container ID from the spec
-//  3. Set up the overlay filesystem based on rootfs and image annotations
-//  4. Mount the configured filesystems
-//  5. Mount standard device files under the new root
-//  6. Create required symbolic links under the new root
-//  7. Perform pivot_root into the container root filesystem
-//  8. Configure Linux capabilities for the process
+//  1. Join the namespaces given by path in the spec
+//  2. Create the time namespace and write linux.timeOffsets
+//  3. Switch to uid=0 (root) inside the user namespace
+//  4. Set the hostname to the container ID from the spec (skipped when the
+//     UTS namespace is joined)
+//  5. Set the process environment variables
+//  6. Apply process.rlimits
+//  7. Apply process.oomScoreAdj
+//  8. Set up the overlay filesystem based on rootfs and image annotations
+//  9. Mount the configured filesystems
+//  10. Mount standard device files under the new root
+//  11. Create required symbolic links under the new root
+//  12. Perform pivot_root into the container root filesystem
+//  13. Switch to the user configured in process.user
+//  14. Configure Linux capabilities for the process
+//  15. Set PR_SET_NO_NEW_PRIVS when process.noNewPrivileges is true
+//  16. Install the seccomp filter
+//  17. Change to the working directory
 //
 // If any step fails, the error is returned immediately and the remaining
 // steps are not executed.
 func (p *rootContainerEnvPreparer) prepare(containerId string, spec spec.Spec) (err error) {
-	// 1. change uid=0(root) inside container
-	err = p.switchToUserNamespaceRoot()
+	// 1. join existing namespaces
+	err = p.joinNamespaces(spec.LinuxSpec.Namespaces)
 	if err != nil {
 		return err
 	}
-	// 2. set hostname
-	err = p.setHostnameToContainerId(spec.Hostname)
+	// 2. create time namespace
+	if buildNamespaceConfig(spec).time {
+		err = p.unshareTimeNamespace(spec.LinuxSpec.TimeOffsets)
+		if err != nil {
+			return err
+		}
+	}
+	// 3. change uid=0(root) inside container
+	err = p.switchToUserNamespaceRoot()
 	if err != nil {
 		return err
 	}
-	// 3. set env
+	// 4. set hostname
+	//    a joined UTS namespace keeps the hostname of its owner
+	if !isNamespaceJoined(spec.LinuxSpec, "uts") {
+		err = p.setHostnameToContainerId(spec.Hostname)
+		if err != nil {
+			return err
+		}
+	}
+	// 5. set env
 	err = p.setEnv(spec.Process.Env)
 	if err != nil {
 		return err
 	}
-	// 4. setup overlay
+	// 6. set rlimits
+	err = p.setRlimits(spec.Process.Rlimits)
+	if err != nil {
+		return err
+	}
+	// 7. set oom_score_adj
+	err = p.setOOMScoreAdj(spec.Process.OOMScoreAdj)
+	if err != nil {
+		return err
+	}
+	// 8. setup overlay
 	if err := p.setupOverlay(spec.Root.Path, spec.Annotations.Image); err != nil {
 		return err
 	}
-	// 5. mount filesystem
-	err = p.mountFilesystem(containerId, spec.Root.Path, spec.Mounts)
+	// 9. mount filesystem
+	etcMounts, err := etcFileMounts(containerId, spec)
 	if err != nil {
 		return err
 	}
-	// 6. mount standard device
+	err = p.mountFilesystem(containerId, spec.Root.Path, spec.Mounts, etcMounts)
+	if err != nil {
+		return err
+	}
+	// 10. mount standard device
 	err = p.mountStdDevice(spec.Root.Path)
 	if err != nil {
 		return err
 	}
-	// 7. create symbolic link
+	// 11. create symbolic link
 	err = p.createSymbolicLink(spec.Root.Path)
 	if err != nil {
 		return err
 	}
-	// 8. pivot_root
+	// 12. pivot_root
 	err = p.pivotRoot(spec.Root.Path)
 	if err != nil {
 		return err
 	}
-	// 9. set capability
+	// 13. switch to process user
+	err = p.setUser(containerId, spec)
+	if err != nil {
+		return err
+	}
+	// 14. set capability
 	err = p.setCapability(spec.Process.Capabilities)
 	if err != nil {
 		return err
 	}
-	// 10. install seccomp (NO_NEW_PRIVS + filter)
+	// 15. set no_new_privs
+	if spec.Process.NoNewPrivileges {
+		err = p.setNoNewPrivileges()
+		if err != nil {
+			return err
+		}
+	}
+	// 16. install seccomp
 	err = p.seccompHandler.InstallDenyFilter(*spec.LinuxSpec.Seccomp)
 	if err != nil {
 		return err
 	}
-	// 12. change current dir
+	// 17. change current dir
 	err = p.syscallHandler.Chdir(spec.Process.Cwd)
 	if err != nil {
 		return err
@@ -322,6 +380,57 @@ func (p *rootContainerEnvPreparer) prepare(containerId string, spec spec.Spec) (
 	return nil
 }
 
+// joinNamespaces moves the init process into the namespaces that have a
+// path in the spec (e.g. /proc/<pid>/ns/net) via setns(2).
+//
+// This runs first so that every later step, and finally the container
+// entrypoint, operates inside the joined namespaces. The calling goroutine
+// is locked to its OS thread by Execute, so the thread that performs the
+// setns is the one that later calls execve.
+func (p *rootContainerEnvPreparer) joinNamespaces(namespaces []spec.NamespaceObject) error {
+	for _, ns := range namespaces {
+		if ns.Path == "" {
+			continue
+		}
+		nstype, ok := joinableNamespaceMap[ns.Type]
+		if !ok {
+			return fmt.Errorf("joining %s namespace by path is not supported", ns.Type)
+		}
+		f, err := p.syscallHandler.OpenFile(ns.Path, os.O_RDONLY, 0)
+		if err != nil {
+			return fmt.Errorf("open %s namespace %s failed: %w", ns.Type, ns.Path, err)
+		}
+		err = p.syscallHandler.Setns(int(f.Fd()), nstype)
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("setns %s namespace %s failed: %w", ns.Type, ns.Path, err)
+		}
+	}
+	return nil
+}
+
+// unshareTimeNamespace creates a new time namespace and applies the clock
+// offsets from linux.timeOffsets.
+//
+// unshare(2) with CLONE_NEWTIME does not move the caller itself; the new
+// namespace is entered by the container entrypoint on execve. The offsets
+// must therefore be written here, before the first process enters the
+// namespace, after which the kernel rejects changes. Entering the namespace
+// on execve needs Linux 5.11 or later, which is checked when the process
+// attributes are built (see checkTimeNamespaceSupport).
+func (p *rootContainerEnvPreparer) unshareTimeNamespace(offsets map[string]spec.TimeOffsetObject) error {
+	if err := p.syscallHandler.Unshare(unix.CLONE_NEWTIME); err != nil {
+		return fmt.Errorf("unshare(CLONE_NEWTIME) failed: %w", err)
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+	if err := p.syscallHandler.WriteFile(timeNsOffsetsPath(), []byte(formatTimeOffsets(offsets)), 0o644); err != nil {
+		return fmt.Errorf("write timens_offsets failed: %w", err)
+	}
+	return nil
+}
+
 // switchToUserNamespaceRoot switches the current process credentials to
 // UID and GID 0 within the active user namespace.
 //
@@ -341,6 +450,113 @@ func (p *rootContainerEnvPreparer) switchToUserNamespaceRoot() error {
 	return nil
 }
 
+// setUser switches the process credentials to the identity configured in
+// the OCI spec's process.user.
+//
+// User and group names are resolved through the container's /etc/passwd
+// and /etc/group, so this must run after pivot_root. Credentials are
+// applied in the order setgroups, setresgid, setresuid and umask.
+// PR_SET_KEEPCAPS keeps the permitted set across the uid change, and the
+// effective set is restored from it so that setCapability can still
+// configure the final capability sets afterwards.
+//
+// The applied identity is written to the audit log, since the record of
+// the init event is only written when init fails.
+func (p *rootContainerEnvPreparer) setUser(containerId string, containerSpec spec.Spec) (err error) {
+	// resolve user/group names inside the container
+	execUser, err := resolveExecUser(containerSpec.Process.User, containerPasswdPath, containerGroupPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			_ = logs.RecordAuditLog(logs.AuditRecord{
+				ContainerId: containerId,
+				Event:       "init",
+				Stage:       "set_user",
+				Pid:         os.Getpid(),
+				User:        execUser.auditInfo(),
+				Spec:        &containerSpec,
+				Result:      "success",
+			})
+		}
+	}()
+
+	// keep permitted capabilities across setresuid
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("prctl(PR_SET_KEEPCAPS) failed: %w", err)
+	}
+	// setgroups
+	if err := p.syscallHandler.Setgroups(execUser.additionalGids); err != nil {
+		return fmt.Errorf("setgroups %v failed: %w", execUser.additionalGids, err)
+	}
+	// setresgid
+	if err := p.syscallHandler.Setresgid(execUser.gid, execUser.gid, execUser.gid); err != nil {
+		return fmt.Errorf("setresgid %d failed: %w", execUser.gid, err)
+	}
+	// setresuid
+	if err := p.syscallHandler.Setresuid(execUser.uid, execUser.uid, execUser.uid); err != nil {
+		return fmt.Errorf("setresuid %d failed: %w", execUser.uid, err)
+	}
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 0, 0, 0, 0); err != nil {
+		return fmt.Errorf("prctl(PR_SET_KEEPCAPS) failed: %w", err)
+	}
+	// umask
+	p.syscallHandler.Umask(execUser.umask)
+
+	// the kernel clears the effective set when leaving uid 0
+	if execUser.uid != 0 {
+		if err := restoreEffectiveCapability(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setRlimits applies the resource limits configured in process.rlimits.
+//
+// All entries are validated before the first setrlimit call. Limits are
+// set while the process is still uid 0 so that raising a hard limit is
+// not rejected after the switch to the process user.
+func (p *rootContainerEnvPreparer) setRlimits(rlimits []spec.RlimitObject) error {
+	if err := validateRlimits(rlimits); err != nil {
+		return err
+	}
+	for _, r := range rlimits {
+		rlim := &syscall.Rlimit{Cur: r.Soft, Max: r.Hard}
+		if err := p.syscallHandler.Setrlimit(rlimitMap[r.Type], rlim); err != nil {
+			return fmt.Errorf("setrlimit %s failed: %w", r.Type, err)
+		}
+	}
+	return nil
+}
+
+// setOOMScoreAdj writes process.oomScoreAdj to /proc/self/oom_score_adj.
+// Nothing is written when the value is not set in the spec.
+func (p *rootContainerEnvPreparer) setOOMScoreAdj(score *int) error {
+	if score == nil {
+		return nil
+	}
+	if err := validateOOMScoreAdj(*score); err != nil {
+		return err
+	}
+	if err := p.syscallHandler.WriteFile("/proc/self/oom_score_adj", []byte(strconv.Itoa(*score)), 0o644); err != nil {
+		return fmt.Errorf("write oom_score_adj failed: %w", err)
+	}
+	return nil
+}
+
+// setNoNewPrivileges sets PR_SET_NO_NEW_PRIVS so that the container
+// process cannot gain privileges through setuid binaries or file
+// capabilities on execve(2).
+func (p *rootContainerEnvPreparer) setNoNewPrivileges() error {
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("prctl(PR_SET_NO_NEW_PRIVS) failed: %w", err)
+	}
+	return nil
+}
+
 // setHostnameToContainerId configures the hostname for the process inside
 // the UTS namespace.
 //
@@ -408,9 +624,10 @@ func (p *rootContainerEnvPreparer) setupOverlay(rootfs string, imageAnnotation s
 // as well as user-specified bind mounts.
 //
 // The mountList contains entries such as /proc, /dev, /sys, cgroup, tmpfs,
-// and arbitrary host paths. For bind mounts, this method prepares the
+// and arbitrary host paths, and etcMounts the bind mounts of the /etc
+// files generated by the runtime. For bind mounts, this method prepares the
 // destination path depending on whether the source is a file or a directory.
-func (p *rootContainerEnvPreparer) mountFilesystem(containerId string, rootfs string, mountList []spec.MountObject) error {
+func (p *rootContainerEnvPreparer) mountFilesystem(containerId string, rootfs string, mountList []spec.MountObject, etcMounts []spec.MountObject) error {
 	// mount file system required for operation. required fs is the following
 	//   /proc, /dev, /dev/pts, /sys, /sys/fs/cgroup, /dev/mqueue, /dev/shm
 	// additionally, mount user-specified host directories
@@ -561,35 +778,11 @@ func (p *rootContainerEnvPreparer) mountFilesystem(containerId string, rootfs st
 				"size=67108864",
 			},
 		},
-		{
-			Destination: "/etc/resolv.conf",
-			Type:        "bind",
-			Source:      fmt.Sprintf("/etc/raind/container/%s/etc/resolv.conf", containerId),
-			Options: []string{
-				"rbind",
-				"rprivate",
-			},
-		},
-		{
-			Destination: "/etc/hostname",
-			Type:        "bind",
-			Source:      fmt.Sprintf("/etc/raind/container/%s/etc/hostname", containerId),
-			Options: []string{
-				"rbind",
-				"rprivate",
-			},
-		},
-		{
-			Destination: "/etc/hosts",
-			Type:        "bind",
-			Source:      fmt.Sprintf("/etc/raind/container/%s/etc/hosts", containerId),
-			Options: []string{
-				"rbind",
-				"rprivate",
-			},
-		},
 	}
 
+	// generated /etc files
+	prerequiredMounts = append(prerequiredMounts, etcMounts...)
+
 	// user mounts
 	for _, user_mount := range mountList {
 		// validate source
@@ -905,3 +1098,24 @@ func (p *rootContainerEnvPreparer) setCapability(capConfig spec.CapabilityObject
 
 	return nil
 }
+
+// restoreEffectiveCapability raises the effective capability set of the
+// current thread to match its permitted set.
+func restoreEffectiveCapability() error {
+	c, err := capability.NewPid2(0)
+	if err != nil {
+		return err
+	}
+	if err := c.Load(); err != nil {
+		return err
+	}
+	for i := capability.Cap(0); i <= capability.CAP_LAST_CAP; i++ {
+		if c.Get(capability.PERMITTED, i) {
+			c.Set(capability.EFFECTIVE, i)
+		}
+	}
+	if err := c.Apply(capability.CAPS); err != nil {
+		return fmt.Errorf("restore effective capability failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeFifoReader struct{}
+
+func (f *fakeFifoReader) readFifo(path string) error {
+	return nil
+}
+
+type fakeContainerEnvPreparer struct {
+	spec spec.Spec
+	err  error
+}
+
+func (f *fakeContainerEnvPreparer) prepare(containerId string, spec spec.Spec) error {
+	f.spec = spec
+	return f.err
+}
+
+func TestContainerInit_ContainerModeUsesPassedNetns(t *testing.T) {
+	// == arrange ==
+	setupTestRootDir(t)
+	containerId := "111111"
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir(containerId), 0700))
+	assert.Nil(t, os.WriteFile(utils.ConfigFilePath(containerId), []byte("{}"), 0600))
+	hash, err := utils.Sha256File(utils.ConfigFilePath(containerId))
+	assert.Nil(t, err)
+	assert.Nil(t, utils.WriteJsonToFile(utils.ConfigFileHashPath(containerId), spec.SpecHash{Sha256: hash}))
+	containerSpec := buildAuditableSpec()
+	containerSpec.Annotations = spec.AnnotationObject{Version: "0.2.0", Net: `{"mode":"container:web"}`}
+	containerSpec.LinuxSpec.Namespaces = []spec.NamespaceObject{{Type: "mount"}, {Type: "network"}}
+	t.Setenv(netnsPathEnv, "/proc/4321/ns/net")
+	envPreparer := &fakeContainerEnvPreparer{err: errors.New("stop after prepare")}
+	containerInit := &ContainerInit{
+		fifoReader:           &fakeFifoReader{},
+		specLoader:           &fakeSpecLoader{spec: containerSpec},
+		containerEnvPreparer: envPreparer,
+		syscallHandler:       utils.NewSyscallHandler(),
+	}
+
+	// == act ==
+	err = containerInit.Execute(InitOption{ContainerId: containerId, Fifo: utils.FifoPath(containerId), Entrypoint: []string{"/bin/sh"}})
+
+	// == assert ==
+	assert.EqualError(t, err, "stop after prepare")
+	assert.Equal(t, []spec.NamespaceObject{{Type: "mount"}, {Type: "network", Path: "/proc/4321/ns/net"}}, envPreparer.spec.LinuxSpec.Namespaces)
+	_, passed := os.LookupEnv(netnsPathEnv)
+	assert.False(t, passed)
+}
+
+func TestContainerInit_ContainerModeWithoutPassedNetns(t *testing.T) {
+	// == arrange ==
+	containerSpec := buildNetworkModeSpec(`{"mode":"container:web"}`, spec.NamespaceObject{Type: "network"})
+	t.Setenv(netnsPathEnv, "")
+
+	// == act ==
+	err := applyPassedNetnsPath(&containerSpec)
+
+	// == assert ==
+	assert.EqualError(t, err, "network mode container:web: no network namespace path was passed to init")
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -24,16 +25,22 @@ func NewContainerKill() *ContainerKill {
 		syscallHandler:          utils.NewSyscallHandler(),
 		containerStatusManager:  status.NewStatusHandler(),
 		containerHookController: hook.NewHookController(),
+		containerCgroupFreezer:  newContainerCgroupController(),
+		containerCgroupKiller:   newContainerCgroupController(),
+		portPublisher:           newNftPortPublisher(),
 	}
 }
 
 // ContainerKill orchestrates the container termination flow.
 //
 // It is responsible for:
-//   - Verifying that the container is currently RUNNING
+//   - Verifying that the container is currently RUNNING or PAUSED
+//   - Thawing a PAUSED container so that the signal can be delivered
 //   - Resolving the container’s init process PID from state.json
-//   - Sending the requested signal to that process
+//   - Sending the requested signal to that process, or to every process
+//     in the container cgroup
 //   - Updating the container status to STOPPED
+//   - Removing the ports the container published on the host
 //
 // Low-level system interactions are delegated to collaborators to
 // keep the workflow testable and replaceable.
@@ -42,15 +49,23 @@ type ContainerKill struct {
 	syscallHandler          utils.KernelSyscallHandler
 	containerStatusManager  status.ContainerStatusManager
 	containerHookController hook.ContainerHookController
+	containerCgroupFreezer  containerCgroupFreezer
+	containerCgroupKiller   containerCgroupKiller
+	portPublisher           portPublisher
 }
 
 // Kill sends a signal to the container’s init process and updates its state.
 //
 // The workflow is:
-//  1. Check that the container is RUNNING
+//  1. Check that the container is RUNNING or PAUSED, and thaw it if it
+//     is PAUSED
 //  2. Retrieve the init PID from state.json
-//  3. Send the configured signal to that PID
+//  3. Send the configured signal to that PID, or to every process in the
+//     container cgroup if opt.All is set
 //  4. Update the status file to STOPPED and clear the PID
+//  5. Record the OOM counters of the cgroup in the status file
+//  6. Remove the published ports of the container
+//  7. Run the stopContainer hooks
 //
 // If any step fails, the method stops and returns the error.
 func (c *ContainerKill) Kill(opt KillOption) (err error) {
@@ -88,7 +103,7 @@ func (c *ContainerKill) Kill(opt KillOption) (err error) {
 	}
 
 	// 2. check container status
-	//    if status is not running, return error
+	//    if status is not running or paused, return error
 	stage = "get_status"
 	containerStatus, err := c.containerStatusManager.GetStatusFromId(opt.ContainerId)
 	if err != nil {
@@ -96,10 +111,20 @@ func (c *ContainerKill) Kill(opt KillOption) (err error) {
 	}
 
 	stage = "check_status"
-	if containerStatus != status.RUNNING {
+	if containerStatus != status.RUNNING && containerStatus != status.PAUSED {
 		return fmt.Errorf("container: %s not running.", opt.ContainerId)
 	}
 
+	// a frozen process does not handle signals until it is thawed,
+	// so resume a paused container before signaling it
+	if containerStatus == status.PAUSED {
+		stage = "thaw_cgroup"
+		err = c.containerCgroupFreezer.thaw(opt.ContainerId, spec)
+		if err != nil {
+			return err
+		}
+	}
+
 	// 3. retrieve pid and shimpid from state.json
 	stage = "get_pid"
 	containerPid, err := c.containerStatusManager.GetPidFromId(opt.ContainerId)
@@ -122,7 +147,7 @@ func (c *ContainerKill) Kill(opt KillOption) (err error) {
 		Pid:       containerPid,
 		StartTime: procStartTime,
 	}
-	err = c.syscallHandler.Kill(containerPid, signalMap[opt.Signal])
+	err = c.sendSignal(opt, spec, containerPid, signalMap[opt.Signal])
 	signal = append(signal, opt.Signal)
 	if err != nil {
 		return err
@@ -134,7 +159,7 @@ func (c *ContainerKill) Kill(opt KillOption) (err error) {
 		if err != nil {
 			// timeout: send SIGKILL
 			stage = "send_sigkill"
-			_ = c.syscallHandler.Kill(containerPid, signalMap["KILL"])
+			_ = c.sendSignal(opt, spec, containerPid, signalMap["KILL"])
 			signal = append(signal, "KILL")
 
 			stage = "wait_exit_kill"
@@ -167,7 +192,19 @@ func (c *ContainerKill) Kill(opt KillOption) (err error) {
 		return err
 	}
 
-	// 5. HOOK: stopContainer
+	// 5. record oom events
+	//      a process may have been OOM killed before the signal
+	stage = "check_oom"
+	recordOOMEvents(c.containerStatusManager, opt.ContainerId, spec)
+
+	// 6. remove published ports
+	stage = "unpublish_ports"
+	err = c.portPublisher.unpublish(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+
+	// 7. HOOK: stopContainer
 	stage = "hook_stopContainer"
 	err = c.containerHookController.RunStopContainerHooks(
 		opt.ContainerId,
@@ -180,6 +217,15 @@ func (c *ContainerKill) Kill(opt KillOption) (err error) {
 	return nil
 }
 
+// sendSignal sends signal to the init process, or to every process in the
+// container cgroup when opt.All is set.
+func (c *ContainerKill) sendSignal(opt KillOption, spec spec.Spec, containerPid int, signal syscall.Signal) error {
+	if opt.All {
+		return c.containerCgroupKiller.kill(opt.ContainerId, spec, signal)
+	}
+	return c.syscallHandler.Kill(containerPid, signal)
+}
+
 func (c *ContainerKill) cleanupShim(containerId string) error {
 	// remove tty.sock
 	if err := c.syscallHandler.Remove(utils.SockPath(containerId)); err != nil {
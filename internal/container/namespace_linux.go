@@ -1,18 +1,21 @@
 package container
 
 import (
+	"fmt"
+	"os"
 	"syscall"
 
 	"droplet/internal/spec"
+	"droplet/internal/utils"
 )
 
 // procAttr represents the low-level process attributes that will be applied
 // when starting the container init process.
 //
-// At present it contains only the cloneFlags derived from the selected
-// namespaces, but the struct exists to allow future extension (for example,
-// UID/GID mappings, capability settings, or seccomp configuration) without
-// changing the function signatures that depend on it.
+// It contains the cloneFlags derived from the selected namespaces and the
+// UID/GID mappings of the user namespace. The struct exists so that further
+// attributes (for example, capability settings or seccomp configuration)
+// can be added without changing the function signatures that depend on it.
 type procAttr struct {
 	cloneFlags    uintptr
 	uidMap        []syscall.SysProcIDMap
@@ -24,29 +27,52 @@ type procAttr struct {
 // which can be assigned to exec.Cmd.SysProcAttr when launching the init
 // process.
 //
-// The returned SysProcAttr currently sets only the Cloneflags field, but
-// additional process attributes (such as UID/GID mappings for user
-// namespaces) may be added here in the future as the runtime evolves.
+// The returned SysProcAttr sets the Cloneflags, UidMappings, GidMappings
+// and GidMappingsEnableSetgroups fields, and Credential when mappings are
+// present.
+//
+// When UID/GID mappings are present, the child is started as uid/gid 0 of
+// the new user namespace. Otherwise a host root that is not part of the
+// mapping (e.g. an allocated 100000:65536 range) would appear as the
+// overflow uid inside the namespace and lose its capabilities on execve.
 func buildSysProcAttr(procAttr procAttr) *syscall.SysProcAttr {
-	return &syscall.SysProcAttr{
+	sysProcAttr := &syscall.SysProcAttr{
 		Cloneflags:                 procAttr.cloneFlags,
 		UidMappings:                procAttr.uidMap,
 		GidMappings:                procAttr.gidMap,
 		GidMappingsEnableSetgroups: procAttr.setGroupsFlag,
 	}
+	if len(procAttr.uidMap) > 0 {
+		sysProcAttr.Credential = &syscall.Credential{Uid: 0, Gid: 0}
+	}
+	return sysProcAttr
 }
 
 // buildProcAttrForRootContainer builds a procAttr for a root-executed
 // container, including user namespaces if requested in nsConfig.
 //
-// For now this configures a simple identity mapping (0 -> 0, size 65535)
-// when the user namespace is enabled. Other namespaces are expressed as
-// clone flags only. This function can be extended to support additional
-// mappings (e.g. non-root users, rootless mode, or spec-based mappings)
-// without changing the SysProcAttr construction logic.
-func buildProcAttrForRootContainer(nsConfig namespaceConfig) procAttr {
+// When the user namespace is enabled, the UID/GID mappings are taken from
+// linux.uidMappings / linux.gidMappings in the spec, or from the host id
+// range allocated to the container when none are given. Other namespaces
+// are expressed as clone flags only. An error is returned when the spec
+// mappings fail validation or no id range can be allocated.
+func buildProcAttrForRootContainer(containerId string, spec spec.Spec, nsConfig namespaceConfig) (procAttr, error) {
+	if err := validateNamespacePaths(nsConfig); err != nil {
+		return procAttr{}, err
+	}
+	if err := validateTimeOffsets(nsConfig, spec.LinuxSpec.TimeOffsets); err != nil {
+		return procAttr{}, err
+	}
+	if nsConfig.time {
+		if err := checkTimeNamespaceSupport(timeNsPath, utils.KernelVersionAtLeast(5, 11)); err != nil {
+			return procAttr{}, err
+		}
+	}
 	cloneFlags := buildCloneFlags(nsConfig)
-	uidMap, gidMap := buildRootUserNamespaceIDMap(nsConfig)
+	uidMap, gidMap, err := buildRootUserNamespaceIDMap(containerId, nsConfig, spec.LinuxSpec)
+	if err != nil {
+		return procAttr{}, err
+	}
 	setGroupsFlag := true
 
 	return procAttr{
@@ -54,7 +80,7 @@ func buildProcAttrForRootContainer(nsConfig namespaceConfig) procAttr {
 		uidMap:        uidMap,
 		gidMap:        gidMap,
 		setGroupsFlag: setGroupsFlag,
-	}
+	}, nil
 }
 
 // namespaceConfig represents the set of Linux namespaces that should be
@@ -63,6 +89,8 @@ func buildProcAttrForRootContainer(nsConfig namespaceConfig) procAttr {
 // Each field corresponds to an OCI runtime-spec namespace type.
 // A value of true indicates that the namespace should be created
 // (i.e., the associated CLONE_NEW* flag will be applied).
+// Namespaces that have a path in the spec are not created; they are
+// recorded in paths and joined by the init process via setns(2).
 type namespaceConfig struct {
 	mount   bool
 	network bool
@@ -71,6 +99,22 @@ type namespaceConfig struct {
 	ipc     bool
 	user    bool
 	cgroup  bool
+	time    bool
+
+	paths map[string]string
+}
+
+// joinableNamespaceMap lists the namespace types that the init process can
+// join by path, together with the nstype passed to setns(2).
+//
+// Only per-thread namespaces are supported: the init process is a
+// multi-threaded Go program, so the kernel refuses setns(2) into mount and
+// user namespaces, and joining a pid namespace would only affect children.
+var joinableNamespaceMap = map[string]int{
+	"network": syscall.CLONE_NEWNET,
+	"uts":     syscall.CLONE_NEWUTS,
+	"ipc":     syscall.CLONE_NEWIPC,
+	"cgroup":  syscall.CLONE_NEWCGROUP,
 }
 
 // buildNamespaceConfig constructs a namespaceConfig from the namespaces
@@ -85,6 +129,14 @@ type namespaceConfig struct {
 func buildNamespaceConfig(spec spec.Spec) namespaceConfig {
 	var nsConfig namespaceConfig
 	for _, ns := range spec.LinuxSpec.Namespaces {
+		// existing namespace: joined instead of created
+		if ns.Path != "" {
+			if nsConfig.paths == nil {
+				nsConfig.paths = map[string]string{}
+			}
+			nsConfig.paths[ns.Type] = ns.Path
+			continue
+		}
 		switch ns.Type {
 		case "mount":
 			nsConfig.mount = true
@@ -100,11 +152,46 @@ func buildNamespaceConfig(spec spec.Spec) namespaceConfig {
 			nsConfig.user = true
 		case "cgroup":
 			nsConfig.cgroup = true
+		case "time":
+			nsConfig.time = true
 		}
 	}
 	return nsConfig
 }
 
+// validateNamespacePaths checks the namespaces that are joined by path.
+//
+// The namespace type must be one the init process can join, and the path
+// must exist at the time the container is created. Namespaces cannot be
+// joined together with a new user namespace: setns(2) needs CAP_SYS_ADMIN
+// in the user namespace owning the target, which the new user namespace
+// does not own.
+func validateNamespacePaths(nsConfig namespaceConfig) error {
+	for nsType, path := range nsConfig.paths {
+		if _, ok := joinableNamespaceMap[nsType]; !ok {
+			return fmt.Errorf("joining %s namespace by path is not supported", nsType)
+		}
+		if nsConfig.user {
+			return fmt.Errorf("joining %s namespace by path is not supported with a new user namespace", nsType)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("%s namespace path %s: %w", nsType, path, err)
+		}
+	}
+	return nil
+}
+
+// isNamespaceJoined reports whether the namespace of the given type is
+// joined by path in the spec rather than newly created.
+func isNamespaceJoined(linuxSpec spec.LinuxSpecObject, nsType string) bool {
+	for _, ns := range linuxSpec.Namespaces {
+		if ns.Type == nsType && ns.Path != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // buildCloneFlags constructs the Linux namespace clone flags from the given
 // namespaceConfig and returns the bitwise OR of the corresponding CLONE_NEW*
 //
@@ -113,6 +200,10 @@ func buildNamespaceConfig(spec spec.Spec) namespaceConfig {
 // to be used as syscall.SysProcAttr.Cloneflags when spawning the container
 // init process.
 //
+// The time namespace is not included: CLONE_NEWTIME is only accepted by
+// unshare(2) and clone3(2), so the init process creates it itself (see
+// unshareTimeNamespace).
+//
 // This function does not perform any system calls; it only derives the flag
 // mask based on the requested namespaces.
 func buildCloneFlags(nsConfig namespaceConfig) uintptr {
@@ -146,16 +237,59 @@ func buildCloneFlags(nsConfig namespaceConfig) uintptr {
 // buildRootUserNamespaceIDMaps returns UID/GID ID maps suitable for a
 // root-executed container when the user namespace is enabled.
 //
-// When nsConfig.user is true, this function creates an identity mapping
-// from container UID/GID 0..(size-1) to host UID/GID 0..(size-1).
+// When linux.uidMappings / linux.gidMappings are present in the spec, they
+// are validated against /etc/subuid and /etc/subgid and the ranges allocated
+// to other containers, and used as-is. Several ranges per map are supported.
+// Otherwise a 65536-id host range is allocated for the container from the
+// subuid/subgid pool and container UID/GID 0 is mapped onto its start. The allocation is idempotent, so create, shim and
+// run all resolve the same range for a container. When no pool is
+// configured, an identity mapping from container UID/GID 0..(size-1) to host
+// UID/GID 0..(size-1) is created.
 // When the user namespace is disabled, it returns nil maps.
-//
-// This function is the main extension point for future mapping policies:
-// for example, supporting rootless containers, using /etc/subuid/subgid,
-// or honoring OCI spec.Process.User fields.
-func buildRootUserNamespaceIDMap(nsConfig namespaceConfig) (uidMap, gidMap []syscall.SysProcIDMap) {
+func buildRootUserNamespaceIDMap(containerId string, nsConfig namespaceConfig, linuxSpec spec.LinuxSpecObject) (uidMap, gidMap []syscall.SysProcIDMap, err error) {
 	if !nsConfig.user {
-		return nil, nil
+		return nil, nil, nil
+	}
+
+	// spec-driven mappings
+	if len(linuxSpec.UIDMappings) > 0 || len(linuxSpec.GIDMappings) > 0 {
+		if len(linuxSpec.UIDMappings) == 0 || len(linuxSpec.GIDMappings) == 0 {
+			return nil, nil, fmt.Errorf("both uidMappings and gidMappings must be specified")
+		}
+		subUids, err := loadSubIDRanges(subUidPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := validateIDMappings("uid", linuxSpec.UIDMappings, subUids); err != nil {
+			return nil, nil, err
+		}
+		subGids, err := loadSubIDRanges(subGidPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := validateIDMappings("gid", linuxSpec.GIDMappings, subGids); err != nil {
+			return nil, nil, err
+		}
+		if err := newUserNsAllocator().reserveMappings(containerId, linuxSpec.UIDMappings, linuxSpec.GIDMappings); err != nil {
+			return nil, nil, err
+		}
+		return toSysProcIDMap(linuxSpec.UIDMappings), toSysProcIDMap(linuxSpec.GIDMappings), nil
+	}
+
+	// allocated mappings
+	allocation, ok, err := newUserNsAllocator().allocate(containerId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		idMap := []syscall.SysProcIDMap{
+			{
+				ContainerID: 0,
+				HostID:      int(allocation.HostID),
+				Size:        int(allocation.Size),
+			},
+		}
+		return idMap, idMap, nil
 	}
 
 	const idMapSize = 65535
@@ -175,5 +309,5 @@ func buildRootUserNamespaceIDMap(nsConfig namespaceConfig) (uidMap, gidMap []sys
 		},
 	}
 
-	return uidMap, gidMap
+	return uidMap, gidMap, nil
 }
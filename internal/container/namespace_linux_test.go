@@ -0,0 +1,136 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestBuildNamespaceConfig_JoinByPath(t *testing.T) {
+	// == arrange ==
+	containerSpec := spec.Spec{
+		LinuxSpec: spec.LinuxSpecObject{
+			Namespaces: []spec.NamespaceObject{
+				{Type: "mount"},
+				{Type: "pid"},
+				{Type: "network", Path: "/proc/self/ns/net"},
+			},
+		},
+	}
+
+	// == act ==
+	nsConfig := buildNamespaceConfig(containerSpec)
+	err := validateNamespacePaths(nsConfig)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.True(t, nsConfig.mount)
+	assert.True(t, nsConfig.pid)
+	assert.False(t, nsConfig.network)
+	assert.Equal(t, map[string]string{"network": "/proc/self/ns/net"}, nsConfig.paths)
+	assert.True(t, isNamespaceJoined(containerSpec.LinuxSpec, "network"))
+	assert.False(t, isNamespaceJoined(containerSpec.LinuxSpec, "pid"))
+}
+
+func TestValidateNamespacePaths_Unsupported(t *testing.T) {
+	// == arrange ==
+	nsConfig := namespaceConfig{
+		paths: map[string]string{"mount": "/proc/self/ns/mnt"},
+	}
+
+	// == act ==
+	err := validateNamespacePaths(nsConfig)
+
+	// == assert ==
+	assert.EqualError(t, err, "joining mount namespace by path is not supported")
+}
+
+func TestValidateNamespacePaths_NewUserNamespace(t *testing.T) {
+	// == arrange ==
+	nsConfig := namespaceConfig{
+		user:  true,
+		paths: map[string]string{"network": "/proc/self/ns/net"},
+	}
+
+	// == act ==
+	err := validateNamespacePaths(nsConfig)
+
+	// == assert ==
+	assert.EqualError(t, err, "joining network namespace by path is not supported with a new user namespace")
+}
+
+func TestValidateTimeOffsets(t *testing.T) {
+	// == arrange ==
+	offsets := map[string]spec.TimeOffsetObject{
+		"monotonic": {Secs: 86400},
+		"boottime":  {Secs: -10, Nanosecs: 500},
+	}
+
+	// == act ==
+	err_1 := validateTimeOffsets(namespaceConfig{time: true}, offsets)
+	err_2 := validateTimeOffsets(namespaceConfig{}, offsets)
+	err_3 := validateTimeOffsets(namespaceConfig{time: true}, map[string]spec.TimeOffsetObject{"realtime": {Secs: 1}})
+	formatted := formatTimeOffsets(offsets)
+
+	// == assert ==
+	assert.Nil(t, err_1)
+	assert.EqualError(t, err_2, "timeOffsets requires a time namespace")
+	assert.EqualError(t, err_3, `timeOffsets: unsupported clock "realtime"`)
+	assert.Equal(t, "boottime -10 500\nmonotonic 86400 0\n", formatted)
+}
+
+func TestCheckTimeNamespaceSupport_Unsupported(t *testing.T) {
+	// == arrange ==
+	nsPath := filepath.Join(t.TempDir(), "time")
+
+	// == act ==
+	errMissing := checkTimeNamespaceSupport(nsPath, true)
+	errOldKernel := checkTimeNamespaceSupport("/proc/self/ns/net", false)
+
+	// == assert ==
+	assert.ErrorContains(t, errMissing, "Linux 5.11 or later is required")
+	assert.ErrorContains(t, errOldKernel, "Linux 5.11 or later is required")
+}
+
+func TestUnshareTimeNamespace_WritesOffsets(t *testing.T) {
+	// == arrange ==
+	if checkTimeNamespaceSupport(timeNsPath, utils.KernelVersionAtLeast(5, 11)) != nil {
+		t.Skip("time namespace is not supported")
+	}
+	preparer := &rootContainerEnvPreparer{syscallHandler: utils.NewSyscallHandler()}
+	offsets := map[string]spec.TimeOffsetObject{"monotonic": {Secs: 86400}}
+
+	// == act ==
+	var (
+		err     error
+		written []byte
+		readErr error
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// the thread is left locked, so that it exits with the goroutine
+		// instead of running other goroutines in the new namespace
+		runtime.LockOSThread()
+		if err = preparer.unshareTimeNamespace(offsets); err != nil {
+			return
+		}
+		written, readErr = os.ReadFile(timeNsOffsetsPath())
+	}()
+	<-done
+	if errors.Is(err, unix.EPERM) {
+		t.Skip("unshare(CLONE_NEWTIME) is not permitted")
+	}
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Nil(t, readErr)
+	assert.Regexp(t, `(?m)^(monotonic|1)\s+86400\s+0$`, string(written))
+}
@@ -1,18 +1,28 @@
 package container
 
 import (
+	"droplet/internal/netlink"
 	"droplet/internal/spec"
-	"droplet/internal/utils"
+	"droplet/internal/status"
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
 )
 
-// newContainerNetworkController constructs a containerNetworkController with
-// the default CommandFactory implementation. The controller is responsible
-// for preparing container networking (veth creation and namespace setup)
-// during container initialization.
+// newContainerNetworkController constructs a containerNetworkController.
+// The controller is responsible for preparing container networking (veth
+// creation and namespace setup) during container initialization, and
+// hands containers of the cni backend over to the CNI plugins.
 func newContainerNetworkController() *containerNetworkController {
 	return &containerNetworkController{
-		commandFactory: &utils.ExecCommandFactory{},
+		cniBackend:     newCniNetworkController(),
+		portPublisher:  newNftPortPublisher(),
+		policyEnforcer: newNftPolicyEnforcer(),
+		statusManager:  status.NewStatusHandler(),
 	}
 }
 
@@ -20,113 +30,603 @@ func newContainerNetworkController() *containerNetworkController {
 // container networking resources for a target process. Implementations
 // should configure interfaces according to annotation-provided settings.
 type containerNetworkPreparer interface {
-	prepare(containerId string, pid int, annotation spec.AnnotationObject) error
+	prepare(containerId string, pid int, containerSpec spec.Spec) error
+}
+
+// containerNetworkRemover defines the behavior required to release the
+// host-side network resources of a container.
+type containerNetworkRemover interface {
+	remove(containerId string, containerSpec spec.Spec) error
+}
+
+// networkLinkHandler defines the host link operations used to find and
+// remove leaked container interfaces.
+type networkLinkHandler interface {
+	listBridgePorts(bridge string) ([]string, error)
+	deleteLink(name string) error
 }
 
 // containerNetworkController is the default implementation of
-// containerNetworkPreparer. It sets up a veth pair, attaches it to the
-// host bridge, and configures the container network namespace.
+// containerNetworkPreparer and containerNetworkRemover. It sets up a veth
+// pair, attaches it to the host bridge, and configures the container
+// network namespace through rtnetlink.
+//
+// Containers whose annotation selects the cni backend are delegated to
+// cniBackend instead. Published ports are handled by portPublisher with
+// either backend, and the firewall policy by policyEnforcer. The verified
+// interface settings are recorded in state.json through statusManager.
 type containerNetworkController struct {
-	commandFactory utils.CommandFactory
+	cniBackend     networkBackend
+	portPublisher  portPublisher
+	policyEnforcer policyEnforcer
+	statusManager  status.ContainerStatusManager
+}
+
+// NetworkStepError reports which step of the network setup failed and
+// on which link.
+type NetworkStepError struct {
+	Step string
+	Link string
+	Err  error
+}
+
+func (e *NetworkStepError) Error() string {
+	if e.Link == "" {
+		return fmt.Sprintf("network %s: %v", e.Step, e.Err)
+	}
+	return fmt.Sprintf("network %s (%s): %v", e.Step, e.Link, e.Err)
+}
+
+func (e *NetworkStepError) Unwrap() error {
+	return e.Err
+}
+
+// networkSetup is the parsed form of the network annotation.
+type networkSetup struct {
+	interfaces []interfaceSetup
+}
+
+// interfaceSetup is the parsed form of one interface of the network
+// annotation.
+type interfaceSetup struct {
+	hostLink      string
+	peerLink      string
+	bridge        string
+	containerLink string
+	mac           net.HardwareAddr
+	hostMac       net.HardwareAddr
+	mtu           int
+	ingress       rateLimit
+	egress        rateLimit
+	address       *net.IPNet
+	gateway       net.IP
+	address6      *net.IPNet
+	gateway6      net.IP
+	disableDAD6   bool
+	routes        []networkRoute
+}
+
+// networkRoute is a parsed static route. gateway is nil for a directly
+// connected route.
+type networkRoute struct {
+	destination *net.IPNet
+	gateway     net.IP
 }
 
-// prepare configures networking for the given container process.
+// prepare configures networking for the given container process
+// according to its network mode.
 //
-// The workflow is:
+// In bridge mode the workflow is:
 //  1. Parse the network configuration from container annotations
-//  2. Create and attach a veth pair on the host side
-//  3. Enter the container network namespace and configure the interface
+//  2. Create and attach a veth pair on the host side for each interface
+//  3. Enter the container network namespace and configure the interfaces
+//  4. Verify the MAC addresses, MTU and rate limits of the interfaces and
+//     record them in state.json
+//  5. Publish the ports of the annotation on the host and apply the
+//     firewall policy to the host veths
+//
+// or, with the cni backend, running the ADD of the CNI plugins before the
+// ports are published.
 //
-// Returns an error if any networking operation fails.
-func (c *containerNetworkController) prepare(containerId string, pid int, annotation spec.AnnotationObject) error {
+// In none mode only loopback is brought up. Nothing is configured in host
+// mode, or when the network namespace is joined, since it is owned and
+// set up by another container.
+// Returns a *NetworkStepError naming the step that failed.
+func (c *containerNetworkController) prepare(containerId string, pid int, containerSpec spec.Spec) error {
 	// 1. retrieve network config from annotation
-	var networkConfig spec.NetConfigObject
-	if err := utils.StringToJson(annotation.Net, &networkConfig); err != nil {
-		return err
+	mode, networkConfig, err := networkModeOf(containerSpec)
+	if err != nil {
+		return &NetworkStepError{Step: "parse_config", Err: err}
 	}
+	netnsPath := fmt.Sprintf("/proc/%d/ns/net", pid)
 
-	// 2. create veth pair
-	if err := c.createVethPair(containerId, pid, networkConfig); err != nil {
+	switch mode.kind {
+	case networkModeNone:
+		return c.setupContainerNetns(netnsPath, networkSetup{})
+	case networkModeBridge:
+	default:
+		return nil
+	}
+	if networkConfig.Backend == networkBackendCni {
+		if err := c.cniBackend.prepare(containerId, pid, containerSpec); err != nil {
+			return err
+		}
+		return c.applyHostRules(containerId, containerSpec)
+	}
+
+	setup, err := parseNetworkSetup(networkConfig)
+	if err != nil {
 		return err
 	}
 
+	// 2. create veth pairs
+	for _, iface := range setup.interfaces {
+		if err := c.createVethPair(netnsPath, iface); err != nil {
+			return err
+		}
+	}
+
 	// 3. setup inside container
-	if err := c.setupContainerNetns(pid, networkConfig); err != nil {
+	if err := c.setupContainerNetns(netnsPath, setup); err != nil {
 		return err
 	}
+
+	// 4. verify interfaces
+	interfaces, err := c.inspectInterfaces(netnsPath, setup)
+	if err != nil {
+		return err
+	}
+	if err := c.statusManager.SetInterfaces(containerId, interfaces); err != nil {
+		return &NetworkStepError{Step: "record_interfaces", Err: err}
+	}
+
+	// 5. publish ports and apply policy
+	return c.applyHostRules(containerId, containerSpec)
+}
+
+// applyHostRules installs the port mappings and the firewall policy of
+// the container.
+func (c *containerNetworkController) applyHostRules(containerId string, containerSpec spec.Spec) error {
+	if err := c.portPublisher.publish(containerId, containerSpec); err != nil {
+		return &NetworkStepError{Step: "publish_ports", Err: err}
+	}
+	if err := c.policyEnforcer.apply(containerId, containerSpec); err != nil {
+		return &NetworkStepError{Step: "apply_policy", Err: err}
+	}
 	return nil
 }
 
+// parseNetworkSetup validates the network annotation and parses the
+// addresses and routes of its interfaces.
+//
+// Interface names must be unique, and only one interface may set the
+// default gateway of each address family.
+func parseNetworkSetup(networkConfig spec.NetConfigObject) (networkSetup, error) {
+	var (
+		setup       networkSetup
+		hostLinks   = map[string]bool{}
+		netnsLinks  = map[string]bool{}
+		hasGateway  bool
+		hasGateway6 bool
+	)
+
+	for _, i := range networkConfig.Interfaces {
+		iface, err := parseInterfaceSetup(i)
+		if err != nil {
+			return setup, err
+		}
+
+		if hostLinks[iface.hostLink] {
+			return setup, &NetworkStepError{Step: "parse_config", Link: iface.hostLink, Err: fmt.Errorf("duplicate interface name")}
+		}
+		hostLinks[iface.hostLink] = true
+		if netnsLinks[iface.peerLink] || netnsLinks[iface.containerLink] {
+			return setup, &NetworkStepError{Step: "parse_config", Link: iface.containerLink, Err: fmt.Errorf("duplicate container interface name")}
+		}
+		netnsLinks[iface.peerLink] = true
+		netnsLinks[iface.containerLink] = true
+
+		if (iface.gateway != nil && hasGateway) || (iface.gateway6 != nil && hasGateway6) {
+			return setup, &NetworkStepError{Step: "parse_config", Link: iface.containerLink, Err: fmt.Errorf("default gateway is already set by another interface")}
+		}
+		hasGateway = hasGateway || iface.gateway != nil
+		hasGateway6 = hasGateway6 || iface.gateway6 != nil
+
+		setup.interfaces = append(setup.interfaces, iface)
+	}
+	return setup, nil
+}
+
+// parseInterfaceSetup validates one interface of the network annotation.
+func parseInterfaceSetup(i spec.InterfaceObject) (interfaceSetup, error) {
+	iface := interfaceSetup{
+		hostLink:      i.Name,
+		peerLink:      i.HostInterface,
+		bridge:        i.BridgeInterface,
+		containerLink: i.ContainerInterface,
+		mtu:           i.Mtu,
+	}
+
+	if iface.hostLink == "" || iface.peerLink == "" || iface.bridge == "" {
+		return iface, &NetworkStepError{Step: "parse_config", Link: iface.hostLink, Err: fmt.Errorf("interface, host interface and bridge are required")}
+	}
+	if iface.containerLink == "" {
+		iface.containerLink = iface.peerLink
+	}
+
+	var err error
+	parseErr := func(err error) error {
+		return &NetworkStepError{Step: "parse_config", Link: iface.containerLink, Err: err}
+	}
+
+	// link attributes
+	if iface.mac, err = parseLinkMac(i.Mac, iface.hostLink+"/container"); err != nil {
+		return iface, parseErr(err)
+	}
+	if iface.hostMac, err = parseLinkMac(i.HostMac, iface.hostLink+"/host"); err != nil {
+		return iface, parseErr(err)
+	}
+	if iface.mtu < 0 {
+		return iface, parseErr(fmt.Errorf("invalid mtu: %d", iface.mtu))
+	}
+	if iface.ingress, err = parseRateLimit(i.IngressRate, i.IngressBurst); err != nil {
+		return iface, parseErr(fmt.Errorf("ingress: %w", err))
+	}
+	if iface.egress, err = parseRateLimit(i.EgressRate, i.EgressBurst); err != nil {
+		return iface, parseErr(fmt.Errorf("egress: %w", err))
+	}
+
+	// ipv4
+	//   may be omitted on an ipv6 only interface
+	if i.IPv4.Address != "" || i.IPv6 == nil {
+		if iface.address, err = parseInterfaceAddress(i.IPv4.Address); err != nil {
+			return iface, parseErr(err)
+		}
+	}
+	if iface.gateway, err = parseGateway(i.IPv4.Gateway); err != nil {
+		return iface, parseErr(err)
+	}
+
+	// ipv6
+	if ipv6 := i.IPv6; ipv6 != nil {
+		if iface.address6, err = parseInterfaceAddress(ipv6.Address); err != nil {
+			return iface, parseErr(err)
+		}
+		if iface.address6.IP.To4() != nil {
+			return iface, parseErr(fmt.Errorf("not an ipv6 address: %s", ipv6.Address))
+		}
+		if iface.gateway6, err = parseGateway(ipv6.Gateway); err != nil {
+			return iface, parseErr(err)
+		}
+		iface.disableDAD6 = ipv6.DisableDAD
+	}
+
+	// static routes
+	for _, r := range i.Routes {
+		_, destination, err := net.ParseCIDR(r.Destination)
+		if err != nil {
+			return iface, parseErr(err)
+		}
+		gateway, err := parseGateway(r.Gateway)
+		if err != nil {
+			return iface, parseErr(err)
+		}
+		iface.routes = append(iface.routes, networkRoute{destination: destination, gateway: gateway})
+	}
+	return iface, nil
+}
+
+// parseInterfaceAddress parses an address in CIDR notation, keeping the
+// host part of the address.
+func parseInterfaceAddress(address string) (*net.IPNet, error) {
+	ip, ipNet, err := net.ParseCIDR(address)
+	if err != nil {
+		return nil, err
+	}
+	ipNet.IP = ip
+	return ipNet, nil
+}
+
+// parseGateway parses an optional gateway address.
+func parseGateway(gateway string) (net.IP, error) {
+	if gateway == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(gateway)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid gateway: %s", gateway)
+	}
+	return ip, nil
+}
+
 // createVethPair creates the veth pair used for container networking.
 //
 // Host-side operations performed:
-//  1. Create a veth pair (host ↔ container)
-//  2. Attach the host-side veth to the specified bridge
-//  3. Bring the host-side veth interface up
-func (c *containerNetworkController) createVethPair(containerId string, pid int, networkConfig spec.NetConfigObject) error {
-	pidStr := fmt.Sprint(pid)
+//  1. Create a veth pair with the peer placed in the container netns
+//  2. Set the MAC address and MTU of the host-side veth, if configured
+//  3. Attach the host-side veth to the specified bridge
+//  4. Bring the host-side veth interface up
+//  5. Apply the rate limits, if configured
+func (c *containerNetworkController) createVethPair(netnsPath string, iface interfaceSetup) error {
+	netnsFd, err := unix.Open(netnsPath, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &NetworkStepError{Step: "open_netns", Err: err}
+	}
+	defer unix.Close(netnsFd)
+
+	h, err := netlink.NewHandle()
+	if err != nil {
+		return &NetworkStepError{Step: "open_netlink", Err: err}
+	}
+	defer h.Close()
 
 	// 1. create veth
-	createVeth := c.commandFactory.Command("ip", "link", "add", "name", networkConfig.Interface.Name, "type", "veth", "peer", "name", networkConfig.HostInterface, "netns", pidStr)
-	if err := createVeth.Run(); err != nil {
-		return err
+	if err := h.AddVeth(iface.hostLink, iface.peerLink, netnsFd); err != nil {
+		return &NetworkStepError{Step: "create_veth", Link: iface.hostLink, Err: err}
+	}
+	vethIndex, err := h.LinkByName(iface.hostLink)
+	if err != nil {
+		return &NetworkStepError{Step: "create_veth", Link: iface.hostLink, Err: err}
 	}
 
-	// 2. attach veth to bridge
-	attacheVeth := c.commandFactory.Command("ip", "link", "set", networkConfig.Interface.Name, "master", networkConfig.BridgeInterface)
-	if err := attacheVeth.Run(); err != nil {
-		return err
+	// 2. link attributes
+	if iface.hostMac != nil {
+		if err := h.SetLinkHardwareAddr(vethIndex, iface.hostMac); err != nil {
+			return &NetworkStepError{Step: "set_mac", Link: iface.hostLink, Err: err}
+		}
+	}
+	if iface.mtu > 0 {
+		if err := h.SetLinkMTU(vethIndex, iface.mtu); err != nil {
+			return &NetworkStepError{Step: "set_mtu", Link: iface.hostLink, Err: err}
+		}
 	}
 
-	// 3. up veth
-	upVeth := c.commandFactory.Command("ip", "link", "set", networkConfig.Interface.Name, "up")
-	if err := upVeth.Run(); err != nil {
-		return err
+	// 3. attach veth to bridge
+	bridgeIndex, err := h.LinkByName(iface.bridge)
+	if err != nil {
+		return &NetworkStepError{Step: "attach_bridge", Link: iface.bridge, Err: err}
 	}
-	return nil
+	if err := h.SetLinkMaster(vethIndex, bridgeIndex); err != nil {
+		return &NetworkStepError{Step: "attach_bridge", Link: iface.hostLink, Err: err}
+	}
+
+	// 4. up veth
+	if err := h.SetLinkUp(vethIndex); err != nil {
+		return &NetworkStepError{Step: "up_veth", Link: iface.hostLink, Err: err}
+	}
+
+	// 5. rate limits
+	return applyRateLimits(h, vethIndex, iface)
 }
 
 // setupContainerNetns configures networking inside the container's
-// network namespace.
+// network namespace: it brings up loopback and configures every
+// interface.
+func (c *containerNetworkController) setupContainerNetns(netnsPath string, setup networkSetup) error {
+	err := netlink.RunInNetns(netnsPath, func(h *netlink.Handle) error {
+		// up loopback i/f
+		loIndex, err := h.LinkByName("lo")
+		if err == nil {
+			err = h.SetLinkUp(loIndex)
+		}
+		if err != nil {
+			return &NetworkStepError{Step: "up_loopback", Link: "lo", Err: err}
+		}
+
+		for _, iface := range setup.interfaces {
+			if err := configureContainerInterface(h, iface); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var stepErr *NetworkStepError
+	if err != nil && !errors.As(err, &stepErr) {
+		// failed to enter or leave the namespace
+		return &NetworkStepError{Step: "enter_netns", Err: err}
+	}
+	return err
+}
+
+// configureContainerInterface configures one veth peer from inside the
+// container's network namespace.
 //
 // Inside-namespace operations performed:
-//  1. Bring up loopback
-//  2. Rename the veth interface
-//  3. Assign the IPv4 address
-//  4. Bring the interface up
-//  5. Configure the default gateway
-func (c *containerNetworkController) setupContainerNetns(pid int, networkConfig spec.NetConfigObject) error {
-	pidStr := fmt.Sprint(pid)
-
-	// 1. up loopback i/f
-	upLoopbackIf := c.commandFactory.Command("nsenter", "-t", pidStr, "-n", "ip", "link", "set", "lo", "up")
-	if err := upLoopbackIf.Run(); err != nil {
-		return err
+//  1. Rename the veth interface
+//  2. Set the MAC address and MTU, if configured
+//  3. Set the IPv6 sysctls of the interface, if IPv6 is configured
+//  4. Assign the IPv4 and IPv6 addresses
+//  5. Bring the interface up
+//  6. Configure the default gateways
+//  7. Add the static routes
+func configureContainerInterface(h *netlink.Handle, iface interfaceSetup) error {
+	// 1. rename veth
+	index, err := h.LinkByName(iface.peerLink)
+	if err == nil && iface.peerLink != iface.containerLink {
+		err = h.SetLinkName(index, iface.containerLink)
+	}
+	if err != nil {
+		return &NetworkStepError{Step: "rename_veth", Link: iface.peerLink, Err: err}
 	}
 
-	// 2. rename veth
-	renameVeth := c.commandFactory.Command("nsenter", "-t", pidStr, "-n", "ip", "link", "set", networkConfig.HostInterface, "name", "eth0")
-	if err := renameVeth.Run(); err != nil {
-		return err
+	// 2. link attributes
+	if iface.mac != nil {
+		if err := h.SetLinkHardwareAddr(index, iface.mac); err != nil {
+			return &NetworkStepError{Step: "set_mac", Link: iface.containerLink, Err: err}
+		}
+	}
+	if iface.mtu > 0 {
+		if err := h.SetLinkMTU(index, iface.mtu); err != nil {
+			return &NetworkStepError{Step: "set_mtu", Link: iface.containerLink, Err: err}
+		}
 	}
 
-	// 3. assign address
-	assignAddr := c.commandFactory.Command("nsenter", "-t", pidStr, "-n", "ip", "addr", "add", networkConfig.Interface.IPv4.Address, "dev", "eth0")
-	if err := assignAddr.Run(); err != nil {
-		return err
+	// 3. ipv6 sysctls
+	//      sysctls under /proc/sys/net belong to the netns of this thread
+	if iface.address6 != nil {
+		if err := setIPv6Sysctls(iface.containerLink, iface.disableDAD6); err != nil {
+			return &NetworkStepError{Step: "set_ipv6_sysctl", Link: iface.containerLink, Err: err}
+		}
 	}
 
-	// 4. up veth
-	upVeth := c.commandFactory.Command("nsenter", "-t", pidStr, "-n", "ip", "link", "set", "eth0", "up")
-	if err := upVeth.Run(); err != nil {
-		return err
+	// 4. assign address
+	if iface.address != nil {
+		if err := h.AddAddr(index, iface.address, 0); err != nil {
+			return &NetworkStepError{Step: "assign_address", Link: iface.containerLink, Err: err}
+		}
+	}
+	if iface.address6 != nil {
+		var flags uint8
+		if iface.disableDAD6 {
+			flags = unix.IFA_F_NODAD
+		}
+		if err := h.AddAddr(index, iface.address6, flags); err != nil {
+			return &NetworkStepError{Step: "assign_address6", Link: iface.containerLink, Err: err}
+		}
+	}
+
+	// 5. up veth
+	if err := h.SetLinkUp(index); err != nil {
+		return &NetworkStepError{Step: "up_interface", Link: iface.containerLink, Err: err}
+	}
+
+	// 6. set gateway
+	if iface.gateway != nil {
+		if err := h.AddRoute(index, nil, iface.gateway); err != nil {
+			return &NetworkStepError{Step: "add_default_route", Link: iface.containerLink, Err: err}
+		}
+	}
+	if iface.gateway6 != nil {
+		if err := h.AddRoute(index, nil, iface.gateway6); err != nil {
+			return &NetworkStepError{Step: "add_default_route6", Link: iface.containerLink, Err: err}
+		}
+	}
+
+	// 7. static routes
+	for _, r := range iface.routes {
+		if err := h.AddRoute(index, r.destination, r.gateway); err != nil {
+			return &NetworkStepError{Step: "add_route", Link: iface.containerLink, Err: fmt.Errorf("%s: %w", r.destination, err)}
+		}
+	}
+	return nil
+}
+
+// setIPv6Sysctls enables IPv6 on the interface for static addressing:
+// router advertisements are ignored and, if requested, duplicate address
+// detection is disabled.
+func setIPv6Sysctls(link string, disableDAD bool) error {
+	sysctls := [][2]string{
+		{"disable_ipv6", "0"},
+		{"accept_ra", "0"},
+	}
+	if disableDAD {
+		sysctls = append(sysctls, [2]string{"accept_dad", "0"})
+	}
+	for _, kv := range sysctls {
+		path := filepath.Join("/proc/sys/net/ipv6/conf", link, kv[0])
+		if err := os.WriteFile(path, []byte(kv[1]), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove tears down the host-side network resources of the container.
+//
+// The workflow is:
+//  1. Parse the network configuration from container annotations
+//  2. Remove the published ports and the firewall policy of the
+//     container
+//  3. Delete the host-side veth of every interface, which also removes
+//     its peer if the container network namespace still exists
+//
+// An interface that no longer exists is not an error, so remove can be
+// called on a partially set up or already torn down container. Every
+// interface is attempted even if an earlier one fails. With the cni
+// backend the DEL of the CNI plugins is run instead of step 3.
+func (c *containerNetworkController) remove(containerId string, containerSpec spec.Spec) error {
+	if isNamespaceJoined(containerSpec.LinuxSpec, "network") || containerSpec.Annotations.Net == "" {
+		return nil
 	}
 
-	// 5. set gateway
-	setGateway := c.commandFactory.Command("nsenter", "-t", pidStr, "-n", "ip", "route", "add", "default", "via", networkConfig.Interface.IPv4.Gateway)
-	if err := setGateway.Run(); err != nil {
+	// 1. retrieve network config from annotation
+	networkConfig, err := spec.ParseNetConfig(containerSpec.Annotations)
+	if err != nil {
+		return &NetworkStepError{Step: "parse_config", Err: err}
+	}
+
+	// 2. remove published ports and policy
+	var errs []error
+	if err := c.portPublisher.unpublish(containerId); err != nil {
+		errs = append(errs, &NetworkStepError{Step: "unpublish_ports", Err: err})
+	}
+	if err := c.policyEnforcer.remove(containerId); err != nil {
+		errs = append(errs, &NetworkStepError{Step: "remove_policy", Err: err})
+	}
+	if networkConfig.Backend == networkBackendCni {
+		if err := c.cniBackend.remove(containerId, containerSpec); err != nil {
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+
+	// 3. delete host veths
+	for _, iface := range networkConfig.Interfaces {
+		if iface.Name == "" {
+			continue
+		}
+		if err := c.deleteLink(iface.Name); err != nil {
+			errs = append(errs, &NetworkStepError{Step: "delete_veth", Link: iface.Name, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// listBridgePorts returns the names of the veth interfaces attached to
+// the bridge.
+func (c *containerNetworkController) listBridgePorts(bridge string) ([]string, error) {
+	h, err := netlink.NewHandle()
+	if err != nil {
+		return nil, err
+	}
+	defer h.Close()
+
+	bridgeIndex, err := h.LinkByName(bridge)
+	if err != nil {
+		return nil, err
+	}
+	links, err := h.LinkList()
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []string
+	for _, link := range links {
+		if link.Kind == "veth" && link.MasterIndex == bridgeIndex {
+			ports = append(ports, link.Name)
+		}
+	}
+	return ports, nil
+}
+
+// deleteLink deletes the link with the given name. A link that does not
+// exist is ignored.
+func (c *containerNetworkController) deleteLink(name string) error {
+	h, err := netlink.NewHandle()
+	if err != nil {
 		return err
 	}
+	defer h.Close()
 
+	index, err := h.LinkByName(name)
+	if err != nil {
+		if errors.Is(err, unix.ENODEV) {
+			return nil
+		}
+		return err
+	}
+	if err := h.DeleteLink(index); err != nil && !errors.Is(err, unix.ENODEV) {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,66 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"fmt"
+)
+
+// NewNetworkCheck constructs a NetworkCheck with the default
+// implementations of its dependencies.
+// This is the main entry point for the `network check` workflow, which
+// asks the CNI plugins of a container to verify its network.
+func NewNetworkCheck() *NetworkCheck {
+	return &NetworkCheck{
+		specLoader:             newFileSpecLoader(),
+		containerStatusManager: status.NewStatusHandler(),
+		cniBackend:             newCniNetworkController(),
+	}
+}
+
+// NetworkCheck runs the CHECK of the CNI plugins of a container.
+type NetworkCheck struct {
+	specLoader             specLoader
+	containerStatusManager status.ContainerStatusManager
+	cniBackend             networkBackend
+}
+
+// Check verifies the network of a created, running or paused container.
+//
+// The workflow is:
+//  1. Check the container status and resolve its init process
+//  2. Load the OCI spec (config.json) and make sure it uses the cni
+//     backend
+//  3. Run CHECK of the CNI plugins in the container network namespace
+func (n *NetworkCheck) Check(opt NetworkCheckOption) error {
+	// 1. check status
+	containerStatus, err := n.containerStatusManager.GetStatusFromId(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	switch containerStatus {
+	case status.CREATED, status.RUNNING, status.PAUSED:
+	default:
+		return fmt.Errorf("container is not running. current status: %s", containerStatus)
+	}
+	pid, err := n.containerStatusManager.GetPidFromId(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+
+	// 2. load config.json
+	containerSpec, err := n.specLoader.loadFile(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	networkConfig, err := spec.ParseNetConfig(containerSpec.Annotations)
+	if err != nil {
+		return err
+	}
+	if networkConfig.Backend != networkBackendCni {
+		return fmt.Errorf("network check requires network backend cni")
+	}
+
+	// 3. CHECK
+	return n.cniBackend.check(opt.ContainerId, pid, containerSpec)
+}
@@ -0,0 +1,329 @@
+package container
+
+import (
+	"bytes"
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// network backends of the io.raind.net.config annotation
+const (
+	networkBackendBuiltin = "builtin"
+	networkBackendCni     = "cni"
+)
+
+// cniDefaultIfName is the interface created in the container netns when
+// the annotation does not name one.
+const cniDefaultIfName = "eth0"
+
+// newCniNetworkController constructs a cniNetworkController that reads
+// conflists from the CNI configuration directory and runs the plugins
+// found in the CNI plugin path.
+func newCniNetworkController() *cniNetworkController {
+	return &cniNetworkController{
+		commandFactory: utils.NewCommandFactory(),
+		confDir:        utils.CniConfDir(),
+		pluginPath:     utils.CniPath(),
+	}
+}
+
+// networkBackend defines the behavior of an alternative implementation
+// of bridge mode networking.
+type networkBackend interface {
+	containerNetworkPreparer
+	containerNetworkRemover
+	check(containerId string, pid int, containerSpec spec.Spec) error
+}
+
+// cniNetworkController is the CNI implementation of networkBackend.
+//
+// It executes the plugins of a network configuration list following the
+// CNI protocol: the command and its parameters are passed in CNI_*
+// environment variables, the plugin configuration on stdin, and the
+// result or error is read from stdout. The result of ADD is persisted in
+// the container directory and passed as prevResult to CHECK and DEL.
+type cniNetworkController struct {
+	commandFactory utils.CommandFactory
+	confDir        string
+	pluginPath     string
+}
+
+// cniNetworkList is a CNI network configuration list (.conflist).
+type cniNetworkList struct {
+	CniVersion   string           `json:"cniVersion"`
+	Name         string           `json:"name"`
+	DisableCheck bool             `json:"disableCheck,omitempty"`
+	Plugins      []map[string]any `json:"plugins"`
+}
+
+// cniResultFile is the persisted result of the ADD of a container.
+type cniResultFile struct {
+	Network string          `json:"network"`
+	IfName  string          `json:"ifName"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// cniError is the error a plugin prints on stdout when it fails.
+type cniError struct {
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+	Details string `json:"details,omitempty"`
+}
+
+// prepare runs ADD of every plugin of the conflist for the container
+// netns, in order, and persists the result of the last plugin.
+func (c *cniNetworkController) prepare(containerId string, pid int, containerSpec spec.Spec) error {
+	cni, err := cniConfigOf(containerSpec)
+	if err != nil {
+		return &NetworkStepError{Step: "parse_config", Err: err}
+	}
+	networkList, err := c.loadNetworkList(cni.Network)
+	if err != nil {
+		return &NetworkStepError{Step: "load_cni_config", Err: err}
+	}
+	netnsPath := fmt.Sprintf("/proc/%d/ns/net", pid)
+
+	var result json.RawMessage
+	for _, plugin := range networkList.Plugins {
+		result, err = c.invoke(networkList, plugin, "ADD", containerId, netnsPath, cni.IfName, result)
+		if err != nil {
+			return &NetworkStepError{Step: "cni_add", Link: cni.IfName, Err: err}
+		}
+	}
+
+	if err := utils.WriteJsonToFile(utils.CniResultPath(containerId), cniResultFile{
+		Network: cni.Network,
+		IfName:  cni.IfName,
+		Result:  result,
+	}); err != nil {
+		return &NetworkStepError{Step: "save_cni_result", Err: err}
+	}
+	return nil
+}
+
+// remove runs DEL of every plugin of the conflist, in reverse order, and
+// removes the persisted result.
+//
+// DEL is also run when ADD did not complete, without prevResult, so that
+// plugins can release what they allocated. The container netns is gone
+// by the time a container is deleted, so CNI_NETNS is left empty.
+func (c *cniNetworkController) remove(containerId string, containerSpec spec.Spec) error {
+	cni, err := cniConfigOf(containerSpec)
+	if err != nil {
+		return &NetworkStepError{Step: "parse_config", Err: err}
+	}
+	networkList, err := c.loadNetworkList(cni.Network)
+	if err != nil {
+		return &NetworkStepError{Step: "load_cni_config", Err: err}
+	}
+	resultFile, err := readCniResult(containerId)
+	if err != nil {
+		return &NetworkStepError{Step: "load_cni_result", Err: err}
+	}
+
+	for i := len(networkList.Plugins) - 1; i >= 0; i-- {
+		if _, err := c.invoke(networkList, networkList.Plugins[i], "DEL", containerId, "", cni.IfName, resultFile.Result); err != nil {
+			return &NetworkStepError{Step: "cni_del", Link: cni.IfName, Err: err}
+		}
+	}
+
+	if err := os.Remove(utils.CniResultPath(containerId)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return &NetworkStepError{Step: "remove_cni_result", Err: err}
+	}
+	return nil
+}
+
+// check runs CHECK of every plugin of the conflist, in order, against the
+// persisted result. Nothing is checked if the conflist disables it.
+func (c *cniNetworkController) check(containerId string, pid int, containerSpec spec.Spec) error {
+	cni, err := cniConfigOf(containerSpec)
+	if err != nil {
+		return &NetworkStepError{Step: "parse_config", Err: err}
+	}
+	networkList, err := c.loadNetworkList(cni.Network)
+	if err != nil {
+		return &NetworkStepError{Step: "load_cni_config", Err: err}
+	}
+	if networkList.DisableCheck {
+		return nil
+	}
+	switch networkList.CniVersion {
+	case "", "0.1.0", "0.2.0", "0.3.0", "0.3.1":
+		return &NetworkStepError{Step: "cni_check", Err: fmt.Errorf("cni version %q does not support CHECK", networkList.CniVersion)}
+	}
+	resultFile, err := readCniResult(containerId)
+	if err != nil {
+		return &NetworkStepError{Step: "load_cni_result", Err: err}
+	}
+	if resultFile.Result == nil {
+		return &NetworkStepError{Step: "load_cni_result", Err: fmt.Errorf("no cni result for container %s", containerId)}
+	}
+	netnsPath := fmt.Sprintf("/proc/%d/ns/net", pid)
+
+	for _, plugin := range networkList.Plugins {
+		if _, err := c.invoke(networkList, plugin, "CHECK", containerId, netnsPath, cni.IfName, resultFile.Result); err != nil {
+			return &NetworkStepError{Step: "cni_check", Link: cni.IfName, Err: err}
+		}
+	}
+	return nil
+}
+
+// invoke executes a single plugin and returns its stdout.
+//
+// The plugin configuration is the conflist entry with the name and
+// cniVersion of the list and, if given, the prevResult added.
+func (c *cniNetworkController) invoke(networkList cniNetworkList, plugin map[string]any, command string,
+	containerId string, netnsPath string, ifName string, prevResult json.RawMessage) (json.RawMessage, error) {
+	pluginType, _ := plugin["type"].(string)
+	if pluginType == "" {
+		return nil, fmt.Errorf("plugin of network %s has no type", networkList.Name)
+	}
+	pluginBin, err := c.findPlugin(pluginType)
+	if err != nil {
+		return nil, err
+	}
+
+	// build stdin
+	conf := map[string]any{}
+	for k, v := range plugin {
+		conf[k] = v
+	}
+	conf["name"] = networkList.Name
+	conf["cniVersion"] = networkList.CniVersion
+	if prevResult != nil {
+		conf["prevResult"] = prevResult
+	}
+	stdin, err := json.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// execute plugin
+	var stdout, stderr bytes.Buffer
+	cmd := c.commandFactory.Command(pluginBin)
+	cmd.SetEnv(append(os.Environ(),
+		"CNI_COMMAND="+command,
+		"CNI_CONTAINERID="+containerId,
+		"CNI_NETNS="+netnsPath,
+		"CNI_IFNAME="+ifName,
+		"CNI_ARGS=",
+		"CNI_PATH="+c.pluginPath,
+	))
+	cmd.SetStdin(bytes.NewReader(stdin))
+	cmd.SetStdout(&stdout)
+	cmd.SetStderr(&stderr)
+	if err := cmd.Run(); err != nil {
+		var pluginErr cniError
+		if jsonErr := json.Unmarshal(stdout.Bytes(), &pluginErr); jsonErr == nil && pluginErr.Msg != "" {
+			if pluginErr.Details != "" {
+				return nil, fmt.Errorf("plugin %s %s failed: %s: %s (code %d)", pluginType, command, pluginErr.Msg, pluginErr.Details, pluginErr.Code)
+			}
+			return nil, fmt.Errorf("plugin %s %s failed: %s (code %d)", pluginType, command, pluginErr.Msg, pluginErr.Code)
+		}
+		return nil, fmt.Errorf("plugin %s %s failed: %w: %s", pluginType, command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	// only ADD returns a result
+	if command != "ADD" {
+		return prevResult, nil
+	}
+	return json.RawMessage(bytes.TrimSpace(stdout.Bytes())), nil
+}
+
+// findPlugin returns the path of the plugin binary in the plugin path.
+func (c *cniNetworkController) findPlugin(pluginType string) (string, error) {
+	for _, dir := range filepath.SplitList(c.pluginPath) {
+		path := filepath.Join(dir, pluginType)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("cni plugin %q not found in %s", pluginType, c.pluginPath)
+}
+
+// loadNetworkList returns the conflist with the given network name from
+// the configuration directory.
+func (c *cniNetworkController) loadNetworkList(network string) (cniNetworkList, error) {
+	files, err := filepath.Glob(filepath.Join(c.confDir, "*.conflist"))
+	if err != nil {
+		return cniNetworkList{}, err
+	}
+	for _, file := range files {
+		var networkList cniNetworkList
+		if err := utils.ReadJsonFile(file, &networkList); err != nil {
+			return cniNetworkList{}, fmt.Errorf("%s: %w", file, err)
+		}
+		if networkList.Name != network {
+			continue
+		}
+		if len(networkList.Plugins) == 0 {
+			return cniNetworkList{}, fmt.Errorf("%s: network %s has no plugins", file, network)
+		}
+		return networkList, nil
+	}
+	return cniNetworkList{}, fmt.Errorf("cni network %s not found in %s", network, c.confDir)
+}
+
+// cniConfigOf returns the CNI configuration of the annotation with the
+// default interface name applied.
+func cniConfigOf(containerSpec spec.Spec) (spec.CniObject, error) {
+	networkConfig, err := spec.ParseNetConfig(containerSpec.Annotations)
+	if err != nil {
+		return spec.CniObject{}, err
+	}
+	if networkConfig.Cni == nil || networkConfig.Cni.Network == "" {
+		return spec.CniObject{}, fmt.Errorf("backend cni requires a cni network")
+	}
+	cni := *networkConfig.Cni
+	if cni.IfName == "" {
+		cni.IfName = cniDefaultIfName
+	}
+	return cni, nil
+}
+
+// cniHostInterfaces returns the names of the host side interfaces, those
+// without a sandbox, in the persisted ADD result of the container. ok is
+// false when there is no result yet.
+func cniHostInterfaces(containerId string) (names []string, ok bool, err error) {
+	resultFile, err := readCniResult(containerId)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(resultFile.Result) == 0 {
+		return nil, false, nil
+	}
+	var result struct {
+		Interfaces []struct {
+			Name    string `json:"name"`
+			Sandbox string `json:"sandbox,omitempty"`
+		} `json:"interfaces"`
+	}
+	if err := json.Unmarshal(resultFile.Result, &result); err != nil {
+		return nil, false, err
+	}
+	for _, iface := range result.Interfaces {
+		if iface.Sandbox == "" && iface.Name != "" {
+			names = append(names, iface.Name)
+		}
+	}
+	return names, true, nil
+}
+
+// readCniResult reads the persisted result of the container. A missing
+// file yields an empty result.
+func readCniResult(containerId string) (cniResultFile, error) {
+	var resultFile cniResultFile
+	if err := utils.ReadJsonFile(utils.CniResultPath(containerId), &resultFile); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return cniResultFile{}, err
+		}
+	}
+	return resultFile, nil
+}
@@ -0,0 +1,119 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubCniPlugin logs each call as "<type> <command> <ifname> <stdin>" and
+// prints a result naming the plugin, or an error if CNI_COMMAND is FAIL.
+const stubCniPlugin = `#!/bin/sh
+stdin=$(cat)
+echo "$(basename "$0") $CNI_COMMAND $CNI_IFNAME $stdin" >> "$(dirname "$0")/calls.log"
+if [ "$CNI_COMMAND" = "ADD" ]; then
+	echo '{"cniVersion":"1.0.0","interfaces":[{"name":"'"$(basename "$0")"'"}]}'
+fi
+`
+
+const failCniPlugin = `#!/bin/sh
+echo '{"cniVersion":"1.0.0","code":11,"msg":"failed to allocate","details":"pool exhausted"}'
+exit 1
+`
+
+func newTestCniNetworkController(t *testing.T) (*cniNetworkController, string) {
+	tmp := t.TempDir()
+	t.Setenv("RAIND_ROOT_DIR", tmp)
+	assert.Nil(t, os.MkdirAll(filepath.Join(tmp, "111111"), 0755))
+
+	binDir := filepath.Join(tmp, "bin")
+	confDir := filepath.Join(tmp, "net.d")
+	assert.Nil(t, os.MkdirAll(binDir, 0755))
+	assert.Nil(t, os.MkdirAll(confDir, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(binDir, "bridge"), []byte(stubCniPlugin), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(binDir, "portmap"), []byte(stubCniPlugin), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(binDir, "fail"), []byte(failCniPlugin), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(confDir, "10-raind.conflist"), []byte(`{
+		"cniVersion": "1.0.0",
+		"name": "raind",
+		"plugins": [{"type": "bridge", "bridge": "cni0"}, {"type": "portmap"}]
+	}`), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(confDir, "20-broken.conflist"), []byte(`{
+		"cniVersion": "1.0.0",
+		"name": "broken",
+		"plugins": [{"type": "fail"}]
+	}`), 0644))
+
+	return &cniNetworkController{
+		commandFactory: utils.NewCommandFactory(),
+		confDir:        confDir,
+		pluginPath:     binDir,
+	}, binDir
+}
+
+func buildCniSpec(network string) spec.Spec {
+	return buildNetworkModeSpec(`{"mode":"bridge","backend":"cni","cni":{"network":"`+network+`"}}`, spec.NamespaceObject{Type: "network"})
+}
+
+func TestCniNetwork_AddAndDel(t *testing.T) {
+	// == arrange ==
+	controller, binDir := newTestCniNetworkController(t)
+	containerSpec := buildCniSpec("raind")
+
+	// == act ==
+	addErr := controller.prepare("111111", 4321, containerSpec)
+	var resultFile cniResultFile
+	readErr := utils.ReadJsonFile(utils.CniResultPath("111111"), &resultFile)
+	delErr := controller.remove("111111", containerSpec)
+
+	// == assert ==
+	assert.Nil(t, addErr)
+	assert.Nil(t, readErr)
+	assert.Equal(t, "raind", resultFile.Network)
+	assert.JSONEq(t, `{"cniVersion":"1.0.0","interfaces":[{"name":"portmap"}]}`, string(resultFile.Result))
+	assert.Nil(t, delErr)
+	assert.NoFileExists(t, utils.CniResultPath("111111"))
+
+	data, _ := os.ReadFile(filepath.Join(binDir, "calls.log"))
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, calls, 4)
+	assert.True(t, strings.HasPrefix(calls[0], "bridge ADD eth0 "))
+	assert.True(t, strings.HasPrefix(calls[1], "portmap ADD eth0 "))
+	assert.True(t, strings.HasPrefix(calls[2], "portmap DEL eth0 "))
+	assert.True(t, strings.HasPrefix(calls[3], "bridge DEL eth0 "))
+
+	// the second plugin gets the result of the first one
+	var conf map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(strings.SplitN(calls[1], " ", 4)[3]), &conf))
+	assert.Equal(t, "raind", conf["name"])
+	assert.Equal(t, "1.0.0", conf["cniVersion"])
+	assert.Equal(t, map[string]any{"cniVersion": "1.0.0", "interfaces": []any{map[string]any{"name": "bridge"}}}, conf["prevResult"])
+}
+
+func TestCniNetwork_PluginError(t *testing.T) {
+	// == arrange ==
+	controller, _ := newTestCniNetworkController(t)
+
+	// == act ==
+	err := controller.prepare("111111", 4321, buildCniSpec("broken"))
+
+	// == assert ==
+	assert.EqualError(t, err, "network cni_add (eth0): plugin fail ADD failed: failed to allocate: pool exhausted (code 11)")
+}
+
+func TestCniNetwork_NetworkNotFound(t *testing.T) {
+	// == arrange ==
+	controller, _ := newTestCniNetworkController(t)
+
+	// == act ==
+	err := controller.prepare("111111", 4321, buildCniSpec("missing"))
+
+	// == assert ==
+	assert.EqualError(t, err, "network load_cni_config: cni network missing not found in "+controller.confDir)
+}
@@ -0,0 +1,124 @@
+package container
+
+import (
+	"droplet/internal/ipam"
+	"droplet/internal/spec"
+	"fmt"
+)
+
+// addressAuto is the IPv4 address of the io.raind.net.config annotation
+// that asks for an address from the IPAM pool of the bridge.
+const addressAuto = "auto"
+
+// newContainerAddressAllocator constructs a containerAddressAllocator with
+// the default IPAM lease store.
+func newContainerAddressAllocator() *containerAddressAllocator {
+	return &containerAddressAllocator{
+		addressManager: ipam.NewIpamHandler(),
+	}
+}
+
+// addressAllocator defines the behavior required to lease the addresses
+// of container interfaces before the network is configured, and to give
+// them back when the container is removed or its creation fails.
+type addressAllocator interface {
+	allocate(containerId string, containerSpec *spec.Spec) ([]string, error)
+	release(containerId string) error
+	releaseInterfaces(containerId string, ifaces []string) error
+}
+
+// containerAddressAllocator is the default implementation of
+// addressAllocator.
+type containerAddressAllocator struct {
+	addressManager ipam.AddressManager
+}
+
+// allocate leases the IPv4 address of every interface of a bridge mode
+// container and rewrites the annotation of the spec with the result.
+//
+// An "auto" address is allocated from the pool of the interface bridge.
+// Its default gateway is set to the pool gateway unless another interface
+// of the container already has an IPv4 gateway. Static addresses are
+// recorded as well, which fails if the address is leased to another
+// container.
+//
+// The interfaces leased by this call are returned, which excludes those
+// that already held a lease. If any interface fails, they are released
+// again and the earlier leases are kept.
+func (a *containerAddressAllocator) allocate(containerId string, containerSpec *spec.Spec) (leased []string, err error) {
+	mode, networkConfig, err := networkModeOf(*containerSpec)
+	if err != nil {
+		return nil, err
+	}
+	if mode.kind != networkModeBridge {
+		return nil, nil
+	}
+
+	leases, err := a.addressManager.ListLeases()
+	if err != nil {
+		return nil, err
+	}
+	held := map[string]bool{}
+	for _, l := range leases {
+		if l.ContainerId == containerId {
+			held[l.Interface] = true
+		}
+	}
+
+	defer func() {
+		if err != nil {
+			_ = a.addressManager.ReleaseInterfaces(containerId, leased)
+			leased = nil
+		}
+	}()
+
+	hasGateway := false
+	for _, i := range networkConfig.Interfaces {
+		if i.IPv4.Gateway != "" {
+			hasGateway = true
+		}
+	}
+
+	rewrite := false
+	for n := range networkConfig.Interfaces {
+		i := &networkConfig.Interfaces[n]
+		switch i.IPv4.Address {
+		case "":
+			continue
+		case addressAuto:
+			lease, err := a.addressManager.Allocate(containerId, i.Name, i.BridgeInterface)
+			if err != nil {
+				return leased, fmt.Errorf("allocate address of %s: %w", i.Name, err)
+			}
+			i.IPv4.Address = lease.Address
+			if !hasGateway {
+				i.IPv4.Gateway = lease.Gateway
+				hasGateway = true
+			}
+			rewrite = true
+		default:
+			if _, err := a.addressManager.Reserve(containerId, i.Name, i.BridgeInterface, i.IPv4.Address); err != nil {
+				return leased, fmt.Errorf("reserve address of %s: %w", i.Name, err)
+			}
+		}
+		if !held[i.Name] {
+			leased = append(leased, i.Name)
+		}
+	}
+
+	if !rewrite {
+		return leased, nil
+	}
+	return leased, spec.EncodeNetConfig(&containerSpec.Annotations, networkConfig)
+}
+
+// release gives back every address leased to the container.
+func (a *containerAddressAllocator) release(containerId string) error {
+	return a.addressManager.Release(containerId)
+}
+
+// releaseInterfaces gives back the addresses leased to the given
+// interfaces of the container.
+func (a *containerAddressAllocator) releaseInterfaces(containerId string, ifaces []string) error {
+	return a.addressManager.ReleaseInterfaces(containerId, ifaces)
+}
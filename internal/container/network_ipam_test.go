@@ -0,0 +1,90 @@
+package container
+
+import (
+	"droplet/internal/ipam"
+	"droplet/internal/spec"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAddressManager struct {
+	ipam.AddressManager
+	reserveErr         error
+	reserved           []string
+	released           []string
+	releasedInterfaces []string
+	leases             []ipam.Lease
+}
+
+func (f *fakeAddressManager) Allocate(containerId string, iface string, bridge string) (ipam.Lease, error) {
+	return ipam.Lease{ContainerId: containerId, Interface: iface, Bridge: bridge, Address: "10.166.0.2/24", Gateway: "10.166.0.254"}, nil
+}
+
+func (f *fakeAddressManager) Reserve(containerId string, iface string, bridge string, address string) (ipam.Lease, error) {
+	f.reserved = append(f.reserved, address)
+	return ipam.Lease{}, f.reserveErr
+}
+
+func (f *fakeAddressManager) Release(containerId string) error {
+	f.released = append(f.released, containerId)
+	return nil
+}
+
+func (f *fakeAddressManager) ReleaseInterfaces(containerId string, ifaces []string) error {
+	f.releasedInterfaces = append(f.releasedInterfaces, ifaces...)
+	return nil
+}
+
+func (f *fakeAddressManager) ListLeases() ([]ipam.Lease, error) {
+	return f.leases, nil
+}
+
+func TestAddressAllocate_Auto(t *testing.T) {
+	// == arrange ==
+	containerSpec := buildNetworkModeSpec(
+		`{"mode":"bridge","interfaces":[`+
+			`{"name":"rd_data","bridgeInterface":"raind0","ipv4":{"address":"auto"}},`+
+			`{"name":"rd_mgmt","bridgeInterface":"raind1","ipv4":{"address":"192.168.100.2/24"}}]}`,
+		spec.NamespaceObject{Type: "network"},
+	)
+	manager := &fakeAddressManager{}
+	allocator := &containerAddressAllocator{addressManager: manager}
+
+	// == act ==
+	leased, err := allocator.allocate("111111", &containerSpec)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"rd_data", "rd_mgmt"}, leased)
+	assert.Equal(t, []string{"192.168.100.2/24"}, manager.reserved)
+	networkConfig, _ := spec.ParseNetConfig(containerSpec.Annotations)
+	assert.Equal(t, spec.IPv4Object{Address: "10.166.0.2/24", Gateway: "10.166.0.254"}, networkConfig.Interfaces[0].IPv4)
+	assert.Equal(t, spec.IPv4Object{Address: "192.168.100.2/24"}, networkConfig.Interfaces[1].IPv4)
+}
+
+func TestAddressAllocate_DuplicateReleasesOwnLeases(t *testing.T) {
+	// == arrange ==
+	containerSpec := buildNetworkModeSpec(
+		`{"mode":"bridge","interfaces":[`+
+			`{"name":"rd_held","bridgeInterface":"raind0","ipv4":{"address":"auto"}},`+
+			`{"name":"rd_data","bridgeInterface":"raind0","ipv4":{"address":"auto"}},`+
+			`{"name":"rd_mgmt","bridgeInterface":"raind1","ipv4":{"address":"10.166.0.2/24"}}]}`,
+		spec.NamespaceObject{Type: "network"},
+	)
+	manager := &fakeAddressManager{
+		reserveErr: errors.New("address 10.166.0.2 is already leased to container 222222 (rd_222222)"),
+		leases:     []ipam.Lease{{ContainerId: "111111", Interface: "rd_held"}},
+	}
+	allocator := &containerAddressAllocator{addressManager: manager}
+
+	// == act ==
+	leased, err := allocator.allocate("111111", &containerSpec)
+
+	// == assert ==
+	assert.EqualError(t, err, "reserve address of rd_mgmt: address 10.166.0.2 is already leased to container 222222 (rd_222222)")
+	assert.Nil(t, leased)
+	assert.Equal(t, []string{"rd_data"}, manager.releasedInterfaces)
+	assert.Nil(t, manager.released)
+}
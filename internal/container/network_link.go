@@ -0,0 +1,225 @@
+package container
+
+import (
+	"crypto/sha256"
+	"droplet/internal/netlink"
+	"droplet/internal/status"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"time"
+)
+
+// macAuto derives the MAC address of a veth end from its host link name,
+// so that it stays the same when the container is recreated.
+const macAuto = "auto"
+
+const (
+	// rateLimitLatency is the longest time a packet waits in the tbf queue
+	// of an ingress rate limit
+	rateLimitLatency = 50 * time.Millisecond
+	// minRateLimitBurst is the smallest default burst of a rate limit. It
+	// holds a GRO packet, which the egress policer cannot split.
+	minRateLimitBurst = 64 << 10
+)
+
+// rateLimit is a parsed rate limit. A zero rate is no limit.
+type rateLimit struct {
+	// rate in bytes per second
+	rate  uint64
+	burst uint32
+}
+
+// parseLinkMac parses the MAC address of a veth end, deriving it from
+// seed if it is auto. An empty value leaves the address to the kernel.
+func parseLinkMac(value string, seed string) (net.HardwareAddr, error) {
+	switch value {
+	case "":
+		return nil, nil
+	case macAuto:
+		return deriveMac(seed), nil
+	}
+	mac, err := net.ParseMAC(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(mac) != 6 || mac[0]&0x01 != 0 {
+		return nil, fmt.Errorf("not a unicast ethernet address: %s", value)
+	}
+	return mac, nil
+}
+
+// deriveMac returns a locally administered unicast MAC address derived
+// from seed.
+func deriveMac(seed string) net.HardwareAddr {
+	sum := sha256.Sum256([]byte(seed))
+	mac := net.HardwareAddr(sum[:6])
+	mac[0] = mac[0]&0xfe | 0x02
+	return mac
+}
+
+// parseRateLimit converts a rate in bits per second and a burst in bytes
+// to a rateLimit. The rate is rounded down to whole bytes; the burst
+// defaults to the traffic of 10ms, and at least minRateLimitBurst.
+func parseRateLimit(rate uint64, burst uint64) (rateLimit, error) {
+	if rate == 0 {
+		if burst != 0 {
+			return rateLimit{}, fmt.Errorf("burst requires a rate")
+		}
+		return rateLimit{}, nil
+	}
+	limit := rateLimit{rate: rate / 8}
+	if limit.rate == 0 {
+		return rateLimit{}, fmt.Errorf("invalid rate: %d", rate)
+	}
+	if burst == 0 {
+		burst = max(limit.rate/100, minRateLimitBurst)
+	}
+	if burst > math.MaxUint32 {
+		return rateLimit{}, fmt.Errorf("invalid burst: %d", burst)
+	}
+	limit.burst = uint32(burst)
+	return limit, nil
+}
+
+// applyRateLimits shapes the traffic to the container with a tbf qdisc
+// on the host veth, and polices the traffic from the container on the
+// ingress of the host veth.
+func applyRateLimits(h *netlink.Handle, index int, iface interfaceSetup) error {
+	if iface.ingress.rate != 0 {
+		if err := h.SetTbfQdisc(index, iface.ingress.rate, iface.ingress.burst, rateLimitLatency); err != nil {
+			return &NetworkStepError{Step: "set_ingress_rate", Link: iface.hostLink, Err: err}
+		}
+	}
+	if iface.egress.rate != 0 {
+		if err := h.SetIngressPolice(index, iface.egress.rate, iface.egress.burst); err != nil {
+			return &NetworkStepError{Step: "set_egress_rate", Link: iface.hostLink, Err: err}
+		}
+	}
+	return nil
+}
+
+// inspectInterfaces reads back the MAC addresses, MTU and rate limits of
+// the interfaces from the host and the container netns, and checks them
+// against the annotation.
+func (c *containerNetworkController) inspectInterfaces(netnsPath string, setup networkSetup) ([]status.InterfaceObject, error) {
+	h, err := netlink.NewHandle()
+	if err != nil {
+		return nil, &NetworkStepError{Step: "open_netlink", Err: err}
+	}
+	defer h.Close()
+
+	// 1. host side
+	var interfaces []status.InterfaceObject
+	var containerMtus []int
+	for _, iface := range setup.interfaces {
+		inspected, err := inspectHostLink(h, iface)
+		if err != nil {
+			return nil, &NetworkStepError{Step: "verify_interface", Link: iface.hostLink, Err: err}
+		}
+		interfaces = append(interfaces, inspected)
+	}
+
+	// 2. container side
+	err = netlink.RunInNetns(netnsPath, func(h *netlink.Handle) error {
+		for i, iface := range setup.interfaces {
+			link, err := linkByName(h, iface.containerLink)
+			if err != nil {
+				return &NetworkStepError{Step: "verify_interface", Link: iface.containerLink, Err: err}
+			}
+			interfaces[i].Mac = link.HardwareAddr.String()
+			containerMtus = append(containerMtus, link.MTU)
+		}
+		return nil
+	})
+	var stepErr *NetworkStepError
+	if err != nil && !errors.As(err, &stepErr) {
+		return nil, &NetworkStepError{Step: "enter_netns", Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. compare
+	for i, iface := range setup.interfaces {
+		if containerMtus[i] != interfaces[i].Mtu {
+			return nil, &NetworkStepError{Step: "verify_interface", Link: iface.containerLink,
+				Err: fmt.Errorf("mtu %d differs from the host side %d", containerMtus[i], interfaces[i].Mtu)}
+		}
+		if err := checkInterfaceStatus(iface, interfaces[i]); err != nil {
+			return nil, &NetworkStepError{Step: "verify_interface", Link: iface.hostLink, Err: err}
+		}
+	}
+	return interfaces, nil
+}
+
+// inspectHostLink reads the settings of the host veth of an interface.
+func inspectHostLink(h *netlink.Handle, iface interfaceSetup) (status.InterfaceObject, error) {
+	link, err := linkByName(h, iface.hostLink)
+	if err != nil {
+		return status.InterfaceObject{}, err
+	}
+	inspected := status.InterfaceObject{
+		Name:               iface.hostLink,
+		ContainerInterface: iface.containerLink,
+		HostMac:            link.HardwareAddr.String(),
+		Mtu:                link.MTU,
+	}
+
+	qdiscs, err := h.QdiscList(link.Index)
+	if err != nil {
+		return inspected, fmt.Errorf("list qdiscs: %w", err)
+	}
+	hasIngress := false
+	for _, q := range qdiscs {
+		switch {
+		case q.Kind == "tbf" && q.Parent == netlink.HandleRoot:
+			inspected.IngressRate = q.Rate * 8
+		case q.Kind == "ingress":
+			hasIngress = true
+		}
+	}
+	if hasIngress {
+		filters, err := h.IngressFilterList(link.Index)
+		if err != nil {
+			return inspected, fmt.Errorf("list filters: %w", err)
+		}
+		for _, f := range filters {
+			if f.PoliceRate != 0 {
+				inspected.EgressRate = f.PoliceRate * 8
+			}
+		}
+	}
+	return inspected, nil
+}
+
+// checkInterfaceStatus compares the settings read back from the kernel
+// with those of the annotation.
+func checkInterfaceStatus(iface interfaceSetup, inspected status.InterfaceObject) error {
+	if iface.mtu > 0 && inspected.Mtu != iface.mtu {
+		return fmt.Errorf("mtu is %d, expected %d", inspected.Mtu, iface.mtu)
+	}
+	if iface.mac != nil && inspected.Mac != iface.mac.String() {
+		return fmt.Errorf("mac is %s, expected %s", inspected.Mac, iface.mac)
+	}
+	if iface.hostMac != nil && inspected.HostMac != iface.hostMac.String() {
+		return fmt.Errorf("host mac is %s, expected %s", inspected.HostMac, iface.hostMac)
+	}
+	if inspected.IngressRate != iface.ingress.rate*8 {
+		return fmt.Errorf("ingress rate is %dbit, expected %dbit", inspected.IngressRate, iface.ingress.rate*8)
+	}
+	if inspected.EgressRate != iface.egress.rate*8 {
+		return fmt.Errorf("egress rate is %dbit, expected %dbit", inspected.EgressRate, iface.egress.rate*8)
+	}
+	return nil
+}
+
+// linkByName returns the attributes of the named link.
+func linkByName(h *netlink.Handle, name string) (netlink.Link, error) {
+	index, err := h.LinkByName(name)
+	if err != nil {
+		return netlink.Link{}, err
+	}
+	return h.LinkByIndex(index)
+}
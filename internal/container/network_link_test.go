@@ -0,0 +1,130 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNetworkSetup_LinkAttributes(t *testing.T) {
+	// == arrange ==
+	networkConfig := spec.NetConfigObject{
+		Interfaces: []spec.InterfaceObject{
+			{
+				Name:               "rd_01234567",
+				HostInterface:      "vethc_01234567",
+				BridgeInterface:    "raind0",
+				ContainerInterface: "eth0",
+				Mac:                "auto",
+				HostMac:            "02:00:00:00:00:01",
+				Mtu:                1400,
+				IngressRate:        10000000,
+				EgressRate:         1000000,
+				EgressBurst:        131072,
+				IPv4:               spec.IPv4Object{Address: "10.166.0.2/24"},
+			},
+		},
+	}
+
+	// == act ==
+	setup, err := parseNetworkSetup(networkConfig)
+
+	// == assert ==
+	assert.Nil(t, err)
+	iface := setup.interfaces[0]
+	assert.Equal(t, deriveMac("rd_01234567/container"), iface.mac)
+	assert.Equal(t, "02:00:00:00:00:01", iface.hostMac.String())
+	assert.Equal(t, 1400, iface.mtu)
+	assert.Equal(t, rateLimit{rate: 1250000, burst: minRateLimitBurst}, iface.ingress)
+	assert.Equal(t, rateLimit{rate: 125000, burst: 131072}, iface.egress)
+}
+
+func TestParseNetworkSetup_InvalidRateLimit(t *testing.T) {
+	// == arrange ==
+	networkConfig := spec.NetConfigObject{
+		Interfaces: []spec.InterfaceObject{
+			{
+				Name:               "rd_01234567",
+				HostInterface:      "vethc_01234567",
+				BridgeInterface:    "raind0",
+				ContainerInterface: "eth0",
+				EgressBurst:        65536,
+				IPv4:               spec.IPv4Object{Address: "10.166.0.2/24"},
+			},
+		},
+	}
+
+	// == act ==
+	_, err := parseNetworkSetup(networkConfig)
+
+	// == assert ==
+	var stepErr *NetworkStepError
+	assert.True(t, errors.As(err, &stepErr))
+	assert.EqualError(t, err, "network parse_config (eth0): egress: burst requires a rate")
+}
+
+func TestParseLinkMac_Multicast(t *testing.T) {
+	// == act ==
+	_, err := parseLinkMac("01:00:5e:00:00:01", "rd_01234567/host")
+
+	// == assert ==
+	assert.EqualError(t, err, "not a unicast ethernet address: 01:00:5e:00:00:01")
+}
+
+func TestDeriveMac(t *testing.T) {
+	// == act ==
+	container := deriveMac("rd_01234567/container")
+	host := deriveMac("rd_01234567/host")
+
+	// == assert ==
+	assert.Equal(t, container, deriveMac("rd_01234567/container"))
+	assert.NotEqual(t, container, host)
+	// locally administered unicast
+	assert.Equal(t, byte(0x02), container[0]&0x03)
+	assert.Equal(t, byte(0x02), host[0]&0x03)
+}
+
+func TestParseRateLimit_DefaultBurst(t *testing.T) {
+	// == act ==
+	slow, slowErr := parseRateLimit(1000000, 0)
+	fast, fastErr := parseRateLimit(10000000000, 0)
+
+	// == assert ==
+	assert.Nil(t, slowErr)
+	assert.Equal(t, rateLimit{rate: 125000, burst: minRateLimitBurst}, slow)
+	assert.Nil(t, fastErr)
+	// 10ms of traffic
+	assert.Equal(t, rateLimit{rate: 1250000000, burst: 12500000}, fast)
+}
+
+func TestCheckInterfaceStatus(t *testing.T) {
+	// == arrange ==
+	iface := interfaceSetup{
+		mac:     deriveMac("rd_01234567/container"),
+		mtu:     1400,
+		ingress: rateLimit{rate: 1250000, burst: minRateLimitBurst},
+	}
+	inspected := status.InterfaceObject{
+		Mac:         iface.mac.String(),
+		HostMac:     "02:00:00:00:00:01",
+		Mtu:         1400,
+		IngressRate: 10000000,
+	}
+	missingRate := inspected
+	missingRate.IngressRate = 0
+	wrongMtu := inspected
+	wrongMtu.Mtu = 1500
+
+	// == act ==
+	err := checkInterfaceStatus(iface, inspected)
+	missingRateErr := checkInterfaceStatus(iface, missingRate)
+	wrongMtuErr := checkInterfaceStatus(iface, wrongMtu)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.EqualError(t, missingRateErr, "ingress rate is 0bit, expected 10000000bit")
+	assert.EqualError(t, wrongMtuErr, "mtu is 1500, expected 1400")
+}
@@ -0,0 +1,270 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// netnsPathEnv names the environment variable used to hand the network
+// namespace path of container:<id>, resolved on the host, to the init
+// process. The init process runs in its own PID namespace, where the
+// status of the other container cannot be looked up.
+const netnsPathEnv = "_DROPLET_NETNS_PATH"
+
+// network modes of the io.raind.net.config annotation
+const (
+	networkModeNone      = "none"
+	networkModeHost      = "host"
+	networkModeBridge    = "bridge"
+	networkModeContainer = "container"
+	// networkModePath is not a mode of the annotation. It is used for
+	// specs without a mode that join a network namespace by path.
+	networkModePath = "path"
+)
+
+// networkMode is the parsed network mode of a container.
+type networkMode struct {
+	kind string
+	// containerId is the container whose network namespace is joined in
+	// container mode.
+	containerId string
+}
+
+func (m networkMode) String() string {
+	if m.kind == networkModeContainer {
+		return networkModeContainer + ":" + m.containerId
+	}
+	return m.kind
+}
+
+// parseNetworkMode parses none, host, bridge or container:<id>.
+func parseNetworkMode(mode string) (networkMode, error) {
+	switch mode {
+	case networkModeNone, networkModeHost, networkModeBridge:
+		return networkMode{kind: mode}, nil
+	}
+	if id, ok := strings.CutPrefix(mode, networkModeContainer+":"); ok {
+		if id == "" {
+			return networkMode{}, fmt.Errorf("network mode container requires a container id")
+		}
+		return networkMode{kind: networkModeContainer, containerId: id}, nil
+	}
+	return networkMode{}, fmt.Errorf("invalid network mode: %q", mode)
+}
+
+// networkModeOf returns the network mode of the spec.
+//
+// Specs without a mode (annotation version 0.1.0, or a mode left empty)
+// keep their previous behavior: no network namespace means host,
+// a namespace joined by path is left as is, and a new namespace means
+// bridge, or none if no interface is configured and the backend is not
+// cni.
+func networkModeOf(containerSpec spec.Spec) (networkMode, spec.NetConfigObject, error) {
+	networkConfig, err := spec.ParseNetConfig(containerSpec.Annotations)
+	if err != nil {
+		return networkMode{}, networkConfig, err
+	}
+	if networkConfig.Mode != "" {
+		mode, err := parseNetworkMode(networkConfig.Mode)
+		return mode, networkConfig, err
+	}
+
+	switch {
+	case !hasNamespace(containerSpec.LinuxSpec, "network"):
+		return networkMode{kind: networkModeHost}, networkConfig, nil
+	case isNamespaceJoined(containerSpec.LinuxSpec, "network"):
+		return networkMode{kind: networkModePath}, networkConfig, nil
+	case networkConfig.Backend == networkBackendCni:
+		return networkMode{kind: networkModeBridge}, networkConfig, nil
+	case len(networkConfig.Interfaces) == 0:
+		return networkMode{kind: networkModeNone}, networkConfig, nil
+	default:
+		return networkMode{kind: networkModeBridge}, networkConfig, nil
+	}
+}
+
+// hasNamespace reports whether the namespace of the given type is listed
+// in the spec, either created or joined by path.
+func hasNamespace(linuxSpec spec.LinuxSpecObject, nsType string) bool {
+	for _, ns := range linuxSpec.Namespaces {
+		if ns.Type == nsType {
+			return true
+		}
+	}
+	return false
+}
+
+// newNetworkModeResolver constructs a containerNetworkModeResolver with
+// the default status manager, used to look up the container whose
+// network namespace is joined.
+func newNetworkModeResolver() *containerNetworkModeResolver {
+	return &containerNetworkModeResolver{
+		containerStatusManager: status.NewStatusHandler(),
+	}
+}
+
+// networkModeResolver defines the behavior required to apply the network
+// mode of the annotation to the namespaces of a spec.
+type networkModeResolver interface {
+	resolve(containerId string, containerSpec *spec.Spec) (networkMode, error)
+}
+
+// containerNetworkModeResolver is the default implementation of
+// networkModeResolver.
+type containerNetworkModeResolver struct {
+	containerStatusManager status.ContainerStatusManager
+}
+
+// resolve validates the network mode against the spec and rewrites the
+// network namespace of the spec for that mode.
+//
+// The modes are:
+//   - none:   a new network namespace with loopback only
+//   - host:   no network namespace; the host network is used
+//   - bridge: a new network namespace with veths on host bridges, or
+//     the interfaces of the CNI plugins with the cni backend
+//   - container:<id>: the network namespace of another container, joined
+//     by the path /proc/<pid>/ns/net of its init process
+//
+// The spec has to be resolved on the host before the init process is
+// cloned. The init process does not resolve it again; it receives the
+// network namespace path through passNetnsPath instead.
+func (r *containerNetworkModeResolver) resolve(containerId string, containerSpec *spec.Spec) (networkMode, error) {
+	mode, networkConfig, err := networkModeOf(*containerSpec)
+	if err != nil {
+		return mode, err
+	}
+	linuxSpec := &containerSpec.LinuxSpec
+
+	switch networkConfig.Backend {
+	case "", networkBackendBuiltin:
+	case networkBackendCni:
+		if mode.kind != networkModeBridge {
+			return mode, fmt.Errorf("network backend cni requires network mode bridge")
+		}
+		if networkConfig.Cni == nil || networkConfig.Cni.Network == "" {
+			return mode, fmt.Errorf("network backend cni requires a cni network")
+		}
+		if len(networkConfig.Interfaces) > 0 {
+			return mode, fmt.Errorf("network backend cni cannot configure interfaces")
+		}
+	default:
+		return mode, fmt.Errorf("invalid network backend: %q", networkConfig.Backend)
+	}
+
+	switch mode.kind {
+	case networkModeHost:
+		if hasNamespace(*linuxSpec, "network") {
+			return mode, fmt.Errorf("network mode host cannot be used with a network namespace")
+		}
+		if len(networkConfig.Interfaces) > 0 {
+			return mode, fmt.Errorf("network mode host cannot configure interfaces")
+		}
+
+	case networkModeNone, networkModeBridge:
+		if !hasNamespace(*linuxSpec, "network") || isNamespaceJoined(*linuxSpec, "network") {
+			return mode, fmt.Errorf("network mode %s requires a new network namespace", mode)
+		}
+		if mode.kind == networkModeNone && len(networkConfig.Interfaces) > 0 {
+			return mode, fmt.Errorf("network mode none cannot configure interfaces")
+		}
+		if mode.kind == networkModeBridge && networkConfig.Backend != networkBackendCni && len(networkConfig.Interfaces) == 0 {
+			return mode, fmt.Errorf("network mode bridge requires at least one interface")
+		}
+
+	case networkModeContainer:
+		if mode.containerId == containerId {
+			return mode, fmt.Errorf("network mode %s refers to the container itself", mode)
+		}
+		if isNamespaceJoined(*linuxSpec, "network") {
+			return mode, fmt.Errorf("network mode %s cannot be used with a network namespace path", mode)
+		}
+		if len(networkConfig.Interfaces) > 0 {
+			return mode, fmt.Errorf("network mode %s cannot configure interfaces", mode)
+		}
+		netnsPath, err := r.containerNetnsPath(mode.containerId)
+		if err != nil {
+			return mode, err
+		}
+		setNamespacePath(linuxSpec, "network", netnsPath)
+	}
+	return mode, nil
+}
+
+// containerNetnsPath returns the network namespace path of a container
+// that has a live init process.
+func (r *containerNetworkModeResolver) containerNetnsPath(containerId string) (string, error) {
+	containerStatus, err := r.containerStatusManager.GetStatusFromId(containerId)
+	if err != nil {
+		return "", fmt.Errorf("network mode container:%s: %w", containerId, err)
+	}
+	switch containerStatus {
+	case status.CREATED, status.RUNNING, status.PAUSED:
+	default:
+		return "", fmt.Errorf("network mode container:%s: container is not running. current status: %s", containerId, containerStatus)
+	}
+	pid, err := r.containerStatusManager.GetPidFromId(containerId)
+	if err != nil {
+		return "", fmt.Errorf("network mode container:%s: %w", containerId, err)
+	}
+	if pid <= 0 {
+		return "", fmt.Errorf("network mode container:%s: container has no init process", containerId)
+	}
+	return fmt.Sprintf("/proc/%d/ns/net", pid), nil
+}
+
+// passNetnsPath hands the network namespace path of a resolved
+// container:<id> spec to the init process started by cmd. It must be
+// called after passAuditLog, which sets the environment of cmd.
+func passNetnsPath(cmd utils.CommandExecutor, containerSpec spec.Spec) error {
+	mode, _, err := networkModeOf(containerSpec)
+	if err != nil {
+		return err
+	}
+	if mode.kind != networkModeContainer {
+		return nil
+	}
+	for _, ns := range containerSpec.LinuxSpec.Namespaces {
+		if ns.Type == "network" && ns.Path != "" {
+			cmd.SetEnv([]string{netnsPathEnv + "=" + ns.Path})
+			return nil
+		}
+	}
+	return fmt.Errorf("network mode %s is not resolved", mode)
+}
+
+// applyPassedNetnsPath sets the network namespace path handed over by
+// passNetnsPath in the spec loaded by the init process.
+func applyPassedNetnsPath(containerSpec *spec.Spec) error {
+	netnsPath := os.Getenv(netnsPathEnv)
+	_ = os.Unsetenv(netnsPathEnv)
+
+	mode, _, err := networkModeOf(*containerSpec)
+	if err != nil {
+		return err
+	}
+	if mode.kind != networkModeContainer {
+		return nil
+	}
+	if netnsPath == "" {
+		return fmt.Errorf("network mode %s: no network namespace path was passed to init", mode)
+	}
+	setNamespacePath(&containerSpec.LinuxSpec, "network", netnsPath)
+	return nil
+}
+
+// setNamespacePath sets the path of the namespace of the given type,
+// adding the namespace if it is not listed.
+func setNamespacePath(linuxSpec *spec.LinuxSpecObject, nsType string, path string) {
+	for i := range linuxSpec.Namespaces {
+		if linuxSpec.Namespaces[i].Type == nsType {
+			linuxSpec.Namespaces[i].Path = path
+			return
+		}
+	}
+	linuxSpec.Namespaces = append(linuxSpec.Namespaces, spec.NamespaceObject{Type: nsType, Path: path})
+}
@@ -0,0 +1,141 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeContainerStatusManager struct {
+	status.ContainerStatusManager
+	containerStatus status.ContainerStatus
+	pid             int
+}
+
+func (f *fakeContainerStatusManager) GetStatusFromId(containerId string) (status.ContainerStatus, error) {
+	return f.containerStatus, nil
+}
+
+func (f *fakeContainerStatusManager) GetPidFromId(containerId string) (int, error) {
+	return f.pid, nil
+}
+
+func buildNetworkModeSpec(net string, namespaces ...spec.NamespaceObject) spec.Spec {
+	return spec.Spec{
+		Annotations: spec.AnnotationObject{Version: "0.2.0", Net: net},
+		LinuxSpec:   spec.LinuxSpecObject{Namespaces: namespaces},
+	}
+}
+
+func TestNetworkModeResolve_Container(t *testing.T) {
+	// == arrange ==
+	containerSpec := buildNetworkModeSpec(`{"mode":"container:web"}`,
+		spec.NamespaceObject{Type: "mount"},
+		spec.NamespaceObject{Type: "network"},
+	)
+	resolver := &containerNetworkModeResolver{
+		containerStatusManager: &fakeContainerStatusManager{containerStatus: status.RUNNING, pid: 4321},
+	}
+
+	// == act ==
+	mode, err := resolver.resolve("sidecar", &containerSpec)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, "container:web", mode.String())
+	assert.Equal(t, "/proc/4321/ns/net", containerSpec.LinuxSpec.Namespaces[1].Path)
+}
+
+func TestNetworkModeResolve_ContainerStopped(t *testing.T) {
+	// == arrange ==
+	containerSpec := buildNetworkModeSpec(`{"mode":"container:web"}`)
+	resolver := &containerNetworkModeResolver{
+		containerStatusManager: &fakeContainerStatusManager{containerStatus: status.STOPPED, pid: 4321},
+	}
+
+	// == act ==
+	_, err := resolver.resolve("sidecar", &containerSpec)
+
+	// == assert ==
+	assert.EqualError(t, err, "network mode container:web: container is not running. current status: stopped")
+}
+
+func TestNetworkModeResolve_HostWithNetns(t *testing.T) {
+	// == arrange ==
+	containerSpec := buildNetworkModeSpec(`{"mode":"host"}`, spec.NamespaceObject{Type: "network"})
+	resolver := &containerNetworkModeResolver{}
+
+	// == act ==
+	_, err := resolver.resolve("app", &containerSpec)
+
+	// == assert ==
+	assert.EqualError(t, err, "network mode host cannot be used with a network namespace")
+}
+
+func TestNetworkModeResolve_NoneWithInterfaces(t *testing.T) {
+	// == arrange ==
+	containerSpec := buildNetworkModeSpec(`{"mode":"none","interfaces":[{"name":"rd_app"}]}`, spec.NamespaceObject{Type: "network"})
+	resolver := &containerNetworkModeResolver{}
+
+	// == act ==
+	_, err := resolver.resolve("app", &containerSpec)
+
+	// == assert ==
+	assert.EqualError(t, err, "network mode none cannot configure interfaces")
+}
+
+func TestNetworkModeOf_Inferred(t *testing.T) {
+	// == arrange ==
+	hostSpec := buildNetworkModeSpec(`{}`)
+	noneSpec := buildNetworkModeSpec(`{}`, spec.NamespaceObject{Type: "network"})
+	pathSpec := buildNetworkModeSpec(`{}`, spec.NamespaceObject{Type: "network", Path: "/proc/1/ns/net"})
+	bridgeSpec := buildNetworkModeSpec(`{"interfaces":[{"name":"rd_app"}]}`, spec.NamespaceObject{Type: "network"})
+
+	// == act ==
+	hostMode, _, hostErr := networkModeOf(hostSpec)
+	noneMode, _, noneErr := networkModeOf(noneSpec)
+	pathMode, _, pathErr := networkModeOf(pathSpec)
+	bridgeMode, _, bridgeErr := networkModeOf(bridgeSpec)
+
+	// == assert ==
+	assert.Nil(t, hostErr)
+	assert.Equal(t, networkModeHost, hostMode.kind)
+	assert.Nil(t, noneErr)
+	assert.Equal(t, networkModeNone, noneMode.kind)
+	assert.Nil(t, pathErr)
+	assert.Equal(t, networkModePath, pathMode.kind)
+	assert.Nil(t, bridgeErr)
+	assert.Equal(t, networkModeBridge, bridgeMode.kind)
+}
+
+type fakeCommandExecutor struct {
+	utils.CommandExecutor
+	env []string
+}
+
+func (f *fakeCommandExecutor) SetEnv(envv []string) {
+	f.env = append(f.env, envv...)
+}
+
+func TestPassNetnsPath_ContainerMode(t *testing.T) {
+	// == arrange ==
+	containerSpec := buildNetworkModeSpec(`{"mode":"container:web"}`,
+		spec.NamespaceObject{Type: "network", Path: "/proc/4321/ns/net"},
+	)
+	noneSpec := buildNetworkModeSpec(`{"mode":"none"}`, spec.NamespaceObject{Type: "network"})
+	containerCmd := &fakeCommandExecutor{}
+	noneCmd := &fakeCommandExecutor{}
+
+	// == act ==
+	containerErr := passNetnsPath(containerCmd, containerSpec)
+	noneErr := passNetnsPath(noneCmd, noneSpec)
+
+	// == assert ==
+	assert.Nil(t, containerErr)
+	assert.Equal(t, []string{"_DROPLET_NETNS_PATH=/proc/4321/ns/net"}, containerCmd.env)
+	assert.Nil(t, noneErr)
+	assert.Nil(t, noneCmd.env)
+}
@@ -0,0 +1,131 @@
+package container
+
+import (
+	"bytes"
+	"droplet/internal/utils"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// nftTable is the name of the nftables tables of the runtime: ip raind
+// holds the port publishing rules and bridge raind the firewall policies.
+const nftTable = "raind"
+
+// newNftCommand constructs an nftCommand that runs the nft command found
+// in PATH.
+func newNftCommand() nftCommand {
+	return nftCommand{
+		commandFactory: utils.NewCommandFactory(),
+		path:           "nft",
+	}
+}
+
+// nftCommand runs the nft command line tool.
+//
+// Rules are written as nft scripts, each applied by a single `nft -f -`
+// transaction, and read back with `nft -j list table`. The rules that
+// attach a container to the base chains of a table carry the container id
+// as comment, which is how they are found again when the container is
+// removed.
+type nftCommand struct {
+	commandFactory utils.CommandFactory
+	path           string
+}
+
+// nftRuleset is the part of `nft -j list table` used to find the rules
+// and chains of a container and to read rule counters.
+type nftRuleset struct {
+	Nftables []struct {
+		Chain *struct {
+			Name string `json:"name"`
+		} `json:"chain,omitempty"`
+		Rule *nftRule `json:"rule,omitempty"`
+	} `json:"nftables"`
+}
+
+// nftRule is a rule of a listed table. Only the counter statement of its
+// expressions is decoded.
+type nftRule struct {
+	Chain   string `json:"chain"`
+	Handle  int    `json:"handle"`
+	Comment string `json:"comment,omitempty"`
+	Expr    []struct {
+		Counter *struct {
+			Packets uint64 `json:"packets"`
+			Bytes   uint64 `json:"bytes"`
+		} `json:"counter,omitempty"`
+	} `json:"expr,omitempty"`
+}
+
+// run applies an nft script as a single transaction.
+func (n nftCommand) run(script string) error {
+	var stderr bytes.Buffer
+	cmd := n.commandFactory.Command(n.path, "-f", "-")
+	cmd.SetStdin(strings.NewReader(script))
+	cmd.SetStderr(&stderr)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("nft failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// listTable returns the rules and chains of the raind table of the
+// family. A table that does not exist yields an empty ruleset.
+func (n nftCommand) listTable(family string) (nftRuleset, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := n.commandFactory.Command(n.path, "-j", "list", "table", family, nftTable)
+	cmd.SetStdout(&stdout)
+	cmd.SetStderr(&stderr)
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stderr.String(), "No such file or directory") {
+			return nftRuleset{}, nil
+		}
+		return nftRuleset{}, fmt.Errorf("nft list table failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var ruleset nftRuleset
+	if err := json.Unmarshal(stdout.Bytes(), &ruleset); err != nil {
+		return nftRuleset{}, fmt.Errorf("parse nft ruleset: %w", err)
+	}
+	return ruleset, nil
+}
+
+// removeContainerRules deletes the rules commented with the container id
+// and the given chains of the container from the raind table of the
+// family.
+func (n nftCommand) removeContainerRules(family string, containerId string, chains ...string) error {
+	ruleset, err := n.listTable(family)
+	if err != nil {
+		return err
+	}
+	script := buildDeleteScript(family, containerId, ruleset, chains)
+	if script == "" {
+		return nil
+	}
+	return n.run(script)
+}
+
+// buildDeleteScript returns the nft script that deletes the rules
+// commented with the container id, then flushes and deletes the listed
+// chains of the container.
+func buildDeleteScript(family string, containerId string, ruleset nftRuleset, chains []string) string {
+	var b strings.Builder
+	for _, item := range ruleset.Nftables {
+		if item.Rule != nil && item.Rule.Comment == containerId {
+			fmt.Fprintf(&b, "delete rule %s %s %s handle %d\n", family, nftTable, item.Rule.Chain, item.Rule.Handle)
+		}
+	}
+	for _, item := range ruleset.Nftables {
+		if item.Chain == nil {
+			continue
+		}
+		for _, chain := range chains {
+			if item.Chain.Name == chain {
+				fmt.Fprintf(&b, "flush chain %s %s %q\n", family, nftTable, chain)
+				fmt.Fprintf(&b, "delete chain %s %s %q\n", family, nftTable, chain)
+			}
+		}
+	}
+	return b.String()
+}
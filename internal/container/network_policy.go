@@ -0,0 +1,335 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+// policy directions and actions of the io.raind.net.config annotation
+const (
+	policyIngress = "ingress"
+	policyEgress  = "egress"
+	policyAllow   = "allow"
+	policyDeny    = "deny"
+)
+
+// newNftPolicyEnforcer constructs an nftPolicyEnforcer that runs the nft
+// command found in PATH.
+func newNftPolicyEnforcer() *nftPolicyEnforcer {
+	return &nftPolicyEnforcer{
+		nft: newNftCommand(),
+	}
+}
+
+// policyEnforcer defines the behavior required to filter the traffic of
+// the host veths of a container with its firewall policy, and to report
+// how much traffic each rule matched.
+type policyEnforcer interface {
+	apply(containerId string, containerSpec spec.Spec) error
+	remove(containerId string) error
+	counters(containerId string) ([]PolicyCounterObject, error)
+}
+
+// nftPolicyEnforcer is the nftables implementation of policyEnforcer.
+//
+// All rules live in the bridge raind table, so that they see the frames
+// of the host veths on the bridge:
+//
+//	forward, input   filter base chains jumping to egress_<id> for
+//	                 frames received from a host veth of the container
+//	forward, output  filter base chains jumping to ingress_<id> for
+//	                 frames sent to a host veth of the container
+//	egress_<id>      egress policy of the container
+//	ingress_<id>     ingress policy of the container
+//
+// A policy chain accepts ARP, IPv6 neighbor discovery and packets of
+// established connections, then applies the allow rules and the default
+// action. The allow rules and the default rule count the packets they
+// match. Connection tracking in the bridge family requires Linux 5.3.
+//
+// The applied policy is saved in the container directory; a container
+// without that file has no rules.
+type nftPolicyEnforcer struct {
+	nft nftCommand
+}
+
+// PolicyCounterObject is the hit counter of a rule of the policy of a
+// container.
+type PolicyCounterObject struct {
+	Direction string `json:"direction"`
+	Action    string `json:"action"`
+	Rule      string `json:"rule"`
+	Packets   uint64 `json:"packets"`
+	Bytes     uint64 `json:"bytes"`
+}
+
+// appliedPolicy is the saved policy of a container.
+type appliedPolicy struct {
+	Links  []string          `json:"links"`
+	Policy spec.PolicyObject `json:"policy"`
+}
+
+// apply installs the policy of the annotation on the host veths of the
+// container, replacing the policy applied before. A policy without
+// directions removes it.
+func (e *nftPolicyEnforcer) apply(containerId string, containerSpec spec.Spec) error {
+	mode, networkConfig, err := networkModeOf(containerSpec)
+	if err != nil {
+		return err
+	}
+	policy := networkConfig.Policy
+	if policy == nil || (policy.Ingress == nil && policy.Egress == nil) {
+		return e.remove(containerId)
+	}
+	if mode.kind != networkModeBridge || networkConfig.Backend == networkBackendCni {
+		return fmt.Errorf("a network policy requires network mode bridge with the builtin backend")
+	}
+
+	// 1. validate policy
+	var links []string
+	for _, iface := range networkConfig.Interfaces {
+		links = append(links, iface.Name)
+	}
+	chains, err := buildPolicyChains(containerId, *policy)
+	if err != nil {
+		return err
+	}
+
+	// 2. drop the rules of the previous policy
+	if err := e.remove(containerId); err != nil {
+		return err
+	}
+
+	// 3. install rules
+	if err := e.nft.run(buildPolicyScript(containerId, links, chains)); err != nil {
+		return err
+	}
+	if err := utils.WriteJsonToFile(utils.ContainerPolicyPath(containerId), appliedPolicy{
+		Links:  links,
+		Policy: *policy,
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// remove deletes the jump rules and policy chains of the container.
+// Nothing is done if the container has no policy, so nft is only needed
+// on hosts that use policies.
+func (e *nftPolicyEnforcer) remove(containerId string) error {
+	policyPath := utils.ContainerPolicyPath(containerId)
+	if _, err := os.Stat(policyPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if err := e.nft.removeContainerRules("bridge", containerId,
+		policyChain(policyIngress, containerId), policyChain(policyEgress, containerId)); err != nil {
+		return err
+	}
+	if err := os.Remove(policyPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// counters returns the counters of the allow rules and default rules of
+// the policy of the container, in rule order. nil is returned if the
+// container has no policy.
+func (e *nftPolicyEnforcer) counters(containerId string) ([]PolicyCounterObject, error) {
+	if _, err := os.Stat(utils.ContainerPolicyPath(containerId)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	ruleset, err := e.nft.listTable("bridge")
+	if err != nil {
+		return nil, err
+	}
+	chains := map[string]string{
+		policyChain(policyIngress, containerId): policyIngress,
+		policyChain(policyEgress, containerId):  policyEgress,
+	}
+
+	var list []PolicyCounterObject
+	for _, item := range ruleset.Nftables {
+		if item.Rule == nil || item.Rule.Comment == "" {
+			continue
+		}
+		direction, ok := chains[item.Rule.Chain]
+		if !ok {
+			continue
+		}
+		action, rule, _ := strings.Cut(item.Rule.Comment, " ")
+		counter := PolicyCounterObject{
+			Direction: direction,
+			Action:    action,
+			Rule:      rule,
+		}
+		for _, expr := range item.Rule.Expr {
+			if expr.Counter != nil {
+				counter.Packets = expr.Counter.Packets
+				counter.Bytes = expr.Counter.Bytes
+			}
+		}
+		list = append(list, counter)
+	}
+	return list, nil
+}
+
+// policyChainRules is the compiled policy of one direction.
+type policyChainRules struct {
+	direction string
+	chain     string
+	rules     []string
+}
+
+// buildPolicyChains validates the policy and compiles the rules of the
+// policy chain of each direction. The comment of a counted rule is its
+// action followed by a description of what it matches.
+func buildPolicyChains(containerId string, policy spec.PolicyObject) ([]policyChainRules, error) {
+	var chains []policyChainRules
+	for _, d := range []struct {
+		direction string
+		policy    *spec.PolicyDirectionObject
+	}{
+		{policyIngress, policy.Ingress},
+		{policyEgress, policy.Egress},
+	} {
+		if d.policy == nil {
+			continue
+		}
+		defaultAction := d.policy.Default
+		if defaultAction == "" {
+			defaultAction = policyAllow
+		}
+		if defaultAction != policyAllow && defaultAction != policyDeny {
+			return nil, fmt.Errorf("invalid %s policy default: %q", d.direction, d.policy.Default)
+		}
+
+		chain := policyChainRules{
+			direction: d.direction,
+			chain:     policyChain(d.direction, containerId),
+			rules: []string{
+				"ether type arp accept",
+				"icmpv6 type { nd-neighbor-solicit, nd-neighbor-advert, nd-router-solicit, nd-router-advert } accept",
+				"ct state established,related accept",
+			},
+		}
+		for _, r := range d.policy.Allow {
+			match, description, err := buildPolicyMatch(d.direction, r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s policy rule: %w", d.direction, err)
+			}
+			chain.rules = append(chain.rules, fmt.Sprintf("%scounter accept comment %q", match, policyAllow+" "+description))
+		}
+		verdict := "accept"
+		if defaultAction == policyDeny {
+			verdict = "drop"
+		}
+		chain.rules = append(chain.rules, fmt.Sprintf("counter %s comment %q", verdict, defaultAction+" default"))
+		chains = append(chains, chain)
+	}
+	return chains, nil
+}
+
+// buildPolicyMatch returns the nft match of an allow rule, with a trailing
+// space if not empty, and its description.
+func buildPolicyMatch(direction string, r spec.PolicyRuleObject) (string, string, error) {
+	var match, description []string
+
+	if r.Cidr != "" {
+		_, network, err := net.ParseCIDR(r.Cidr)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid cidr: %q", r.Cidr)
+		}
+		family := "ip"
+		if network.IP.To4() == nil {
+			family = "ip6"
+		}
+		peer := "daddr"
+		if direction == policyIngress {
+			peer = "saddr"
+		}
+		match = append(match, fmt.Sprintf("%s %s %s", family, peer, network))
+		description = append(description, network.String())
+	}
+
+	switch r.Protocol {
+	case "":
+		if r.Port != 0 || r.EndPort != 0 {
+			return "", "", fmt.Errorf("port requires protocol tcp or udp")
+		}
+	case portProtocolTcp, portProtocolUdp:
+		if r.Port == 0 {
+			match = append(match, "meta l4proto "+r.Protocol)
+			description = append(description, r.Protocol)
+			break
+		}
+		endPort := r.EndPort
+		if endPort == 0 {
+			endPort = r.Port
+		}
+		if r.Port < 1 || endPort < r.Port || endPort > 65535 {
+			return "", "", fmt.Errorf("invalid port: %d-%d", r.Port, endPort)
+		}
+		ports := portRange(r.Port, endPort-r.Port+1)
+		match = append(match, fmt.Sprintf("%s dport %s", r.Protocol, ports))
+		description = append(description, r.Protocol+"/"+ports)
+	default:
+		return "", "", fmt.Errorf("invalid protocol: %q", r.Protocol)
+	}
+
+	if len(match) == 0 {
+		return "", "any", nil
+	}
+	return strings.Join(match, " ") + " ", strings.Join(description, " "), nil
+}
+
+// buildPolicyScript returns the nft script that creates the table and
+// base chains if needed, and the policy chains and jump rules of the
+// container.
+func buildPolicyScript(containerId string, links []string, chains []policyChainRules) string {
+	comment := fmt.Sprintf("comment %q", containerId)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "add table bridge %s\n", nftTable)
+	for _, hook := range []string{"forward", "input", "output"} {
+		fmt.Fprintf(&b, "add chain bridge %s %s { type filter hook %s priority 0; policy accept; }\n", nftTable, hook, hook)
+	}
+	for _, chain := range chains {
+		fmt.Fprintf(&b, "add chain bridge %s %q\n", nftTable, chain.chain)
+		fmt.Fprintf(&b, "flush chain bridge %s %q\n", nftTable, chain.chain)
+		for _, rule := range chain.rules {
+			fmt.Fprintf(&b, "add rule bridge %s %q %s\n", nftTable, chain.chain, rule)
+		}
+
+		// frames from the container are received on its host veth
+		hooks, link := []string{"forward", "input"}, "iifname"
+		if chain.direction == policyIngress {
+			hooks, link = []string{"forward", "output"}, "oifname"
+		}
+		for _, name := range links {
+			for _, hook := range hooks {
+				fmt.Fprintf(&b, "add rule bridge %s %s %s %q jump %q %s\n", nftTable, hook, link, name, chain.chain, comment)
+			}
+		}
+	}
+	return b.String()
+}
+
+// policyChain returns the name of the policy chain of a direction of the
+// container.
+func policyChain(direction string, containerId string) string {
+	return direction + "_" + containerId
+}
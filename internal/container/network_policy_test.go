@@ -0,0 +1,119 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestNftPolicyEnforcer(t *testing.T) (*nftPolicyEnforcer, string) {
+	publisher, binDir := newTestNftPortPublisher(t)
+	return &nftPolicyEnforcer{nft: publisher.nft}, binDir
+}
+
+func buildPolicySpec(policy string) spec.Spec {
+	return spec.Spec{
+		Annotations: spec.AnnotationObject{
+			Version: "0.2.0",
+			Net: `{"mode":"bridge","interfaces":[{"name":"rd_111111","bridgeInterface":"raind0","ipv4":{"address":"10.166.0.2/24"}}],` +
+				`"policy":` + policy + `}`,
+		},
+		LinuxSpec: spec.LinuxSpecObject{Namespaces: []spec.NamespaceObject{{Type: "network"}}},
+	}
+}
+
+func TestPolicyApply_Rules(t *testing.T) {
+	// == arrange ==
+	enforcer, binDir := newTestNftPolicyEnforcer(t)
+	containerSpec := buildPolicySpec(`{
+		"egress":{"default":"deny","allow":[
+			{"cidr":"10.0.0.0/8","protocol":"tcp","port":443},
+			{"cidr":"fd00::/64","protocol":"udp","port":5000,"endPort":5010}
+		]},
+		"ingress":{"allow":[{"protocol":"tcp","port":80}]}
+	}`)
+
+	// == act ==
+	err := enforcer.apply("111111", containerSpec)
+	calls, readErr := os.ReadFile(filepath.Join(binDir, "calls.log"))
+	var applied appliedPolicy
+	appliedErr := utils.ReadJsonFile(utils.ContainerPolicyPath("111111"), &applied)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Nil(t, readErr)
+	assert.Contains(t, string(calls), `add chain bridge raind forward { type filter hook forward priority 0; policy accept; }`)
+	assert.Contains(t, string(calls), `add rule bridge raind "egress_111111" ct state established,related accept`)
+	assert.Contains(t, string(calls), `add rule bridge raind "egress_111111" ip daddr 10.0.0.0/8 tcp dport 443 counter accept comment "allow 10.0.0.0/8 tcp/443"`)
+	assert.Contains(t, string(calls), `add rule bridge raind "egress_111111" ip6 daddr fd00::/64 udp dport 5000-5010 counter accept comment "allow fd00::/64 udp/5000-5010"`)
+	assert.Contains(t, string(calls), `add rule bridge raind "egress_111111" counter drop comment "deny default"`)
+	assert.Contains(t, string(calls), `add rule bridge raind "ingress_111111" tcp dport 80 counter accept comment "allow tcp/80"`)
+	assert.Contains(t, string(calls), `add rule bridge raind "ingress_111111" counter accept comment "allow default"`)
+	assert.Contains(t, string(calls), `add rule bridge raind input iifname "rd_111111" jump "egress_111111" comment "111111"`)
+	assert.Contains(t, string(calls), `add rule bridge raind output oifname "rd_111111" jump "ingress_111111" comment "111111"`)
+	assert.Nil(t, appliedErr)
+	assert.Equal(t, []string{"rd_111111"}, applied.Links)
+}
+
+func TestPolicyApply_InvalidRule(t *testing.T) {
+	// == arrange ==
+	enforcer, binDir := newTestNftPolicyEnforcer(t)
+	containerSpec := buildPolicySpec(`{"egress":{"default":"deny","allow":[{"port":443}]}}`)
+
+	// == act ==
+	err := enforcer.apply("111111", containerSpec)
+
+	// == assert ==
+	assert.EqualError(t, err, "invalid egress policy rule: port requires protocol tcp or udp")
+	_, statErr := os.Stat(filepath.Join(binDir, "calls.log"))
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func TestPolicyApply_CniBackend(t *testing.T) {
+	// == arrange ==
+	enforcer, _ := newTestNftPolicyEnforcer(t)
+	containerSpec := spec.Spec{
+		Annotations: spec.AnnotationObject{
+			Version: "0.2.0",
+			Net:     `{"mode":"bridge","backend":"cni","cni":{"network":"raind"},"policy":{"egress":{"default":"deny"}}}`,
+		},
+		LinuxSpec: spec.LinuxSpecObject{Namespaces: []spec.NamespaceObject{{Type: "network"}}},
+	}
+
+	// == act ==
+	err := enforcer.apply("111111", containerSpec)
+
+	// == assert ==
+	assert.EqualError(t, err, "a network policy requires network mode bridge with the builtin backend")
+}
+
+func TestPolicyCounters(t *testing.T) {
+	// == arrange ==
+	enforcer, binDir := newTestNftPolicyEnforcer(t)
+	assert.Nil(t, utils.WriteJsonToFile(utils.ContainerPolicyPath("111111"), appliedPolicy{}))
+	assert.Nil(t, os.WriteFile(filepath.Join(binDir, "ruleset.json"), []byte(`{"nftables":[
+		{"chain":{"family":"bridge","table":"raind","name":"egress_111111","handle":4}},
+		{"rule":{"family":"bridge","table":"raind","chain":"forward","handle":6,"comment":"111111"}},
+		{"rule":{"family":"bridge","table":"raind","chain":"egress_111111","handle":7,"expr":[{"accept":null}]}},
+		{"rule":{"family":"bridge","table":"raind","chain":"egress_111111","handle":8,"comment":"allow 10.0.0.0/8 tcp/443",
+			"expr":[{"match":{"op":"==","left":{},"right":443}},{"counter":{"packets":12,"bytes":3400}},{"accept":null}]}},
+		{"rule":{"family":"bridge","table":"raind","chain":"egress_111111","handle":9,"comment":"deny default",
+			"expr":[{"counter":{"packets":3,"bytes":180}},{"drop":null}]}},
+		{"rule":{"family":"bridge","table":"raind","chain":"egress_222222","handle":10,"comment":"deny default",
+			"expr":[{"counter":{"packets":1,"bytes":60}},{"drop":null}]}}
+	]}`), 0644))
+
+	// == act ==
+	counters, err := enforcer.counters("111111")
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []PolicyCounterObject{
+		{Direction: "egress", Action: "allow", Rule: "10.0.0.0/8 tcp/443", Packets: 12, Bytes: 3400},
+		{Direction: "egress", Action: "deny", Rule: "default", Packets: 3, Bytes: 180},
+	}, counters)
+}
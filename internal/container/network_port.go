@@ -0,0 +1,309 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+// protocols of published ports
+const (
+	portProtocolTcp = "tcp"
+	portProtocolUdp = "udp"
+)
+
+// newNftPortPublisher constructs an nftPortPublisher that runs the nft
+// command found in PATH.
+func newNftPortPublisher() *nftPortPublisher {
+	return &nftPortPublisher{
+		nft: newNftCommand(),
+	}
+}
+
+// portPublisher defines the behavior required to make ports of a bridge
+// mode container reachable through the host, and to withdraw them when
+// the container stops.
+type portPublisher interface {
+	publish(containerId string, containerSpec spec.Spec) error
+	unpublish(containerId string) error
+}
+
+// nftPortPublisher is the nftables implementation of portPublisher.
+//
+// All rules live in the ip raind table:
+//
+//	prerouting, output  nat base chains jumping to dnat_<id> for
+//	                    traffic to a local address
+//	postrouting         nat base chain jumping to snat_<id>
+//	dnat_<id>           DNAT of the published ports to the container
+//	snat_<id>           masquerade of hairpin and loopback traffic to the
+//	                    published ports, so that replies return through
+//	                    the host
+//
+// The published mappings are saved in the container directory; a
+// container without that file has no rules.
+type nftPortPublisher struct {
+	nft nftCommand
+}
+
+// PortMapping is a port of a container published on the host. Ports
+// hostPort to hostPort+range-1 map to containerPort onwards.
+type PortMapping struct {
+	HostIP        string `json:"hostIP"`
+	HostPort      int    `json:"hostPort"`
+	ContainerIP   string `json:"containerIP"`
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol"`
+	Range         int    `json:"range"`
+}
+
+func (m PortMapping) String() string {
+	if m.Range > 1 {
+		return fmt.Sprintf("%d-%d/%s -> %s:%d-%d", m.ContainerPort, m.ContainerPort+m.Range-1, m.Protocol,
+			m.HostIP, m.HostPort, m.HostPort+m.Range-1)
+	}
+	return fmt.Sprintf("%d/%s -> %s:%d", m.ContainerPort, m.Protocol, m.HostIP, m.HostPort)
+}
+
+// publish installs the rules of the ports of the annotation, replacing
+// those installed for the container before. Only bridge mode containers
+// publish ports; the first IPv4 address of the container is the DNAT
+// target.
+//
+// Host ports already published by another container are rejected. The
+// check and the install hold the ports lock, so that two containers do
+// not publish the same port at once.
+func (p *nftPortPublisher) publish(containerId string, containerSpec spec.Spec) error {
+	mode, networkConfig, err := networkModeOf(containerSpec)
+	if err != nil {
+		return err
+	}
+	if len(networkConfig.Ports) == 0 {
+		return nil
+	}
+	if mode.kind != networkModeBridge {
+		return fmt.Errorf("publishing ports requires network mode bridge")
+	}
+
+	// 1. resolve target address
+	var containerIP string
+	for _, address := range containerAddresses(containerId, networkConfig) {
+		if ip := net.ParseIP(address); ip != nil && ip.To4() != nil {
+			containerIP = address
+			break
+		}
+	}
+	if containerIP == "" {
+		return fmt.Errorf("publishing ports requires an ipv4 address of the container")
+	}
+
+	// 2. validate ports
+	mappings, err := parsePortMappings(networkConfig.Ports, containerIP)
+	if err != nil {
+		return err
+	}
+
+	return utils.WithFileLock(utils.PortsLockPath(), func() error {
+		// 3. check conflicts
+		if err := checkPortConflicts(containerId, mappings); err != nil {
+			return err
+		}
+
+		// 4. drop the rules of a previous publish
+		if err := p.unpublish(containerId); err != nil {
+			return err
+		}
+
+		// 5. install rules
+		if err := p.nft.run(buildPublishScript(containerId, mappings)); err != nil {
+			return err
+		}
+		return utils.WriteJsonToFile(utils.ContainerPortsPath(containerId), mappings)
+	})
+}
+
+// unpublish removes the jump rules and chains of the container. Nothing
+// is done if the container has no published ports, so nft is only needed
+// on hosts that publish ports.
+func (p *nftPortPublisher) unpublish(containerId string) error {
+	portsPath := utils.ContainerPortsPath(containerId)
+	if _, err := os.Stat(portsPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	dnatChain, snatChain := portChains(containerId)
+	if err := p.nft.removeContainerRules("ip", containerId, dnatChain, snatChain); err != nil {
+		return err
+	}
+	if err := os.Remove(portsPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// parsePortMappings validates the ports of the annotation and applies the
+// defaults: all host addresses, tcp and a range of one port.
+func parsePortMappings(ports []spec.PortObject, containerIP string) ([]PortMapping, error) {
+	var mappings []PortMapping
+	for _, port := range ports {
+		m := PortMapping{
+			HostIP:        port.HostIP,
+			HostPort:      port.HostPort,
+			ContainerIP:   containerIP,
+			ContainerPort: port.ContainerPort,
+			Protocol:      port.Protocol,
+			Range:         port.Range,
+		}
+		if m.HostIP == "" {
+			m.HostIP = "0.0.0.0"
+		}
+		if m.Protocol == "" {
+			m.Protocol = portProtocolTcp
+		}
+		if m.Range == 0 {
+			m.Range = 1
+		}
+
+		if ip := net.ParseIP(m.HostIP); ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("invalid host ip of port %d: %q", port.HostPort, port.HostIP)
+		}
+		if m.Protocol != portProtocolTcp && m.Protocol != portProtocolUdp {
+			return nil, fmt.Errorf("invalid protocol of port %d: %q", port.HostPort, port.Protocol)
+		}
+		if m.Range < 1 {
+			return nil, fmt.Errorf("invalid range of port %d: %d", port.HostPort, port.Range)
+		}
+		for _, first := range []int{m.HostPort, m.ContainerPort} {
+			if first < 1 || first+m.Range-1 > 65535 {
+				return nil, fmt.Errorf("invalid port: %d (range %d)", first, m.Range)
+			}
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+// checkPortConflicts returns an error if a mapping overlaps another one of
+// mappings, or the ports saved by another container of the root
+// directory.
+func checkPortConflicts(containerId string, mappings []PortMapping) error {
+	for i, m := range mappings {
+		for _, other := range mappings[:i] {
+			if m.overlaps(other) {
+				return fmt.Errorf("port %s overlaps %s", m, other)
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(utils.DefaultRootDir())
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == containerId {
+			continue
+		}
+		var published []PortMapping
+		if err := utils.ReadJsonFile(utils.ContainerPortsPath(entry.Name()), &published); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		for _, m := range mappings {
+			for _, other := range published {
+				if m.overlaps(other) {
+					return fmt.Errorf("port %s conflicts with %s of container %s", m, other, entry.Name())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// overlaps reports whether m and other share a host port of the same
+// protocol on the same host address. 0.0.0.0 overlaps every address.
+func (m PortMapping) overlaps(other PortMapping) bool {
+	if m.Protocol != other.Protocol {
+		return false
+	}
+	if m.HostIP != other.HostIP && m.HostIP != "0.0.0.0" && other.HostIP != "0.0.0.0" {
+		return false
+	}
+	return m.HostPort <= other.HostPort+other.Range-1 && other.HostPort <= m.HostPort+m.Range-1
+}
+
+// buildPublishScript returns the nft script that creates the table and
+// base chains if needed, and the chains and jump rules of the container.
+//
+// A range whose host and container ports are equal is translated by a
+// single rule that keeps the port; otherwise each port gets its own rule,
+// since nft maps a port range to a pool rather than one to one.
+func buildPublishScript(containerId string, mappings []PortMapping) string {
+	dnatChain, snatChain := portChains(containerId)
+	// chain names are quoted since container ids may contain '-'
+	dnatChain, snatChain = fmt.Sprintf("%q", dnatChain), fmt.Sprintf("%q", snatChain)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "add table ip %s\n", nftTable)
+	fmt.Fprintf(&b, "add chain ip %s prerouting { type nat hook prerouting priority -100; policy accept; }\n", nftTable)
+	fmt.Fprintf(&b, "add chain ip %s output { type nat hook output priority -100; policy accept; }\n", nftTable)
+	fmt.Fprintf(&b, "add chain ip %s postrouting { type nat hook postrouting priority 100; policy accept; }\n", nftTable)
+	for _, chain := range []string{dnatChain, snatChain} {
+		fmt.Fprintf(&b, "add chain ip %s %s\n", nftTable, chain)
+		fmt.Fprintf(&b, "flush chain ip %s %s\n", nftTable, chain)
+	}
+
+	for _, m := range mappings {
+		daddr := ""
+		if m.HostIP != "0.0.0.0" {
+			daddr = "ip daddr " + m.HostIP + " "
+		}
+		switch {
+		case m.Range == 1:
+			fmt.Fprintf(&b, "add rule ip %s %s %s%s dport %d dnat to %s:%d\n", nftTable, dnatChain,
+				daddr, m.Protocol, m.HostPort, m.ContainerIP, m.ContainerPort)
+		case m.HostPort == m.ContainerPort:
+			fmt.Fprintf(&b, "add rule ip %s %s %s%s dport %s dnat to %s\n", nftTable, dnatChain,
+				daddr, m.Protocol, portRange(m.HostPort, m.Range), m.ContainerIP)
+		default:
+			for i := 0; i < m.Range; i++ {
+				fmt.Fprintf(&b, "add rule ip %s %s %s%s dport %d dnat to %s:%d\n", nftTable, dnatChain,
+					daddr, m.Protocol, m.HostPort+i, m.ContainerIP, m.ContainerPort+i)
+			}
+		}
+		containerPorts := portRange(m.ContainerPort, m.Range)
+		fmt.Fprintf(&b, "add rule ip %s %s ip saddr %s ip daddr %s %s dport %s masquerade\n", nftTable, snatChain,
+			m.ContainerIP, m.ContainerIP, m.Protocol, containerPorts)
+		fmt.Fprintf(&b, "add rule ip %s %s ip saddr 127.0.0.0/8 ip daddr %s %s dport %s masquerade\n", nftTable, snatChain,
+			m.ContainerIP, m.Protocol, containerPorts)
+	}
+
+	comment := fmt.Sprintf("comment %q", containerId)
+	fmt.Fprintf(&b, "add rule ip %s prerouting fib daddr type local jump %s %s\n", nftTable, dnatChain, comment)
+	fmt.Fprintf(&b, "add rule ip %s output fib daddr type local jump %s %s\n", nftTable, dnatChain, comment)
+	fmt.Fprintf(&b, "add rule ip %s postrouting jump %s %s\n", nftTable, snatChain, comment)
+	return b.String()
+}
+
+// portChains returns the names of the dnat and snat chains of the
+// container.
+func portChains(containerId string) (string, string) {
+	return "dnat_" + containerId, "snat_" + containerId
+}
+
+// portRange formats a port, or a range of ports, for a dport match.
+func portRange(first int, count int) string {
+	if count == 1 {
+		return fmt.Sprint(first)
+	}
+	return fmt.Sprintf("%d-%d", first, first+count-1)
+}
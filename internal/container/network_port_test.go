@@ -0,0 +1,192 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubNft logs each call as "<args>" followed by stdin, and prints
+// ruleset.json for `nft -j list table`, or fails as nft does when the
+// table does not exist.
+const stubNft = `#!/bin/sh
+dir=$(dirname "$0")
+echo "$*" >> "$dir/calls.log"
+if [ "$1" = "-j" ]; then
+	if [ -f "$dir/ruleset.json" ]; then
+		cat "$dir/ruleset.json"
+		exit 0
+	fi
+	echo "Error: No such file or directory" >&2
+	exit 1
+fi
+cat >> "$dir/calls.log"
+`
+
+func newTestNftPortPublisher(t *testing.T) (*nftPortPublisher, string) {
+	tmp := t.TempDir()
+	t.Setenv("RAIND_ROOT_DIR", tmp)
+	assert.Nil(t, os.MkdirAll(filepath.Join(tmp, "111111"), 0755))
+	binDir := filepath.Join(tmp, "bin")
+	assert.Nil(t, os.MkdirAll(binDir, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(binDir, "nft"), []byte(stubNft), 0755))
+
+	return &nftPortPublisher{
+		nft: nftCommand{
+			commandFactory: utils.NewCommandFactory(),
+			path:           filepath.Join(binDir, "nft"),
+		},
+	}, binDir
+}
+
+func buildPortSpec(ports string) spec.Spec {
+	return spec.Spec{
+		Annotations: spec.AnnotationObject{
+			Version: "0.2.0",
+			Net: `{"mode":"bridge","interfaces":[{"name":"rd_111111","bridgeInterface":"raind0","ipv4":{"address":"10.166.0.2/24"}}],` +
+				`"ports":` + ports + `}`,
+		},
+		LinuxSpec: spec.LinuxSpecObject{Namespaces: []spec.NamespaceObject{{Type: "network"}}},
+	}
+}
+
+func TestPortPublish_Rules(t *testing.T) {
+	// == arrange ==
+	publisher, binDir := newTestNftPortPublisher(t)
+	containerSpec := buildPortSpec(`[
+		{"hostPort":8080,"containerPort":80},
+		{"hostIP":"192.168.1.10","hostPort":5000,"containerPort":6000,"protocol":"udp","range":2}
+	]`)
+
+	// == act ==
+	err := publisher.publish("111111", containerSpec)
+	calls, readErr := os.ReadFile(filepath.Join(binDir, "calls.log"))
+	var mappings []PortMapping
+	mappingErr := utils.ReadJsonFile(utils.ContainerPortsPath("111111"), &mappings)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Nil(t, readErr)
+	assert.Contains(t, string(calls), `add chain ip raind prerouting { type nat hook prerouting priority -100; policy accept; }`)
+	assert.Contains(t, string(calls), `add rule ip raind "dnat_111111" tcp dport 8080 dnat to 10.166.0.2:80`)
+	assert.Contains(t, string(calls), `add rule ip raind "dnat_111111" ip daddr 192.168.1.10 udp dport 5000 dnat to 10.166.0.2:6000`)
+	assert.Contains(t, string(calls), `add rule ip raind "dnat_111111" ip daddr 192.168.1.10 udp dport 5001 dnat to 10.166.0.2:6001`)
+	assert.Contains(t, string(calls), `add rule ip raind "snat_111111" ip saddr 10.166.0.2 ip daddr 10.166.0.2 udp dport 6000-6001 masquerade`)
+	assert.Contains(t, string(calls), `add rule ip raind prerouting fib daddr type local jump "dnat_111111" comment "111111"`)
+	assert.Nil(t, mappingErr)
+	assert.Equal(t, []PortMapping{
+		{HostIP: "0.0.0.0", HostPort: 8080, ContainerIP: "10.166.0.2", ContainerPort: 80, Protocol: "tcp", Range: 1},
+		{HostIP: "192.168.1.10", HostPort: 5000, ContainerIP: "10.166.0.2", ContainerPort: 6000, Protocol: "udp", Range: 2},
+	}, mappings)
+	assert.Equal(t, "6000-6001/udp -> 192.168.1.10:5000-5001", mappings[1].String())
+}
+
+func TestPortPublish_InvalidProtocol(t *testing.T) {
+	// == arrange ==
+	publisher, _ := newTestNftPortPublisher(t)
+	containerSpec := buildPortSpec(`[{"hostPort":8080,"containerPort":80,"protocol":"sctp"}]`)
+
+	// == act ==
+	err := publisher.publish("111111", containerSpec)
+
+	// == assert ==
+	assert.EqualError(t, err, `invalid protocol of port 8080: "sctp"`)
+	_, statErr := os.Stat(utils.ContainerPortsPath("111111"))
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func TestPortPublish_Conflict(t *testing.T) {
+	// == arrange ==
+	publisher, binDir := newTestNftPortPublisher(t)
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir("222222"), 0755))
+	assert.Nil(t, utils.WriteJsonToFile(utils.ContainerPortsPath("222222"), []PortMapping{
+		{HostIP: "192.168.1.10", HostPort: 8000, ContainerIP: "10.166.0.3", ContainerPort: 8000, Protocol: "tcp", Range: 10},
+	}))
+	containerSpec := buildPortSpec(`[
+		{"hostPort":9000,"containerPort":80},
+		{"hostPort":8005,"containerPort":80}
+	]`)
+
+	// == act ==
+	err := publisher.publish("111111", containerSpec)
+
+	// == assert ==
+	assert.EqualError(t, err, "port 80/tcp -> 0.0.0.0:8005 conflicts with 8000-8009/tcp -> 192.168.1.10:8000-8009 of container 222222")
+	_, callsErr := os.Stat(filepath.Join(binDir, "calls.log"))
+	assert.True(t, os.IsNotExist(callsErr))
+	_, statErr := os.Stat(utils.ContainerPortsPath("111111"))
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func TestPortMappingOverlaps(t *testing.T) {
+	// == arrange ==
+	published := PortMapping{HostIP: "192.168.1.10", HostPort: 8000, Protocol: "tcp", Range: 10}
+	tests := []struct {
+		mapping  PortMapping
+		expected bool
+	}{
+		{PortMapping{HostIP: "192.168.1.10", HostPort: 8009, Protocol: "tcp", Range: 1}, true},
+		{PortMapping{HostIP: "0.0.0.0", HostPort: 7990, Protocol: "tcp", Range: 20}, true},
+		{PortMapping{HostIP: "192.168.1.10", HostPort: 8010, Protocol: "tcp", Range: 1}, false},
+		{PortMapping{HostIP: "192.168.1.11", HostPort: 8000, Protocol: "tcp", Range: 1}, false},
+		{PortMapping{HostIP: "192.168.1.10", HostPort: 8000, Protocol: "udp", Range: 1}, false},
+	}
+
+	for _, tt := range tests {
+		// == act ==
+		got := tt.mapping.overlaps(published)
+
+		// == assert ==
+		assert.Equal(t, tt.expected, got, tt.mapping.String())
+	}
+}
+
+func TestPortUnpublish_DeletesRules(t *testing.T) {
+	// == arrange ==
+	publisher, binDir := newTestNftPortPublisher(t)
+	assert.Nil(t, utils.WriteJsonToFile(utils.ContainerPortsPath("111111"), []PortMapping{}))
+	assert.Nil(t, os.WriteFile(filepath.Join(binDir, "ruleset.json"), []byte(`{"nftables":[
+		{"metainfo":{"json_schema_version":1}},
+		{"table":{"family":"ip","name":"raind","handle":1}},
+		{"chain":{"family":"ip","table":"raind","name":"prerouting","handle":1}},
+		{"chain":{"family":"ip","table":"raind","name":"dnat_111111","handle":4}},
+		{"chain":{"family":"ip","table":"raind","name":"snat_111111","handle":5}},
+		{"chain":{"family":"ip","table":"raind","name":"dnat_222222","handle":6}},
+		{"rule":{"family":"ip","table":"raind","chain":"prerouting","handle":7,"comment":"111111"}},
+		{"rule":{"family":"ip","table":"raind","chain":"prerouting","handle":8,"comment":"222222"}},
+		{"rule":{"family":"ip","table":"raind","chain":"postrouting","handle":9,"comment":"111111"}}
+	]}`), 0644))
+
+	// == act ==
+	err := publisher.unpublish("111111")
+	calls, readErr := os.ReadFile(filepath.Join(binDir, "calls.log"))
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Nil(t, readErr)
+	assert.Contains(t, string(calls), "delete rule ip raind prerouting handle 7\n")
+	assert.Contains(t, string(calls), "delete rule ip raind postrouting handle 9\n")
+	assert.NotContains(t, string(calls), "handle 8")
+	assert.Contains(t, string(calls), "flush chain ip raind \"dnat_111111\"\ndelete chain ip raind \"dnat_111111\"\n")
+	assert.Contains(t, string(calls), "delete chain ip raind \"snat_111111\"\n")
+	assert.NotContains(t, string(calls), "dnat_222222")
+	_, statErr := os.Stat(utils.ContainerPortsPath("111111"))
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func TestPortUnpublish_NotPublished(t *testing.T) {
+	// == arrange ==
+	publisher, binDir := newTestNftPortPublisher(t)
+
+	// == act ==
+	err := publisher.unpublish("111111")
+
+	// == assert ==
+	assert.Nil(t, err)
+	_, statErr := os.Stat(filepath.Join(binDir, "calls.log"))
+	assert.True(t, os.IsNotExist(statErr))
+}
@@ -0,0 +1,158 @@
+package container
+
+import (
+	"droplet/internal/ipam"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// NewNetworkPrune constructs a NetworkPrune with the default
+// implementations of its dependencies.
+// This is the main entry point for the `network prune` workflow, which
+// removes veth interfaces and IPAM leases leaked by crashed or removed
+// containers.
+func NewNetworkPrune() *NetworkPrune {
+	return &NetworkPrune{
+		containerStatusManager: status.NewStatusHandler(),
+		networkLinkHandler:     newContainerNetworkController(),
+		addressManager:         ipam.NewIpamHandler(),
+	}
+}
+
+// NetworkPrune removes veth interfaces attached to the bridges that no
+// longer belong to a live container, and the IPAM leases of containers
+// that no longer exist.
+//
+// Bridges may be shared with the CNI backend, whose plugins name the host
+// veths themselves, so the interfaces recorded in the CNI result of every
+// CNI container are kept as well.
+type NetworkPrune struct {
+	containerStatusManager status.ContainerStatusManager
+	networkLinkHandler     networkLinkHandler
+	addressManager         ipam.AddressManager
+}
+
+// Prune deletes the leaked veth interfaces and returns their names.
+//
+// The workflow is:
+//  1. Collect the host-side veth of every created, running or paused
+//     container, and the host-side interfaces of every CNI container
+//  2. List the veth interfaces attached to the bridges
+//  3. Delete every interface that is not in use
+func (p *NetworkPrune) Prune(opt NetworkPruneOption) ([]string, error) {
+	// 1. collect interfaces in use
+	containerStatusList, err := p.containerStatusManager.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+	inUse := map[string]bool{}
+	for _, entry := range containerStatusList {
+		if entry.Annotaion.Net == "" {
+			continue
+		}
+		networkConfig, err := spec.ParseNetConfig(entry.Annotaion)
+		if err != nil {
+			continue
+		}
+		if networkConfig.Backend == networkBackendCni {
+			// released by CNI DEL when the container is deleted
+			names, ok, err := cniHostInterfaces(entry.Id)
+			if err == nil && !ok {
+				err = fmt.Errorf("container %s has no cni result yet", entry.Id)
+			}
+			if err != nil {
+				return nil, &NetworkStepError{Step: "load_cni_result", Err: err}
+			}
+			for _, name := range names {
+				inUse[name] = true
+			}
+			continue
+		}
+		if entry.Status == status.STOPPED.String() {
+			continue
+		}
+		for _, iface := range networkConfig.Interfaces {
+			inUse[iface.Name] = true
+		}
+	}
+
+	// 2. list bridge ports
+	var ports []string
+	for _, bridge := range opt.Bridges {
+		bridgePorts, err := p.networkLinkHandler.listBridgePorts(bridge)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, bridgePorts...)
+	}
+
+	// 3. delete leaked interfaces
+	var removed []string
+	for _, port := range ports {
+		if inUse[port] {
+			continue
+		}
+		if err := p.networkLinkHandler.deleteLink(port); err != nil {
+			return removed, &NetworkStepError{Step: "delete_veth", Link: port, Err: err}
+		}
+		removed = append(removed, port)
+	}
+	return removed, nil
+}
+
+// PruneLeases releases the IPAM leases of containers without state.json,
+// e.g. left behind by a delete whose release failed, and returns their
+// container IDs.
+//
+// state.json is checked under the state lock of the container, which
+// create holds from leasing the addresses until state.json is written,
+// so the leases of a container being created are kept.
+func (p *NetworkPrune) PruneLeases() ([]string, error) {
+	leases, err := p.addressManager.ListLeases()
+	if err != nil {
+		return nil, err
+	}
+
+	var released []string
+	checked := map[string]bool{}
+	for _, lease := range leases {
+		if checked[lease.ContainerId] {
+			continue
+		}
+		checked[lease.ContainerId] = true
+
+		stale, err := p.releaseStaleLeases(lease.ContainerId)
+		if err != nil {
+			return released, &NetworkStepError{Step: "release_address", Err: fmt.Errorf("container %s: %w", lease.ContainerId, err)}
+		}
+		if stale {
+			released = append(released, lease.ContainerId)
+		}
+	}
+	return released, nil
+}
+
+// releaseStaleLeases releases the leases of the container if it has no
+// state.json, and reports whether it did.
+func (p *NetworkPrune) releaseStaleLeases(containerId string) (bool, error) {
+	// without the container directory there is nothing to lock, and no
+	// config.json to create the container from
+	if _, err := os.Stat(utils.ContainerDir(containerId)); errors.Is(err, fs.ErrNotExist) {
+		return true, p.addressManager.Release(containerId)
+	}
+
+	stale := false
+	err := utils.WithFileLock(utils.ContainerStateLockPath(containerId), func() error {
+		if _, err := os.Stat(utils.ContainerStatePath(containerId)); !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		stale = true
+		return p.addressManager.Release(containerId)
+	})
+	return stale, err
+}
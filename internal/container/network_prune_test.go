@@ -0,0 +1,125 @@
+package container
+
+import (
+	"droplet/internal/ipam"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeListStatusManager struct {
+	status.ContainerStatusManager
+	list []status.StatusObject
+}
+
+func (f *fakeListStatusManager) ListContainers() ([]status.StatusObject, error) {
+	return f.list, nil
+}
+
+type fakeNetworkLinkHandler struct {
+	ports   []string
+	deleted []string
+}
+
+func (f *fakeNetworkLinkHandler) listBridgePorts(bridge string) ([]string, error) {
+	return f.ports, nil
+}
+
+func (f *fakeNetworkLinkHandler) deleteLink(name string) error {
+	f.deleted = append(f.deleted, name)
+	return nil
+}
+
+func TestNetworkPrune_RemovesLeakedVeth(t *testing.T) {
+	// == arrange ==
+	statusManager := &fakeListStatusManager{
+		list: []status.StatusObject{
+			{
+				Id:        "running",
+				Status:    status.RUNNING.String(),
+				Annotaion: spec.AnnotationObject{Net: `{"interfaces":[{"name":"rd_running"}]}`, Version: "0.2.0"},
+			},
+			{
+				Id:        "stopped",
+				Status:    status.STOPPED.String(),
+				Annotaion: spec.AnnotationObject{Net: `{"interfaces":[{"name":"rd_stopped"}]}`, Version: "0.2.0"},
+			},
+		},
+	}
+	linkHandler := &fakeNetworkLinkHandler{
+		ports: []string{"rd_running", "rd_stopped", "rd_removed"},
+	}
+	networkPrune := &NetworkPrune{
+		containerStatusManager: statusManager,
+		networkLinkHandler:     linkHandler,
+	}
+
+	// == act ==
+	removed, err := networkPrune.Prune(NetworkPruneOption{Bridges: []string{"raind_br0"}})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"rd_stopped", "rd_removed"}, removed)
+	assert.Equal(t, []string{"rd_stopped", "rd_removed"}, linkHandler.deleted)
+}
+
+func TestNetworkPrune_KeepsCniVeth(t *testing.T) {
+	// == arrange ==
+	setupTestRootDir(t)
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir("cni"), 0700))
+	assert.Nil(t, os.WriteFile(utils.CniResultPath("cni"), []byte(`{"network":"raind","ifName":"eth0","result":{"interfaces":[{"name":"raind_br0"},{"name":"veth1a2b3c4d"},{"name":"eth0","sandbox":"/proc/1/ns/net"}]}}`), 0600))
+	statusManager := &fakeListStatusManager{
+		list: []status.StatusObject{
+			{
+				Id:        "cni",
+				Status:    status.RUNNING.String(),
+				Annotaion: spec.AnnotationObject{Net: `{"mode":"bridge","backend":"cni","cni":{"network":"raind"}}`, Version: "0.2.0"},
+			},
+		},
+	}
+	linkHandler := &fakeNetworkLinkHandler{
+		ports: []string{"veth1a2b3c4d", "rd_removed"},
+	}
+	networkPrune := &NetworkPrune{
+		containerStatusManager: statusManager,
+		networkLinkHandler:     linkHandler,
+	}
+
+	// == act ==
+	removed, err := networkPrune.Prune(NetworkPruneOption{Bridges: []string{"raind_br0"}})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"rd_removed"}, removed)
+}
+
+func TestNetworkPrune_ReleasesStaleLeases(t *testing.T) {
+	// == arrange ==
+	setupTestRootDir(t)
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir("live"), 0700))
+	assert.Nil(t, os.WriteFile(utils.ContainerStatePath("live"), []byte(`{}`), 0600))
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir("deleted"), 0700))
+	addressManager := &fakeAddressManager{
+		leases: []ipam.Lease{
+			{ContainerId: "deleted", Interface: "rd_data"},
+			{ContainerId: "deleted", Interface: "rd_mgmt"},
+			{ContainerId: "live", Interface: "rd_live"},
+			{ContainerId: "removed", Interface: "rd_removed"},
+		},
+	}
+	networkPrune := &NetworkPrune{
+		addressManager: addressManager,
+	}
+
+	// == act ==
+	released, err := networkPrune.PruneLeases()
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"deleted", "removed"}, released)
+	assert.Equal(t, []string{"deleted", "removed"}, addressManager.released)
+}
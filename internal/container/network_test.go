@@ -0,0 +1,163 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNetworkSetup_Success(t *testing.T) {
+	// == arrange ==
+	networkConfig := spec.NetConfigObject{
+		Interfaces: []spec.InterfaceObject{
+			{
+				Name:               "rd_01234567",
+				HostInterface:      "vethc_01234567",
+				BridgeInterface:    "raind0",
+				ContainerInterface: "eth0",
+				IPv4:               spec.IPv4Object{Address: "10.166.0.2/24", Gateway: "10.166.0.254"},
+			},
+		},
+	}
+
+	// == act ==
+	setup, err := parseNetworkSetup(networkConfig)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(setup.interfaces))
+	assert.Equal(t, "10.166.0.2/24", setup.interfaces[0].address.String())
+	assert.Equal(t, "10.166.0.254", setup.interfaces[0].gateway.String())
+	assert.Equal(t, "eth0", setup.interfaces[0].containerLink)
+}
+
+func TestParseNetworkSetup_InvalidAddress(t *testing.T) {
+	// == arrange ==
+	networkConfig := spec.NetConfigObject{
+		Interfaces: []spec.InterfaceObject{
+			{
+				Name:               "rd_01234567",
+				HostInterface:      "vethc_01234567",
+				BridgeInterface:    "raind0",
+				ContainerInterface: "eth0",
+				IPv4:               spec.IPv4Object{Address: "10.166.0.2"},
+			},
+		},
+	}
+
+	// == act ==
+	_, err := parseNetworkSetup(networkConfig)
+
+	// == assert ==
+	var stepErr *NetworkStepError
+	assert.True(t, errors.As(err, &stepErr))
+	assert.Equal(t, "parse_config", stepErr.Step)
+	assert.Equal(t, "eth0", stepErr.Link)
+}
+
+func TestNetworkStepError_Error(t *testing.T) {
+	// == arrange ==
+	err := &NetworkStepError{Step: "attach_bridge", Link: "raind0", Err: errors.New("no such device")}
+
+	// == act ==
+	msg := err.Error()
+
+	// == assert ==
+	assert.Equal(t, "network attach_bridge (raind0): no such device", msg)
+}
+
+func TestParseNetworkSetup_DualStack(t *testing.T) {
+	// == arrange ==
+	networkConfig := spec.NetConfigObject{
+		Interfaces: []spec.InterfaceObject{
+			{
+				Name:               "rd_01234567",
+				HostInterface:      "vethc_01234567",
+				BridgeInterface:    "raind0",
+				ContainerInterface: "eth0",
+				IPv4:               spec.IPv4Object{Address: "10.166.0.2/24"},
+				IPv6:               &spec.IPv6Object{Address: "fd00::2/64", Gateway: "fd00::1", DisableDAD: true},
+				Routes: []spec.RouteObject{
+					{Destination: "10.10.0.0/16", Gateway: "10.166.0.253"},
+					{Destination: "fd01::/64"},
+				},
+			},
+		},
+	}
+
+	// == act ==
+	setup, err := parseNetworkSetup(networkConfig)
+
+	// == assert ==
+	assert.Nil(t, err)
+	iface := setup.interfaces[0]
+	assert.Equal(t, "fd00::2/64", iface.address6.String())
+	assert.Equal(t, "fd00::1", iface.gateway6.String())
+	assert.True(t, iface.disableDAD6)
+	assert.Equal(t, 2, len(iface.routes))
+	assert.Equal(t, "10.10.0.0/16", iface.routes[0].destination.String())
+	assert.Equal(t, "10.166.0.253", iface.routes[0].gateway.String())
+	assert.Nil(t, iface.routes[1].gateway)
+}
+
+func TestParseNetworkSetup_MultipleInterfaces(t *testing.T) {
+	// == arrange ==
+	networkConfig := spec.NetConfigObject{
+		Interfaces: []spec.InterfaceObject{
+			{
+				Name:               "rd_data",
+				HostInterface:      "eth0",
+				BridgeInterface:    "raind_data",
+				ContainerInterface: "eth0",
+				Mtu:                9000,
+				IPv4:               spec.IPv4Object{Address: "10.166.0.2/24", Gateway: "10.166.0.254"},
+			},
+			{
+				Name:               "rd_mgmt",
+				HostInterface:      "eth1",
+				BridgeInterface:    "raind_mgmt",
+				ContainerInterface: "mgmt0",
+				Mac:                "02:42:ac:11:00:02",
+				IPv4:               spec.IPv4Object{Address: "192.168.100.2/24"},
+			},
+		},
+	}
+
+	// == act ==
+	setup, err := parseNetworkSetup(networkConfig)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(setup.interfaces))
+	assert.Equal(t, 9000, setup.interfaces[0].mtu)
+	assert.Equal(t, "mgmt0", setup.interfaces[1].containerLink)
+	assert.Equal(t, "02:42:ac:11:00:02", setup.interfaces[1].mac.String())
+}
+
+func TestParseNetworkSetup_DuplicateGateway(t *testing.T) {
+	// == arrange ==
+	networkConfig := spec.NetConfigObject{
+		Interfaces: []spec.InterfaceObject{
+			{
+				Name:            "rd_data",
+				HostInterface:   "eth0",
+				BridgeInterface: "raind_data",
+				IPv4:            spec.IPv4Object{Address: "10.166.0.2/24", Gateway: "10.166.0.254"},
+			},
+			{
+				Name:            "rd_mgmt",
+				HostInterface:   "eth1",
+				BridgeInterface: "raind_mgmt",
+				IPv4:            spec.IPv4Object{Address: "192.168.100.2/24", Gateway: "192.168.100.254"},
+			},
+		},
+	}
+
+	// == act ==
+	_, err := parseNetworkSetup(networkConfig)
+
+	// == assert ==
+	assert.EqualError(t, err, "network parse_config (eth1): default gateway is already set by another interface")
+}
@@ -0,0 +1,97 @@
+package container
+
+import (
+	"droplet/internal/logs"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// recordOOMEvents reads the oom and oom_kill counters from memory.events
+// of the container's cgroup and records them in the status file.
+//
+// oomKilled is set once the OOM killer has killed a process of the
+// container. When the counters differ from the recorded ones, an audit
+// record with event "oom" is emitted. Nothing is done if the cgroup or
+// the memory controller does not exist.
+//
+// The counters are informational, so a failure is written to the audit
+// log instead of failing the caller.
+func recordOOMEvents(statusManager status.ContainerStatusManager, containerId string, containerSpec spec.Spec) {
+	oom, changed, err := updateOOMStatus(statusManager, containerId, containerSpec)
+	if err == nil && !changed {
+		return
+	}
+
+	result := "success"
+	var oomInfo *logs.OOMInfo
+	if err != nil {
+		result = "fail"
+	} else {
+		oomInfo = &logs.OOMInfo{
+			Oom:     oom.Oom,
+			OomKill: oom.OomKill,
+		}
+	}
+	_ = logs.RecordAuditLog(logs.AuditRecord{
+		ContainerId: containerId,
+		Event:       "oom",
+		Stage:       "memory_events",
+		OOM:         oomInfo,
+		Result:      result,
+		Error:       err,
+	})
+}
+
+// updateOOMStatus records the counters of memory.events in the status
+// file. changed is false when the file does not exist or the counters
+// are already recorded.
+func updateOOMStatus(statusManager status.ContainerStatusManager, containerId string, containerSpec spec.Spec) (status.OOMObject, bool, error) {
+	cgroupPath, err := utils.ResolveCgroupPath(containerId, containerSpec.LinuxSpec.CgroupsPath)
+	if err != nil {
+		return status.OOMObject{}, false, err
+	}
+	oom, found, err := readOOMEvents(filepath.Join(cgroupPath, "memory.events"))
+	if err != nil || !found {
+		return status.OOMObject{}, false, err
+	}
+	changed, err := statusManager.SetOOM(containerId, oom)
+	if err != nil {
+		return status.OOMObject{}, false, err
+	}
+	return oom, changed, nil
+}
+
+// readOOMEvents parses the oom and oom_kill keys of memory.events. found
+// is false when the file does not exist.
+func readOOMEvents(path string) (oom status.OOMObject, found bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return status.OOMObject{}, false, nil
+		}
+		return status.OOMObject{}, false, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return status.OOMObject{}, false, fmt.Errorf("invalid value in %s: %q", path, line)
+		}
+		switch fields[0] {
+		case "oom":
+			oom.Oom = v
+		case "oom_kill":
+			oom.OomKill = v
+		}
+	}
+	return oom, true, nil
+}
@@ -0,0 +1,37 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"droplet/internal/status"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOOMEvents_Success(t *testing.T) {
+	// == arrange ==
+	path := filepath.Join(t.TempDir(), "memory.events")
+	assert.Nil(t, os.WriteFile(path, []byte("low 0\nhigh 0\nmax 12\noom 2\noom_kill 1\noom_group_kill 0\n"), 0644))
+
+	// == act ==
+	oom, found, err := readOOMEvents(path)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, status.OOMObject{Oom: 2, OomKill: 1}, oom)
+}
+
+func TestReadOOMEvents_NotExist(t *testing.T) {
+	// == arrange ==
+	path := filepath.Join(t.TempDir(), "memory.events")
+
+	// == act ==
+	_, found, err := readOOMEvents(path)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
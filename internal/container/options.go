@@ -1,5 +1,7 @@
 package container
 
+import "droplet/internal/spec"
+
 // create options
 type CreateOption struct {
 	ContainerId  string
@@ -37,14 +39,63 @@ type ExecOption struct {
 type KillOption struct {
 	ContainerId string
 	Signal      string
+	All         bool
+}
+
+// pause options
+type PauseOption struct {
+	ContainerId string
+}
+
+// resume options
+type ResumeOption struct {
+	ContainerId string
+}
+
+// state options
+type StateOption struct {
+	ContainerId string
 }
 
 // delete options
 type DeleteOption struct {
 	ContainerId string
+	Force       bool
+}
+
+// update options
+type UpdateOption struct {
+	ContainerId string
+	Resources   spec.ResourceObject
+	// NetworkFiles, if not nil, regenerates the /etc files of the
+	// container with the given dns settings and extra hosts.
+	NetworkFiles *spec.NetworkFilesObject
+	// Policy, if not nil, replaces the firewall policy of the container.
+	// A policy without directions removes it.
+	Policy *spec.PolicyObject
+}
+
+// port options
+type PortListOption struct {
+	ContainerId string
+}
+
+// stats options
+type StatsOption struct {
+	ContainerId string
 }
 
 // attach options
 type AttachOption struct {
 	ContainerId string
 }
+
+// network prune options
+type NetworkPruneOption struct {
+	Bridges []string
+}
+
+// network check options
+type NetworkCheckOption struct {
+	ContainerId string
+}
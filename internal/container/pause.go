@@ -0,0 +1,104 @@
+package container
+
+import (
+	"droplet/internal/logs"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"fmt"
+)
+
+// NewContainerPause constructs a ContainerPause with the default
+// implementations of its dependencies.
+// This is the main entry point for the `pause` workflow, which suspends
+// every process of a running container.
+func NewContainerPause() *ContainerPause {
+	return &ContainerPause{
+		specLoader:             newFileSpecLoader(),
+		containerCgroupFreezer: newContainerCgroupController(),
+		containerStatusManager: status.NewStatusHandler(),
+	}
+}
+
+// ContainerPause orchestrates the container pause flow.
+//
+// It is responsible for:
+//   - Verifying that the container is RUNNING
+//   - Freezing the container's cgroup
+//   - Updating the container status to PAUSED
+type ContainerPause struct {
+	specLoader             specLoader
+	containerCgroupFreezer containerCgroupFreezer
+	containerStatusManager status.ContainerStatusManager
+}
+
+// Pause freezes all processes of the container.
+//
+// The workflow is:
+//  1. Load config.json
+//  2. Check that the container is RUNNING
+//  3. Freeze the container's cgroup and wait until it is frozen
+//  4. Update the status file to PAUSED
+//
+// If any step fails, the method stops and returns the error.
+func (c *ContainerPause) Pause(opt PauseOption) (err error) {
+	var (
+		spec  spec.Spec
+		event = "pause"
+		stage string
+	)
+
+	// audit log
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "fail"
+		}
+		_ = logs.RecordAuditLog(logs.AuditRecord{
+			ContainerId: opt.ContainerId,
+			Event:       event,
+			Stage:       stage,
+			Spec:        &spec,
+			Result:      result,
+			Error:       err,
+		})
+	}()
+
+	// 1. load config.json
+	stage = "load_spec"
+	spec, err = c.specLoader.loadFile(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+
+	// 2. check container status
+	stage = "check_status"
+	containerStatus, err := c.containerStatusManager.GetStatusFromId(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	if containerStatus != status.RUNNING {
+		return fmt.Errorf("container: %s is not running. current status: %s", opt.ContainerId, containerStatus)
+	}
+
+	// 3. freeze cgroup
+	stage = "freeze_cgroup"
+	err = c.containerCgroupFreezer.freeze(opt.ContainerId, spec)
+	if err != nil {
+		return err
+	}
+
+	// 4. update state.json
+	//      status = paused
+	stage = "update_state"
+	err = c.containerStatusManager.UpdateStatus(
+		opt.ContainerId,
+		status.PAUSED,
+		-1, // no update
+		-1, // no update
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package container
+
+import (
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"errors"
+	"io/fs"
+)
+
+// NewContainerPort constructs a ContainerPort with the default
+// implementations of its dependencies.
+// This is the main entry point for the `port` workflow, which lists the
+// ports a container publishes on the host.
+func NewContainerPort() *ContainerPort {
+	return &ContainerPort{
+		containerStatusManager: status.NewStatusHandler(),
+	}
+}
+
+// ContainerPort lists the published ports of a container.
+type ContainerPort struct {
+	containerStatusManager status.ContainerStatusManager
+}
+
+// List returns the port mappings currently installed for the container.
+// A container that is stopped or publishes no ports has none.
+func (c *ContainerPort) List(opt PortListOption) ([]PortMapping, error) {
+	// 1. check that the container exists
+	if _, err := c.containerStatusManager.GetStatusFromId(opt.ContainerId); err != nil {
+		return nil, err
+	}
+
+	// 2. read mappings
+	var mappings []PortMapping
+	if err := utils.ReadJsonFile(utils.ContainerPortsPath(opt.ContainerId), &mappings); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return mappings, nil
+}
@@ -0,0 +1,104 @@
+package container
+
+import (
+	"droplet/internal/logs"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"fmt"
+)
+
+// NewContainerResume constructs a ContainerResume with the default
+// implementations of its dependencies.
+// This is the main entry point for the `resume` workflow, which resumes
+// the processes of a paused container.
+func NewContainerResume() *ContainerResume {
+	return &ContainerResume{
+		specLoader:             newFileSpecLoader(),
+		containerCgroupFreezer: newContainerCgroupController(),
+		containerStatusManager: status.NewStatusHandler(),
+	}
+}
+
+// ContainerResume orchestrates the container resume flow.
+//
+// It is responsible for:
+//   - Verifying that the container is PAUSED
+//   - Thawing the container's cgroup
+//   - Updating the container status to RUNNING
+type ContainerResume struct {
+	specLoader             specLoader
+	containerCgroupFreezer containerCgroupFreezer
+	containerStatusManager status.ContainerStatusManager
+}
+
+// Resume thaws all processes of the container.
+//
+// The workflow is:
+//  1. Load config.json
+//  2. Check that the container is PAUSED
+//  3. Thaw the container's cgroup and wait until it is no longer frozen
+//  4. Update the status file to RUNNING
+//
+// If any step fails, the method stops and returns the error.
+func (c *ContainerResume) Resume(opt ResumeOption) (err error) {
+	var (
+		spec  spec.Spec
+		event = "resume"
+		stage string
+	)
+
+	// audit log
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "fail"
+		}
+		_ = logs.RecordAuditLog(logs.AuditRecord{
+			ContainerId: opt.ContainerId,
+			Event:       event,
+			Stage:       stage,
+			Spec:        &spec,
+			Result:      result,
+			Error:       err,
+		})
+	}()
+
+	// 1. load config.json
+	stage = "load_spec"
+	spec, err = c.specLoader.loadFile(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+
+	// 2. check container status
+	stage = "check_status"
+	containerStatus, err := c.containerStatusManager.GetStatusFromId(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	if containerStatus != status.PAUSED {
+		return fmt.Errorf("container: %s is not paused. current status: %s", opt.ContainerId, containerStatus)
+	}
+
+	// 3. thaw cgroup
+	stage = "thaw_cgroup"
+	err = c.containerCgroupFreezer.thaw(opt.ContainerId, spec)
+	if err != nil {
+		return err
+	}
+
+	// 4. update state.json
+	//      status = running
+	stage = "update_state"
+	err = c.containerStatusManager.UpdateStatus(
+		opt.ContainerId,
+		status.RUNNING,
+		-1, // no update
+		-1, // no update
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
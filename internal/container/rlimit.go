@@ -0,0 +1,70 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+var rlimitMap = map[string]int{
+	"RLIMIT_AS":         unix.RLIMIT_AS,
+	"RLIMIT_CORE":       unix.RLIMIT_CORE,
+	"RLIMIT_CPU":        unix.RLIMIT_CPU,
+	"RLIMIT_DATA":       unix.RLIMIT_DATA,
+	"RLIMIT_FSIZE":      unix.RLIMIT_FSIZE,
+	"RLIMIT_LOCKS":      unix.RLIMIT_LOCKS,
+	"RLIMIT_MEMLOCK":    unix.RLIMIT_MEMLOCK,
+	"RLIMIT_MSGQUEUE":   unix.RLIMIT_MSGQUEUE,
+	"RLIMIT_NICE":       unix.RLIMIT_NICE,
+	"RLIMIT_NOFILE":     unix.RLIMIT_NOFILE,
+	"RLIMIT_NPROC":      unix.RLIMIT_NPROC,
+	"RLIMIT_RSS":        unix.RLIMIT_RSS,
+	"RLIMIT_RTPRIO":     unix.RLIMIT_RTPRIO,
+	"RLIMIT_RTTIME":     unix.RLIMIT_RTTIME,
+	"RLIMIT_SIGPENDING": unix.RLIMIT_SIGPENDING,
+	"RLIMIT_STACK":      unix.RLIMIT_STACK,
+}
+
+const (
+	oomScoreAdjMin = -1000
+	oomScoreAdjMax = 1000
+)
+
+// ValidateRlimitType reports an error when name is not a resource
+// supported by setrlimit(2) on Linux (e.g. RLIMIT_NOFILE).
+func ValidateRlimitType(name string) error {
+	if _, ok := rlimitMap[name]; !ok {
+		return fmt.Errorf("unknown rlimit type: %q", name)
+	}
+	return nil
+}
+
+// validateRlimits checks every entry of process.rlimits before any of
+// them is applied, so that a bad entry does not leave the process with
+// only part of the limits set.
+func validateRlimits(rlimits []spec.RlimitObject) error {
+	seen := map[string]struct{}{}
+	for i, r := range rlimits {
+		if err := ValidateRlimitType(r.Type); err != nil {
+			return fmt.Errorf("rlimits[%d]: %w", i, err)
+		}
+		if _, dup := seen[r.Type]; dup {
+			return fmt.Errorf("rlimits[%d]: duplicate rlimit type: %q", i, r.Type)
+		}
+		seen[r.Type] = struct{}{}
+		if r.Soft > r.Hard {
+			return fmt.Errorf("rlimits[%d]: soft limit %d exceeds hard limit %d for %s", i, r.Soft, r.Hard, r.Type)
+		}
+	}
+	return nil
+}
+
+// validateOOMScoreAdj checks that process.oomScoreAdj is within the range
+// accepted by /proc/<pid>/oom_score_adj.
+func validateOOMScoreAdj(score int) error {
+	if score < oomScoreAdjMin || score > oomScoreAdjMax {
+		return fmt.Errorf("oomScoreAdj %d out of range [%d, %d]", score, oomScoreAdjMin, oomScoreAdjMax)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRlimits_Success(t *testing.T) {
+	// == arrange ==
+	rlimits := []spec.RlimitObject{
+		{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 4096},
+		{Type: "RLIMIT_NPROC", Soft: 512, Hard: 512},
+	}
+
+	// == act ==
+	err := validateRlimits(rlimits)
+
+	// == assert ==
+	assert.Nil(t, err)
+}
+
+func TestValidateRlimits_InvalidEntry(t *testing.T) {
+	// == arrange ==
+	unknown := []spec.RlimitObject{{Type: "RLIMIT_UNKNOWN", Soft: 1, Hard: 1}}
+	duplicate := []spec.RlimitObject{
+		{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 1024},
+		{Type: "RLIMIT_NOFILE", Soft: 2048, Hard: 2048},
+	}
+	softExceedsHard := []spec.RlimitObject{{Type: "RLIMIT_CORE", Soft: 10, Hard: 1}}
+
+	// == act ==
+	err_1 := validateRlimits(unknown)
+	err_2 := validateRlimits(duplicate)
+	err_3 := validateRlimits(softExceedsHard)
+
+	// == assert ==
+	assert.EqualError(t, err_1, `rlimits[0]: unknown rlimit type: "RLIMIT_UNKNOWN"`)
+	assert.EqualError(t, err_2, `rlimits[1]: duplicate rlimit type: "RLIMIT_NOFILE"`)
+	assert.EqualError(t, err_3, "rlimits[0]: soft limit 10 exceeds hard limit 1 for RLIMIT_CORE")
+}
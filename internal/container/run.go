@@ -23,9 +23,14 @@ func NewContainerRun() *ContainerRun {
 		commandFactory:           utils.NewCommandFactory(),
 		containerStart:           NewContainerStart(),
 		containerCgroupPreparer:  newContainerCgroupController(),
+		containerCgroupStarter:   newContainerCgroupController(),
 		containerNetworkPreparer: newContainerNetworkController(),
+		networkModeResolver:      newNetworkModeResolver(),
+		addressAllocator:         newContainerAddressAllocator(),
+		etcFileGenerator:         newContainerEtcFileGenerator(),
 		containerStatusManager:   status.NewStatusHandler(),
 		containerHookController:  hook.NewHookController(),
+		userNsAllocator:          newUserNsAllocator(),
 	}
 }
 
@@ -33,9 +38,11 @@ func NewContainerRun() *ContainerRun {
 //
 // The run flow performs the following steps:
 //
-//  1. Load the OCI spec (config.json)
+//  1. Load the OCI spec (config.json), resolve its network mode and lease
+//     the addresses of its interfaces
 //  2. Create the FIFO used for init synchronization
 //  3. Spawn the init subprocess of this runtime (via the `init` subcommand)
+//     directly inside the container cgroup
 //  4. Signal the init process to start by writing to the FIFO
 //  5. Attach to and wait for the container process to exit
 //
@@ -47,9 +54,14 @@ type ContainerRun struct {
 	commandFactory           utils.CommandFactory
 	containerStart           *ContainerStart
 	containerCgroupPreparer  containerCgroupPreparer
+	containerCgroupStarter   containerCgroupStarter
 	containerNetworkPreparer containerNetworkPreparer
+	networkModeResolver      networkModeResolver
+	addressAllocator         addressAllocator
+	etcFileGenerator         etcFileGenerator
 	containerStatusManager   status.ContainerStatusManager
 	containerHookController  hook.ContainerHookController
+	userNsAllocator          userNsRangeManager
 }
 
 // Run executes the container run pipeline for the provided container ID.
@@ -66,18 +78,32 @@ func (c *ContainerRun) Run(opt RunOption) error {
 	if err != nil {
 		return err
 	}
+	networkMode, err := c.networkModeResolver.resolve(opt.ContainerId, &spec)
+	if err != nil {
+		return err
+	}
 
-	// 2. create state.json
+	// 2. lease addresses and create state.json
 	//      status = creating
 	//      pid = 0
-	if err := c.containerStatusManager.CreateStatusFile(
-		opt.ContainerId,
-		0,
-		status.CREATING,
-		spec.Root.Path,
-		utils.ContainerDir(opt.ContainerId),
-		spec.Annotations,
-	); err != nil {
+	//    under the state lock, so that network prune does not release the
+	//    leases before state.json exists
+	if err := utils.WithFileLock(utils.ContainerStateLockPath(opt.ContainerId), func() error {
+		if err := checkContainerNotExists(opt.ContainerId); err != nil {
+			return err
+		}
+		if _, err := c.addressAllocator.allocate(opt.ContainerId, &spec); err != nil {
+			return err
+		}
+		return c.containerStatusManager.CreateStatusFile(
+			opt.ContainerId,
+			0,
+			status.CREATING,
+			spec.Root.Path,
+			utils.ContainerDir(opt.ContainerId),
+			spec.Annotations,
+		)
+	}); err != nil {
 		return err
 	}
 
@@ -95,7 +121,12 @@ func (c *ContainerRun) Run(opt RunOption) error {
 		return err
 	}
 
-	// 5. prepare init subcommand
+	// 5. cgroup setup
+	if err := c.containerCgroupPreparer.prepare(opt.ContainerId, spec); err != nil {
+		return err
+	}
+
+	// 6. prepare init subcommand
 	entrypoint := spec.Process.Args
 	initArgs := append([]string{"init", opt.ContainerId, fifo}, entrypoint...)
 	cmd := c.commandFactory.Command(os.Args[0], initArgs...)
@@ -110,12 +141,27 @@ func (c *ContainerRun) Run(opt RunOption) error {
 
 	// apply SysProcAttr
 	nsConfig := buildNamespaceConfig(spec)
-	procAttr := buildProcAttrForRootContainer(nsConfig)
+	procAttr, err := buildProcAttrForRootContainer(opt.ContainerId, spec, nsConfig)
+	if err != nil {
+		return err
+	}
 	sysProcAttr := buildSysProcAttr(procAttr)
 	cmd.SetSysProcAttr(sysProcAttr)
+	// hand runtime files over to the remapped container root
+	if err := chownForRemappedRoot(opt.ContainerId, spec.Annotations.Image, procAttr.uidMap, procAttr.gidMap); err != nil {
+		return err
+	}
+	auditLog, err := passAuditLog(cmd)
+	if err != nil {
+		return err
+	}
+	defer auditLog.Close()
+	if err := passNetnsPath(cmd, spec); err != nil {
+		return err
+	}
 
-	// 6. start init process
-	if err := cmd.Start(); err != nil {
+	// 7. start init process inside the container cgroup
+	if err := c.containerCgroupStarter.start(cmd, opt.ContainerId, spec); err != nil {
 		return err
 	}
 	initPid := cmd.Pid()
@@ -129,13 +175,11 @@ func (c *ContainerRun) Run(opt RunOption) error {
 		fmt.Printf("create container success. ID: %s\n", opt.ContainerId)
 	}
 
-	// 7. cgroup setup
-	if err := c.containerCgroupPreparer.prepare(opt.ContainerId, spec, initPid); err != nil {
+	// 8. network setup
+	if err := c.containerNetworkPreparer.prepare(opt.ContainerId, initPid, spec); err != nil {
 		return err
 	}
-
-	// 8. network setup
-	if err := c.containerNetworkPreparer.prepare(opt.ContainerId, initPid, spec.Annotations); err != nil {
+	if err := c.etcFileGenerator.generate(opt.ContainerId, spec, nil); err != nil {
 		return err
 	}
 
@@ -143,6 +187,8 @@ func (c *ContainerRun) Run(opt RunOption) error {
 	//      status = created
 	//      pid    = init pid
 	//		shimPid = 0
+	//      userNamespace = allocated host id range
+	//      networkMode = resolved network mode
 	if err := c.containerStatusManager.UpdateStatus(
 		opt.ContainerId,
 		status.CREATED,
@@ -151,6 +197,18 @@ func (c *ContainerRun) Run(opt RunOption) error {
 	); err != nil {
 		return err
 	}
+	if err := c.containerStatusManager.SetNetworkMode(opt.ContainerId, networkMode.String()); err != nil {
+		return err
+	}
+	allocation, allocated, err := c.userNsAllocator.lookup(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	if allocated {
+		if err := c.containerStatusManager.SetUserNamespace(opt.ContainerId, allocation.HostID, allocation.Size); err != nil {
+			return err
+		}
+	}
 
 	// 10. HOOK: createContainer
 	if err := c.containerHookController.RunCreateContainerHooks(
@@ -105,12 +105,7 @@ func (m *SeccompManager) InstallDenyFilter(seccompConfig spec.SeccompObject) err
 		return err
 	}
 
-	// 1. no_new_privs is required for unprivileged seccomp filter install
-	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
-		return fmt.Errorf("prctl(PR_SET_NO_NEW_PRIVS) failed: %w", err)
-	}
-
-	// 2. build classic BPF program
+	// 1. build classic BPF program
 	//    - verify arch; if mismatch, kill (safe default)
 	//    - load syscall number; if it matches any blocked syscall, return ERRNO(EPERM)
 	//    - other; ALLOW
@@ -165,6 +160,13 @@ func (m *SeccompManager) InstallDenyFilter(seccompConfig spec.SeccompObject) err
 		Filter: &prog[0],
 	}
 
+	// 2. no_new_privs is required for unprivileged seccomp filter install.
+	//    process.noNewPrivileges is applied separately by the init process;
+	//    this only covers the case where a filter is actually installed.
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("prctl(PR_SET_NO_NEW_PRIVS) failed: %w", err)
+	}
+
 	// 3. Call seccomp(SECCOMP_SET_MODE_FILTER, 0, &fp)
 	//    Use raw syscall because x/sys/unix does not guarantee wrapper availability.
 	_, _, errno := unix.Syscall(unix.SYS_SECCOMP,
@@ -21,14 +21,18 @@ import (
 
 func NewContainerShim() *ContainerShim {
 	return &ContainerShim{
-		specLoader:     newFileSpecLoader(),
-		commandFactory: &utils.ExecCommandFactory{},
+		specLoader:             newFileSpecLoader(),
+		commandFactory:         &utils.ExecCommandFactory{},
+		containerCgroupStarter: newContainerCgroupController(),
+		networkModeResolver:    newNetworkModeResolver(),
 	}
 }
 
 type ContainerShim struct {
-	specLoader     specLoader
-	commandFactory utils.CommandFactory
+	specLoader             specLoader
+	commandFactory         utils.CommandFactory
+	containerCgroupStarter containerCgroupStarter
+	networkModeResolver    networkModeResolver
 }
 
 func (c *ContainerShim) Execute(containerId string, fifo string, entrypoint []string) (err error) {
@@ -62,6 +66,11 @@ func (c *ContainerShim) Execute(containerId string, fifo string, entrypoint []st
 	if err != nil {
 		return err
 	}
+	stage = "resolve_network_mode"
+	_, err = c.networkModeResolver.resolve(containerId, &spec)
+	if err != nil {
+		return err
+	}
 
 	// 2. pty
 	stage = "open_pty"
@@ -102,16 +111,37 @@ func (c *ContainerShim) Execute(containerId string, fifo string, entrypoint []st
 	cmd.SetStderr(tty)
 	// apply SysProcAttr
 	nsConfig := buildNamespaceConfig(spec)
-	procAttr := buildProcAttrForRootContainer(nsConfig)
+	procAttr, err := buildProcAttrForRootContainer(containerId, spec, nsConfig)
+	if err != nil {
+		logger.Printf("build proc attr failed: %v", err)
+		return err
+	}
 	sysProcAttr := buildSysProcAttr(procAttr)
 	sysProcAttr.Setsid = true
 	sysProcAttr.Setctty = true
 	sysProcAttr.Ctty = 0
 	cmd.SetSysProcAttr(sysProcAttr)
+	// hand runtime files over to the remapped container root
+	err = chownForRemappedRoot(containerId, spec.Annotations.Image, procAttr.uidMap, procAttr.gidMap)
+	if err != nil {
+		logger.Printf("chown for user namespace failed: %v", err)
+		return err
+	}
+	auditLog, err := passAuditLog(cmd)
+	if err != nil {
+		logger.Printf("pass audit log failed: %v", err)
+		return err
+	}
+	defer auditLog.Close()
+	err = passNetnsPath(cmd, spec)
+	if err != nil {
+		logger.Printf("pass netns path failed: %v", err)
+		return err
+	}
 
-	// 5. execute init subcommand
+	// 5. execute init subcommand inside the container cgroup
 	stage = "exec_init"
-	err = cmd.Start()
+	err = c.containerCgroupStarter.start(cmd, containerId, spec)
 	if err != nil {
 		logger.Printf("init start failed: %v", err)
 		return err
@@ -0,0 +1,46 @@
+package container
+
+import (
+	"droplet/internal/status"
+)
+
+// NewContainerState constructs a ContainerState with the default
+// implementations of its dependencies.
+// This is the main entry point for the `state` workflow, which reports
+// the state.json of a container.
+func NewContainerState() *ContainerState {
+	return &ContainerState{
+		specLoader:             newFileSpecLoader(),
+		containerStatusManager: status.NewStatusHandler(),
+	}
+}
+
+// ContainerState reads the state of a container.
+type ContainerState struct {
+	specLoader             specLoader
+	containerStatusManager status.ContainerStatusManager
+}
+
+// State returns the raw state.json of the container.
+//
+// The workflow is:
+//  1. Recompute the status from the liveness of the init process
+//  2. If the container is STOPPED, record the OOM counters of its cgroup
+//  3. Read state.json
+func (c *ContainerState) State(opt StateOption) (string, error) {
+	// 1. recompute status
+	containerStatus, err := c.containerStatusManager.GetStatusFromId(opt.ContainerId)
+	if err != nil {
+		return "", err
+	}
+
+	// 2. record oom events
+	if containerStatus == status.STOPPED {
+		if spec, err := c.specLoader.loadFile(opt.ContainerId); err == nil {
+			recordOOMEvents(c.containerStatusManager, opt.ContainerId, spec)
+		}
+	}
+
+	// 3. read state.json
+	return c.containerStatusManager.ReadStatusFile(opt.ContainerId)
+}
@@ -0,0 +1,467 @@
+package container
+
+import (
+	"droplet/internal/netlink"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsObject is a single resource usage sample of a container.
+//
+// Counters (cpu usage, io bytes, network bytes, ...) are cumulative since
+// the cgroup or interface was created, so rates are computed by the caller
+// from two consecutive samples.
+type StatsObject struct {
+	Id       string                         `json:"id"`
+	Status   string                         `json:"status"`
+	Read     time.Time                      `json:"read"`
+	Memory   *MemoryStatsObject             `json:"memory,omitempty"`
+	Cpu      *CpuStatsObject                `json:"cpu,omitempty"`
+	Pids     *PidsStatsObject               `json:"pids,omitempty"`
+	IO       []IOStatsObject                `json:"io,omitempty"`
+	Pressure map[string]PressureStatsObject `json:"pressure,omitempty"`
+	Network  []NetworkStatsObject           `json:"network,omitempty"`
+	// SharedNetns is set when the container does not have a network
+	// namespace of its own (see readNetworkStats).
+	SharedNetns string                `json:"sharedNetns,omitempty"`
+	Policy      []PolicyCounterObject `json:"policy,omitempty"`
+}
+
+// MemoryStatsObject is read from memory.current, memory.max and
+// memory.stat. Limit is 0 when memory.max is "max".
+type MemoryStatsObject struct {
+	Usage uint64            `json:"usage"`
+	Limit uint64            `json:"limit"`
+	Stat  map[string]uint64 `json:"stat,omitempty"`
+}
+
+// CpuStatsObject is read from cpu.stat.
+type CpuStatsObject struct {
+	UsageUsec     uint64 `json:"usageUsec"`
+	UserUsec      uint64 `json:"userUsec"`
+	SystemUsec    uint64 `json:"systemUsec"`
+	NrPeriods     uint64 `json:"nrPeriods"`
+	NrThrottled   uint64 `json:"nrThrottled"`
+	ThrottledUsec uint64 `json:"throttledUsec"`
+}
+
+// PidsStatsObject is read from pids.current and pids.max. Limit is 0
+// when pids.max is "max".
+type PidsStatsObject struct {
+	Current uint64 `json:"current"`
+	Limit   uint64 `json:"limit"`
+}
+
+// IOStatsObject is a single device entry of io.stat.
+type IOStatsObject struct {
+	Major  uint64 `json:"major"`
+	Minor  uint64 `json:"minor"`
+	RBytes uint64 `json:"rbytes"`
+	WBytes uint64 `json:"wbytes"`
+	RIOs   uint64 `json:"rios"`
+	WIOs   uint64 `json:"wios"`
+}
+
+// PressureStatsObject is a PSI (pressure stall information) file such as
+// cpu.pressure. Full is nil for resources that only report "some".
+type PressureStatsObject struct {
+	Some PressureValueObject  `json:"some"`
+	Full *PressureValueObject `json:"full,omitempty"`
+}
+
+// PressureValueObject is one line of a PSI file.
+type PressureValueObject struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total"`
+}
+
+// NetworkStatsObject holds the counters of a container interface, seen
+// from inside the container (rx is traffic received by the container).
+// Interface is the host side veth, if known.
+type NetworkStatsObject struct {
+	Interface          string `json:"interface,omitempty"`
+	ContainerInterface string `json:"containerInterface"`
+	RxBytes            uint64 `json:"rxBytes"`
+	TxBytes            uint64 `json:"txBytes"`
+	RxPackets          uint64 `json:"rxPackets"`
+	TxPackets          uint64 `json:"txPackets"`
+	RxErrors           uint64 `json:"rxErrors"`
+	TxErrors           uint64 `json:"txErrors"`
+	RxDropped          uint64 `json:"rxDropped"`
+	TxDropped          uint64 `json:"txDropped"`
+}
+
+// NewContainerStats constructs a ContainerStats with the default
+// implementations of its dependencies.
+// This is the main entry point for the `stats` workflow, which reports
+// the resource usage of a container.
+func NewContainerStats() *ContainerStats {
+	return &ContainerStats{
+		specLoader:             newFileSpecLoader(),
+		containerStatusManager: status.NewStatusHandler(),
+		policyEnforcer:         newNftPolicyEnforcer(),
+	}
+}
+
+// ContainerStats collects resource usage of containers from cgroup v2
+// accounting files, the interfaces of the container network namespace and
+// the counters of the firewall policy.
+type ContainerStats struct {
+	specLoader             specLoader
+	containerStatusManager status.ContainerStatusManager
+	policyEnforcer         policyEnforcer
+}
+
+// Stats returns a resource usage sample of the container.
+//
+// The workflow is:
+//  1. Check that the container is CREATED, RUNNING or PAUSED
+//  2. Load config.json and resolve the cgroup path
+//  3. Read the cgroup v2 accounting and PSI files
+//  4. Read the counters of the interfaces in the container netns
+//  5. Read the hit counters of the rules of the firewall policy
+//
+// Files of controllers that are not enabled for the container are
+// skipped, leaving the corresponding fields empty.
+func (c *ContainerStats) Stats(opt StatsOption) (StatsObject, error) {
+	// 1. check container status
+	containerStatus, err := c.containerStatusManager.GetStatusFromId(opt.ContainerId)
+	if err != nil {
+		return StatsObject{}, err
+	}
+	if containerStatus != status.CREATED && containerStatus != status.RUNNING && containerStatus != status.PAUSED {
+		return StatsObject{}, fmt.Errorf("container: %s is not running. current status: %s", opt.ContainerId, containerStatus)
+	}
+
+	// 2. resolve cgroup path
+	spec, err := c.specLoader.loadFile(opt.ContainerId)
+	if err != nil {
+		return StatsObject{}, err
+	}
+	cgroupPath, err := utils.ResolveCgroupPath(opt.ContainerId, spec.LinuxSpec.CgroupsPath)
+	if err != nil {
+		return StatsObject{}, err
+	}
+
+	// 3. read cgroup files
+	stats, err := readCgroupStats(cgroupPath)
+	if err != nil {
+		return StatsObject{}, err
+	}
+	stats.Id = opt.ContainerId
+	stats.Status = containerStatus.String()
+
+	// 4. read interface counters
+	stats.Network, stats.SharedNetns, err = c.readNetworkStats(opt.ContainerId, spec)
+	if err != nil {
+		return StatsObject{}, err
+	}
+
+	// 5. read policy counters
+	stats.Policy, err = c.policyEnforcer.counters(opt.ContainerId)
+	if err != nil {
+		return StatsObject{}, err
+	}
+
+	return stats, nil
+}
+
+// readCgroupStats reads the accounting files of the cgroup at cgroupPath.
+func readCgroupStats(cgroupPath string) (StatsObject, error) {
+	stats := StatsObject{Read: time.Now()}
+
+	// memory
+	if usage, ok, err := readUintFile(cgroupPath, "memory.current"); err != nil {
+		return StatsObject{}, err
+	} else if ok {
+		memory := &MemoryStatsObject{Usage: usage}
+		if memory.Limit, _, err = readUintFile(cgroupPath, "memory.max"); err != nil {
+			return StatsObject{}, err
+		}
+		if memory.Stat, _, err = readFlatKeyedFile(cgroupPath, "memory.stat"); err != nil {
+			return StatsObject{}, err
+		}
+		stats.Memory = memory
+	}
+
+	// cpu (cpu.stat is a core file and always present)
+	if cpuStat, ok, err := readFlatKeyedFile(cgroupPath, "cpu.stat"); err != nil {
+		return StatsObject{}, err
+	} else if ok {
+		stats.Cpu = &CpuStatsObject{
+			UsageUsec:     cpuStat["usage_usec"],
+			UserUsec:      cpuStat["user_usec"],
+			SystemUsec:    cpuStat["system_usec"],
+			NrPeriods:     cpuStat["nr_periods"],
+			NrThrottled:   cpuStat["nr_throttled"],
+			ThrottledUsec: cpuStat["throttled_usec"],
+		}
+	}
+
+	// pids
+	if current, ok, err := readUintFile(cgroupPath, "pids.current"); err != nil {
+		return StatsObject{}, err
+	} else if ok {
+		pids := &PidsStatsObject{Current: current}
+		if pids.Limit, _, err = readUintFile(cgroupPath, "pids.max"); err != nil {
+			return StatsObject{}, err
+		}
+		stats.Pids = pids
+	}
+
+	// io
+	io, err := readIOStat(cgroupPath)
+	if err != nil {
+		return StatsObject{}, err
+	}
+	stats.IO = io
+
+	// pressure
+	for _, resource := range []string{"cpu", "memory", "io"} {
+		pressure, ok, err := readPressure(cgroupPath, resource+".pressure")
+		if err != nil {
+			return StatsObject{}, err
+		}
+		if !ok {
+			continue
+		}
+		if stats.Pressure == nil {
+			stats.Pressure = map[string]PressureStatsObject{}
+		}
+		stats.Pressure[resource] = pressure
+	}
+
+	return stats, nil
+}
+
+// readStatFile reads a statistics file. ok is false when the file does
+// not exist, e.g. the controller is not enabled for the cgroup.
+func readStatFile(dir string, file string) (data string, ok bool, err error) {
+	b, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return string(b), true, nil
+}
+
+// readUintFile reads a single value file such as memory.current.
+// "max" is returned as 0.
+func readUintFile(dir string, file string) (uint64, bool, error) {
+	data, ok, err := readStatFile(dir, file)
+	if err != nil || !ok {
+		return 0, ok, err
+	}
+	value := strings.TrimSpace(data)
+	if value == cgroupMax {
+		return 0, true, nil
+	}
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid value in %s: %q", file, value)
+	}
+	return v, true, nil
+}
+
+// readFlatKeyedFile reads a flat keyed file such as cpu.stat, where
+// each line is "<key> <value>".
+func readFlatKeyedFile(dir string, file string) (map[string]uint64, bool, error) {
+	data, ok, err := readStatFile(dir, file)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	values := map[string]uint64{}
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid value in %s: %q", file, line)
+		}
+		values[fields[0]] = v
+	}
+	return values, true, nil
+}
+
+// readIOStat reads io.stat, where each line is
+//
+//	<major>:<minor> rbytes=<n> wbytes=<n> rios=<n> wios=<n> dbytes=<n> dios=<n>
+func readIOStat(cgroupPath string) ([]IOStatsObject, error) {
+	data, ok, err := readStatFile(cgroupPath, "io.stat")
+	if err != nil || !ok {
+		return nil, err
+	}
+	var entries []IOStatsObject
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var entry IOStatsObject
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &entry.Major, &entry.Minor); err != nil {
+			return nil, fmt.Errorf("invalid device in io.stat: %q", line)
+		}
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value in io.stat: %q", line)
+			}
+			switch key {
+			case "rbytes":
+				entry.RBytes = v
+			case "wbytes":
+				entry.WBytes = v
+			case "rios":
+				entry.RIOs = v
+			case "wios":
+				entry.WIOs = v
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readPressure reads a PSI file, where each line is
+//
+//	some avg10=<f> avg60=<f> avg300=<f> total=<n>
+//	full avg10=<f> avg60=<f> avg300=<f> total=<n>
+func readPressure(cgroupPath string, file string) (PressureStatsObject, bool, error) {
+	data, ok, err := readStatFile(cgroupPath, file)
+	if err != nil || !ok {
+		return PressureStatsObject{}, ok, err
+	}
+	var pressure PressureStatsObject
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var value PressureValueObject
+		for _, field := range fields[1:] {
+			key, v, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			var err error
+			switch key {
+			case "avg10":
+				value.Avg10, err = strconv.ParseFloat(v, 64)
+			case "avg60":
+				value.Avg60, err = strconv.ParseFloat(v, 64)
+			case "avg300":
+				value.Avg300, err = strconv.ParseFloat(v, 64)
+			case "total":
+				value.Total, err = strconv.ParseUint(v, 10, 64)
+			}
+			if err != nil {
+				return PressureStatsObject{}, false, fmt.Errorf("invalid value in %s: %q", file, line)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			pressure.Some = value
+		case "full":
+			full := value
+			pressure.Full = &full
+		}
+	}
+	return pressure, true, nil
+}
+
+// readNetworkStats reads the counters of the interfaces inside the
+// network namespace of the container's init process, so that every
+// network backend is covered. Loopback is skipped. The host side veth of
+// an interface is filled in when the annotation names it.
+//
+// sharedNetns is "host" when the container has no network namespace of
+// its own, in which case no counters are read, and the namespace path
+// when it joins an existing one, in which case the counters are those of
+// the shared namespace.
+func (c *ContainerStats) readNetworkStats(containerId string, containerSpec spec.Spec) (list []NetworkStatsObject, sharedNetns string, err error) {
+	nsConfig := buildNamespaceConfig(containerSpec)
+	if path, ok := nsConfig.paths["network"]; ok {
+		sharedNetns = path
+	} else if !nsConfig.network {
+		return nil, "host", nil
+	}
+
+	pid, err := c.containerStatusManager.GetPidFromId(containerId)
+	if err != nil {
+		return nil, "", err
+	}
+	if pid <= 0 {
+		return nil, sharedNetns, nil
+	}
+
+	var links []netlink.Link
+	err = netlink.RunInNetns(fmt.Sprintf("/proc/%d/ns/net", pid), func(h *netlink.Handle) error {
+		links, err = h.LinkList()
+		return err
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("read interface counters: %w", err)
+	}
+
+	return networkStatsFromLinks(links, hostLinkNames(containerSpec)), sharedNetns, nil
+}
+
+// hostLinkNames maps the container interfaces of the io.raind.net.config
+// annotation onto their host side veths.
+func hostLinkNames(containerSpec spec.Spec) map[string]string {
+	names := map[string]string{}
+	if containerSpec.Annotations.Net == "" {
+		return names
+	}
+	networkConfig, err := spec.ParseNetConfig(containerSpec.Annotations)
+	if err != nil {
+		return names
+	}
+	for _, iface := range networkConfig.Interfaces {
+		if iface.Name != "" && iface.ContainerInterface != "" {
+			names[iface.ContainerInterface] = iface.Name
+		}
+	}
+	return names
+}
+
+// networkStatsFromLinks converts the counters of the links of the
+// container network namespace, skipping loopback.
+func networkStatsFromLinks(links []netlink.Link, hostNames map[string]string) []NetworkStatsObject {
+	var list []NetworkStatsObject
+	for _, link := range links {
+		if link.Name == "lo" || link.Stats == nil {
+			continue
+		}
+		list = append(list, NetworkStatsObject{
+			Interface:          hostNames[link.Name],
+			ContainerInterface: link.Name,
+			RxBytes:            link.Stats.RxBytes,
+			TxBytes:            link.Stats.TxBytes,
+			RxPackets:          link.Stats.RxPackets,
+			TxPackets:          link.Stats.TxPackets,
+			RxErrors:           link.Stats.RxErrors,
+			TxErrors:           link.Stats.TxErrors,
+			RxDropped:          link.Stats.RxDropped,
+			TxDropped:          link.Stats.TxDropped,
+		})
+	}
+	return list
+}
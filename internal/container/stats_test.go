@@ -0,0 +1,63 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"droplet/internal/netlink"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadCgroupStats_Success(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	files := map[string]string{
+		"memory.current":  "1048576\n",
+		"memory.max":      "max\n",
+		"memory.stat":     "anon 4096\nfile 8192\n",
+		"cpu.stat":        "usage_usec 1500\nuser_usec 1000\nsystem_usec 500\n",
+		"pids.current":    "3\n",
+		"pids.max":        "512\n",
+		"io.stat":         "8:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0\n",
+		"cpu.pressure":    "some avg10=1.50 avg60=0.00 avg300=0.00 total=1234\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+		"memory.pressure": "some avg10=0.00 avg60=0.00 avg300=0.00 total=0\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+	}
+	for name, content := range files {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	// == act ==
+	stats, err := readCgroupStats(dir)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, &MemoryStatsObject{Usage: 1048576, Limit: 0, Stat: map[string]uint64{"anon": 4096, "file": 8192}}, stats.Memory)
+	assert.Equal(t, &CpuStatsObject{UsageUsec: 1500, UserUsec: 1000, SystemUsec: 500}, stats.Cpu)
+	assert.Equal(t, &PidsStatsObject{Current: 3, Limit: 512}, stats.Pids)
+	assert.Equal(t, []IOStatsObject{{Major: 8, Minor: 0, RBytes: 4096, WBytes: 8192, RIOs: 1, WIOs: 2}}, stats.IO)
+	assert.Equal(t, PressureValueObject{Avg10: 1.5, Total: 1234}, stats.Pressure["cpu"].Some)
+	assert.NotNil(t, stats.Pressure["cpu"].Full)
+	assert.Contains(t, stats.Pressure, "memory")
+	assert.NotContains(t, stats.Pressure, "io")
+}
+
+func TestNetworkStatsFromLinks(t *testing.T) {
+	// == arrange ==
+	links := []netlink.Link{
+		{Index: 1, Name: "lo", Stats: &netlink.LinkStats{RxBytes: 100}},
+		{Index: 2, Name: "eth0", Stats: &netlink.LinkStats{RxBytes: 4096, TxBytes: 1024, RxPackets: 4, TxPackets: 2}},
+		{Index: 3, Name: "net1", Stats: &netlink.LinkStats{RxDropped: 1}},
+	}
+	hostNames := map[string]string{"eth0": "rd_111111"}
+
+	// == act ==
+	list := networkStatsFromLinks(links, hostNames)
+
+	// == assert ==
+	assert.Equal(t, []NetworkStatsObject{
+		{Interface: "rd_111111", ContainerInterface: "eth0", RxBytes: 4096, TxBytes: 1024, RxPackets: 4, TxPackets: 2},
+		{ContainerInterface: "net1", RxDropped: 1},
+	}, list)
+}
@@ -0,0 +1,89 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// timeNsOffsetsPath returns the offsets file of the time namespace the
+// calling thread's children (and its next execve) will enter.
+//
+// The kernel only has the file in /proc/<pid>, which is /proc/self for
+// the thread group leader. The thread ID is used instead of self because
+// the init goroutine is locked to a thread that is not necessarily the
+// leader, and unshare(2) only changes the namespace of the calling thread.
+func timeNsOffsetsPath() string {
+	return fmt.Sprintf("/proc/%d/timens_offsets", unix.Gettid())
+}
+
+// timeNsPath is the time namespace of the calling process. It exists
+// since Linux 5.6, which introduced the time namespace.
+const timeNsPath = "/proc/self/ns/time"
+
+// timeNsClocks lists the clocks that can be offset in a time namespace.
+var timeNsClocks = map[string]struct{}{
+	"monotonic": {},
+	"boottime":  {},
+}
+
+// validateTimeOffsets checks linux.timeOffsets against the namespace
+// configuration.
+//
+// Offsets are only meaningful together with a new time namespace, and
+// only the monotonic and boottime clocks can be shifted.
+func validateTimeOffsets(nsConfig namespaceConfig, offsets map[string]spec.TimeOffsetObject) error {
+	if len(offsets) == 0 {
+		return nil
+	}
+	if !nsConfig.time {
+		return fmt.Errorf("timeOffsets requires a time namespace")
+	}
+	for clock, offset := range offsets {
+		if _, ok := timeNsClocks[clock]; !ok {
+			return fmt.Errorf("timeOffsets: unsupported clock %q", clock)
+		}
+		if offset.Nanosecs >= 1e9 {
+			return fmt.Errorf("timeOffsets: %s nanosecs %d out of range", clock, offset.Nanosecs)
+		}
+	}
+	return nil
+}
+
+// checkTimeNamespaceSupport returns an error when the kernel does not
+// support the time namespace as the init process uses it.
+//
+// The init process unshares the time namespace, writes its offsets before
+// any process is in it and leaves the namespace to be entered on execve.
+// The namespace exists since Linux 5.6, but a task only enters its
+// time_for_children namespace on execve since Linux 5.11.
+func checkTimeNamespaceSupport(nsPath string, kernelSupported bool) error {
+	if _, err := os.Stat(nsPath); err != nil || !kernelSupported {
+		if err == nil {
+			err = fmt.Errorf("time namespace is not entered on execve")
+		}
+		return fmt.Errorf("time namespace is not supported by the kernel (Linux 5.11 or later is required): %w", err)
+	}
+	return nil
+}
+
+// formatTimeOffsets renders offsets in the "<clock> <secs> <nanosecs>"
+// line format accepted by /proc/<pid>/timens_offsets, sorted by clock
+// name so the output is stable.
+func formatTimeOffsets(offsets map[string]spec.TimeOffsetObject) string {
+	clocks := make([]string, 0, len(offsets))
+	for clock := range offsets {
+		clocks = append(clocks, clock)
+	}
+	sort.Strings(clocks)
+
+	var b strings.Builder
+	for _, clock := range clocks {
+		fmt.Fprintf(&b, "%s %d %d\n", clock, offsets[clock].Secs, offsets[clock].Nanosecs)
+	}
+	return b.String()
+}
@@ -0,0 +1,250 @@
+package container
+
+import (
+	"droplet/internal/logs"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"fmt"
+)
+
+// NewContainerUpdate constructs a ContainerUpdate with the default
+// implementations of its dependencies.
+// This is the main entry point for the `update` workflow, which changes
+// the resource limits, the /etc files and the firewall policy of a
+// created or running container.
+func NewContainerUpdate() *ContainerUpdate {
+	return &ContainerUpdate{
+		specLoader:             newFileSpecLoader(),
+		containerCgroupUpdater: newContainerCgroupController(),
+		etcFileGenerator:       newContainerEtcFileGenerator(),
+		policyEnforcer:         newNftPolicyEnforcer(),
+		containerStatusManager: status.NewStatusHandler(),
+	}
+}
+
+// ContainerUpdate orchestrates live resource limit, /etc file and
+// firewall policy changes.
+//
+// It is responsible for:
+//   - Verifying that the container is CREATED, RUNNING or PAUSED
+//   - Merging the requested limits onto the limits currently in effect
+//   - Applying the result to the container's cgroup
+//   - Recording the effective limits in state.json
+//   - Regenerating resolv.conf and hosts with new dns settings and extra
+//     hosts
+//   - Replacing the firewall policy of the container interfaces
+type ContainerUpdate struct {
+	specLoader             specLoader
+	containerCgroupUpdater containerCgroupUpdater
+	etcFileGenerator       etcFileGenerator
+	policyEnforcer         policyEnforcer
+	containerStatusManager status.ContainerStatusManager
+}
+
+// Update applies new resource limits to the container's cgroup.
+//
+// The workflow is:
+//  1. Load config.json
+//  2. Check that the container is CREATED, RUNNING or PAUSED
+//  3. Resolve the limits in effect (state.json, or config.json if the
+//     container has never been updated) and merge the requested limits
+//  4. Apply the merged limits to the cgroup
+//  5. Record the merged limits in state.json
+//  6. If dns settings or extra hosts are requested, merge them onto those
+//     in effect, regenerate the /etc files and record the result in
+//     state.json
+//  7. If a policy is requested, replace the firewall policy
+//
+// The audit record contains both the previous and the new limits.
+func (c *ContainerUpdate) Update(opt UpdateOption) (err error) {
+	var (
+		spec     spec.Spec
+		event    = "update"
+		stage    string
+		resource logs.ResourceUpdateInfo
+	)
+
+	// audit log
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "fail"
+		}
+		_ = logs.RecordAuditLog(logs.AuditRecord{
+			ContainerId: opt.ContainerId,
+			Event:       event,
+			Stage:       stage,
+			Spec:        &spec,
+			Resources:   &resource,
+			Result:      result,
+			Error:       err,
+		})
+	}()
+
+	// 1. load config.json
+	stage = "load_spec"
+	spec, err = c.specLoader.loadFile(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+
+	// 2. check container status
+	stage = "check_status"
+	containerStatus, err := c.containerStatusManager.GetStatusFromId(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	//   the limits of a frozen cgroup can be changed as well
+	if containerStatus != status.CREATED && containerStatus != status.RUNNING && containerStatus != status.PAUSED {
+		return fmt.Errorf("container: %s is not created, running or paused. current status: %s", opt.ContainerId, containerStatus)
+	}
+
+	// 3. merge resources
+	stage = "merge_resources"
+	current, err := c.currentResources(opt.ContainerId, spec)
+	if err != nil {
+		return err
+	}
+	merged := mergeResources(current, opt.Resources)
+	resource.Old = &current
+	resource.New = &merged
+
+	// 4. apply to cgroup
+	stage = "update_cgroup"
+	err = c.containerCgroupUpdater.update(opt.ContainerId, spec, merged)
+	if err != nil {
+		return err
+	}
+
+	// 5. update state.json
+	//      resources = merged
+	stage = "update_state"
+	err = c.containerStatusManager.SetResources(opt.ContainerId, merged)
+	if err != nil {
+		return err
+	}
+
+	if opt.NetworkFiles == nil && opt.Policy == nil {
+		return nil
+	}
+	// the annotation of state.json holds the leased addresses
+	stage = "load_annotation"
+	spec.Annotations, err = c.containerStatusManager.GetAnnotationFromId(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+
+	// 6. regenerate /etc files
+	if opt.NetworkFiles != nil {
+		stage = "generate_etc_files"
+		files, err := c.currentNetworkFiles(opt.ContainerId, spec)
+		if err != nil {
+			return err
+		}
+		files = mergeNetworkFiles(files, *opt.NetworkFiles)
+		err = c.etcFileGenerator.generate(opt.ContainerId, spec, &files)
+		if err != nil {
+			return err
+		}
+
+		stage = "update_state_network_files"
+		err = c.containerStatusManager.SetNetworkFiles(opt.ContainerId, files)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 7. apply policy
+	if opt.Policy != nil {
+		stage = "apply_policy"
+		policySpec, err := withPolicy(spec, *opt.Policy)
+		if err != nil {
+			return err
+		}
+		err = c.policyEnforcer.apply(opt.ContainerId, policySpec)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// currentResources returns the resource limits in effect for the
+// container: the last updated values recorded in state.json, or
+// linux.resources from config.json if the container has never been
+// updated.
+func (c *ContainerUpdate) currentResources(containerId string, containerSpec spec.Spec) (spec.ResourceObject, error) {
+	resources, err := c.containerStatusManager.GetResourcesFromId(containerId)
+	if err != nil {
+		return spec.ResourceObject{}, err
+	}
+	if resources != nil {
+		return *resources, nil
+	}
+	return containerSpec.LinuxSpec.Resources, nil
+}
+
+// currentNetworkFiles returns the dns settings and extra hosts in effect
+// for the container: the last updated values recorded in state.json, or
+// those of the annotation if they have never been updated.
+func (c *ContainerUpdate) currentNetworkFiles(containerId string, containerSpec spec.Spec) (spec.NetworkFilesObject, error) {
+	files, err := c.containerStatusManager.GetNetworkFilesFromId(containerId)
+	if err != nil {
+		return spec.NetworkFilesObject{}, err
+	}
+	if files != nil {
+		return *files, nil
+	}
+	networkConfig, err := spec.ParseNetConfig(containerSpec.Annotations)
+	if err != nil {
+		return spec.NetworkFilesObject{}, err
+	}
+	return spec.NetworkFilesObject{
+		Dns:        &networkConfig.Dns,
+		ExtraHosts: networkConfig.ExtraHosts,
+	}, nil
+}
+
+// mergeNetworkFiles overlays the requested dns settings and extra hosts
+// onto the current ones. Each of servers, search, options and extra hosts
+// is replaced only if it is requested.
+func mergeNetworkFiles(current spec.NetworkFilesObject, requested spec.NetworkFilesObject) spec.NetworkFilesObject {
+	dns := spec.DnsObject{}
+	if current.Dns != nil {
+		dns = *current.Dns
+	}
+	if requested.Dns != nil {
+		if requested.Dns.Servers != nil {
+			dns.Servers = requested.Dns.Servers
+		}
+		if requested.Dns.Search != nil {
+			dns.Search = requested.Dns.Search
+		}
+		if requested.Dns.Options != nil {
+			dns.Options = requested.Dns.Options
+		}
+	}
+	merged := spec.NetworkFilesObject{
+		Dns:        &dns,
+		ExtraHosts: current.ExtraHosts,
+	}
+	if requested.ExtraHosts != nil {
+		merged.ExtraHosts = requested.ExtraHosts
+	}
+	return merged
+}
+
+// withPolicy returns the spec with the policy of its network annotation
+// replaced.
+func withPolicy(containerSpec spec.Spec, policy spec.PolicyObject) (spec.Spec, error) {
+	networkConfig, err := spec.ParseNetConfig(containerSpec.Annotations)
+	if err != nil {
+		return spec.Spec{}, err
+	}
+	networkConfig.Policy = &policy
+	if err := spec.EncodeNetConfig(&containerSpec.Annotations, networkConfig); err != nil {
+		return spec.Spec{}, err
+	}
+	return containerSpec, nil
+}
@@ -0,0 +1,226 @@
+package container
+
+import (
+	"bufio"
+	"droplet/internal/logs"
+	"droplet/internal/spec"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	containerPasswdPath = "/etc/passwd"
+	containerGroupPath  = "/etc/group"
+	defaultUmask        = 0o022
+)
+
+// execUser represents the resolved identity the container process runs as.
+//
+// It is derived from spec.UserObject after user/group names have been
+// resolved through the container's /etc/passwd and /etc/group.
+type execUser struct {
+	username       string
+	groupname      string
+	uid            int
+	gid            int
+	additionalGids []int
+	umask          int
+}
+
+// auditInfo returns the identity for the audit log.
+func (u execUser) auditInfo() *logs.UserInfo {
+	info := &logs.UserInfo{
+		Uid:       uint32(u.uid),
+		Gid:       uint32(u.gid),
+		Umask:     fmt.Sprintf("%04o", u.umask),
+		Username:  u.username,
+		Groupname: u.groupname,
+		Resolved:  true,
+	}
+	for _, gid := range u.additionalGids {
+		info.AdditionalGids = append(info.AdditionalGids, uint32(gid))
+	}
+	return info
+}
+
+// passwdEntry is a single line of an /etc/passwd file.
+type passwdEntry struct {
+	name string
+	uid  int
+	gid  int
+}
+
+// groupEntry is a single line of an /etc/group file.
+type groupEntry struct {
+	name string
+	gid  int
+}
+
+// resolveExecUser converts the OCI process.user object into an execUser.
+//
+// Numeric uid/gid values are used as-is. When username is set, the uid and
+// the primary gid are looked up in passwdPath, and the groups listing the
+// user as member in groupPath are added to the additional gids. When
+// groupname is set, the gid is looked up in groupPath and overrides the
+// primary gid of the user. An unset umask falls back to 0022.
+func resolveExecUser(user spec.UserObject, passwdPath string, groupPath string) (execUser, error) {
+	u := execUser{
+		username:  user.Username,
+		groupname: user.Groupname,
+		uid:       int(user.Uid),
+		gid:       int(user.Gid),
+		umask:     defaultUmask,
+	}
+
+	// username
+	if user.Username != "" {
+		entry, err := lookupPasswd(passwdPath, user.Username)
+		if err != nil {
+			return execUser{}, err
+		}
+		u.uid = entry.uid
+		u.gid = entry.gid
+	}
+
+	// groupname
+	if user.Groupname != "" {
+		entry, err := lookupGroup(groupPath, user.Groupname)
+		if err != nil {
+			return execUser{}, err
+		}
+		u.gid = entry.gid
+	}
+
+	// additional gids
+	for _, gid := range user.AdditionalGids {
+		u.additionalGids = append(u.additionalGids, int(gid))
+	}
+
+	// supplementary groups of the user
+	if user.Username != "" {
+		gids, err := lookupGroupMembership(groupPath, user.Username)
+		if err != nil {
+			return execUser{}, err
+		}
+		for _, gid := range gids {
+			if !slices.Contains(u.additionalGids, gid) {
+				u.additionalGids = append(u.additionalGids, gid)
+			}
+		}
+	}
+
+	// umask
+	if user.Umask != nil {
+		u.umask = int(*user.Umask)
+	}
+
+	return u, nil
+}
+
+// lookupPasswd returns the passwd entry for the given user name.
+//
+// The file format is name:password:uid:gid:gecos:home:shell.
+func lookupPasswd(path string, name string) (passwdEntry, error) {
+	var found *passwdEntry
+	err := scanColonFile(path, func(fields []string) error {
+		if len(fields) < 4 || fields[0] != name {
+			return nil
+		}
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return fmt.Errorf("invalid uid for user %s in %s: %q", name, path, fields[2])
+		}
+		gid, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return fmt.Errorf("invalid gid for user %s in %s: %q", name, path, fields[3])
+		}
+		found = &passwdEntry{name: name, uid: uid, gid: gid}
+		return errStopScan
+	})
+	if err != nil {
+		return passwdEntry{}, err
+	}
+	if found == nil {
+		return passwdEntry{}, fmt.Errorf("user %s not found in %s", name, path)
+	}
+	return *found, nil
+}
+
+// lookupGroup returns the group entry for the given group name.
+//
+// The file format is name:password:gid:members.
+func lookupGroup(path string, name string) (groupEntry, error) {
+	var found *groupEntry
+	err := scanColonFile(path, func(fields []string) error {
+		if len(fields) < 3 || fields[0] != name {
+			return nil
+		}
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return fmt.Errorf("invalid gid for group %s in %s: %q", name, path, fields[2])
+		}
+		found = &groupEntry{name: name, gid: gid}
+		return errStopScan
+	})
+	if err != nil {
+		return groupEntry{}, err
+	}
+	if found == nil {
+		return groupEntry{}, fmt.Errorf("group %s not found in %s", name, path)
+	}
+	return *found, nil
+}
+
+// lookupGroupMembership returns the gids of the groups whose member list
+// contains the user name. A missing group file yields no groups.
+func lookupGroupMembership(path string, name string) ([]int, error) {
+	var gids []int
+	err := scanColonFile(path, func(fields []string) error {
+		if len(fields) < 4 || !slices.Contains(strings.Split(fields[3], ","), name) {
+			return nil
+		}
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return fmt.Errorf("invalid gid for group %s in %s: %q", fields[0], path, fields[2])
+		}
+		gids = append(gids, gid)
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return gids, err
+}
+
+var errStopScan = fmt.Errorf("stop scan")
+
+// scanColonFile calls fn for every non-comment line of a colon separated
+// file such as /etc/passwd or /etc/group. Returning errStopScan from fn
+// ends the scan without error.
+func scanColonFile(path string, fn func(fields []string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(strings.Split(line, ":")); err != nil {
+			if err == errStopScan {
+				return nil
+			}
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,95 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"droplet/internal/spec"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeUserDbFiles(t *testing.T) (string, string) {
+	tmp := t.TempDir()
+	passwd := filepath.Join(tmp, "passwd")
+	group := filepath.Join(tmp, "group")
+	_ = os.WriteFile(passwd, []byte("root:x:0:0:root:/root:/bin/sh\n# comment\nnginx:x:101:102:nginx:/var/lib/nginx:/sbin/nologin\n"), 0644)
+	_ = os.WriteFile(group, []byte("root:x:0:root\nadm:x:4:syslog,nginx\nnginx:x:102:nginx\nwww-data:x:82:\n"), 0644)
+	return passwd, group
+}
+
+func TestResolveExecUser_Numeric(t *testing.T) {
+	// == arrange ==
+	passwd, group := writeUserDbFiles(t)
+	umask := uint32(0o077)
+	user := spec.UserObject{
+		Uid:            1000,
+		Gid:            1000,
+		AdditionalGids: []uint32{10, 20},
+		Umask:          &umask,
+	}
+
+	// == act ==
+	result, err := resolveExecUser(user, passwd, group)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, result.uid)
+	assert.Equal(t, 1000, result.gid)
+	assert.Equal(t, []int{10, 20}, result.additionalGids)
+	assert.Equal(t, 0o077, result.umask)
+}
+
+func TestResolveExecUser_Name(t *testing.T) {
+	// == arrange ==
+	passwd, group := writeUserDbFiles(t)
+	user := spec.UserObject{
+		Username:  "nginx",
+		Groupname: "www-data",
+	}
+
+	// == act ==
+	result, err := resolveExecUser(user, passwd, group)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, 101, result.uid)
+	assert.Equal(t, 82, result.gid)
+	assert.Equal(t, defaultUmask, result.umask)
+}
+
+func TestResolveExecUser_SupplementaryGroups(t *testing.T) {
+	// == arrange ==
+	passwd, group := writeUserDbFiles(t)
+	user := spec.UserObject{
+		Username:       "nginx",
+		AdditionalGids: []uint32{4, 1000},
+	}
+
+	// == act ==
+	result, err := resolveExecUser(user, passwd, group)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, 102, result.gid)
+	assert.Equal(t, []int{4, 1000, 102}, result.additionalGids)
+	info := result.auditInfo()
+	assert.Equal(t, "nginx", info.Username)
+	assert.Equal(t, []uint32{4, 1000, 102}, info.AdditionalGids)
+	assert.True(t, info.Resolved)
+}
+
+func TestResolveExecUser_UnknownUser(t *testing.T) {
+	// == arrange ==
+	passwd, group := writeUserDbFiles(t)
+	user := spec.UserObject{
+		Username: "nobody",
+	}
+
+	// == act ==
+	_, err := resolveExecUser(user, passwd, group)
+
+	// == assert ==
+	assert.NotNil(t, err)
+}
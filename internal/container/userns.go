@@ -0,0 +1,90 @@
+package container
+
+import (
+	"droplet/internal/logs"
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// hostIDForContainerRoot returns the host id that container id 0 is mapped
+// to, or -1 when id 0 is not mapped.
+func hostIDForContainerRoot(idMap []syscall.SysProcIDMap) int {
+	for _, m := range idMap {
+		if m.ContainerID <= 0 && 0 < m.ContainerID+m.Size {
+			return m.HostID - m.ContainerID
+		}
+	}
+	return -1
+}
+
+// chownForRemappedRoot hands the per-container files the init process
+// needs over to the host ids that container root is mapped to.
+//
+// With an identity mapping the init process keeps host uid 0 and nothing
+// is changed. Otherwise the following are chowned:
+//   - exec.fifo and config_hash.json (read and removed by init)
+//   - the overlay upper and work directories
+//   - the container directory group, made sticky and group-writable so that
+//     init may remove only the files it owns
+func chownForRemappedRoot(containerId string, imageAnnotation string, uidMap []syscall.SysProcIDMap, gidMap []syscall.SysProcIDMap) error {
+	uid := hostIDForContainerRoot(uidMap)
+	gid := hostIDForContainerRoot(gidMap)
+	if uid <= 0 && gid <= 0 {
+		return nil
+	}
+	if uid < 0 || gid < 0 {
+		return fmt.Errorf("container root (id 0) is not mapped in the user namespace")
+	}
+
+	// runtime files consumed by init
+	for _, path := range []string{
+		utils.FifoPath(containerId),
+		utils.ConfigFileHashPath(containerId),
+	} {
+		if err := os.Lchown(path, uid, gid); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("chown %s failed: %w", path, err)
+		}
+	}
+
+	// overlay upper/work directories
+	var imageConfig spec.ImageConfigObject
+	if err := utils.StringToJson(imageAnnotation, &imageConfig); err != nil {
+		return err
+	}
+	for _, dir := range []string{imageConfig.UpperDir, imageConfig.WorkDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.Lchown(dir, uid, gid); err != nil {
+			return fmt.Errorf("chown %s failed: %w", dir, err)
+		}
+	}
+
+	// container directory
+	containerDir := utils.ContainerDir(containerId)
+	if err := os.Lchown(containerDir, -1, gid); err != nil {
+		return fmt.Errorf("chown %s failed: %w", containerDir, err)
+	}
+	if err := os.Chmod(containerDir, 0o775|os.ModeSticky); err != nil {
+		return fmt.Errorf("chmod %s failed: %w", containerDir, err)
+	}
+
+	return nil
+}
+
+// passAuditLog hands a duplicate of the audit log descriptor to the child
+// process as fd 3, so that an init process running as a remapped user can
+// still write audit records. The returned file must be closed by the caller
+// once the child has been started.
+func passAuditLog(cmd utils.CommandExecutor) (*os.File, error) {
+	f, err := logs.AuditLogger.Dup()
+	if err != nil {
+		return nil, err
+	}
+	cmd.SetExtraFiles([]*os.File{f})
+	cmd.SetEnv(append(os.Environ(), fmt.Sprintf("%s=%d", logs.AuditLogFdEnv, 3)))
+	return f, nil
+}
@@ -0,0 +1,259 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// userNsRangeSize is the number of host ids allocated to each container.
+const userNsRangeSize = 65536
+
+// newUserNsAllocator returns a userNsAllocator that hands out host id ranges
+// from the runtime user's /etc/subuid and /etc/subgid allocation and records
+// them in the allocation file under the runtime root directory.
+func newUserNsAllocator() *userNsAllocator {
+	return &userNsAllocator{
+		allocationPath: utils.UserNsAllocationPath(),
+		lockPath:       utils.UserNsAllocationLockPath(),
+		subUidPath:     subUidPath,
+		subGidPath:     subGidPath,
+	}
+}
+
+// userNsRangeManager defines the operations required to manage the host id
+// ranges assigned to container user namespaces.
+type userNsRangeManager interface {
+	allocate(containerId string) (userNsAllocation, bool, error)
+	lookup(containerId string) (userNsAllocation, bool, error)
+	release(containerId string) error
+}
+
+// userNsAllocator allocates non-overlapping host id ranges for containers
+// whose spec enables the user namespace without explicit mappings, and
+// records the explicit mappings of the others so that neither overlaps.
+//
+// The same host range is used for uids and gids, so a range is only taken
+// when it is covered by both the subuid and the subgid allocation, and by
+// no uid or gid mapping of another container.
+// Allocations are persisted in a JSON file and every read-modify-write
+// cycle is serialized with a file lock.
+type userNsAllocator struct {
+	allocationPath string
+	lockPath       string
+	subUidPath     string
+	subGidPath     string
+}
+
+// userNsAllocation is a host id range assigned to a single container.
+type userNsAllocation struct {
+	HostID uint32 `json:"hostID"`
+	Size   uint32 `json:"size"`
+}
+
+// userNsMappings are the explicit linux.uidMappings / linux.gidMappings
+// of a container.
+type userNsMappings struct {
+	UIDMappings []spec.IDMappingObject `json:"uidMappings"`
+	GIDMappings []spec.IDMappingObject `json:"gidMappings"`
+}
+
+// userNsAllocationFile is the on-disk representation of all allocations
+// and explicit mappings, keyed by container ID.
+type userNsAllocationFile struct {
+	Allocations map[string]userNsAllocation `json:"allocations"`
+	Mappings    map[string]userNsMappings   `json:"mappings,omitempty"`
+}
+
+// allocate returns the host id range for the container, allocating a new
+// one if the container does not have one yet.
+//
+// ok is false when no subordinate id pool is configured for the runtime
+// user, in which case the caller falls back to the identity mapping.
+func (a *userNsAllocator) allocate(containerId string) (allocation userNsAllocation, ok bool, err error) {
+	// load pool
+	subUids, err := parseSubIDPool(a.subUidPath)
+	if err != nil {
+		return userNsAllocation{}, false, err
+	}
+	subGids, err := parseSubIDPool(a.subGidPath)
+	if err != nil {
+		return userNsAllocation{}, false, err
+	}
+	if len(subUids) == 0 || len(subGids) == 0 {
+		return userNsAllocation{}, false, nil
+	}
+
+	err = utils.WithFileLock(a.lockPath, func() error {
+		allocations, err := a.load()
+		if err != nil {
+			return err
+		}
+
+		// already allocated
+		if existing, found := allocations.Allocations[containerId]; found {
+			allocation = existing
+			return nil
+		}
+
+		// find a free range
+		for _, r := range subUids {
+			for start := uint64(r.start); start+userNsRangeSize <= uint64(r.start)+uint64(r.count); start += userNsRangeSize {
+				if !rangeAllowed(uint32(start), userNsRangeSize, subGids) {
+					continue
+				}
+				if allocations.inUse(uint32(start), userNsRangeSize) {
+					continue
+				}
+				allocation = userNsAllocation{HostID: uint32(start), Size: userNsRangeSize}
+				allocations.Allocations[containerId] = allocation
+				return utils.WriteJsonToFile(a.allocationPath, allocations)
+			}
+		}
+		return fmt.Errorf("no free user namespace id range left in %s/%s pool", a.subUidPath, a.subGidPath)
+	})
+	if err != nil {
+		return userNsAllocation{}, false, err
+	}
+	return allocation, true, nil
+}
+
+// lookup returns the host id range recorded for the container, if any.
+func (a *userNsAllocator) lookup(containerId string) (userNsAllocation, bool, error) {
+	var (
+		allocation userNsAllocation
+		found      bool
+	)
+	err := utils.WithFileLock(a.lockPath, func() error {
+		allocations, err := a.load()
+		if err != nil {
+			return err
+		}
+		allocation, found = allocations.Allocations[containerId]
+		return nil
+	})
+	if err != nil {
+		return userNsAllocation{}, false, err
+	}
+	return allocation, found, nil
+}
+
+// release removes the host id range or the mappings recorded for the
+// container. Releasing a container without either is a no-op.
+func (a *userNsAllocator) release(containerId string) error {
+	return utils.WithFileLock(a.lockPath, func() error {
+		allocations, err := a.load()
+		if err != nil {
+			return err
+		}
+		_, allocated := allocations.Allocations[containerId]
+		_, mapped := allocations.Mappings[containerId]
+		if !allocated && !mapped {
+			return nil
+		}
+		delete(allocations.Allocations, containerId)
+		delete(allocations.Mappings, containerId)
+		return utils.WriteJsonToFile(a.allocationPath, allocations)
+	})
+}
+
+// reserveMappings records the explicit uid and gid mappings of the
+// container, so that allocate does not hand out their host ranges.
+//
+// An error is returned when a host range overlaps the range allocated to
+// another container, or a mapping of the same kind of another container.
+// Reserving the mappings of a container again replaces them.
+func (a *userNsAllocator) reserveMappings(containerId string, uidMappings []spec.IDMappingObject, gidMappings []spec.IDMappingObject) error {
+	return utils.WithFileLock(a.lockPath, func() error {
+		allocations, err := a.load()
+		if err != nil {
+			return err
+		}
+		kinds := []struct {
+			name     string
+			mappings []spec.IDMappingObject
+			of       func(userNsMappings) []spec.IDMappingObject
+		}{
+			{"uid", uidMappings, func(m userNsMappings) []spec.IDMappingObject { return m.UIDMappings }},
+			{"gid", gidMappings, func(m userNsMappings) []spec.IDMappingObject { return m.GIDMappings }},
+		}
+		for _, kind := range kinds {
+			for i, m := range kind.mappings {
+				for id, allocation := range allocations.Allocations {
+					if id == containerId || !rangesOverlap(m.HostID, m.Size, allocation.HostID, allocation.Size) {
+						continue
+					}
+					return fmt.Errorf("%s mapping[%d]: host range %d-%d is allocated to container %s",
+						kind.name, i, m.HostID, uint64(m.HostID)+uint64(m.Size)-1, id)
+				}
+				for id, mappings := range allocations.Mappings {
+					if id == containerId || !mappingsOverlap(m.HostID, m.Size, kind.of(mappings)) {
+						continue
+					}
+					return fmt.Errorf("%s mapping[%d]: host range %d-%d is mapped by container %s",
+						kind.name, i, m.HostID, uint64(m.HostID)+uint64(m.Size)-1, id)
+				}
+			}
+		}
+
+		allocations.Mappings[containerId] = userNsMappings{UIDMappings: uidMappings, GIDMappings: gidMappings}
+		return utils.WriteJsonToFile(a.allocationPath, allocations)
+	})
+}
+
+// load reads the allocation file. A missing file is treated as empty.
+// It must be called with the lock held.
+func (a *userNsAllocator) load() (userNsAllocationFile, error) {
+	allocations := userNsAllocationFile{Allocations: map[string]userNsAllocation{}}
+	if err := utils.ReadJsonFile(a.allocationPath, &allocations); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return userNsAllocationFile{}, err
+		}
+	}
+	if allocations.Allocations == nil {
+		allocations.Allocations = map[string]userNsAllocation{}
+	}
+	if allocations.Mappings == nil {
+		allocations.Mappings = map[string]userNsMappings{}
+	}
+	return allocations, nil
+}
+
+// inUse reports whether [start, start+size) overlaps any recorded
+// allocation, or any uid or gid mapping recorded for a container.
+func (f userNsAllocationFile) inUse(start uint32, size uint32) bool {
+	for _, a := range f.Allocations {
+		if rangesOverlap(start, size, a.HostID, a.Size) {
+			return true
+		}
+	}
+	for _, m := range f.Mappings {
+		if mappingsOverlap(start, size, m.UIDMappings) || mappingsOverlap(start, size, m.GIDMappings) {
+			return true
+		}
+	}
+	return false
+}
+
+// mappingsOverlap reports whether [start, start+size) overlaps the host
+// range of any of mappings.
+func mappingsOverlap(start uint32, size uint32, mappings []spec.IDMappingObject) bool {
+	for _, m := range mappings {
+		if rangesOverlap(start, size, m.HostID, m.Size) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSubIDPool loads the runtime user's subordinate ranges from path.
+// A missing file means that no pool is configured.
+func parseSubIDPool(path string) ([]subIDRange, error) {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return loadSubIDRanges(path)
+}
@@ -0,0 +1,97 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"droplet/internal/spec"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestUserNsAllocator(t *testing.T, pool string) *userNsAllocator {
+	tmp := t.TempDir()
+	subUid := filepath.Join(tmp, "subuid")
+	subGid := filepath.Join(tmp, "subgid")
+	entry := fmt.Sprintf("%d:%s\n", os.Getuid(), pool)
+	_ = os.WriteFile(subUid, []byte(entry), 0644)
+	_ = os.WriteFile(subGid, []byte(entry), 0644)
+	return &userNsAllocator{
+		allocationPath: filepath.Join(tmp, "userns_allocations.json"),
+		lockPath:       filepath.Join(tmp, "userns_allocations.lock"),
+		subUidPath:     subUid,
+		subGidPath:     subGid,
+	}
+}
+
+func TestUserNsAllocator_AllocateAndRelease(t *testing.T) {
+	// == arrange ==
+	allocator := newTestUserNsAllocator(t, "100000:131072")
+
+	// == act ==
+	first, ok_1, err_1 := allocator.allocate("111111")
+	again, _, _ := allocator.allocate("111111")
+	second, ok_2, err_2 := allocator.allocate("222222")
+	_, ok_3, err_3 := allocator.allocate("333333")
+	releaseErr := allocator.release("111111")
+	third, ok_4, err_4 := allocator.allocate("333333")
+
+	// == assert ==
+	assert.Nil(t, err_1)
+	assert.True(t, ok_1)
+	assert.Equal(t, userNsAllocation{HostID: 100000, Size: 65536}, first)
+	assert.Equal(t, first, again)
+	assert.Nil(t, err_2)
+	assert.True(t, ok_2)
+	assert.Equal(t, uint32(165536), second.HostID)
+	assert.NotNil(t, err_3)
+	assert.False(t, ok_3)
+	assert.Nil(t, releaseErr)
+	assert.Nil(t, err_4)
+	assert.True(t, ok_4)
+	assert.Equal(t, uint32(100000), third.HostID)
+}
+
+func TestUserNsAllocator_NoPool(t *testing.T) {
+	// == arrange ==
+	allocator := newTestUserNsAllocator(t, "100000:65536")
+	allocator.subUidPath = filepath.Join(t.TempDir(), "missing")
+
+	// == act ==
+	_, ok, err := allocator.allocate("111111")
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestUserNsAllocator_ReserveMappings(t *testing.T) {
+	// == arrange ==
+	allocator := newTestUserNsAllocator(t, "100000:196608")
+	_, _, _ = allocator.allocate("111111")
+	overlapping := []spec.IDMappingObject{{ContainerID: 0, HostID: 160000, Size: 10000}}
+	free := []spec.IDMappingObject{{ContainerID: 0, HostID: 165536, Size: 65536}}
+	own := []spec.IDMappingObject{{ContainerID: 0, HostID: 100000, Size: 1000}}
+
+	// == act ==
+	errOverlap := allocator.reserveMappings("222222", free, overlapping)
+	errFree := allocator.reserveMappings("222222", free, free)
+	errMapped := allocator.reserveMappings("333333", free[:0], free)
+	errOwn := allocator.reserveMappings("111111", own, own)
+	allocated, _, allocateErr := allocator.allocate("444444")
+	releaseErr := allocator.release("222222")
+	reused, _, reuseErr := allocator.allocate("555555")
+
+	// == assert ==
+	assert.ErrorContains(t, errOverlap, "gid mapping[0]: host range 160000-169999 is allocated to container 111111")
+	assert.Nil(t, errFree)
+	assert.ErrorContains(t, errMapped, "gid mapping[0]: host range 165536-231071 is mapped by container 222222")
+	assert.Nil(t, errOwn)
+	assert.Nil(t, allocateErr)
+	assert.Equal(t, uint32(231072), allocated.HostID)
+	assert.Nil(t, releaseErr)
+	assert.Nil(t, reuseErr)
+	assert.Equal(t, uint32(165536), reused.HostID)
+}
@@ -0,0 +1,430 @@
+package ipam
+
+import (
+	"droplet/internal/utils"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"sort"
+)
+
+// AddressManager defines the operations required to manage the IPv4
+// subnet pools of the host bridges and the addresses leased from them
+// to container interfaces.
+type AddressManager interface {
+	AddPool(pool Pool) (Pool, error)
+	RemovePool(bridge string) error
+	ListPools() ([]Pool, error)
+	Allocate(containerId string, iface string, bridge string) (Lease, error)
+	Reserve(containerId string, iface string, bridge string, address string) (Lease, error)
+	Release(containerId string) error
+	ReleaseInterfaces(containerId string, ifaces []string) error
+	ListLeases() ([]Lease, error)
+}
+
+// NewIpamHandler constructs an IpamHandler backed by the lease store
+// under the runtime root directory. This is the default implementation
+// of AddressManager used by the runtime.
+func NewIpamHandler() *IpamHandler {
+	return &IpamHandler{
+		storePath: utils.IpamStorePath(),
+		lockPath:  utils.IpamLockPath(),
+	}
+}
+
+// IpamHandler is a host-local IPAM.
+//
+// Pools and leases are persisted in a single JSON file and every
+// read-modify-write cycle is serialized with a file lock, so concurrent
+// droplet invocations never hand out the same address.
+type IpamHandler struct {
+	storePath string
+	lockPath  string
+}
+
+// Pool is the IPv4 subnet of a bridge. Addresses of the subnet except
+// the network, broadcast and gateway addresses can be allocated.
+type Pool struct {
+	Bridge  string `json:"bridge"`
+	Subnet  string `json:"subnet"`
+	Gateway string `json:"gateway"`
+}
+
+// Lease is an address held by a container interface, identified by the
+// container ID and its host-side veth name.
+//
+// Static leases record addresses given in the spec, so that allocation
+// skips them and duplicates are detected.
+type Lease struct {
+	ContainerId string `json:"containerId"`
+	Interface   string `json:"interface"`
+	Bridge      string `json:"bridge"`
+	Address     string `json:"address"`
+	Gateway     string `json:"gateway,omitempty"`
+	Static      bool   `json:"static"`
+}
+
+// storeFile is the on-disk representation of the pools and leases.
+type storeFile struct {
+	Pools  []Pool  `json:"pools"`
+	Leases []Lease `json:"leases"`
+}
+
+// AddPool defines the subnet pool of a bridge.
+//
+// The gateway defaults to the last usable address of the subnet (e.g.
+// 10.166.0.254 for 10.166.0.0/24). Pools may not overlap and each bridge
+// has at most one pool. The normalized pool is returned.
+func (h *IpamHandler) AddPool(pool Pool) (Pool, error) {
+	if pool.Bridge == "" {
+		return Pool{}, fmt.Errorf("pool bridge is required")
+	}
+	subnet, err := parseSubnet(pool.Subnet)
+	if err != nil {
+		return Pool{}, err
+	}
+	first, last := hostRange(subnet)
+	gateway := uint32ToIP(last)
+	if pool.Gateway != "" {
+		gateway = net.ParseIP(pool.Gateway).To4()
+		if gateway == nil {
+			return Pool{}, fmt.Errorf("invalid gateway: %s", pool.Gateway)
+		}
+		if v := ipToUint32(gateway); !subnet.Contains(gateway) || v < first || v > last {
+			return Pool{}, fmt.Errorf("gateway %s is not a host address of %s", gateway, subnet)
+		}
+	}
+	pool = Pool{Bridge: pool.Bridge, Subnet: subnet.String(), Gateway: gateway.String()}
+
+	err = h.update(func(store *storeFile) error {
+		for _, p := range store.Pools {
+			if p.Bridge == pool.Bridge {
+				return fmt.Errorf("bridge %s already has a pool: %s", p.Bridge, p.Subnet)
+			}
+			_, other, err := net.ParseCIDR(p.Subnet)
+			if err != nil {
+				return err
+			}
+			if other.Contains(subnet.IP) || subnet.Contains(other.IP) {
+				return fmt.Errorf("subnet %s overlaps the pool of bridge %s: %s", subnet, p.Bridge, p.Subnet)
+			}
+		}
+		store.Pools = append(store.Pools, pool)
+		return nil
+	})
+	if err != nil {
+		return Pool{}, err
+	}
+	return pool, nil
+}
+
+// RemovePool removes the subnet pool of a bridge. A pool with addresses
+// still allocated from it cannot be removed.
+func (h *IpamHandler) RemovePool(bridge string) error {
+	return h.update(func(store *storeFile) error {
+		index := -1
+		for i, p := range store.Pools {
+			if p.Bridge == bridge {
+				index = i
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("bridge %s has no pool", bridge)
+		}
+		for _, l := range store.Leases {
+			if l.Bridge == bridge && !l.Static {
+				return fmt.Errorf("pool of bridge %s is in use by container %s", bridge, l.ContainerId)
+			}
+		}
+		store.Pools = append(store.Pools[:index], store.Pools[index+1:]...)
+		return nil
+	})
+}
+
+// ListPools returns the subnet pools sorted by bridge.
+func (h *IpamHandler) ListPools() ([]Pool, error) {
+	var pools []Pool
+	err := h.view(func(store storeFile) error {
+		pools = store.Pools
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].Bridge < pools[j].Bridge
+	})
+	return pools, nil
+}
+
+// Allocate leases the lowest free address of the bridge pool to the
+// container interface. The lease carries the gateway of the pool.
+//
+// If the interface already holds a lease from the bridge it is returned
+// as is, so that allocation can be retried.
+func (h *IpamHandler) Allocate(containerId string, iface string, bridge string) (Lease, error) {
+	var lease Lease
+	err := h.update(func(store *storeFile) error {
+		if existing, ok := store.lease(containerId, iface); ok && existing.Bridge == bridge && !existing.Static {
+			lease = existing
+			return nil
+		}
+
+		pool, ok := store.pool(bridge)
+		if !ok {
+			return fmt.Errorf("bridge %s has no ipam pool", bridge)
+		}
+		_, subnet, err := net.ParseCIDR(pool.Subnet)
+		if err != nil {
+			return err
+		}
+		gateway := net.ParseIP(pool.Gateway)
+		used := store.usedAddresses()
+		used[pool.Gateway] = true
+
+		ones, _ := subnet.Mask.Size()
+		first, last := hostRange(subnet)
+		for v := first; v <= last; v++ {
+			ip := uint32ToIP(v)
+			if used[ip.String()] {
+				continue
+			}
+			lease = Lease{
+				ContainerId: containerId,
+				Interface:   iface,
+				Bridge:      bridge,
+				Address:     fmt.Sprintf("%s/%d", ip, ones),
+				Gateway:     gateway.String(),
+			}
+			store.setLease(lease)
+			return nil
+		}
+		return fmt.Errorf("no free address left in the pool of bridge %s: %s", bridge, pool.Subnet)
+	})
+	if err != nil {
+		return Lease{}, err
+	}
+	return lease, nil
+}
+
+// Reserve records a static address of the container interface.
+//
+// It fails if the address is leased to another interface or is the
+// network, broadcast or gateway address of a pool.
+func (h *IpamHandler) Reserve(containerId string, iface string, bridge string, address string) (Lease, error) {
+	ip, _, err := net.ParseCIDR(address)
+	if err != nil {
+		return Lease{}, err
+	}
+	lease := Lease{
+		ContainerId: containerId,
+		Interface:   iface,
+		Bridge:      bridge,
+		Address:     address,
+		Static:      true,
+	}
+
+	err = h.update(func(store *storeFile) error {
+		for _, l := range store.Leases {
+			if l.ContainerId == containerId && l.Interface == iface {
+				continue
+			}
+			leased, _, err := net.ParseCIDR(l.Address)
+			if err != nil {
+				return err
+			}
+			if leased.Equal(ip) {
+				return fmt.Errorf("address %s is already leased to container %s (%s)", ip, l.ContainerId, l.Interface)
+			}
+		}
+		for _, p := range store.Pools {
+			_, subnet, err := net.ParseCIDR(p.Subnet)
+			if err != nil {
+				return err
+			}
+			if !subnet.Contains(ip) {
+				continue
+			}
+			first, last := hostRange(subnet)
+			if v := ipToUint32(ip.To4()); v < first || v > last || ip.Equal(net.ParseIP(p.Gateway)) {
+				return fmt.Errorf("address %s is reserved in the pool of bridge %s", ip, p.Bridge)
+			}
+		}
+		store.setLease(lease)
+		return nil
+	})
+	if err != nil {
+		return Lease{}, err
+	}
+	return lease, nil
+}
+
+// Release removes every lease of the container. Releasing a container
+// without leases is a no-op.
+func (h *IpamHandler) Release(containerId string) error {
+	return h.update(func(store *storeFile) error {
+		leases := store.Leases[:0]
+		for _, l := range store.Leases {
+			if l.ContainerId != containerId {
+				leases = append(leases, l)
+			}
+		}
+		store.Leases = leases
+		return nil
+	})
+}
+
+// ReleaseInterfaces removes the leases of the given interfaces of the
+// container and keeps its other leases.
+func (h *IpamHandler) ReleaseInterfaces(containerId string, ifaces []string) error {
+	if len(ifaces) == 0 {
+		return nil
+	}
+	release := map[string]bool{}
+	for _, iface := range ifaces {
+		release[iface] = true
+	}
+	return h.update(func(store *storeFile) error {
+		leases := store.Leases[:0]
+		for _, l := range store.Leases {
+			if l.ContainerId != containerId || !release[l.Interface] {
+				leases = append(leases, l)
+			}
+		}
+		store.Leases = leases
+		return nil
+	})
+}
+
+// ListLeases returns the leases sorted by container ID and interface.
+func (h *IpamHandler) ListLeases() ([]Lease, error) {
+	var leases []Lease
+	err := h.view(func(store storeFile) error {
+		leases = store.Leases
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		if leases[i].ContainerId != leases[j].ContainerId {
+			return leases[i].ContainerId < leases[j].ContainerId
+		}
+		return leases[i].Interface < leases[j].Interface
+	})
+	return leases, nil
+}
+
+// update runs fn on the store with the lock held and writes the store
+// back if fn succeeds.
+func (h *IpamHandler) update(fn func(store *storeFile) error) error {
+	return utils.WithFileLock(h.lockPath, func() error {
+		store, err := h.load()
+		if err != nil {
+			return err
+		}
+		if err := fn(&store); err != nil {
+			return err
+		}
+		return utils.WriteJsonToFile(h.storePath, store)
+	})
+}
+
+// view runs fn on the store with the lock held.
+func (h *IpamHandler) view(fn func(store storeFile) error) error {
+	return utils.WithFileLock(h.lockPath, func() error {
+		store, err := h.load()
+		if err != nil {
+			return err
+		}
+		return fn(store)
+	})
+}
+
+// load reads the store file. A missing file is treated as empty.
+// It must be called with the lock held.
+func (h *IpamHandler) load() (storeFile, error) {
+	var store storeFile
+	if err := utils.ReadJsonFile(h.storePath, &store); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return storeFile{}, err
+		}
+	}
+	return store, nil
+}
+
+func (s *storeFile) pool(bridge string) (Pool, bool) {
+	for _, p := range s.Pools {
+		if p.Bridge == bridge {
+			return p, true
+		}
+	}
+	return Pool{}, false
+}
+
+func (s *storeFile) lease(containerId string, iface string) (Lease, bool) {
+	for _, l := range s.Leases {
+		if l.ContainerId == containerId && l.Interface == iface {
+			return l, true
+		}
+	}
+	return Lease{}, false
+}
+
+// setLease adds the lease, replacing the previous lease of the interface.
+func (s *storeFile) setLease(lease Lease) {
+	for i, l := range s.Leases {
+		if l.ContainerId == lease.ContainerId && l.Interface == lease.Interface {
+			s.Leases[i] = lease
+			return
+		}
+	}
+	s.Leases = append(s.Leases, lease)
+}
+
+// usedAddresses returns the leased addresses without prefix length.
+func (s *storeFile) usedAddresses() map[string]bool {
+	used := map[string]bool{}
+	for _, l := range s.Leases {
+		if ip, _, err := net.ParseCIDR(l.Address); err == nil {
+			used[ip.String()] = true
+		}
+	}
+	return used
+}
+
+// parseSubnet parses an IPv4 subnet with room for at least two hosts.
+func parseSubnet(subnet string) (*net.IPNet, error) {
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, err
+	}
+	if ipNet.IP.To4() == nil {
+		return nil, fmt.Errorf("not an ipv4 subnet: %s", subnet)
+	}
+	if ones, _ := ipNet.Mask.Size(); ones > 30 {
+		return nil, fmt.Errorf("subnet %s is too small", subnet)
+	}
+	ipNet.IP = ipNet.IP.To4()
+	return ipNet, nil
+}
+
+// hostRange returns the first and last host address of an IPv4 subnet,
+// i.e. without the network and broadcast addresses.
+func hostRange(subnet *net.IPNet) (uint32, uint32) {
+	network := ipToUint32(subnet.IP.To4())
+	broadcast := network | ^binary.BigEndian.Uint32(subnet.Mask[len(subnet.Mask)-4:])
+	return network + 1, broadcast - 1
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIP(v uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, v)
+	return ip
+}
@@ -0,0 +1,112 @@
+package ipam
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestIpamHandler(t *testing.T) *IpamHandler {
+	tmp := t.TempDir()
+	return &IpamHandler{
+		storePath: filepath.Join(tmp, "ipam.json"),
+		lockPath:  filepath.Join(tmp, "ipam.lock"),
+	}
+}
+
+func TestAddPool_DefaultGateway(t *testing.T) {
+	// == arrange ==
+	handler := newTestIpamHandler(t)
+
+	// == act ==
+	pool, err := handler.AddPool(Pool{Bridge: "raind0", Subnet: "10.166.0.10/24"})
+	_, overlapErr := handler.AddPool(Pool{Bridge: "raind1", Subnet: "10.166.0.0/16"})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, Pool{Bridge: "raind0", Subnet: "10.166.0.0/24", Gateway: "10.166.0.254"}, pool)
+	assert.EqualError(t, overlapErr, "subnet 10.166.0.0/16 overlaps the pool of bridge raind0: 10.166.0.0/24")
+}
+
+func TestAllocate_SkipsLeasedAndGateway(t *testing.T) {
+	// == arrange ==
+	handler := newTestIpamHandler(t)
+	_, _ = handler.AddPool(Pool{Bridge: "raind0", Subnet: "10.166.0.0/30", Gateway: "10.166.0.1"})
+
+	// == act ==
+	first, err_1 := handler.Allocate("111111", "rd_111111", "raind0")
+	again, _ := handler.Allocate("111111", "rd_111111", "raind0")
+	_, err_2 := handler.Allocate("222222", "rd_222222", "raind0")
+	releaseErr := handler.Release("111111")
+	second, err_3 := handler.Allocate("222222", "rd_222222", "raind0")
+
+	// == assert ==
+	assert.Nil(t, err_1)
+	assert.Equal(t, Lease{ContainerId: "111111", Interface: "rd_111111", Bridge: "raind0", Address: "10.166.0.2/30", Gateway: "10.166.0.1"}, first)
+	assert.Equal(t, first, again)
+	assert.EqualError(t, err_2, "no free address left in the pool of bridge raind0: 10.166.0.0/30")
+	assert.Nil(t, releaseErr)
+	assert.Nil(t, err_3)
+	assert.Equal(t, "10.166.0.2/30", second.Address)
+}
+
+func TestReserve_Duplicate(t *testing.T) {
+	// == arrange ==
+	handler := newTestIpamHandler(t)
+	_, _ = handler.AddPool(Pool{Bridge: "raind0", Subnet: "10.166.0.0/24"})
+
+	// == act ==
+	_, err_1 := handler.Reserve("111111", "rd_111111", "raind0", "10.166.0.1/24")
+	_, err_2 := handler.Reserve("222222", "rd_222222", "raind0", "10.166.0.1/24")
+	_, err_3 := handler.Reserve("222222", "rd_222222", "raind0", "10.166.0.254/24")
+	lease, err_4 := handler.Allocate("333333", "rd_333333", "raind0")
+	leases, listErr := handler.ListLeases()
+
+	// == assert ==
+	assert.Nil(t, err_1)
+	assert.EqualError(t, err_2, "address 10.166.0.1 is already leased to container 111111 (rd_111111)")
+	assert.EqualError(t, err_3, "address 10.166.0.254 is reserved in the pool of bridge raind0")
+	assert.Nil(t, err_4)
+	assert.Equal(t, "10.166.0.2/24", lease.Address)
+	assert.Nil(t, listErr)
+	assert.Len(t, leases, 2)
+	assert.True(t, leases[0].Static)
+}
+
+func TestRemovePool_InUse(t *testing.T) {
+	// == arrange ==
+	handler := newTestIpamHandler(t)
+	_, _ = handler.AddPool(Pool{Bridge: "raind0", Subnet: "10.166.0.0/24"})
+	_, _ = handler.Allocate("111111", "rd_111111", "raind0")
+
+	// == act ==
+	inUseErr := handler.RemovePool("raind0")
+	_ = handler.Release("111111")
+	err := handler.RemovePool("raind0")
+	pools, _ := handler.ListPools()
+
+	// == assert ==
+	assert.EqualError(t, inUseErr, "pool of bridge raind0 is in use by container 111111")
+	assert.Nil(t, err)
+	assert.Empty(t, pools)
+}
+
+func TestReleaseInterfaces_KeepsOtherLeases(t *testing.T) {
+	// == arrange ==
+	handler := newTestIpamHandler(t)
+	_, _ = handler.AddPool(Pool{Bridge: "raind0", Subnet: "10.166.0.0/24"})
+	_, _ = handler.Allocate("111111", "rd_data", "raind0")
+	_, _ = handler.Allocate("111111", "rd_mgmt", "raind0")
+	_, _ = handler.Allocate("222222", "rd_data", "raind0")
+
+	// == act ==
+	err := handler.ReleaseInterfaces("111111", []string{"rd_data"})
+	leases, _ := handler.ListLeases()
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Len(t, leases, 2)
+	assert.Equal(t, Lease{ContainerId: "111111", Interface: "rd_mgmt"}, Lease{ContainerId: leases[0].ContainerId, Interface: leases[0].Interface})
+	assert.Equal(t, Lease{ContainerId: "222222", Interface: "rd_data"}, Lease{ContainerId: leases[1].ContainerId, Interface: leases[1].Interface})
+}
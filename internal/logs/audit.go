@@ -3,6 +3,7 @@ package logs
 import (
 	"droplet/internal/spec"
 	"droplet/internal/utils"
+	"fmt"
 	"log"
 	"time"
 )
@@ -14,9 +15,15 @@ type AuditRecord struct {
 	Pid         int
 	Command     *[]string
 	Signals     *[]string
-	Spec        *spec.Spec
-	Result      string
-	Error       error
+	UserNs      *UserNsInfo
+	Resources   *ResourceUpdateInfo
+	OOM         *OOMInfo
+	// User is the identity applied to the process. Without it, the
+	// identity requested by the spec is recorded.
+	User   *UserInfo
+	Spec   *spec.Spec
+	Result string
+	Error  error
 }
 
 func RecordAuditLog(auditRecord AuditRecord) error {
@@ -50,9 +57,26 @@ func RecordAuditLog(auditRecord AuditRecord) error {
 		rec.Signals = *auditRecord.Signals
 	}
 
+	if auditRecord.UserNs != nil {
+		rec.UserNs = auditRecord.UserNs
+	}
+
+	if auditRecord.Resources != nil {
+		rec.Resources = auditRecord.Resources
+	}
+
+	if auditRecord.OOM != nil {
+		rec.OOM = auditRecord.OOM
+	}
+
 	if auditRecord.Spec != nil {
 		rec.Oci.ProcessArg0 = auditRecord.Spec.Process.Args[0]
 		rec.Namespaces = mapNamespace(auditRecord.Spec.LinuxSpec)
+		rec.User = auditRecord.User
+		if rec.User == nil {
+			rec.User = mapUser(auditRecord.Spec.Process.User)
+		}
+		rec.Limits = mapLimits(auditRecord.Spec.Process)
 		rec.Capabilities = &CapsInfo{
 			Bounding:    auditRecord.Spec.Process.Capabilities.Bounding,
 			Effective:   auditRecord.Spec.Process.Capabilities.Effective,
@@ -122,6 +146,7 @@ func mapNamespace(linuxObject spec.LinuxSpecObject) map[string]bool {
 		"ipc":     false,
 		"user":    false,
 		"cgroup":  false,
+		"time":    false,
 	}
 
 	for _, ns := range linuxObject.Namespaces {
@@ -131,3 +156,32 @@ func mapNamespace(linuxObject spec.LinuxSpecObject) map[string]bool {
 	}
 	return mapNs
 }
+
+func mapUser(userObject spec.UserObject) *UserInfo {
+	userInfo := &UserInfo{
+		Uid:            userObject.Uid,
+		Gid:            userObject.Gid,
+		AdditionalGids: userObject.AdditionalGids,
+		Username:       userObject.Username,
+		Groupname:      userObject.Groupname,
+	}
+	if userObject.Umask != nil {
+		userInfo.Umask = fmt.Sprintf("%04o", *userObject.Umask)
+	}
+	return userInfo
+}
+
+func mapLimits(processObject spec.ProcessObject) *LimitsInfo {
+	limitsInfo := &LimitsInfo{
+		OOMScoreAdj:     processObject.OOMScoreAdj,
+		NoNewPrivileges: processObject.NoNewPrivileges,
+	}
+	for _, r := range processObject.Rlimits {
+		limitsInfo.Rlimits = append(limitsInfo.Rlimits, RlimitInfo{
+			Type: r.Type,
+			Soft: r.Soft,
+			Hard: r.Hard,
+		})
+	}
+	return limitsInfo
+}
@@ -5,9 +5,11 @@ import (
 	"droplet/internal/utils"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"strconv"
 	"sync"
 
 	"golang.org/x/sys/unix"
@@ -25,9 +27,26 @@ var AuditLogger *FileLogger
 const (
 	MaxAuditLines  = 15000
 	AuditTrimLines = 15000
+
+	// AuditLogFdEnv names the environment variable used to hand an already
+	// opened audit log descriptor to a child process (e.g. the container init
+	// running as a remapped user that cannot open the log file itself).
+	AuditLogFdEnv = "_DROPLET_AUDIT_LOG_FD"
 )
 
 func InitAuditLogger() error {
+	// inherited audit log descriptor
+	if v := os.Getenv(AuditLogFdEnv); v != "" {
+		_ = os.Unsetenv(AuditLogFdEnv)
+		fd, err := strconv.Atoi(v)
+		if err != nil || fd < 3 {
+			return fmt.Errorf("invalid %s: %q", AuditLogFdEnv, v)
+		}
+		unix.CloseOnExec(fd)
+		AuditLogger = &FileLogger{path: utils.AuditLog, fd: fd, maxLine: 64 * 1024}
+		return nil
+	}
+
 	l, err := OpenFileLogger(utils.AuditLog, 64*1024)
 	if err != nil {
 		return err
@@ -64,6 +83,25 @@ func (l *FileLogger) Reopen() error {
 	return nil
 }
 
+// Dup returns a duplicate of the audit log descriptor as an *os.File so that
+// it can be passed to a child process via ExtraFiles. The caller is
+// responsible for closing the returned file.
+func (l *FileLogger) Dup() (*os.File, error) {
+	if l == nil {
+		return nil, errors.New("logger not initialized")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fd <= 0 {
+		return nil, errors.New("logger closed")
+	}
+	fd, err := unix.Dup(l.fd)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), l.path), nil
+}
+
 func (l *FileLogger) Close() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -1,6 +1,9 @@
 package logs
 
-import "time"
+import (
+	"droplet/internal/spec"
+	"time"
+)
 
 type Record struct {
 	TS          time.Time `json:"ts"`
@@ -19,11 +22,16 @@ type Record struct {
 	Pid     int      `json:"pid,omitempty"`
 	Signals []string `json:"signals,omitempty"`
 
-	Namespaces   map[string]bool `json:"namespaces,omitempty"`
-	Capabilities *CapsInfo       `json:"capabilities,omitempty"`
-	Seccomp      *SeccompInfo    `json:"seccomp,omitempty"`
-	LSM          *LsmInfo        `json:"lsm,omitempty"`
-	Hook         *HookResult     `json:"hook,omitempty"`
+	Namespaces   map[string]bool     `json:"namespaces,omitempty"`
+	UserNs       *UserNsInfo         `json:"userns,omitempty"`
+	User         *UserInfo           `json:"user,omitempty"`
+	Limits       *LimitsInfo         `json:"limits,omitempty"`
+	Resources    *ResourceUpdateInfo `json:"resources,omitempty"`
+	OOM          *OOMInfo            `json:"oom,omitempty"`
+	Capabilities *CapsInfo           `json:"capabilities,omitempty"`
+	Seccomp      *SeccompInfo        `json:"seccomp,omitempty"`
+	LSM          *LsmInfo            `json:"lsm,omitempty"`
+	Hook         *HookResult         `json:"hook,omitempty"`
 
 	Result string   `json:"result,omitempty"`
 	Error  *ErrInfo `json:"error,omitempty"`
@@ -41,6 +49,41 @@ type UserNsInfo struct {
 	GIDMap  string `json:"gid_map,omitempty"`
 }
 
+type UserInfo struct {
+	Uid            uint32   `json:"uid"`
+	Gid            uint32   `json:"gid"`
+	AdditionalGids []uint32 `json:"additional_gids,omitempty"`
+	Umask          string   `json:"umask,omitempty"`
+	Username       string   `json:"username,omitempty"`
+	Groupname      string   `json:"groupname,omitempty"`
+	// Resolved is true when the ids are those applied to the process
+	// after the names were resolved, and false for the ids requested by
+	// the spec.
+	Resolved bool `json:"resolved"`
+}
+
+type LimitsInfo struct {
+	Rlimits         []RlimitInfo `json:"rlimits,omitempty"`
+	OOMScoreAdj     *int         `json:"oom_score_adj,omitempty"`
+	NoNewPrivileges bool         `json:"no_new_privileges"`
+}
+
+type RlimitInfo struct {
+	Type string `json:"type"`
+	Soft uint64 `json:"soft"`
+	Hard uint64 `json:"hard"`
+}
+
+type ResourceUpdateInfo struct {
+	Old *spec.ResourceObject `json:"old,omitempty"`
+	New *spec.ResourceObject `json:"new,omitempty"`
+}
+
+type OOMInfo struct {
+	Oom     uint64 `json:"oom"`
+	OomKill uint64 `json:"oom_kill"`
+}
+
 type CapsInfo struct {
 	Bounding    []string `json:"bounding,omitempty"`
 	Effective   []string `json:"effective,omitempty"`
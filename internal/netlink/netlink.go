@@ -0,0 +1,443 @@
+// Package netlink implements the small subset of rtnetlink needed to set
+// up container networking (links, addresses, routes and the qdiscs of
+// rate limits) without spawning `ip`, `tc` or `nsenter`.
+package netlink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// vethInfoPeer is VETH_INFO_PEER from linux/veth.h, which is not exported
+// by x/sys/unix.
+const vethInfoPeer = 1
+
+// Handle is a NETLINK_ROUTE socket.
+//
+// A netlink socket operates on the network namespace of the thread that
+// created it, so a Handle created inside RunInNetns keeps configuring that
+// namespace until it is closed.
+type Handle struct {
+	fd  int
+	seq uint32
+}
+
+// NewHandle opens a NETLINK_ROUTE socket in the network namespace of the
+// calling thread.
+func NewHandle() (*Handle, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("open netlink socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("bind netlink socket: %w", err)
+	}
+	return &Handle{fd: fd}, nil
+}
+
+// Close closes the netlink socket.
+func (h *Handle) Close() error {
+	return unix.Close(h.fd)
+}
+
+// LinkByName returns the index of the link with the given name.
+func (h *Handle) LinkByName(name string) (int, error) {
+	msg := newIfInfomsg(unix.AF_UNSPEC, 0)
+	msg = append(msg, encodeAttr(unix.IFLA_IFNAME, zeroTerminated(name))...)
+
+	replies, err := h.request(unix.RTM_GETLINK, 0, msg)
+	if err != nil {
+		return 0, fmt.Errorf("link %s: %w", name, err)
+	}
+	for _, reply := range replies {
+		if reply.Header.Type != unix.RTM_NEWLINK || len(reply.Data) < unix.SizeofIfInfomsg {
+			continue
+		}
+		return int(int32(binary.NativeEndian.Uint32(reply.Data[4:8]))), nil
+	}
+	return 0, fmt.Errorf("link %s: no reply", name)
+}
+
+// Link describes a network link.
+type Link struct {
+	Index int
+	Name  string
+	// Kind is the link type, e.g. "veth" or "bridge". It is empty for
+	// links without link info such as physical devices.
+	Kind string
+	// MasterIndex is the index of the master device (e.g. a bridge) the
+	// link is attached to, or 0.
+	MasterIndex  int
+	MTU          int
+	HardwareAddr net.HardwareAddr
+	// Stats holds the counters of the link, or nil when the kernel did
+	// not report them.
+	Stats *LinkStats
+}
+
+// LinkStats is the leading part of struct rtnl_link_stats64.
+type LinkStats struct {
+	RxPackets uint64
+	TxPackets uint64
+	RxBytes   uint64
+	TxBytes   uint64
+	RxErrors  uint64
+	TxErrors  uint64
+	RxDropped uint64
+	TxDropped uint64
+}
+
+// LinkList returns every link in the network namespace.
+func (h *Handle) LinkList() ([]Link, error) {
+	replies, err := h.request(unix.RTM_GETLINK, unix.NLM_F_DUMP, newIfInfomsg(unix.AF_UNSPEC, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	var links []Link
+	for _, reply := range replies {
+		if reply.Header.Type != unix.RTM_NEWLINK || len(reply.Data) < unix.SizeofIfInfomsg {
+			continue
+		}
+		links = append(links, parseLink(reply.Data))
+	}
+	return links, nil
+}
+
+// LinkByIndex returns the link with the given index.
+func (h *Handle) LinkByIndex(index int) (Link, error) {
+	replies, err := h.request(unix.RTM_GETLINK, 0, newIfInfomsg(unix.AF_UNSPEC, index))
+	if err != nil {
+		return Link{}, fmt.Errorf("link %d: %w", index, err)
+	}
+	for _, reply := range replies {
+		if reply.Header.Type != unix.RTM_NEWLINK || len(reply.Data) < unix.SizeofIfInfomsg {
+			continue
+		}
+		return parseLink(reply.Data), nil
+	}
+	return Link{}, fmt.Errorf("link %d: no reply", index)
+}
+
+// parseLink decodes an RTM_NEWLINK message.
+func parseLink(data []byte) Link {
+	link := Link{
+		Index: int(int32(binary.NativeEndian.Uint32(data[4:8]))),
+	}
+	for _, a := range parseAttrs(data[unix.SizeofIfInfomsg:]) {
+		switch a.attrType {
+		case unix.IFLA_IFNAME:
+			link.Name = strings.TrimRight(string(a.data), "\x00")
+		case unix.IFLA_MASTER:
+			if len(a.data) >= 4 {
+				link.MasterIndex = int(binary.NativeEndian.Uint32(a.data))
+			}
+		case unix.IFLA_MTU:
+			if len(a.data) >= 4 {
+				link.MTU = int(binary.NativeEndian.Uint32(a.data))
+			}
+		case unix.IFLA_ADDRESS:
+			link.HardwareAddr = net.HardwareAddr(append([]byte(nil), a.data...))
+		case unix.IFLA_STATS64:
+			link.Stats = parseLinkStats(a.data)
+		case unix.IFLA_LINKINFO:
+			for _, info := range parseAttrs(a.data) {
+				if info.attrType == unix.IFLA_INFO_KIND {
+					link.Kind = strings.TrimRight(string(info.data), "\x00")
+				}
+			}
+		}
+	}
+	return link
+}
+
+// parseLinkStats decodes the counters of IFLA_STATS64.
+func parseLinkStats(data []byte) *LinkStats {
+	if len(data) < 8*8 {
+		return nil
+	}
+	counter := func(i int) uint64 {
+		return binary.NativeEndian.Uint64(data[i*8 : i*8+8])
+	}
+	return &LinkStats{
+		RxPackets: counter(0),
+		TxPackets: counter(1),
+		RxBytes:   counter(2),
+		TxBytes:   counter(3),
+		RxErrors:  counter(4),
+		TxErrors:  counter(5),
+		RxDropped: counter(6),
+		TxDropped: counter(7),
+	}
+}
+
+// AddVeth creates a veth pair. The peer is created directly in the network
+// namespace referred to by peerNsFd, or in the current one if peerNsFd is
+// negative.
+func (h *Handle) AddVeth(name string, peerName string, peerNsFd int) error {
+	peer := newIfInfomsg(unix.AF_UNSPEC, 0)
+	peer = append(peer, encodeAttr(unix.IFLA_IFNAME, zeroTerminated(peerName))...)
+	if peerNsFd >= 0 {
+		peer = append(peer, encodeAttr(unix.IFLA_NET_NS_FD, uint32Bytes(uint32(peerNsFd)))...)
+	}
+
+	linkInfo := encodeAttr(unix.IFLA_INFO_KIND, []byte("veth"))
+	linkInfo = append(linkInfo, encodeNestedAttr(unix.IFLA_INFO_DATA,
+		encodeNestedAttr(vethInfoPeer, peer),
+	)...)
+
+	msg := newIfInfomsg(unix.AF_UNSPEC, 0)
+	msg = append(msg, encodeAttr(unix.IFLA_IFNAME, zeroTerminated(name))...)
+	msg = append(msg, encodeNestedAttr(unix.IFLA_LINKINFO, linkInfo)...)
+
+	_, err := h.request(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL, msg)
+	return err
+}
+
+// DeleteLink removes the link. Removing one end of a veth pair removes
+// the other end as well.
+func (h *Handle) DeleteLink(index int) error {
+	_, err := h.request(unix.RTM_DELLINK, 0, newIfInfomsg(unix.AF_UNSPEC, index))
+	return err
+}
+
+// SetLinkUp brings the link up.
+func (h *Handle) SetLinkUp(index int) error {
+	msg := newIfInfomsg(unix.AF_UNSPEC, index)
+	// ifi_flags, ifi_change
+	binary.NativeEndian.PutUint32(msg[8:12], unix.IFF_UP)
+	binary.NativeEndian.PutUint32(msg[12:16], unix.IFF_UP)
+	_, err := h.request(unix.RTM_NEWLINK, 0, msg)
+	return err
+}
+
+// SetLinkMaster enslaves the link to a master device such as a bridge.
+func (h *Handle) SetLinkMaster(index int, masterIndex int) error {
+	msg := newIfInfomsg(unix.AF_UNSPEC, index)
+	msg = append(msg, encodeAttr(unix.IFLA_MASTER, uint32Bytes(uint32(masterIndex)))...)
+	_, err := h.request(unix.RTM_NEWLINK, 0, msg)
+	return err
+}
+
+// SetLinkName renames the link. The link must be down.
+func (h *Handle) SetLinkName(index int, name string) error {
+	msg := newIfInfomsg(unix.AF_UNSPEC, index)
+	msg = append(msg, encodeAttr(unix.IFLA_IFNAME, zeroTerminated(name))...)
+	_, err := h.request(unix.RTM_NEWLINK, 0, msg)
+	return err
+}
+
+// SetLinkMTU sets the MTU of the link.
+func (h *Handle) SetLinkMTU(index int, mtu int) error {
+	msg := newIfInfomsg(unix.AF_UNSPEC, index)
+	msg = append(msg, encodeAttr(unix.IFLA_MTU, uint32Bytes(uint32(mtu)))...)
+	_, err := h.request(unix.RTM_NEWLINK, 0, msg)
+	return err
+}
+
+// SetLinkHardwareAddr sets the MAC address of the link.
+func (h *Handle) SetLinkHardwareAddr(index int, hwAddr net.HardwareAddr) error {
+	msg := newIfInfomsg(unix.AF_UNSPEC, index)
+	msg = append(msg, encodeAttr(unix.IFLA_ADDRESS, hwAddr)...)
+	_, err := h.request(unix.RTM_NEWLINK, 0, msg)
+	return err
+}
+
+// AddAddr assigns addr to the link. flags are IFA_F_* address flags,
+// e.g. IFA_F_NODAD.
+func (h *Handle) AddAddr(index int, addr *net.IPNet, flags uint8) error {
+	family, ip := ipFamily(addr.IP)
+	prefixLen, _ := addr.Mask.Size()
+
+	// struct ifaddrmsg
+	msg := make([]byte, unix.SizeofIfAddrmsg)
+	msg[0] = family
+	msg[1] = uint8(prefixLen)
+	msg[2] = flags
+	binary.NativeEndian.PutUint32(msg[4:8], uint32(index))
+	msg = append(msg, encodeAttr(unix.IFA_LOCAL, ip)...)
+	msg = append(msg, encodeAttr(unix.IFA_ADDRESS, ip)...)
+
+	_, err := h.request(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_EXCL, msg)
+	return err
+}
+
+// AddRoute adds a route to dst through the link. A nil dst adds the
+// default route of the gateway's address family, and a nil gw adds a
+// directly connected route.
+func (h *Handle) AddRoute(index int, dst *net.IPNet, gw net.IP) error {
+	var family uint8
+	switch {
+	case dst != nil:
+		family, _ = ipFamily(dst.IP)
+	case gw != nil:
+		family, _ = ipFamily(gw)
+	default:
+		return fmt.Errorf("route requires a destination or a gateway")
+	}
+
+	// struct rtmsg
+	msg := make([]byte, unix.SizeofRtMsg)
+	msg[0] = family
+	msg[4] = unix.RT_TABLE_MAIN
+	msg[5] = unix.RTPROT_BOOT
+	msg[6] = unix.RT_SCOPE_UNIVERSE
+	msg[7] = unix.RTN_UNICAST
+	if gw == nil {
+		msg[6] = unix.RT_SCOPE_LINK
+	}
+	if dst != nil {
+		_, ip := ipFamily(dst.IP)
+		prefixLen, _ := dst.Mask.Size()
+		msg[1] = uint8(prefixLen)
+		msg = append(msg, encodeAttr(unix.RTA_DST, ip)...)
+	}
+	if gw != nil {
+		gwFamily, ip := ipFamily(gw)
+		if gwFamily != family {
+			return fmt.Errorf("gateway %s does not match destination family", gw)
+		}
+		msg = append(msg, encodeAttr(unix.RTA_GATEWAY, ip)...)
+	}
+	msg = append(msg, encodeAttr(unix.RTA_OIF, uint32Bytes(uint32(index)))...)
+
+	_, err := h.request(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_EXCL, msg)
+	return err
+}
+
+// request sends a netlink request and collects the replies until the
+// kernel acknowledges it. A negative acknowledgement is returned as the
+// corresponding syscall.Errno.
+func (h *Handle) request(msgType uint16, flags uint16, payload []byte) ([]syscall.NetlinkMessage, error) {
+	seq := atomic.AddUint32(&h.seq, 1)
+
+	// struct nlmsghdr
+	msg := make([]byte, unix.NLMSG_HDRLEN, unix.NLMSG_HDRLEN+len(payload))
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(unix.NLMSG_HDRLEN+len(payload)))
+	binary.NativeEndian.PutUint16(msg[4:6], msgType)
+	binary.NativeEndian.PutUint16(msg[6:8], unix.NLM_F_REQUEST|unix.NLM_F_ACK|flags)
+	binary.NativeEndian.PutUint32(msg[8:12], seq)
+	msg = append(msg, payload...)
+
+	if err := unix.Sendto(h.fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	var replies []syscall.NetlinkMessage
+	buf := make([]byte, 1<<16)
+	for {
+		n, _, err := unix.Recvfrom(h.fd, buf, 0)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return nil, err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != seq {
+				continue
+			}
+			switch m.Header.Type {
+			case unix.NLMSG_ERROR:
+				if len(m.Data) < 4 {
+					return nil, fmt.Errorf("short netlink error message")
+				}
+				if errno := -int32(binary.NativeEndian.Uint32(m.Data[0:4])); errno != 0 {
+					return nil, syscall.Errno(errno)
+				}
+				return replies, nil
+			case unix.NLMSG_DONE:
+				return replies, nil
+			default:
+				// buf is reused by the next read
+				m.Data = append([]byte(nil), m.Data...)
+				replies = append(replies, m)
+			}
+		}
+	}
+}
+
+// newIfInfomsg returns a struct ifinfomsg for the given link index.
+func newIfInfomsg(family uint8, index int) []byte {
+	msg := make([]byte, unix.SizeofIfInfomsg)
+	msg[0] = family
+	binary.NativeEndian.PutUint32(msg[4:8], uint32(int32(index)))
+	return msg
+}
+
+// encodeAttr encodes a route attribute (struct rtattr) padded to 4 bytes.
+func encodeAttr(attrType uint16, data []byte) []byte {
+	length := unix.SizeofRtAttr + len(data)
+	b := make([]byte, rtaAlign(length))
+	binary.NativeEndian.PutUint16(b[0:2], uint16(length))
+	binary.NativeEndian.PutUint16(b[2:4], attrType)
+	copy(b[unix.SizeofRtAttr:], data)
+	return b
+}
+
+// encodeNestedAttr encodes an attribute whose payload is a list of
+// already encoded attributes.
+func encodeNestedAttr(attrType uint16, children []byte) []byte {
+	return encodeAttr(attrType|unix.NLA_F_NESTED, children)
+}
+
+// attr is a decoded route attribute.
+type attr struct {
+	attrType uint16
+	data     []byte
+}
+
+// parseAttrs decodes a list of route attributes. The nested flag is
+// cleared from the attribute types; truncated attributes are ignored.
+func parseAttrs(b []byte) []attr {
+	var attrs []attr
+	for len(b) >= unix.SizeofRtAttr {
+		length := int(binary.NativeEndian.Uint16(b[0:2]))
+		if length < unix.SizeofRtAttr || length > len(b) {
+			break
+		}
+		attrs = append(attrs, attr{
+			attrType: binary.NativeEndian.Uint16(b[2:4]) &^ unix.NLA_F_NESTED,
+			data:     b[unix.SizeofRtAttr:length],
+		})
+		if rtaAlign(length) >= len(b) {
+			break
+		}
+		b = b[rtaAlign(length):]
+	}
+	return attrs
+}
+
+func rtaAlign(length int) int {
+	return (length + unix.RTA_ALIGNTO - 1) & ^(unix.RTA_ALIGNTO - 1)
+}
+
+func zeroTerminated(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+func uint32Bytes(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.NativeEndian.PutUint32(b, v)
+	return b
+}
+
+// ipFamily returns the address family of ip together with its 4 or 16
+// byte representation.
+func ipFamily(ip net.IP) (uint8, []byte) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return unix.AF_INET, ip4
+	}
+	return unix.AF_INET6, ip.To16()
+}
@@ -0,0 +1,119 @@
+package netlink
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestEncodeAttr_Padding(t *testing.T) {
+	// == arrange ==
+	data := zeroTerminated("eth0")
+
+	// == act ==
+	b := encodeAttr(unix.IFLA_IFNAME, data)
+
+	// == assert ==
+	assert.Equal(t, 12, len(b))
+	assert.Equal(t, uint16(9), binary.NativeEndian.Uint16(b[0:2]))
+	assert.Equal(t, uint16(unix.IFLA_IFNAME), binary.NativeEndian.Uint16(b[2:4]))
+	assert.Equal(t, []byte("eth0\x00\x00\x00\x00"), b[4:])
+}
+
+func TestEncodeNestedAttr_Length(t *testing.T) {
+	// == arrange ==
+	child := encodeAttr(unix.IFLA_INFO_KIND, []byte("veth"))
+
+	// == act ==
+	b := encodeNestedAttr(unix.IFLA_LINKINFO, child)
+
+	// == assert ==
+	assert.Equal(t, uint16(4+len(child)), binary.NativeEndian.Uint16(b[0:2]))
+	assert.Equal(t, uint16(unix.IFLA_LINKINFO|unix.NLA_F_NESTED), binary.NativeEndian.Uint16(b[2:4]))
+	assert.Equal(t, child, b[4:])
+}
+
+func TestIPFamily(t *testing.T) {
+	// == act ==
+	family4, ip4 := ipFamily(net.ParseIP("10.166.0.2"))
+	family6, ip6 := ipFamily(net.ParseIP("fd00::2"))
+
+	// == assert ==
+	assert.Equal(t, uint8(unix.AF_INET), family4)
+	assert.Equal(t, 4, len(ip4))
+	assert.Equal(t, uint8(unix.AF_INET6), family6)
+	assert.Equal(t, 16, len(ip6))
+}
+
+func TestEncodePoliceFilter_Rate(t *testing.T) {
+	// == act ==
+	msg := encodePoliceFilter(3, 1250000, 65536)
+
+	// == assert ==
+	assert.Equal(t, uint32(3), binary.NativeEndian.Uint32(msg[4:8]))
+	assert.Equal(t, uint32(ingressHandle), binary.NativeEndian.Uint32(msg[12:16]))
+	var kind string
+	var rate uint64
+	for _, a := range parseAttrs(msg[sizeofTcMsg:]) {
+		switch a.attrType {
+		case unix.TCA_KIND:
+			kind = string(a.data)
+		case unix.TCA_OPTIONS:
+			rate = parseMatchallPoliceRate(a.data)
+		}
+	}
+	assert.Equal(t, "matchall\x00", kind)
+	assert.Equal(t, uint64(1250000), rate)
+}
+
+func TestEncodePoliceFilter_Rate64(t *testing.T) {
+	// == act ==
+	msg := encodePoliceFilter(3, 6250000000, 65536)
+
+	// == assert ==
+	var rate uint64
+	for _, a := range parseAttrs(msg[sizeofTcMsg:]) {
+		if a.attrType == unix.TCA_OPTIONS {
+			rate = parseMatchallPoliceRate(a.data)
+		}
+	}
+	assert.Equal(t, uint64(6250000000), rate)
+}
+
+func TestRateTable(t *testing.T) {
+	// == act ==
+	cellLog, rtab := rateTable(1000000)
+
+	// == assert ==
+	// cells of 8 bytes cover 2047 bytes in 256 cells
+	assert.Equal(t, uint8(3), cellLog)
+	assert.Equal(t, sizeofRateTable, len(rtab))
+	// 8 bytes at 1MB/s take 8us, i.e. 125 ticks of 64ns
+	assert.Equal(t, uint32(125), binary.NativeEndian.Uint32(rtab[0:4]))
+	assert.Equal(t, uint32(125*256), binary.NativeEndian.Uint32(rtab[255*4:]))
+}
+
+func TestParseLink_Stats(t *testing.T) {
+	// == arrange ==
+	stats := make([]byte, 24*8)
+	for i := 0; i < 8; i++ {
+		binary.NativeEndian.PutUint64(stats[i*8:], uint64(i+1))
+	}
+	msg := newIfInfomsg(unix.AF_UNSPEC, 2)
+	msg = append(msg, encodeAttr(unix.IFLA_IFNAME, zeroTerminated("eth0"))...)
+	msg = append(msg, encodeAttr(unix.IFLA_STATS64, stats)...)
+
+	// == act ==
+	link := parseLink(msg)
+
+	// == assert ==
+	assert.Equal(t, 2, link.Index)
+	assert.Equal(t, "eth0", link.Name)
+	assert.Equal(t, &LinkStats{
+		RxPackets: 1, TxPackets: 2, RxBytes: 3, TxBytes: 4,
+		RxErrors: 5, TxErrors: 6, RxDropped: 7, TxDropped: 8,
+	}, link.Stats)
+}
@@ -0,0 +1,69 @@
+package netlink
+
+import (
+	"fmt"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// RunInNetns runs fn with a Handle that operates inside the network
+// namespace at nsPath (e.g. /proc/<pid>/ns/net).
+//
+// The namespace is entered from a dedicated goroutine locked to its OS
+// thread, so the rest of the process never observes the switch. The
+// thread is switched back to its original namespace afterwards; if that
+// fails the thread is left locked so that the runtime discards it instead
+// of reusing it in the wrong namespace.
+func RunInNetns(nsPath string, fn func(h *Handle) error) error {
+	errCh := make(chan error, 1)
+
+	go func() {
+		runtime.LockOSThread()
+
+		restored, err := runInNetns(nsPath, fn)
+		if restored {
+			runtime.UnlockOSThread()
+		}
+		errCh <- err
+	}()
+
+	return <-errCh
+}
+
+func runInNetns(nsPath string, fn func(h *Handle) error) (restored bool, err error) {
+	// keep a reference to the namespace of this thread
+	origNs, err := unix.Open("/proc/thread-self/ns/net", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return true, fmt.Errorf("open current netns: %w", err)
+	}
+	defer unix.Close(origNs)
+
+	targetNs, err := unix.Open(nsPath, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return true, fmt.Errorf("open netns %s: %w", nsPath, err)
+	}
+	defer unix.Close(targetNs)
+
+	if err := unix.Setns(targetNs, unix.CLONE_NEWNET); err != nil {
+		return true, fmt.Errorf("enter netns %s: %w", nsPath, err)
+	}
+	defer func() {
+		if restoreErr := unix.Setns(origNs, unix.CLONE_NEWNET); restoreErr != nil {
+			restored = false
+			if err == nil {
+				err = fmt.Errorf("restore netns: %w", restoreErr)
+			}
+			return
+		}
+		restored = true
+	}()
+
+	h, err := NewHandle()
+	if err != nil {
+		return false, err
+	}
+	defer h.Close()
+
+	return false, fn(h)
+}
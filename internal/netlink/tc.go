@@ -0,0 +1,335 @@
+package netlink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Traffic control constants from linux/pkt_sched.h, linux/pkt_cls.h and
+// linux/rtnetlink.h that are not exported by x/sys/unix.
+const (
+	tcHandleIngress = 0xfffffff1
+	// ingressHandle is ffff:, the handle of the ingress qdisc and the
+	// parent of its filters
+	ingressHandle = 0xffff0000
+
+	tcaTbfParms  = 1
+	tcaTbfRate64 = 4
+	tcaTbfBurst  = 6
+
+	tcaMatchallAct = 2
+	tcaActKind     = 1
+	tcaActOptions  = 2
+
+	tcaPoliceTbf    = 1
+	tcaPoliceRate   = 2
+	tcaPoliceRate64 = 8
+
+	tcActShot           = 2
+	tcLinklayerEthernet = 1
+
+	// sizes of struct tcmsg, tc_ratespec, tc_tbf_qopt and tc_police
+	sizeofTcMsg      = 20
+	sizeofRateSpec   = 12
+	sizeofTbfQopt    = 2*sizeofRateSpec + 12
+	sizeofTcPolice   = 5*4 + 2*sizeofRateSpec + 3*4
+	sizeofRateTable  = 256 * 4
+	rateTableMTU     = 2047
+	pschedTicksPerUs = 1000.0 / 64
+)
+
+// HandleRoot is the parent of the root qdisc of a link.
+const HandleRoot uint32 = 0xffffffff
+
+// Qdisc describes a queueing discipline of a link.
+type Qdisc struct {
+	Kind   string
+	Handle uint32
+	Parent uint32
+	// Rate is the rate of a tbf qdisc in bytes per second, or 0.
+	Rate uint64
+}
+
+// Filter describes a traffic control filter of a link.
+type Filter struct {
+	Kind string
+	// PoliceRate is the rate of the police action of a matchall filter
+	// in bytes per second, or 0.
+	PoliceRate uint64
+}
+
+// SetTbfQdisc replaces the root qdisc of the link with a token bucket
+// filter shaping the traffic sent on the link to rate bytes per second.
+// burst is the size of the bucket in bytes, and packets wait in the queue
+// for at most latency.
+func (h *Handle) SetTbfQdisc(index int, rate uint64, burst uint32, latency time.Duration) error {
+	if rate == 0 || burst == 0 {
+		return fmt.Errorf("tbf requires a rate and a burst")
+	}
+	limit := uint64(burst) + rate*uint64(latency)/uint64(time.Second)
+
+	// struct tc_tbf_qopt
+	qopt := make([]byte, sizeofTbfQopt)
+	putRateSpec(qopt[0:sizeofRateSpec], rate, 0)
+	binary.NativeEndian.PutUint32(qopt[2*sizeofRateSpec:], uint32(min(limit, math.MaxUint32)))
+
+	options := encodeAttr(tcaTbfParms, qopt)
+	if rate > math.MaxUint32 {
+		options = append(options, encodeAttr(tcaTbfRate64, uint64Bytes(rate))...)
+	}
+	options = append(options, encodeAttr(tcaTbfBurst, uint32Bytes(burst))...)
+
+	msg := newTcMsg(index, 0, HandleRoot, 0)
+	msg = append(msg, encodeAttr(unix.TCA_KIND, zeroTerminated("tbf"))...)
+	msg = append(msg, encodeNestedAttr(unix.TCA_OPTIONS, options)...)
+
+	_, err := h.request(unix.RTM_NEWQDISC, unix.NLM_F_CREATE|unix.NLM_F_REPLACE, msg)
+	return err
+}
+
+// SetIngressPolice adds the ingress qdisc to the link and a matchall
+// filter dropping the traffic received on the link above rate bytes per
+// second. burst is the size of the bucket in bytes; it should hold the
+// largest (GRO) packet received on the link.
+func (h *Handle) SetIngressPolice(index int, rate uint64, burst uint32) error {
+	if rate == 0 || burst == 0 {
+		return fmt.Errorf("police requires a rate and a burst")
+	}
+
+	// 1. ingress qdisc
+	msg := newTcMsg(index, ingressHandle, tcHandleIngress, 0)
+	msg = append(msg, encodeAttr(unix.TCA_KIND, zeroTerminated("ingress"))...)
+	if _, err := h.request(unix.RTM_NEWQDISC, unix.NLM_F_CREATE|unix.NLM_F_EXCL, msg); err != nil {
+		return fmt.Errorf("add ingress qdisc: %w", err)
+	}
+
+	// 2. matchall filter with a police action
+	if _, err := h.request(unix.RTM_NEWTFILTER, unix.NLM_F_CREATE|unix.NLM_F_EXCL, encodePoliceFilter(index, rate, burst)); err != nil {
+		return fmt.Errorf("add police filter: %w", err)
+	}
+	return nil
+}
+
+// QdiscList returns the qdiscs of the link.
+func (h *Handle) QdiscList(index int) ([]Qdisc, error) {
+	replies, err := h.request(unix.RTM_GETQDISC, unix.NLM_F_DUMP, newTcMsg(0, 0, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	var qdiscs []Qdisc
+	for _, reply := range replies {
+		if reply.Header.Type != unix.RTM_NEWQDISC || len(reply.Data) < sizeofTcMsg {
+			continue
+		}
+		if int(int32(binary.NativeEndian.Uint32(reply.Data[4:8]))) != index {
+			continue
+		}
+		qdisc := Qdisc{
+			Handle: binary.NativeEndian.Uint32(reply.Data[8:12]),
+			Parent: binary.NativeEndian.Uint32(reply.Data[12:16]),
+		}
+		var options []byte
+		for _, a := range parseAttrs(reply.Data[sizeofTcMsg:]) {
+			switch a.attrType {
+			case unix.TCA_KIND:
+				qdisc.Kind = strings.TrimRight(string(a.data), "\x00")
+			case unix.TCA_OPTIONS:
+				options = a.data
+			}
+		}
+		if qdisc.Kind == "tbf" {
+			qdisc.Rate = parseTbfRate(options)
+		}
+		qdiscs = append(qdiscs, qdisc)
+	}
+	return qdiscs, nil
+}
+
+// IngressFilterList returns the filters of the ingress qdisc of the link.
+func (h *Handle) IngressFilterList(index int) ([]Filter, error) {
+	replies, err := h.request(unix.RTM_GETTFILTER, unix.NLM_F_DUMP, newTcMsg(index, 0, ingressHandle, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	var filters []Filter
+	for _, reply := range replies {
+		if reply.Header.Type != unix.RTM_NEWTFILTER || len(reply.Data) < sizeofTcMsg {
+			continue
+		}
+		var filter Filter
+		var options []byte
+		for _, a := range parseAttrs(reply.Data[sizeofTcMsg:]) {
+			switch a.attrType {
+			case unix.TCA_KIND:
+				filter.Kind = strings.TrimRight(string(a.data), "\x00")
+			case unix.TCA_OPTIONS:
+				options = a.data
+			}
+		}
+		// the kernel also dumps the chain head of each priority, which
+		// has no options
+		if options == nil {
+			continue
+		}
+		if filter.Kind == "matchall" {
+			filter.PoliceRate = parseMatchallPoliceRate(options)
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// encodePoliceFilter returns the RTM_NEWTFILTER request of a matchall
+// filter of the ingress qdisc with a police action.
+func encodePoliceFilter(index int, rate uint64, burst uint32) []byte {
+	// struct tc_police
+	//   conforming packets are passed, exceeding ones dropped. The mtu is
+	//   not limited, since the burst is what bounds the packet size.
+	cellLog, rtab := rateTable(rate)
+	police := make([]byte, sizeofTcPolice)
+	binary.NativeEndian.PutUint32(police[4:8], tcActShot)
+	binary.NativeEndian.PutUint32(police[12:16], uint32(min(transmitTicks(rate, uint64(burst)), math.MaxUint32)))
+	binary.NativeEndian.PutUint32(police[16:20], math.MaxUint32)
+	putRateSpec(police[20:20+sizeofRateSpec], rate, cellLog)
+
+	policeOptions := encodeAttr(tcaPoliceTbf, police)
+	policeOptions = append(policeOptions, encodeAttr(tcaPoliceRate, rtab)...)
+	if rate > math.MaxUint32 {
+		policeOptions = append(policeOptions, encodeAttr(tcaPoliceRate64, uint64Bytes(rate))...)
+	}
+	action := encodeAttr(tcaActKind, zeroTerminated("police"))
+	action = append(action, encodeNestedAttr(tcaActOptions, policeOptions)...)
+	// actions are listed by their order, starting at 1
+	matchall := encodeNestedAttr(tcaMatchallAct, encodeNestedAttr(1, action))
+
+	// tcm_info holds the priority and the protocol in network order
+	info := uint32(1)<<16 | uint32(htons(unix.ETH_P_ALL))
+	msg := newTcMsg(index, 0, ingressHandle, info)
+	msg = append(msg, encodeAttr(unix.TCA_KIND, zeroTerminated("matchall"))...)
+	msg = append(msg, encodeNestedAttr(unix.TCA_OPTIONS, matchall)...)
+	return msg
+}
+
+// parseTbfRate returns the rate in the options of a tbf qdisc.
+func parseTbfRate(options []byte) uint64 {
+	var rate uint64
+	for _, a := range parseAttrs(options) {
+		switch a.attrType {
+		case tcaTbfParms:
+			if len(a.data) >= sizeofRateSpec && rate == 0 {
+				rate = uint64(binary.NativeEndian.Uint32(a.data[8:12]))
+			}
+		case tcaTbfRate64:
+			if len(a.data) >= 8 {
+				rate = binary.NativeEndian.Uint64(a.data)
+			}
+		}
+	}
+	return rate
+}
+
+// parseMatchallPoliceRate returns the rate of the police action in the
+// options of a matchall filter.
+func parseMatchallPoliceRate(options []byte) uint64 {
+	var rate uint64
+	for _, a := range parseAttrs(options) {
+		if a.attrType != tcaMatchallAct {
+			continue
+		}
+		for _, action := range parseAttrs(a.data) {
+			var kind string
+			var policeOptions []byte
+			for _, attr := range parseAttrs(action.data) {
+				switch attr.attrType {
+				case tcaActKind:
+					kind = strings.TrimRight(string(attr.data), "\x00")
+				case tcaActOptions:
+					policeOptions = attr.data
+				}
+			}
+			if kind != "police" {
+				continue
+			}
+			for _, attr := range parseAttrs(policeOptions) {
+				switch attr.attrType {
+				case tcaPoliceTbf:
+					if len(attr.data) >= 20+sizeofRateSpec && rate == 0 {
+						rate = uint64(binary.NativeEndian.Uint32(attr.data[28:32]))
+					}
+				case tcaPoliceRate64:
+					if len(attr.data) >= 8 {
+						rate = binary.NativeEndian.Uint64(attr.data)
+					}
+				}
+			}
+		}
+	}
+	return rate
+}
+
+// newTcMsg returns a struct tcmsg.
+func newTcMsg(index int, handle uint32, parent uint32, info uint32) []byte {
+	msg := make([]byte, sizeofTcMsg)
+	msg[0] = unix.AF_UNSPEC
+	binary.NativeEndian.PutUint32(msg[4:8], uint32(int32(index)))
+	binary.NativeEndian.PutUint32(msg[8:12], handle)
+	binary.NativeEndian.PutUint32(msg[12:16], parent)
+	binary.NativeEndian.PutUint32(msg[16:20], info)
+	return msg
+}
+
+// putRateSpec writes a struct tc_ratespec. The link layer is set to
+// ethernet, so the kernel does not need a rate table to detect it; a
+// rate beyond 32 bits is saturated and sent in a separate attribute.
+// cellLog is that of the rate table sent along, if any.
+func putRateSpec(b []byte, rate uint64, cellLog uint8) {
+	b[0] = cellLog
+	b[1] = tcLinklayerEthernet
+	if cellLog != 0 {
+		// cell_align -1, as set by tc
+		binary.NativeEndian.PutUint16(b[4:6], 0xffff)
+	}
+	binary.NativeEndian.PutUint32(b[8:12], uint32(min(rate, math.MaxUint32)))
+}
+
+// rateTable computes the rate table of the police action like tc does:
+// the transmit time in ticks of packets of each size cell, with the cell
+// size chosen so that 256 cells cover an ethernet frame.
+func rateTable(rate uint64) (uint8, []byte) {
+	var cellLog uint8
+	for (rateTableMTU >> cellLog) > 255 {
+		cellLog++
+	}
+	rtab := make([]byte, sizeofRateTable)
+	for i := 0; i < 256; i++ {
+		size := uint64(i+1) << cellLog
+		binary.NativeEndian.PutUint32(rtab[i*4:], uint32(min(transmitTicks(rate, size), math.MaxUint32)))
+	}
+	return cellLog, rtab
+}
+
+// transmitTicks returns the time needed to send size bytes at rate bytes
+// per second, in scheduler ticks of 64ns.
+func transmitTicks(rate uint64, size uint64) uint64 {
+	return uint64(float64(size) / float64(rate) * 1e6 * pschedTicksPerUs)
+}
+
+func uint64Bytes(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.NativeEndian.PutUint64(b, v)
+	return b
+}
+
+// htons converts a 16 bit value to network byte order.
+func htons(v uint16) uint16 {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return binary.NativeEndian.Uint16(b)
+}
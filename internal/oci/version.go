@@ -2,5 +2,5 @@ package oci
 
 var (
 	OCIVersion        = "1.3.0"
-	AnnotationVersion = "0.1.0"
+	AnnotationVersion = "0.2.0"
 )
@@ -0,0 +1,83 @@
+package spec
+
+import (
+	"droplet/internal/utils"
+	"fmt"
+)
+
+// netConfigV1 is the io.raind.net.config annotation of version 0.1.0,
+// which describes a single interface renamed to eth0.
+type netConfigV1 struct {
+	HostInterface   string `json:"hostInterface"`
+	BridgeInterface string `json:"bridgeInterface"`
+	Interface       struct {
+		Name   string        `json:"name"`
+		IPv4   IPv4Object    `json:"ipv4"`
+		IPv6   *IPv6Object   `json:"ipv6,omitempty"`
+		Routes []RouteObject `json:"routes,omitempty"`
+		Dns    DnsObject     `json:"dns"`
+	} `json:"interface"`
+}
+
+// ParseNetConfig decodes the io.raind.net.config annotation according to
+// the annotation version of the spec.
+//
+// Specs without a version are treated as 0.1.0. The layout changes only
+// with the minor version; fields added within a minor version are
+// optional, and an annotation without them keeps the previous behavior.
+// An empty annotation yields an empty NetConfigObject.
+func ParseNetConfig(annotation AnnotationObject) (NetConfigObject, error) {
+	if annotation.Net == "" {
+		return NetConfigObject{}, nil
+	}
+
+	switch annotation.Version {
+	case "", "0.1.0":
+		var v1 netConfigV1
+		if err := utils.StringToJson(annotation.Net, &v1); err != nil {
+			return NetConfigObject{}, err
+		}
+		netConfig := NetConfigObject{
+			Dns: v1.Interface.Dns,
+		}
+		if v1.Interface.Name != "" {
+			netConfig.Interfaces = []InterfaceObject{
+				{
+					Name:               v1.Interface.Name,
+					HostInterface:      v1.HostInterface,
+					BridgeInterface:    v1.BridgeInterface,
+					ContainerInterface: "eth0",
+					IPv4:               v1.Interface.IPv4,
+					IPv6:               v1.Interface.IPv6,
+					Routes:             v1.Interface.Routes,
+				},
+			}
+		}
+		return netConfig, nil
+	case "0.2.0":
+		var netConfig NetConfigObject
+		if err := utils.StringToJson(annotation.Net, &netConfig); err != nil {
+			return NetConfigObject{}, err
+		}
+		return netConfig, nil
+	default:
+		return NetConfigObject{}, fmt.Errorf("unsupported annotation version: %s", annotation.Version)
+	}
+}
+
+// EncodeNetConfig writes netConfig back to the io.raind.net.config
+// annotation, e.g. after addresses have been allocated. Annotations
+// before version 0.2.0 use a different layout and cannot be written.
+func EncodeNetConfig(annotation *AnnotationObject, netConfig NetConfigObject) error {
+	switch annotation.Version {
+	case "0.2.0":
+	default:
+		return fmt.Errorf("net annotation version %q cannot be rewritten", annotation.Version)
+	}
+	net, err := utils.JsonToString(netConfig)
+	if err != nil {
+		return err
+	}
+	annotation.Net = net
+	return nil
+}
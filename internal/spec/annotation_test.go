@@ -0,0 +1,79 @@
+package spec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNetConfig_V1(t *testing.T) {
+	// == arrange ==
+	annotation := AnnotationObject{
+		Version: "0.1.0",
+		Net:     `{"hostInterface":"eth0","bridgeInterface":"raind_br0","interface":{"name":"rd_01","ipv4":{"address":"10.166.0.2/24","gateway":"10.166.0.254"},"dns":{"servers":["8.8.8.8"]}}}`,
+	}
+
+	// == act ==
+	netConfig, err := ParseNetConfig(annotation)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []InterfaceObject{
+		{
+			Name:               "rd_01",
+			HostInterface:      "eth0",
+			BridgeInterface:    "raind_br0",
+			ContainerInterface: "eth0",
+			IPv4:               IPv4Object{Address: "10.166.0.2/24", Gateway: "10.166.0.254"},
+		},
+	}, netConfig.Interfaces)
+	assert.Equal(t, []string{"8.8.8.8"}, netConfig.Dns.Servers)
+}
+
+func TestParseNetConfig_V1Routes(t *testing.T) {
+	// == arrange ==
+	annotation := AnnotationObject{
+		Version: "0.1.0",
+		Net:     `{"interface":{"name":"rd_01","ipv6":{"address":"fd00::2/64","gateway":"fd00::1","disableDad":true},"routes":[{"destination":"10.10.0.0/16","gateway":"10.166.0.253"}]}}`,
+	}
+
+	// == act ==
+	netConfig, err := ParseNetConfig(annotation)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, &IPv6Object{Address: "fd00::2/64", Gateway: "fd00::1", DisableDAD: true}, netConfig.Interfaces[0].IPv6)
+	assert.Equal(t, []RouteObject{{Destination: "10.10.0.0/16", Gateway: "10.166.0.253"}}, netConfig.Interfaces[0].Routes)
+}
+
+func TestParseNetConfig_V2(t *testing.T) {
+	// == arrange ==
+	annotation := AnnotationObject{
+		Version: "0.2.0",
+		Net:     `{"interfaces":[{"name":"rd_data","hostInterface":"eth0","bridgeInterface":"raind_data","containerInterface":"eth0","mtu":9000,"ipv4":{"address":"10.166.0.2/24","gateway":"10.166.0.254"}},{"name":"rd_mgmt","hostInterface":"eth1","bridgeInterface":"raind_mgmt","containerInterface":"eth1","mac":"02:42:ac:11:00:02","ipv4":{"address":"192.168.100.2/24","gateway":""}}],"dns":{"servers":["8.8.8.8"]}}`,
+	}
+
+	// == act ==
+	netConfig, err := ParseNetConfig(annotation)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(netConfig.Interfaces))
+	assert.Equal(t, 9000, netConfig.Interfaces[0].Mtu)
+	assert.Equal(t, "raind_mgmt", netConfig.Interfaces[1].BridgeInterface)
+	assert.Equal(t, "02:42:ac:11:00:02", netConfig.Interfaces[1].Mac)
+}
+
+func TestParseNetConfig_UnsupportedVersion(t *testing.T) {
+	// == arrange ==
+	annotation := AnnotationObject{
+		Version: "9.0.0",
+		Net:     `{}`,
+	}
+
+	// == act ==
+	_, err := ParseNetConfig(annotation)
+
+	// == assert ==
+	assert.EqualError(t, err, "unsupported annotation version: 9.0.0")
+}
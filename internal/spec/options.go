@@ -7,19 +7,83 @@ type MountOption struct {
 	Options     []string
 }
 
+type UserOption struct {
+	Uid            uint32
+	Gid            uint32
+	Username       string
+	Groupname      string
+	AdditionalGids []uint32
+	Umask          *uint32
+}
+
+type RlimitOption struct {
+	Type string
+	Hard uint64
+	Soft uint64
+}
+
 type ProcessOption struct {
-	Cwd  string
-	Env  []string
-	Args []string
+	Cwd             string
+	Env             []string
+	Args            []string
+	User            UserOption
+	Rlimits         []RlimitOption
+	OOMScoreAdj     *int
+	NoNewPrivileges bool
 }
 
 type NetOption struct {
-	HostInterface       string
-	BridgeInterfaceName string
-	InterfaceName       string
-	Address             string
-	Gateway             string
-	Dns                 []string
+	Mode       string
+	Interfaces []NetInterfaceOption
+	Dns        []string
+	DnsSearch  []string
+	DnsOptions []string
+	ExtraHosts []HostOption
+	SkipFiles  []string
+	// CniNetwork selects the cni backend with the named conflist
+	CniNetwork string
+	CniIfName  string
+	Ports      []PortOption
+	// Policy is read from a JSON document as is
+	Policy *PolicyObject
+}
+
+type NetInterfaceOption struct {
+	HostInterface          string
+	BridgeInterfaceName    string
+	InterfaceName          string
+	ContainerInterfaceName string
+	Mac                    string
+	HostMac                string
+	Mtu                    int
+	IngressRate            uint64
+	IngressBurst           uint64
+	EgressRate             uint64
+	EgressBurst            uint64
+	Address                string
+	Gateway                string
+	Address6               string
+	Gateway6               string
+	DisableDAD6            bool
+	Routes                 []RouteOption
+}
+
+type PortOption struct {
+	HostIP        string
+	HostPort      int
+	ContainerPort int
+	Protocol      string
+	Range         int
+}
+
+type HostOption struct {
+	Hostname string
+	Address  string
+}
+
+type RouteOption struct {
+	Destination string
+	Gateway     string
 }
 
 type ImageOption struct {
@@ -45,13 +109,33 @@ type HookLifecycleOption struct {
 	Poststop        []HookOption
 }
 
+type NamespaceOption struct {
+	Type string
+	Path string
+}
+
+type IDMappingOption struct {
+	ContainerID uint32
+	HostID      uint32
+	Size        uint32
+}
+
+type TimeOffsetOption struct {
+	Clock    string
+	Secs     int64
+	Nanosecs uint32
+}
+
 type ConfigOptions struct {
-	Rootfs    string
-	Mounts    []MountOption
-	Process   ProcessOption
-	Namespace []string
-	Hostname  string
-	Net       NetOption
-	Image     ImageOption
-	Hooks     HookLifecycleOption
+	Rootfs      string
+	Mounts      []MountOption
+	Process     ProcessOption
+	Namespace   []NamespaceOption
+	UIDMaps     []IDMappingOption
+	GIDMaps     []IDMappingOption
+	TimeOffsets []TimeOffsetOption
+	Hostname    string
+	Net         NetOption
+	Image       ImageOption
+	Hooks       HookLifecycleOption
 }
@@ -19,29 +19,104 @@ type CapabilityObject struct {
 	Ambient     []string `json:"ambient"`
 }
 
+// UserObject is the OCI process.user object.
+//
+// Username and Groupname are droplet extensions, not part of the OCI
+// runtime spec for Linux: when set, they are resolved through /etc/passwd
+// and /etc/group of the container and take precedence over Uid and Gid.
+type UserObject struct {
+	Uid            uint32   `json:"uid"`
+	Gid            uint32   `json:"gid"`
+	Umask          *uint32  `json:"umask,omitempty"`
+	AdditionalGids []uint32 `json:"additionalGids,omitempty"`
+	Username       string   `json:"username,omitempty"`
+	Groupname      string   `json:"groupname,omitempty"`
+}
+
+type RlimitObject struct {
+	Type string `json:"type"`
+	Hard uint64 `json:"hard"`
+	Soft uint64 `json:"soft"`
+}
+
 type ProcessObject struct {
-	Cwd          string           `json:"cwd"`
-	Env          []string         `json:"env"`
-	Args         []string         `json:"args"`
-	Capabilities CapabilityObject `json:"capabilities"`
+	Cwd             string           `json:"cwd"`
+	Env             []string         `json:"env"`
+	Args            []string         `json:"args"`
+	User            UserObject       `json:"user"`
+	Capabilities    CapabilityObject `json:"capabilities"`
+	Rlimits         []RlimitObject   `json:"rlimits,omitempty"`
+	OOMScoreAdj     *int             `json:"oomScoreAdj,omitempty"`
+	NoNewPrivileges bool             `json:"noNewPrivileges,omitempty"`
 }
 
 type MemoryObject struct {
-	Limit int `json:"limit"`
+	Limit       *int64 `json:"limit,omitempty"`
+	Reservation *int64 `json:"reservation,omitempty"`
+	Swap        *int64 `json:"swap,omitempty"`
 }
 
 type CpuObject struct {
-	Period int `json:"period"`
-	Quota  int `json:"quota"`
+	Shares *uint64 `json:"shares,omitempty"`
+	Quota  *int64  `json:"quota,omitempty"`
+	Period *uint64 `json:"period,omitempty"`
+	Cpus   *string `json:"cpus,omitempty"`
+	Mems   *string `json:"mems,omitempty"`
+}
+
+type PidsObject struct {
+	Limit int64 `json:"limit"`
+}
+
+type WeightDeviceObject struct {
+	Major  int64   `json:"major"`
+	Minor  int64   `json:"minor"`
+	Weight *uint16 `json:"weight,omitempty"`
+}
+
+type ThrottleDeviceObject struct {
+	Major int64  `json:"major"`
+	Minor int64  `json:"minor"`
+	Rate  uint64 `json:"rate"`
+}
+
+type BlockIOObject struct {
+	Weight                  *uint16                `json:"weight,omitempty"`
+	WeightDevice            []WeightDeviceObject   `json:"weightDevice,omitempty"`
+	ThrottleReadBpsDevice   []ThrottleDeviceObject `json:"throttleReadBpsDevice,omitempty"`
+	ThrottleWriteBpsDevice  []ThrottleDeviceObject `json:"throttleWriteBpsDevice,omitempty"`
+	ThrottleReadIOPSDevice  []ThrottleDeviceObject `json:"throttleReadIOPSDevice,omitempty"`
+	ThrottleWriteIOPSDevice []ThrottleDeviceObject `json:"throttleWriteIOPSDevice,omitempty"`
+}
+
+type HugepageLimitObject struct {
+	PageSize string `json:"pageSize"`
+	Limit    uint64 `json:"limit"`
 }
 
 type ResourceObject struct {
-	Memory MemoryObject `json:"memory"`
-	Cpu    CpuObject    `json:"cpu"`
+	Memory         MemoryObject          `json:"memory"`
+	Cpu            CpuObject             `json:"cpu"`
+	Pids           *PidsObject           `json:"pids,omitempty"`
+	BlockIO        *BlockIOObject        `json:"blockIO,omitempty"`
+	HugepageLimits []HugepageLimitObject `json:"hugepageLimits,omitempty"`
+	Unified        map[string]string     `json:"unified,omitempty"`
+}
+
+type IDMappingObject struct {
+	ContainerID uint32 `json:"containerID"`
+	HostID      uint32 `json:"hostID"`
+	Size        uint32 `json:"size"`
 }
 
 type NamespaceObject struct {
 	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+}
+
+type TimeOffsetObject struct {
+	Secs     int64  `json:"secs"`
+	Nanosecs uint32 `json:"nanosecs"`
 }
 
 type SeccompArgObject struct {
@@ -76,10 +151,14 @@ type SeccompObject struct {
 }
 
 type LinuxSpecObject struct {
-	Resources       ResourceObject    `json:"resources"`
-	Namespaces      []NamespaceObject `json:"namespaces"`
-	Seccomp         *SeccompObject    `json:"seccomp,omitempty"`
-	AppArmorProfile string            `json:"apparmorProfile,omitempty"`
+	Resources       ResourceObject              `json:"resources"`
+	Namespaces      []NamespaceObject           `json:"namespaces"`
+	UIDMappings     []IDMappingObject           `json:"uidMappings,omitempty"`
+	GIDMappings     []IDMappingObject           `json:"gidMappings,omitempty"`
+	TimeOffsets     map[string]TimeOffsetObject `json:"timeOffsets,omitempty"`
+	CgroupsPath     string                      `json:"cgroupsPath,omitempty"`
+	Seccomp         *SeccompObject              `json:"seccomp,omitempty"`
+	AppArmorProfile string                      `json:"apparmorProfile,omitempty"`
 }
 
 type AnnotationObject struct {
@@ -122,20 +201,154 @@ type IPv4Object struct {
 	Gateway string `json:"gateway"`
 }
 
+// IPv6Object is available from annotation version 0.2.0.
+type IPv6Object struct {
+	Address string `json:"address"`
+	Gateway string `json:"gateway,omitempty"`
+	// DisableDAD skips duplicate address detection so that the address
+	// is usable as soon as the interface is up.
+	DisableDAD bool `json:"disableDad,omitempty"`
+}
+
+// RouteObject is a static route through the interface. A route without
+// gateway is directly connected. Available from annotation version 0.2.0.
+type RouteObject struct {
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway,omitempty"`
+}
+
+// DnsObject is written to /etc/resolv.conf of the container.
 type DnsObject struct {
 	Servers []string `json:"servers"`
+	Search  []string `json:"search,omitempty"`
+	Options []string `json:"options,omitempty"`
 }
 
+// HostObject is an extra entry of /etc/hosts of the container.
+type HostObject struct {
+	Hostname string `json:"hostname"`
+	Address  string `json:"address"`
+}
+
+// NetworkFilesObject is the content of the generated /etc files changed
+// by update. A nil field leaves the value of the annotation in effect.
+type NetworkFilesObject struct {
+	Dns        *DnsObject   `json:"dns,omitempty"`
+	ExtraHosts []HostObject `json:"extraHosts,omitempty"`
+}
+
+// InterfaceObject describes one veth pair of the container.
+//
+//	name               = host side veth, attached to bridgeInterface
+//	hostInterface      = peer created in the container netns
+//	containerInterface = name the peer is renamed to (e.g. eth0)
+//	mac, hostMac       = MAC address of the container and host side, or
+//	                     auto to derive a stable one from the link name
+//	mtu                = MTU of both sides
+//	ingressRate        = rate limit of the traffic to the container in
+//	                     bits per second
+//	egressRate         = rate limit of the traffic from the container in
+//	                     bits per second
+//	ingressBurst,
+//	egressBurst        = bucket size of the rate limits in bytes
 type InterfaceObject struct {
-	Name string     `json:"name"`
-	IPv4 IPv4Object `json:"ipv4"`
-	Dns  DnsObject  `json:"dns"`
+	Name               string        `json:"name"`
+	HostInterface      string        `json:"hostInterface"`
+	BridgeInterface    string        `json:"bridgeInterface"`
+	ContainerInterface string        `json:"containerInterface"`
+	Mac                string        `json:"mac,omitempty"`
+	HostMac            string        `json:"hostMac,omitempty"`
+	Mtu                int           `json:"mtu,omitempty"`
+	IngressRate        uint64        `json:"ingressRate,omitempty"`
+	IngressBurst       uint64        `json:"ingressBurst,omitempty"`
+	EgressRate         uint64        `json:"egressRate,omitempty"`
+	EgressBurst        uint64        `json:"egressBurst,omitempty"`
+	IPv4               IPv4Object    `json:"ipv4"`
+	IPv6               *IPv6Object   `json:"ipv6,omitempty"`
+	Routes             []RouteObject `json:"routes,omitempty"`
+}
+
+// CniObject selects the CNI network configuration list of a container.
+//
+//	network = name of the conflist in the CNI configuration directory
+//	ifName  = interface created in the container netns (default eth0)
+type CniObject struct {
+	Network string `json:"network"`
+	IfName  string `json:"ifName,omitempty"`
+}
+
+// PortObject publishes a port of the container on the host.
+//
+//	hostIP        = host address the port is published on (default: all)
+//	hostPort      = first published host port
+//	containerPort = first container port
+//	protocol      = tcp (default) or udp
+//	range         = number of consecutive ports published (default 1)
+type PortObject struct {
+	HostIP        string `json:"hostIP,omitempty"`
+	HostPort      int    `json:"hostPort"`
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol,omitempty"`
+	Range         int    `json:"range,omitempty"`
+}
+
+// PolicyObject is the firewall policy of a container. Ingress is the
+// traffic to the container and egress the traffic from it. A direction
+// left nil is not filtered.
+type PolicyObject struct {
+	Ingress *PolicyDirectionObject `json:"ingress,omitempty"`
+	Egress  *PolicyDirectionObject `json:"egress,omitempty"`
+}
+
+// PolicyDirectionObject is the policy of one direction.
+//
+//	default = allow (default) or deny, for traffic no rule allows
+//	allow   = rules of the traffic allowed
+type PolicyDirectionObject struct {
+	Default string             `json:"default,omitempty"`
+	Allow   []PolicyRuleObject `json:"allow,omitempty"`
+}
+
+// PolicyRuleObject matches traffic by peer and destination port.
+//
+//	cidr     = peer network: the destination of egress traffic or the
+//	           source of ingress traffic (default: any)
+//	protocol = tcp or udp (default: any)
+//	port     = first destination port; requires a protocol
+//	endPort  = last destination port of a range (default: port)
+type PolicyRuleObject struct {
+	Cidr     string `json:"cidr,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	EndPort  int    `json:"endPort,omitempty"`
 }
 
+// NetConfigObject is the io.raind.net.config annotation.
+//
+// Mode is one of none, host, bridge or container:<id>. Interfaces are
+// only used in bridge mode.
+//
+// Backend selects how bridge mode is set up: the built-in veth setup
+// ("" or builtin) or the CNI plugins of Cni (cni).
+//
+// ExtraHosts are added to /etc/hosts of the container and SkipFiles lists
+// the files of resolv.conf, hosts and hostname that are not generated, so
+// that the file of the image is used.
+//
+// Ports are published in bridge mode. Policy filters the traffic of the
+// interfaces of a bridge mode container with the builtin backend.
+//
+// All fields are optional.
 type NetConfigObject struct {
-	HostInterface   string          `json:"hostInterface"`
-	BridgeInterface string          `json:"bridgeInterface"`
-	Interface       InterfaceObject `json:"interface"`
+	Mode       string            `json:"mode,omitempty"`
+	Backend    string            `json:"backend,omitempty"`
+	Cni        *CniObject        `json:"cni,omitempty"`
+	Interfaces []InterfaceObject `json:"interfaces"`
+	Dns        DnsObject         `json:"dns"`
+	ExtraHosts []HostObject      `json:"extraHosts,omitempty"`
+	SkipFiles  []string          `json:"skipFiles,omitempty"`
+	Ports      []PortObject      `json:"ports,omitempty"`
+	Policy     *PolicyObject     `json:"policy,omitempty"`
 }
 
 // Annotation: io.raind.image.config
@@ -65,6 +65,14 @@ func buildProcessSpec(opts ConfigOptions) ProcessObject {
 		Cwd:  opts.Process.Cwd,
 		Env:  buildProcessEnvSpec(opts.Process.Env),
 		Args: opts.Process.Args,
+		User: UserObject{
+			Uid:            opts.Process.User.Uid,
+			Gid:            opts.Process.User.Gid,
+			Umask:          opts.Process.User.Umask,
+			AdditionalGids: opts.Process.User.AdditionalGids,
+			Username:       opts.Process.User.Username,
+			Groupname:      opts.Process.User.Groupname,
+		},
 		Capabilities: CapabilityObject{
 			Bounding: []string{
 				"CAP_CHOWN",
@@ -115,7 +123,22 @@ func buildProcessSpec(opts ConfigOptions) ProcessObject {
 				"CAP_AUDIT_WRITE",
 			},
 		},
+		Rlimits:         buildRlimitSpec(opts.Process.Rlimits),
+		OOMScoreAdj:     opts.Process.OOMScoreAdj,
+		NoNewPrivileges: opts.Process.NoNewPrivileges,
+	}
+}
+
+func buildRlimitSpec(rlimits []RlimitOption) []RlimitObject {
+	var rlimitObject []RlimitObject
+	for _, r := range rlimits {
+		rlimitObject = append(rlimitObject, RlimitObject{
+			Type: r.Type,
+			Hard: r.Hard,
+			Soft: r.Soft,
+		})
 	}
+	return rlimitObject
 }
 
 func buildLinuxSpec(opts ConfigOptions) LinuxSpecObject {
@@ -134,14 +157,23 @@ func buildLinuxSpec(opts ConfigOptions) LinuxSpecObject {
 		}
 	}
 
+	var (
+		memoryLimit = int64(1073741824)
+		cpuPeriod   = uint64(100000)
+		cpuQuota    = int64(80000)
+	)
+
 	var linuxSpec = LinuxSpecObject{
 		Resources: ResourceObject{
 			Memory: MemoryObject{ // memory limit: 1024MiB
-				Limit: 1073741824,
+				Limit: &memoryLimit,
 			},
 			Cpu: CpuObject{ // cpu limit: 80%
-				Period: 100000,
-				Quota:  80000,
+				Period: &cpuPeriod,
+				Quota:  &cpuQuota,
+			},
+			Pids: &PidsObject{ // pids limit: 512
+				Limit: 512,
 			},
 		},
 		Seccomp: &SeccompObject{
@@ -185,28 +217,113 @@ func buildLinuxSpec(opts ConfigOptions) LinuxSpecObject {
 
 	for _, ns := range opts.Namespace {
 		linuxSpec.Namespaces = append(linuxSpec.Namespaces, NamespaceObject{
-			Type: ns,
+			Type: ns.Type,
+			Path: ns.Path,
 		})
 	}
 
+	for _, m := range opts.UIDMaps {
+		linuxSpec.UIDMappings = append(linuxSpec.UIDMappings, IDMappingObject{
+			ContainerID: m.ContainerID,
+			HostID:      m.HostID,
+			Size:        m.Size,
+		})
+	}
+	for _, m := range opts.GIDMaps {
+		linuxSpec.GIDMappings = append(linuxSpec.GIDMappings, IDMappingObject{
+			ContainerID: m.ContainerID,
+			HostID:      m.HostID,
+			Size:        m.Size,
+		})
+	}
+
+	for _, o := range opts.TimeOffsets {
+		if linuxSpec.TimeOffsets == nil {
+			linuxSpec.TimeOffsets = map[string]TimeOffsetObject{}
+		}
+		linuxSpec.TimeOffsets[o.Clock] = TimeOffsetObject{
+			Secs:     o.Secs,
+			Nanosecs: o.Nanosecs,
+		}
+	}
+
 	return linuxSpec
 }
 
 func buildNetSpec(opts ConfigOptions) NetConfigObject {
-	return NetConfigObject{
-		HostInterface:   opts.Net.HostInterface,
-		BridgeInterface: opts.Net.BridgeInterfaceName,
-		Interface: InterfaceObject{
-			Name: opts.Net.InterfaceName,
+	interfaces := []InterfaceObject{}
+	for _, i := range opts.Net.Interfaces {
+		var ipv6 *IPv6Object
+		if i.Address6 != "" {
+			ipv6 = &IPv6Object{
+				Address:    i.Address6,
+				Gateway:    i.Gateway6,
+				DisableDAD: i.DisableDAD6,
+			}
+		}
+		var routes []RouteObject
+		for _, r := range i.Routes {
+			routes = append(routes, RouteObject{
+				Destination: r.Destination,
+				Gateway:     r.Gateway,
+			})
+		}
+
+		interfaces = append(interfaces, InterfaceObject{
+			Name:               i.InterfaceName,
+			HostInterface:      i.HostInterface,
+			BridgeInterface:    i.BridgeInterfaceName,
+			ContainerInterface: i.ContainerInterfaceName,
+			Mac:                i.Mac,
+			HostMac:            i.HostMac,
+			Mtu:                i.Mtu,
+			IngressRate:        i.IngressRate,
+			IngressBurst:       i.IngressBurst,
+			EgressRate:         i.EgressRate,
+			EgressBurst:        i.EgressBurst,
 			IPv4: IPv4Object{
-				Address: opts.Net.Address,
-				Gateway: opts.Net.Gateway,
-			},
-			Dns: DnsObject{
-				Servers: opts.Net.Dns,
+				Address: i.Address,
+				Gateway: i.Gateway,
 			},
+			IPv6:   ipv6,
+			Routes: routes,
+		})
+	}
+
+	netConfig := NetConfigObject{
+		Mode:       opts.Net.Mode,
+		Interfaces: interfaces,
+		Dns: DnsObject{
+			Servers: opts.Net.Dns,
+			Search:  opts.Net.DnsSearch,
+			Options: opts.Net.DnsOptions,
 		},
+		SkipFiles: opts.Net.SkipFiles,
+		Policy:    opts.Net.Policy,
+	}
+	for _, h := range opts.Net.ExtraHosts {
+		netConfig.ExtraHosts = append(netConfig.ExtraHosts, HostObject{
+			Hostname: h.Hostname,
+			Address:  h.Address,
+		})
+	}
+	for _, p := range opts.Net.Ports {
+		netConfig.Ports = append(netConfig.Ports, PortObject{
+			HostIP:        p.HostIP,
+			HostPort:      p.HostPort,
+			ContainerPort: p.ContainerPort,
+			Protocol:      p.Protocol,
+			Range:         p.Range,
+		})
+	}
+	if opts.Net.CniNetwork != "" {
+		netConfig.Backend = "cni"
+		netConfig.Cni = &CniObject{
+			Network: opts.Net.CniNetwork,
+			IfName:  opts.Net.CniIfName,
+		}
 	}
+	return netConfig
 }
 
 func buildImageSpec(opts ConfigOptions) ImageConfigObject {
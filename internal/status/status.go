@@ -7,14 +7,57 @@ import (
 )
 
 type StatusObject struct {
-	OciVersion string                `json:"ociVersion"`
-	Id         string                `json:"id"`
-	Status     string                `json:"status"`
-	Pid        int                   `json:"pid"`
-	ShimPid    int                   `json:"shimPid"`
-	Rootfs     string                `json:"rootfs"`
-	Bundle     string                `json:"bundle"`
-	Annotaion  spec.AnnotationObject `json:"annotations"`
+	OciVersion    string                   `json:"ociVersion"`
+	Id            string                   `json:"id"`
+	Status        string                   `json:"status"`
+	Pid           int                      `json:"pid"`
+	ShimPid       int                      `json:"shimPid"`
+	Rootfs        string                   `json:"rootfs"`
+	Bundle        string                   `json:"bundle"`
+	UserNamespace *UserNamespaceObject     `json:"userNamespace,omitempty"`
+	Resources     *spec.ResourceObject     `json:"resources,omitempty"`
+	OOMKilled     bool                     `json:"oomKilled"`
+	OOM           *OOMObject               `json:"oom,omitempty"`
+	NetworkMode   string                   `json:"networkMode,omitempty"`
+	NetworkFiles  *spec.NetworkFilesObject `json:"networkFiles,omitempty"`
+	Interfaces    []InterfaceObject        `json:"interfaces,omitempty"`
+	Annotaion     spec.AnnotationObject    `json:"annotations"`
+}
+
+// UserNamespaceObject records the host id range allocated to the
+// container's user namespace.
+type UserNamespaceObject struct {
+	HostID uint32 `json:"hostID"`
+	Size   uint32 `json:"size"`
+}
+
+// InterfaceObject records the settings of a veth pair of the container
+// as read back from the kernel after the network setup.
+//
+//	mac, hostMac = MAC address of the container and host side
+//	mtu          = MTU of both sides
+//	ingressRate  = rate limit of the traffic to the container in bits per
+//	               second, or 0
+//	egressRate   = rate limit of the traffic from the container in bits
+//	               per second, or 0
+type InterfaceObject struct {
+	Name               string `json:"name"`
+	ContainerInterface string `json:"containerInterface"`
+	Mac                string `json:"mac"`
+	HostMac            string `json:"hostMac"`
+	Mtu                int    `json:"mtu"`
+	IngressRate        uint64 `json:"ingressRate,omitempty"`
+	EgressRate         uint64 `json:"egressRate,omitempty"`
+}
+
+// OOMObject records the OOM counters of the container's cgroup, read
+// from memory.events when the container stopped.
+//
+//	oom     = times memory.max was hit and the OOM killer was invoked
+//	oomKill = processes killed by the OOM killer
+type OOMObject struct {
+	Oom     uint64 `json:"oom"`
+	OomKill uint64 `json:"oomKill"`
 }
 
 // container status
@@ -23,6 +66,7 @@ type StatusObject struct {
 //	created  = 1
 //	running  = 2
 //	stopped  = 3
+//	paused   = 4
 type ContainerStatus int
 
 const (
@@ -30,6 +74,7 @@ const (
 	CREATED
 	RUNNING
 	STOPPED
+	PAUSED
 )
 
 func (s ContainerStatus) String() string {
@@ -42,6 +87,8 @@ func (s ContainerStatus) String() string {
 		return "running"
 	case STOPPED:
 		return "stopped"
+	case PAUSED:
+		return "paused"
 	default:
 		return "unknown"
 	}
@@ -57,6 +104,8 @@ func ParseContainerStatus(s string) (ContainerStatus, error) {
 		return RUNNING, nil
 	case "stopped":
 		return STOPPED, nil
+	case "paused":
+		return PAUSED, nil
 	default:
 		return 0, fmt.Errorf("invalid status: %q", s)
 	}
@@ -4,7 +4,12 @@ import (
 	"droplet/internal/oci"
 	"droplet/internal/spec"
 	"droplet/internal/utils"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
 	"syscall"
 )
 
@@ -19,10 +24,20 @@ type ContainerStatusManager interface {
 	RemoveStatusFile(containerId string) error
 	ReadStatusFile(containerId string) (string, error)
 	UpdateStatus(containerId string, status ContainerStatus, pid int, shimPid int) error
+	SetUserNamespace(containerId string, hostId uint32, size uint32) error
+	SetResources(containerId string, resources spec.ResourceObject) error
+	SetNetworkMode(containerId string, mode string) error
+	SetNetworkFiles(containerId string, files spec.NetworkFilesObject) error
+	SetInterfaces(containerId string, interfaces []InterfaceObject) error
+	SetOOM(containerId string, oom OOMObject) (bool, error)
+	GetResourcesFromId(containerId string) (*spec.ResourceObject, error)
+	GetNetworkFilesFromId(containerId string) (*spec.NetworkFilesObject, error)
+	GetAnnotationFromId(containerId string) (spec.AnnotationObject, error)
 	GetPidFromId(containerId string) (int, error)
 	GetStatusFromId(containerId string) (ContainerStatus, error)
 	GetShimPidFromId(containerId string) (int, error)
 	ListContainers() ([]StatusObject, error)
+	ListLeftoverCgroups() ([]string, error)
 }
 
 // NewStatusHandler constructs a StatusHandler with the default
@@ -45,8 +60,9 @@ type StatusHandler struct {
 	syscallHandler utils.KernelSyscallHandler
 }
 
-// CreateStatusFile creates or overwrites the status file (state.json)
-// for the given container ID.
+// CreateStatusFile creates the status file (state.json) for the given
+// container ID. It fails if the container already has one, so that a
+// live container is never reset.
 //
 // It populates the file with the provided PID, status, rootfs, bundle
 // path and annotations, along with the current OCI version.
@@ -64,7 +80,10 @@ func (h *StatusHandler) CreateStatusFile(containerId string, pid int, status Con
 		Annotaion:  annotation,
 	}
 
-	if err := utils.WriteJsonToFile(stateFilePath, statusObject); err != nil {
+	if err := utils.CreateJsonFile(stateFilePath, statusObject); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("container %s already exists", containerId)
+		}
 		return err
 	}
 
@@ -119,30 +138,138 @@ func (h *StatusHandler) ReadStatusFile(containerId string) (string, error) {
 // If status is in the valid range, it is written. If pid is non-negative,
 // it replaces the existing PID.
 func (h *StatusHandler) UpdateStatus(containerId string, status ContainerStatus, pid int, shimPid int) error {
+	return h.modify(containerId, func(statusObject *StatusObject) {
+		if status >= CREATING && status <= PAUSED {
+			statusObject.Status = status.String()
+		}
+		if pid >= 0 {
+			statusObject.Pid = pid
+		}
+		if shimPid >= 0 {
+			statusObject.ShimPid = shimPid
+		}
+	})
+}
+
+// modify applies fn to the status file of the given container ID.
+//
+// The read-modify-write cycle holds the lock of the status file, so that
+// concurrent droplet invocations do not overwrite each other's fields.
+// fn must not call other methods that modify the status file.
+func (h *StatusHandler) modify(containerId string, fn func(statusObject *StatusObject)) error {
+	stateFilePath := utils.ContainerStatePath(containerId)
+	return utils.WithFileLock(utils.ContainerStateLockPath(containerId), func() error {
+		// load status file
+		var statusObject StatusObject
+		if err := utils.ReadJsonFile(stateFilePath, &statusObject); err != nil {
+			return err
+		}
+
+		// update
+		fn(&statusObject)
+
+		// write status file
+		return utils.WriteJsonToFile(stateFilePath, statusObject)
+	})
+}
+
+// SetUserNamespace records the host id range allocated to the container's
+// user namespace in the status file.
+func (h *StatusHandler) SetUserNamespace(containerId string, hostId uint32, size uint32) error {
+	return h.modify(containerId, func(statusObject *StatusObject) {
+		statusObject.UserNamespace = &UserNamespaceObject{
+			HostID: hostId,
+			Size:   size,
+		}
+	})
+}
+
+// SetNetworkMode records the network mode the container was created
+// with (none, host, bridge or container:<id>) in the status file.
+func (h *StatusHandler) SetNetworkMode(containerId string, mode string) error {
+	return h.modify(containerId, func(statusObject *StatusObject) {
+		statusObject.NetworkMode = mode
+	})
+}
+
+// SetResources records the resource limits currently applied to the
+// container's cgroup in the status file. It is called after the limits
+// are changed with `update`.
+func (h *StatusHandler) SetResources(containerId string, resources spec.ResourceObject) error {
+	return h.modify(containerId, func(statusObject *StatusObject) {
+		statusObject.Resources = &resources
+	})
+}
+
+// SetNetworkFiles records the dns settings and extra hosts the /etc
+// files of the container were last generated with. It is called after
+// they are changed with `update`.
+func (h *StatusHandler) SetNetworkFiles(containerId string, files spec.NetworkFilesObject) error {
+	return h.modify(containerId, func(statusObject *StatusObject) {
+		statusObject.NetworkFiles = &files
+	})
+}
+
+// SetInterfaces records the verified settings of the interfaces of the
+// container in the status file. It is called after the network setup.
+func (h *StatusHandler) SetInterfaces(containerId string, interfaces []InterfaceObject) error {
+	return h.modify(containerId, func(statusObject *StatusObject) {
+		statusObject.Interfaces = interfaces
+	})
+}
+
+// SetOOM records the OOM counters of the container's cgroup in the status
+// file. oomKilled is set once the OOM killer has killed a process of the
+// container. changed is false when the counters were already recorded.
+func (h *StatusHandler) SetOOM(containerId string, oom OOMObject) (changed bool, err error) {
+	err = h.modify(containerId, func(statusObject *StatusObject) {
+		if statusObject.OOM != nil && *statusObject.OOM == oom {
+			return
+		}
+		statusObject.OOM = &oom
+		statusObject.OOMKilled = oom.OomKill > 0
+		changed = true
+	})
+	return changed, err
+}
+
+// GetResourcesFromId returns the resource limits recorded in the status
+// file, or nil when they have never been updated and the values from
+// config.json are still in effect.
+func (h *StatusHandler) GetResourcesFromId(containerId string) (*spec.ResourceObject, error) {
 	stateFilePath := utils.ContainerStatePath(containerId)
 	// load status file
 	var statusObject StatusObject
 	if err := utils.ReadJsonFile(stateFilePath, &statusObject); err != nil {
-		return err
+		return nil, err
 	}
+	return statusObject.Resources, nil
+}
 
-	// update
-	if status >= 0 && status <= 3 {
-		statusObject.Status = status.String()
-	}
-	if pid >= 0 {
-		statusObject.Pid = pid
-	}
-	if shimPid >= 0 {
-		statusObject.ShimPid = shimPid
+// GetNetworkFilesFromId returns the dns settings and extra hosts recorded
+// in the status file, or nil when they have never been updated and the
+// values from the annotation are still in effect.
+func (h *StatusHandler) GetNetworkFilesFromId(containerId string) (*spec.NetworkFilesObject, error) {
+	stateFilePath := utils.ContainerStatePath(containerId)
+	// load status file
+	var statusObject StatusObject
+	if err := utils.ReadJsonFile(stateFilePath, &statusObject); err != nil {
+		return nil, err
 	}
+	return statusObject.NetworkFiles, nil
+}
 
-	// write status file
-	if err := utils.WriteJsonToFile(stateFilePath, statusObject); err != nil {
-		return err
+// GetAnnotationFromId returns the annotations recorded in the status
+// file. Unlike those of config.json, they include the addresses leased
+// when the container was created.
+func (h *StatusHandler) GetAnnotationFromId(containerId string) (spec.AnnotationObject, error) {
+	stateFilePath := utils.ContainerStatePath(containerId)
+	// load status file
+	var statusObject StatusObject
+	if err := utils.ReadJsonFile(stateFilePath, &statusObject); err != nil {
+		return spec.AnnotationObject{}, err
 	}
-
-	return nil
+	return statusObject.Annotaion, nil
 }
 
 // GetPidFromId returns the PID recorded in the status file for the
@@ -205,10 +332,12 @@ func (h *StatusHandler) GetStatusFromId(containerId string) (ContainerStatus, er
 // recomputeStatus recomputes and updates the status in the status file
 // based on the liveness of the recorded PID.
 //
-// Currently, if the status is RUNNING but the process is no longer
-// alive, it updates the status to STOPPED and clears the PID.
+// Currently, if the status is RUNNING or PAUSED but the process is no
+// longer alive, it updates the status to STOPPED and clears the PID.
+// A frozen process still exists, so a PAUSED container stays PAUSED
+// while its init process is alive.
 func (h *StatusHandler) recomputeStatus(containerId string, pid int, currentStatus ContainerStatus) error {
-	if currentStatus == RUNNING {
+	if currentStatus == RUNNING || currentStatus == PAUSED {
 		alive, _ := h.pidAlive(pid)
 		if !alive {
 			if err := h.UpdateStatus(containerId, STOPPED, 0, 0); err != nil {
@@ -293,3 +422,82 @@ func (h *StatusHandler) ListContainers() ([]StatusObject, error) {
 
 	return list, nil
 }
+
+// ListLeftoverCgroups returns the cgroups under the runtime's parent
+// cgroup that do not belong to any container.
+//
+// A cgroup is in use when it is the resolved linux.cgroupsPath of a
+// container in the root directory, or an ancestor of one. Leftovers are
+// reported at their topmost directory; their children are not listed.
+func (h *StatusHandler) ListLeftoverCgroups() ([]string, error) {
+	cgroupRootDir := utils.CgroupRootDir()
+	if _, err := h.syscallHandler.Stat(cgroupRootDir); err != nil {
+		if h.syscallHandler.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// 1. collect cgroups in use and their ancestors
+	inUse := map[string]bool{}
+	entries, err := h.syscallHandler.ReadDir(utils.DefaultRootDir())
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		containerId := entry.Name()
+		var containerSpec spec.Spec
+		if err := utils.ReadJsonFile(utils.ConfigFilePath(containerId), &containerSpec); err != nil {
+			// skip if config.json is not exist
+			continue
+		}
+		cgroupPath, err := utils.ResolveCgroupPath(containerId, containerSpec.LinuxSpec.CgroupsPath)
+		if err != nil {
+			continue
+		}
+		for p := cgroupPath; p != cgroupRootDir && p != utils.CgroupMountDir() && p != "/"; p = filepath.Dir(p) {
+			// false: ancestor only, true: container cgroup
+			if !inUse[p] {
+				inUse[p] = p == cgroupPath
+			}
+		}
+	}
+
+	// 2. walk the runtime's parent cgroup
+	var leftovers []string
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := h.syscallHandler.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			isContainer, ok := inUse[path]
+			if !ok {
+				leftovers = append(leftovers, path)
+				continue
+			}
+			if isContainer {
+				// sub cgroups of a container are managed by the container
+				continue
+			}
+			if err := walk(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(cgroupRootDir); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(leftovers)
+	return leftovers, nil
+}
@@ -0,0 +1,88 @@
+package status
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusHandler_ConcurrentModify(t *testing.T) {
+	// == arrange ==
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	containerId := "111111"
+	assert.Nil(t, os.MkdirAll(filepath.Join(os.Getenv("RAIND_ROOT_DIR"), containerId), 0700))
+	h := NewStatusHandler()
+	assert.Nil(t, h.CreateStatusFile(containerId, 1, CREATED, "/rootfs", "/bundle", spec.AnnotationObject{}))
+
+	// == act ==
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_ = h.SetNetworkMode(containerId, "bridge")
+		}()
+		go func() {
+			defer wg.Done()
+			_ = h.SetUserNamespace(containerId, 100000, 65536)
+		}()
+		go func(pid int) {
+			defer wg.Done()
+			_ = h.UpdateStatus(containerId, RUNNING, pid, -1)
+		}(i + 1)
+	}
+	wg.Wait()
+
+	// == assert ==
+	var statusObject StatusObject
+	assert.Nil(t, utils.ReadJsonFile(utils.ContainerStatePath(containerId), &statusObject))
+	assert.Equal(t, "bridge", statusObject.NetworkMode)
+	assert.Equal(t, &UserNamespaceObject{HostID: 100000, Size: 65536}, statusObject.UserNamespace)
+	assert.Equal(t, RUNNING.String(), statusObject.Status)
+}
+
+func TestStatusHandler_CreateStatusFileExists(t *testing.T) {
+	// == arrange ==
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	containerId := "111111"
+	assert.Nil(t, os.MkdirAll(filepath.Join(os.Getenv("RAIND_ROOT_DIR"), containerId), 0700))
+	h := NewStatusHandler()
+	assert.Nil(t, h.CreateStatusFile(containerId, 4242, RUNNING, "/rootfs", "/bundle", spec.AnnotationObject{}))
+
+	// == act ==
+	err := h.CreateStatusFile(containerId, 0, CREATING, "/rootfs", "/bundle", spec.AnnotationObject{})
+
+	// == assert ==
+	assert.EqualError(t, err, "container 111111 already exists")
+	var statusObject StatusObject
+	assert.Nil(t, utils.ReadJsonFile(utils.ContainerStatePath(containerId), &statusObject))
+	assert.Equal(t, RUNNING.String(), statusObject.Status)
+	assert.Equal(t, 4242, statusObject.Pid)
+}
+
+func TestStatusHandler_SetOOM(t *testing.T) {
+	// == arrange ==
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	containerId := "111111"
+	assert.Nil(t, os.MkdirAll(filepath.Join(os.Getenv("RAIND_ROOT_DIR"), containerId), 0700))
+	h := NewStatusHandler()
+	assert.Nil(t, h.CreateStatusFile(containerId, 0, STOPPED, "/rootfs", "/bundle", spec.AnnotationObject{}))
+
+	// == act ==
+	changed_1, err_1 := h.SetOOM(containerId, OOMObject{Oom: 2, OomKill: 1})
+	changed_2, err_2 := h.SetOOM(containerId, OOMObject{Oom: 2, OomKill: 1})
+
+	// == assert ==
+	assert.Nil(t, err_1)
+	assert.True(t, changed_1)
+	assert.Nil(t, err_2)
+	assert.False(t, changed_2)
+	var statusObject StatusObject
+	assert.Nil(t, utils.ReadJsonFile(utils.ContainerStatePath(containerId), &statusObject))
+	assert.True(t, statusObject.OOMKilled)
+}
@@ -1,9 +1,12 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"sync"
 	"syscall"
 
 	"golang.org/x/sys/unix"
@@ -40,6 +43,7 @@ func (e *ExecCommandFactory) Command(name string, args ...string) CommandExecuto
 // can be substituted or mocked in tests.
 type CommandExecutor interface {
 	Start() error
+	StartInCgroup(cgroupFd int) (bool, error)
 	Wait() error
 	Run() error
 	Pid() int
@@ -65,6 +69,100 @@ func (e *ExecCmd) Start() error {
 	return e.cmd.Start()
 }
 
+// StartInCgroup starts the underlying process directly inside the cgroup
+// referred to by cgroupFd, using clone3 with CLONE_INTO_CGROUP.
+//
+// If the kernel does not support CLONE_INTO_CGROUP (older than 5.7), the
+// process is started normally and false is returned, so that the caller
+// can move it into the cgroup afterwards. Any other error, such as an
+// invalid cgroup fd, is returned.
+func (e *ExecCmd) StartInCgroup(cgroupFd int) (bool, error) {
+	// an exec.Cmd can only be started once, so try on a copy first
+	cmd := &exec.Cmd{
+		Path:       e.cmd.Path,
+		Args:       e.cmd.Args,
+		Env:        e.cmd.Env,
+		Dir:        e.cmd.Dir,
+		Stdin:      e.cmd.Stdin,
+		Stdout:     e.cmd.Stdout,
+		Stderr:     e.cmd.Stderr,
+		ExtraFiles: e.cmd.ExtraFiles,
+		Err:        e.cmd.Err,
+	}
+	sysProcAttr := &syscall.SysProcAttr{}
+	if e.cmd.SysProcAttr != nil {
+		*sysProcAttr = *e.cmd.SysProcAttr
+	}
+	sysProcAttr.UseCgroupFD = true
+	sysProcAttr.CgroupFD = cgroupFd
+	cmd.SysProcAttr = sysProcAttr
+
+	err := cmd.Start()
+	if err == nil {
+		e.cmd = cmd
+		return true, nil
+	}
+	if !isCloneIntoCgroupUnsupported(err, kernelSupportsCloneIntoCgroup()) {
+		return false, err
+	}
+
+	// fallback
+	return false, e.cmd.Start()
+}
+
+// isCloneIntoCgroupUnsupported reports whether err indicates that clone3
+// or its CLONE_INTO_CGROUP flag is not available.
+//
+//	ENOSYS     = clone3 is not implemented (< 5.3)
+//	E2BIG      = clone_args has no cgroup field (< 5.7)
+//	EINVAL     = CLONE_INTO_CGROUP is an unknown flag (< 5.7)
+//	EOPNOTSUPP = the target is not a cgroup v2 directory
+//
+// E2BIG and EINVAL are also returned for real errors such as a bad cgroup
+// fd, so they only mean unsupported when the kernel is older than 5.7.
+func isCloneIntoCgroupUnsupported(err error, kernelSupported bool) bool {
+	if errors.Is(err, syscall.ENOSYS) || errors.Is(err, syscall.EOPNOTSUPP) {
+		return true
+	}
+	if kernelSupported {
+		return false
+	}
+	return errors.Is(err, syscall.E2BIG) || errors.Is(err, syscall.EINVAL)
+}
+
+// kernelSupportsCloneIntoCgroup reports whether the running kernel is 5.7
+// or later, which added CLONE_INTO_CGROUP.
+func kernelSupportsCloneIntoCgroup() bool {
+	return KernelVersionAtLeast(5, 7)
+}
+
+// kernelRelease is the release of the running kernel, read once. It is
+// empty if uname fails.
+var kernelRelease = sync.OnceValue(func() string {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return ""
+	}
+	return unix.ByteSliceToString(uts.Release[:])
+})
+
+// KernelVersionAtLeast reports whether the running kernel is major.minor
+// or later. A kernel whose release cannot be read is treated as recent.
+func KernelVersionAtLeast(major int, minor int) bool {
+	return kernelVersionAtLeast(kernelRelease(), major, minor)
+}
+
+// kernelVersionAtLeast reports whether a kernel release such as
+// "6.1.0-13-amd64" is major.minor or later. An unparsable release is
+// treated as recent.
+func kernelVersionAtLeast(release string, major int, minor int) bool {
+	var gotMajor, gotMinor int
+	if _, err := fmt.Sscanf(release, "%d.%d", &gotMajor, &gotMinor); err != nil {
+		return true
+	}
+	return gotMajor > major || gotMajor == major && gotMinor >= minor
+}
+
 func (e *ExecCmd) Wait() error {
 	return e.cmd.Wait()
 }
@@ -131,7 +229,12 @@ type SyscallHandler interface {
 type KernelSyscallHandler interface {
 	Setresgid(rgid int, egid int, sgid int) error
 	Setresuid(ruid int, euid int, suid int) error
+	Setgroups(gids []int) error
+	Umask(mask int) int
+	Setrlimit(resource int, rlim *syscall.Rlimit) error
 	Sethostname(p []byte) error
+	Setns(fd int, nstype int) error
+	Unshare(flags int) error
 	Mount(source string, target string, fstype string, flags uintptr, data string) error
 	Unmount(target string, flags int) error
 	PivotRoot(newroot string, putold string) error
@@ -194,6 +297,30 @@ func (k *kernelSyscall) Setresuid(ruid int, euid int, suid int) error {
 	return syscall.Setresuid(ruid, euid, suid)
 }
 
+// Setgroups replaces the supplementary group list of the current process
+// by invoking the setgroups(2) syscall.
+//
+// It is called before Setresgid/Setresuid when the container process is
+// switched to the user configured in the OCI spec.
+func (k *kernelSyscall) Setgroups(gids []int) error {
+	return syscall.Setgroups(gids)
+}
+
+// Umask sets the file mode creation mask of the current process and
+// returns the previous mask.
+func (k *kernelSyscall) Umask(mask int) int {
+	return syscall.Umask(mask)
+}
+
+// Setrlimit sets the soft and hard limit of a resource for the current
+// process by invoking the setrlimit(2) syscall.
+//
+// The limits are inherited across execve(2), so setting them in the init
+// process applies them to the container entrypoint.
+func (k *kernelSyscall) Setrlimit(resource int, rlim *syscall.Rlimit) error {
+	return syscall.Setrlimit(resource, rlim)
+}
+
 // Sethostname sets the hostname of the current UTS namespace by invoking the
 // sethostname(2) syscall.
 //
@@ -204,6 +331,21 @@ func (k *kernelSyscall) Sethostname(p []byte) error {
 	return syscall.Sethostname(p)
 }
 
+// Setns moves the calling thread into the namespace referred to by fd by
+// invoking the setns(2) syscall.
+//
+// The caller must have locked its goroutine to the OS thread, since the
+// namespace change only applies to the calling thread.
+func (k *kernelSyscall) Setns(fd int, nstype int) error {
+	return unix.Setns(fd, nstype)
+}
+
+// Unshare disassociates parts of the calling thread's execution context
+// by invoking the unshare(2) syscall.
+func (k *kernelSyscall) Unshare(flags int) error {
+	return unix.Unshare(flags)
+}
+
 // Mount performs a mount(2) system call.
 //
 // It is a thin wrapper around syscall.Mount and is provided so that
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsCloneIntoCgroupUnsupported(t *testing.T) {
+	// == arrange ==
+	tests := []struct {
+		err             error
+		kernelSupported bool
+		expected        bool
+	}{
+		{&os.PathError{Op: "fork/exec", Path: "/bin/droplet", Err: syscall.ENOSYS}, true, true},
+		{&os.PathError{Op: "fork/exec", Path: "/bin/droplet", Err: syscall.EOPNOTSUPP}, true, true},
+		{&os.PathError{Op: "fork/exec", Path: "/bin/droplet", Err: syscall.E2BIG}, false, true},
+		{&os.PathError{Op: "fork/exec", Path: "/bin/droplet", Err: syscall.EINVAL}, false, true},
+		{&os.PathError{Op: "fork/exec", Path: "/bin/droplet", Err: syscall.E2BIG}, true, false},
+		{&os.PathError{Op: "fork/exec", Path: "/bin/droplet", Err: syscall.EINVAL}, true, false},
+		{&os.PathError{Op: "fork/exec", Path: "/bin/droplet", Err: syscall.EBADF}, false, false},
+		{&os.PathError{Op: "fork/exec", Path: "/bin/droplet", Err: syscall.ENOENT}, false, false},
+		{&os.PathError{Op: "fork/exec", Path: "/bin/droplet", Err: syscall.EACCES}, true, false},
+	}
+
+	for _, tt := range tests {
+		// == act ==
+		got := isCloneIntoCgroupUnsupported(tt.err, tt.kernelSupported)
+
+		// == assert ==
+		assert.Equal(t, tt.expected, got, tt.err.Error())
+	}
+}
+
+func TestKernelVersionAtLeast(t *testing.T) {
+	// == assert ==
+	assert.True(t, kernelVersionAtLeast("5.7.0", 5, 7))
+	assert.True(t, kernelVersionAtLeast("6.1.0-13-amd64", 5, 7))
+	assert.False(t, kernelVersionAtLeast("5.4.0-150-generic", 5, 7))
+	assert.False(t, kernelVersionAtLeast("4.19.0", 5, 7))
+	assert.True(t, kernelVersionAtLeast("unknown", 5, 7))
+}
@@ -29,6 +29,25 @@ func WriteJsonToFile(path string, v any) error {
 	return encoder.Encode(v)
 }
 
+// CreateJsonFile writes v to a new file at path. It fails with an error
+// matching fs.ErrExist if the file already exists, and removes the file
+// again if v cannot be written.
+func CreateJsonFile(path string, v any) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(v); err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+	return nil
+}
+
 func ReadJsonFile(path string, v any) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// WithFileLock runs fn while holding an exclusive flock(2) on the lock file
+// at path. The lock file is created if it does not exist.
+//
+// It is used to serialize read-modify-write cycles on runtime-wide state
+// files shared by concurrent droplet invocations.
+func WithFileLock(path string, fn func() error) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		return fmt.Errorf("lock %s failed: %w", path, err)
+	}
+	defer unix.Flock(int(f.Fd()), unix.LOCK_UN)
+
+	return fn()
+}
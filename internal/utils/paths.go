@@ -1,13 +1,16 @@
 package utils
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const (
-	AuditLog      = "/etc/raind/log/droplet_audit.log"
-	cgroupRootDir = "/sys/fs/cgroup/raind"
+	AuditLog       = "/etc/raind/log/droplet_audit.log"
+	cgroupMountDir = "/sys/fs/cgroup"
+	cgroupRootDir  = "/sys/fs/cgroup/raind"
 )
 
 func DefaultRootDir() string {
@@ -35,11 +38,92 @@ func ConfigFileHashPath(containerId string) string {
 	return filepath.Join(ContainerDir(containerId), "config_hash.json")
 }
 
+// user namespace id range allocation file
+//
+//	e.g. /etc/raind/container/userns_allocations.json
+func UserNsAllocationPath() string {
+	return filepath.Join(DefaultRootDir(), "userns_allocations.json")
+}
+
+func UserNsAllocationLockPath() string {
+	return filepath.Join(DefaultRootDir(), "userns_allocations.lock")
+}
+
+// ipam subnet pools and address leases
+//
+//	e.g. /etc/raind/container/ipam.json
+func IpamStorePath() string {
+	return filepath.Join(DefaultRootDir(), "ipam.json")
+}
+
+func IpamLockPath() string {
+	return filepath.Join(DefaultRootDir(), "ipam.lock")
+}
+
+// lock serializing the conflict check and publish of host ports
+//
+//	e.g. /etc/raind/container/ports.lock
+func PortsLockPath() string {
+	return filepath.Join(DefaultRootDir(), "ports.lock")
+}
+
+// cni network configuration directory, searched for conflists
+//
+//	e.g. /etc/cni/net.d
+func CniConfDir() string {
+	if v := os.Getenv("RAIND_CNI_CONF_DIR"); v != "" {
+		return v
+	}
+	return "/etc/cni/net.d"
+}
+
+// cni plugin directories, in CNI_PATH format (colon separated)
+//
+//	e.g. /opt/cni/bin
+func CniPath() string {
+	if v := os.Getenv("RAIND_CNI_PATH"); v != "" {
+		return v
+	}
+	return "/opt/cni/bin"
+}
+
+// result of the cni ADD of a container
+//
+//	e.g. /etc/raind/container/<container-id>/cni_result.json
+func CniResultPath(containerId string) string {
+	return filepath.Join(ContainerDir(containerId), "cni_result.json")
+}
+
+// port mappings published for the container on the host
+//
+//	e.g. /etc/raind/container/<container-id>/ports.json
+func ContainerPortsPath(containerId string) string {
+	return filepath.Join(ContainerDir(containerId), "ports.json")
+}
+
+// firewall policy applied to the interfaces of the container
+//
+//	e.g. /etc/raind/container/<container-id>/policy.json
+func ContainerPolicyPath(containerId string) string {
+	return filepath.Join(ContainerDir(containerId), "policy.json")
+}
+
+// generated /etc files of the container (resolv.conf, hosts, hostname)
+//
+//	e.g. /etc/raind/container/<container-id>/etc/resolv.conf
+func ContainerEtcFilePath(containerId string, name string) string {
+	return filepath.Join(ContainerDir(containerId), "etc", name)
+}
+
 // state path
 func ContainerStatePath(containerId string) string {
 	return filepath.Join(ContainerDir(containerId), "state.json")
 }
 
+func ContainerStateLockPath(containerId string) string {
+	return filepath.Join(ContainerDir(containerId), "state.lock")
+}
+
 // fifo path
 //
 //	e.g. /etc/raind/container/<container-id>/exec.fifo
@@ -60,11 +144,61 @@ func InitPidFilePath(containerId string) string {
 	return filepath.Join(ContainerDir(containerId), "init.pid")
 }
 
-// cgroup path
+// cgroup v2 mount point
+//
+//	e.g. /sys/fs/cgroup
+func CgroupMountDir() string {
+	return cgroupMountDir
+}
+
+// parent cgroup of containers managed by the runtime
+//
+//	e.g. /sys/fs/cgroup/raind
+func CgroupRootDir() string {
+	return cgroupRootDir
+}
+
+// default cgroup path, used when linux.cgroupsPath is not set
+//
+//	e.g. /sys/fs/cgroup/raind/<container-id>
 func CgroupPath(containerId string) string {
 	return filepath.Join(cgroupRootDir, containerId)
 }
 
+// ResolveCgroupPath returns the cgroup directory of a container from
+// linux.cgroupsPath.
+//
+// An absolute cgroupsPath is relative to the cgroup v2 mount point, a
+// relative one to the runtime's parent cgroup, and an empty one falls back
+// to CgroupPath. systemd "slice:prefix:name" paths are not supported.
+//
+//	""          -> /sys/fs/cgroup/raind/<container-id>
+//	"/pods/c1"  -> /sys/fs/cgroup/pods/c1
+//	"pods/c1"   -> /sys/fs/cgroup/raind/pods/c1
+func ResolveCgroupPath(containerId string, cgroupsPath string) (string, error) {
+	if cgroupsPath == "" {
+		return CgroupPath(containerId), nil
+	}
+	if strings.Contains(cgroupsPath, ":") {
+		return "", fmt.Errorf("systemd cgroupsPath is not supported: %q", cgroupsPath)
+	}
+	for _, elem := range strings.Split(cgroupsPath, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("invalid cgroupsPath: %q", cgroupsPath)
+		}
+	}
+
+	base := cgroupRootDir
+	if filepath.IsAbs(cgroupsPath) {
+		base = cgroupMountDir
+	}
+	path := filepath.Join(base, cgroupsPath)
+	if path == cgroupMountDir || path == cgroupRootDir {
+		return "", fmt.Errorf("invalid cgroupsPath: %q", cgroupsPath)
+	}
+	return path, nil
+}
+
 // logs
 func ShimLogPath(containerId string) string {
 	return filepath.Join(ContainerDir(containerId), "logs", "shim.log")
@@ -8,8 +8,6 @@ set -euo pipefail
 
 # == cgroup ==
 # parent cgroup name for runtime
-CONTAINER_ID=111111
-
 RUNTIME_ROOT="raind"
 
 CG_MNT="/sys/fs/cgroup"
@@ -29,13 +27,21 @@ if [[ ! -d "${PARENT}" ]]; then
     mkdir -p "${PARENT}"
 fi
 
-# 3) enable cpu/memory controller
+# 3) enable controllers used by linux.resources
+#    cpu/memory/pids are required by the default spec,
+#    cpuset/io/hugetlb are enabled when available
+#    (the runtime enables missing ones on demand as well)
 SUBTREE_CTL="${PARENT}/cgroup.subtree_control"
-echo "[*] enable +cpu +memory on ${SUBTREE_CTL}"
-echo "+cpu +memory" > "${SUBTREE_CTL}"
-
-# 4) create container directory
-mkdir -p "${PARENT}/${CONTAINER_ID}"
+AVAILABLE="$(cat "${PARENT}/cgroup.controllers")"
+for ctl in cpu memory pids cpuset io hugetlb; do
+    if grep -qw "${ctl}" <<< "${AVAILABLE}"; then
+        echo "[*] enable +${ctl} on ${SUBTREE_CTL}"
+        echo "+${ctl}" > "${SUBTREE_CTL}"
+    fi
+done
+
+# container cgroups (${PARENT}/<container-id>) are created and
+# removed by the runtime
 # ===========
 
 echo "[*] setup completed"
\ No newline at end of file